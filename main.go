@@ -72,7 +72,11 @@ func main2() {
 	if err != nil {
 		panic(err)
 	}
-	bm := etcd.NewBackupManager(host, "/data", "c:/tmp", "wangzhendong", s3Client)
+	bm, err := etcd.NewBackupManager(host, "/data", "c:/tmp", "wangzhendong", s3Client)
+	if err != nil {
+		panic(err)
+	}
+	defer bm.Close()
 	bm.BackupEtcd()
 }
 
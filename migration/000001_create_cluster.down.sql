@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `rdev_cluster_role`;
+DROP TABLE IF EXISTS `rdev_cluster_host`;
+DROP TABLE IF EXISTS `rdev_cluster`;
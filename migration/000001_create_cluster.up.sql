@@ -0,0 +1,64 @@
+CREATE TABLE IF NOT EXISTS `rdev_cluster` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime NULL,
+  `updated_at` datetime NULL,
+  `deleted_at` datetime NULL,
+  `name` varchar(255) NOT NULL,
+  `vip_server` varchar(255),
+  `kube_pods_cidr` varchar(64),
+  `kube_service_cidr` varchar(64),
+  `container_manager` varchar(64),
+  `proxy_mode` varchar(64),
+  `ipip_mode` varchar(64),
+  `vxlan_mode` varchar(64),
+  `kk_path` varchar(1024),
+  `taichu_package_path` varchar(1024),
+  `kubernetes_version` varchar(64),
+  `ntp_servers` varchar(1024),
+  `registry_name` varchar(255),
+  `registry_url` varchar(1024),
+  `registry_user` varchar(255),
+  `registry_password` varchar(1024),
+  `registry_type` varchar(64),
+  `registry_key_path` varchar(1024),
+  `registry_cert_path` varchar(1024),
+  `registry_skip_tls` boolean,
+  `registry_plain_http` boolean,
+  `insecure_registries` varchar(1024),
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uix_rdev_cluster_name` (`name`),
+  INDEX `idx_rdev_cluster_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `rdev_cluster_host` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime NULL,
+  `updated_at` datetime NULL,
+  `deleted_at` datetime NULL,
+  `cluster_id` int unsigned NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `address` varchar(255),
+  `internal_address` varchar(255),
+  `user` varchar(255),
+  `password` varchar(1024),
+  `port` int,
+  `arch` varchar(64),
+  `private_key` varchar(1024),
+  PRIMARY KEY (`id`),
+  INDEX `idx_rdev_cluster_host_cluster_id` (`cluster_id`),
+  INDEX `idx_rdev_cluster_host_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `rdev_cluster_role` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime NULL,
+  `updated_at` datetime NULL,
+  `deleted_at` datetime NULL,
+  `cluster_id` int unsigned NOT NULL,
+  `host_id` int unsigned NOT NULL,
+  `role` varchar(64) NOT NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_rdev_cluster_role_cluster_id` (`cluster_id`),
+  INDEX `idx_rdev_cluster_role_host_id` (`host_id`),
+  INDEX `idx_rdev_cluster_role_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
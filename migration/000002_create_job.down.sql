@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `rdev_job_log`;
+DROP TABLE IF EXISTS `rdev_job`;
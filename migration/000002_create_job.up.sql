@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS `rdev_job` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime NULL,
+  `updated_at` datetime NULL,
+  `deleted_at` datetime NULL,
+  `type` varchar(64) NOT NULL,
+  `cluster_id` int unsigned,
+  `status` varchar(32) NOT NULL,
+  `params` text,
+  `error` text,
+  `started_at` datetime NULL,
+  `ended_at` datetime NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_rdev_job_cluster_id` (`cluster_id`),
+  INDEX `idx_rdev_job_status` (`status`),
+  INDEX `idx_rdev_job_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `rdev_job_log` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `job_id` int unsigned NOT NULL,
+  `seq` int,
+  `message` text,
+  `is_error` boolean,
+  `created_at` datetime NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_rdev_job_log_job_id` (`job_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,10 @@
+ALTER TABLE `rdev_cluster`
+  DROP COLUMN `control_plane_domain`,
+  DROP COLUMN `network_plugin`,
+  DROP COLUMN `enable_multus`,
+  DROP COLUMN `etcd_type`,
+  DROP COLUMN `timezone`,
+  DROP COLUMN `extra_sans`,
+  DROP COLUMN `namespace_override`,
+  DROP COLUMN `registry_mirrors`,
+  DROP COLUMN `addons`;
@@ -0,0 +1,10 @@
+ALTER TABLE `rdev_cluster`
+  ADD COLUMN `control_plane_domain` varchar(255),
+  ADD COLUMN `network_plugin` varchar(64),
+  ADD COLUMN `enable_multus` boolean,
+  ADD COLUMN `etcd_type` varchar(64),
+  ADD COLUMN `timezone` varchar(64),
+  ADD COLUMN `extra_sans` varchar(1024),
+  ADD COLUMN `namespace_override` varchar(255),
+  ADD COLUMN `registry_mirrors` varchar(1024),
+  ADD COLUMN `addons` text;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS `rdev_cluster_cert` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime NULL,
+  `updated_at` datetime NULL,
+  `deleted_at` datetime NULL,
+  `cluster_id` int unsigned NOT NULL,
+  `name` varchar(255) NOT NULL,
+  `node` varchar(255),
+  `expires_at` datetime NULL,
+  `residual_time` varchar(64),
+  `ca` varchar(255),
+  `is_ca` boolean,
+  `checked_at` datetime NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_rdev_cluster_cert_cluster_id` (`cluster_id`),
+  INDEX `idx_rdev_cluster_cert_expires_at` (`expires_at`),
+  INDEX `idx_rdev_cluster_cert_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,9 @@
+ALTER TABLE `rdev_cluster`
+  DROP COLUMN `provisioner`,
+  DROP COLUMN `kubespray_path`,
+  DROP COLUMN `kubespray_image`,
+  DROP COLUMN `offline_template`,
+  DROP COLUMN `files_repo`,
+  DROP COLUMN `yum_repo`,
+  DROP COLUMN `debian_repo`,
+  DROP COLUMN `ubuntu_repo`;
@@ -0,0 +1,9 @@
+ALTER TABLE `rdev_cluster`
+  ADD COLUMN `provisioner` varchar(64),
+  ADD COLUMN `kubespray_path` varchar(1024),
+  ADD COLUMN `kubespray_image` varchar(255),
+  ADD COLUMN `offline_template` varchar(1024),
+  ADD COLUMN `files_repo` varchar(1024),
+  ADD COLUMN `yum_repo` varchar(1024),
+  ADD COLUMN `debian_repo` varchar(1024),
+  ADD COLUMN `ubuntu_repo` varchar(1024);
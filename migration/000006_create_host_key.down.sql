@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `rdev_host_key`;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS `rdev_host_key` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime NULL,
+  `updated_at` datetime NULL,
+  `deleted_at` datetime NULL,
+  `host` varchar(255) NOT NULL,
+  `key_type` varchar(64),
+  `fingerprint` varchar(255) NOT NULL,
+  `public_key` text,
+  `status` varchar(32) NOT NULL,
+  `source` varchar(32),
+  PRIMARY KEY (`id`),
+  INDEX `idx_rdev_host_key_host` (`host`),
+  INDEX `idx_rdev_host_key_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
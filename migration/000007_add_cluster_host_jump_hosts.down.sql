@@ -0,0 +1,2 @@
+ALTER TABLE `rdev_cluster_host`
+  DROP COLUMN `jump_hosts`;
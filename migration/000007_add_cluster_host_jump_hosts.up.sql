@@ -0,0 +1,2 @@
+ALTER TABLE `rdev_cluster_host`
+  ADD COLUMN `jump_hosts` text;
@@ -0,0 +1,3 @@
+ALTER TABLE `rdev_cluster_host`
+  DROP COLUMN `become_method`,
+  DROP COLUMN `become_password`;
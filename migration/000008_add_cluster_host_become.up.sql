@@ -0,0 +1,3 @@
+ALTER TABLE `rdev_cluster_host`
+  ADD COLUMN `become_method` varchar(32),
+  ADD COLUMN `become_password` varchar(1024);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `rdev_terminal_session`;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS `rdev_terminal_session` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime NULL,
+  `updated_at` datetime NULL,
+  `deleted_at` datetime NULL,
+  `user` varchar(255) NOT NULL,
+  `cluster_id` int unsigned NOT NULL,
+  `host` varchar(255) NOT NULL,
+  `address` varchar(255),
+  `remote_addr` varchar(255),
+  `ended_at` datetime NULL,
+  `exit_code` int,
+  `close_reason` varchar(255),
+  `bytes_in` bigint,
+  `bytes_out` bigint,
+  PRIMARY KEY (`id`),
+  INDEX `idx_rdev_terminal_session_user` (`user`),
+  INDEX `idx_rdev_terminal_session_cluster_id` (`cluster_id`),
+  INDEX `idx_rdev_terminal_session_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `rdev_host_facts_record` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime NULL,
+  `updated_at` datetime NULL,
+  `deleted_at` datetime NULL,
+  `host_id` int unsigned NOT NULL,
+  `gathered_at` datetime NULL,
+  `facts` mediumtext,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uix_rdev_host_facts_record_host_id` (`host_id`),
+  INDEX `idx_rdev_host_facts_record_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `rdev_name_resolution_record`;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `rdev_name_resolution_record` (
+  `id` int unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime NULL,
+  `updated_at` datetime NULL,
+  `deleted_at` datetime NULL,
+  `cluster_id` int unsigned NOT NULL,
+  `resolution` text,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `uix_rdev_name_resolution_record_cluster_id` (`cluster_id`),
+  INDEX `idx_rdev_name_resolution_record_deleted_at` (`deleted_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -20,3 +20,15 @@ func Auth() gin.HandlerFunc {
 
 	}
 }
+
+// UserAuth sets the name of the user the request is authenticated as, see jwt.ExtractUsername.
+func UserAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, err := jwt.ExtractUsername(c.Request)
+		if err != nil {
+			ginx.Bomb(http.StatusUnauthorized, "unauthorized")
+		}
+		c.Set("username", username)
+		c.Next()
+	}
+}
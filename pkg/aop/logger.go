@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -270,7 +271,7 @@ func LoggerWithConfig(conf LoggerConfig) gin.HandlerFunc {
 			param.BodySize = c.Writer.Size()
 
 			if raw != "" {
-				path = path + "?" + raw
+				path = path + "?" + redactQuery(raw)
 			}
 
 			param.Path = path
@@ -285,6 +286,31 @@ func LoggerWithConfig(conf LoggerConfig) gin.HandlerFunc {
 	}
 }
 
+// redactedParams are query parameters that carry credentials, e.g. the token of web terminals.
+var redactedParams = []string{"token"}
+
+// redactQuery masks the values of redactedParams in the raw query, keeping the order of the parameters.
+func redactQuery(raw string) string {
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		for _, redacted := range redactedParams {
+			if strings.EqualFold(name, redacted) {
+				params[i] = name + "=***"
+			}
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// redactedURI is the path and the redacted query of request, for logging.
+func redactedURI(request *http.Request) string {
+	if request.URL.RawQuery == "" {
+		return request.URL.Path
+	}
+	return request.URL.Path + "?" + redactQuery(request.URL.RawQuery)
+}
+
 func readBody(reader io.Reader) string {
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(reader)
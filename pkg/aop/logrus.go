@@ -67,7 +67,7 @@ func Logrus() gin.HandlerFunc {
 		//请求方式
 		reqMethod := c.Request.Method
 		//请求路由
-		reqUrl := c.Request.RequestURI
+		reqUrl := redactedURI(c.Request)
 		//状态码
 		statusCode := c.Writer.Status()
 		//请求ip
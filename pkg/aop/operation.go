@@ -54,7 +54,7 @@ func LogRequest() gin.HandlerFunc {
 			User:         "example_user", // 在实际应用中，你可能需要从请求上下文中获取用户信息
 			Timestamp:    endTime.Unix(),
 			Resource:     c.Request.URL.Path,
-			Endpoint:     c.Request.RequestURI,
+			Endpoint:     redactedURI(c.Request),
 			Module:       "example_module", // 根据实际需要设置模块
 			ResourceType: c.Request.Method,
 			Description:  description,
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+)
+
+type CertController struct {
+	Ctx         context.Context
+	certService service.CertService
+}
+
+func NewCertController() *CertController {
+	return &CertController{
+		certService: service.NewCertService(),
+	}
+}
+
+var certController CertController
+
+func init() {
+	certController = *NewCertController()
+}
+
+func CheckClusterCerts(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	certs, err := certController.certService.Check(ctx.Request.Context(), uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Check certificates of cluster %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(certs, nil)
+}
+
+func ListClusterCerts(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	certs, err := certController.certService.List(uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("List certificates of cluster %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(certs, nil)
+}
+
+func ListExpiringCerts(ctx *gin.Context) {
+	days := ginx.QueryInt(ctx, "days", 30)
+	certs, err := certController.certService.ListExpiring(days)
+	if err != nil {
+		logger.GetLogger().Errorf("List certificates expiring within %d days failed: %s", days, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(certs, nil)
+}
+
+func RenewClusterCerts(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	job, err := jobController.jobService.Submit(uint(id), entity.JobRequest{Type: entity.JobRenewCerts})
+	if err != nil {
+		logger.GetLogger().Errorf("Renew certificates of cluster %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(job, nil)
+}
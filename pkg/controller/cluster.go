@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+)
+
+type ClusterController struct {
+	Ctx              context.Context
+	clusterService   service.ClusterService
+	preflightService service.PreflightService
+}
+
+func NewClusterController() *ClusterController {
+	return &ClusterController{
+		clusterService:   service.NewClusterService(),
+		preflightService: service.NewPreflightService(),
+	}
+}
+
+var clusterController ClusterController
+
+func init() {
+	clusterController = *NewClusterController()
+}
+
+func CreateClusterInventory(ctx *gin.Context) {
+	var conf entity.KubekeyConf
+	if err := ctx.ShouldBind(&conf); err != nil {
+		logger.GetLogger().Errorf("KubekeyConf bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	cluster, err := clusterController.clusterService.CreateCluster(conf)
+	if err != nil {
+		logger.GetLogger().Errorf("Create cluster inventory failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(cluster, nil)
+}
+
+func ListClusterInventories(ctx *gin.Context) {
+	clusters, err := clusterController.clusterService.ListClusters()
+	if err != nil {
+		logger.GetLogger().Errorf("List cluster inventories failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(clusters, nil)
+}
+
+func GetClusterInventory(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	cluster, err := clusterController.clusterService.GetCluster(uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Get cluster inventory %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(cluster, nil)
+}
+
+func UpdateClusterInventory(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var conf entity.KubekeyConf
+	if err := ctx.ShouldBind(&conf); err != nil {
+		logger.GetLogger().Errorf("KubekeyConf bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	cluster, err := clusterController.clusterService.UpdateCluster(uint(id), conf)
+	if err != nil {
+		logger.GetLogger().Errorf("Update cluster inventory %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(cluster, nil)
+}
+
+func DeleteClusterInventory(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	err := clusterController.clusterService.DeleteCluster(uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Delete cluster inventory %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data("Delete cluster inventory success", nil)
+}
+
+func AddClusterHost(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var conf entity.ClusterHostConf
+	if err := ctx.ShouldBind(&conf); err != nil {
+		logger.GetLogger().Errorf("ClusterHostConf bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	host, err := clusterController.clusterService.AddHost(uint(id), conf)
+	if err != nil {
+		logger.GetLogger().Errorf("Add host to cluster %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(host, nil)
+}
+
+func UpdateClusterHost(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	hostID := ginx.UrlParamInt64(ctx, "hostId")
+	var conf entity.ClusterHostConf
+	if err := ctx.ShouldBind(&conf); err != nil {
+		logger.GetLogger().Errorf("ClusterHostConf bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	host, err := clusterController.clusterService.UpdateHost(uint(id), uint(hostID), conf)
+	if err != nil {
+		logger.GetLogger().Errorf("Update host %d of cluster %d failed: %s", hostID, id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(host, nil)
+}
+
+func DeleteClusterHost(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	hostID := ginx.UrlParamInt64(ctx, "hostId")
+	err := clusterController.clusterService.DeleteHost(uint(id), uint(hostID))
+	if err != nil {
+		logger.GetLogger().Errorf("Delete host %d of cluster %d failed: %s", hostID, id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data("Delete host success", nil)
+}
+
+func ValidateClusterInventory(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	report, err := clusterController.preflightService.Validate(ctx.Request.Context(), uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Validate cluster %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(report, nil)
+}
+
+func ValidateKubekeyConf(ctx *gin.Context) {
+	var conf entity.KubekeyConf
+	if err := ctx.ShouldBind(&conf); err != nil {
+		logger.GetLogger().Errorf("KubekeyConf bind failed: %s", err.Error())
+		dangerous(err)
+	}
+	report := clusterController.preflightService.ValidateConf(ctx.Request.Context(), conf)
+	ginx.NewRender(ctx).Data(report, nil)
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+)
+
+type DiskController struct {
+	Ctx         context.Context
+	diskService service.DiskService
+}
+
+func NewDiskController() *DiskController {
+	return &DiskController{
+		diskService: service.NewDiskService(),
+	}
+}
+
+var diskController DiskController
+
+func init() {
+	diskController = *NewDiskController()
+}
+
+func ListUnusedDisks(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	disks, err := diskController.diskService.ListUnused(ctx.Request.Context(), uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("List disks of host %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(disks, nil)
+}
+
+// ProvisionDisk formats and mounts an unused disk, or only plans the commands with DryRun set.
+func ProvisionDisk(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var request entity.DiskProvisionRequest
+	if err := ctx.ShouldBind(&request); err != nil {
+		logger.GetLogger().Errorf("DiskProvisionRequest bind failed: %s", err.Error())
+		dangerous(err)
+	}
+	report, err := diskController.diskService.Provision(ctx.Request.Context(), uint(id), request)
+	if err != nil {
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(report, nil)
+}
+
+// GrowDisk grows an LV and its filesystem, or only plans the commands with DryRun set.
+func GrowDisk(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var request entity.DiskGrowRequest
+	if err := ctx.ShouldBind(&request); err != nil {
+		logger.GetLogger().Errorf("DiskGrowRequest bind failed: %s", err.Error())
+		dangerous(err)
+	}
+	report, err := diskController.diskService.Grow(ctx.Request.Context(), uint(id), request)
+	if err != nil {
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(report, nil)
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+)
+
+type HostFactsController struct {
+	Ctx              context.Context
+	hostFactsService service.HostFactsService
+}
+
+func NewHostFactsController() *HostFactsController {
+	return &HostFactsController{
+		hostFactsService: service.NewHostFactsService(),
+	}
+}
+
+var hostFactsController HostFactsController
+
+func init() {
+	hostFactsController = *NewHostFactsController()
+}
+
+func GetHostFacts(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	facts, err := hostFactsController.hostFactsService.Get(ctx.Request.Context(), uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Get facts of host %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(facts, nil)
+}
+
+func RefreshHostFacts(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	facts, err := hostFactsController.hostFactsService.Refresh(ctx.Request.Context(), uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Refresh facts of host %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(facts, nil)
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"net/http"
+)
+
+type HostKeyController struct {
+	Ctx            context.Context
+	hostKeyService service.HostKeyService
+}
+
+func NewHostKeyController() *HostKeyController {
+	return &HostKeyController{
+		hostKeyService: service.NewHostKeyService(),
+	}
+}
+
+var hostKeyController HostKeyController
+
+func init() {
+	hostKeyController = *NewHostKeyController()
+}
+
+func ListHostKeys(ctx *gin.Context) {
+	keys, err := hostKeyController.hostKeyService.List(ginx.QueryStr(ctx, "host", ""))
+	if err != nil {
+		logger.GetLogger().Errorf("List host keys failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(keys, nil)
+}
+
+func ApproveHostKey(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	key, err := hostKeyController.hostKeyService.Approve(uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Approve host key %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(key, nil)
+}
+
+func RevokeHostKey(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	key, err := hostKeyController.hostKeyService.Revoke(uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Revoke host key %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(key, nil)
+}
+
+func ImportKnownHosts(ctx *gin.Context) {
+	var request entity.KnownHostsImport
+	if err := ctx.ShouldBind(&request); err != nil {
+		logger.GetLogger().Errorf("KnownHostsImport bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	keys, err := hostKeyController.hostKeyService.Import(request)
+	if err != nil {
+		logger.GetLogger().Errorf("Import known_hosts failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(keys, nil)
+}
+
+// dangerous is ginx.Dangerous, except that a host key which is not accepted answers 409 so that
+// clients can tell it from other connection failures and offer an approval.
+func dangerous(err error) {
+	var hostKeyErr *utils.HostKeyError
+	if errors.As(err, &hostKeyErr) {
+		ginx.Bomb(http.StatusConflict, err.Error())
+	}
+	ginx.Dangerous(err)
+}
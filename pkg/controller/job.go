@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/aop"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"time"
+)
+
+type JobController struct {
+	Ctx        context.Context
+	jobService service.JobService
+}
+
+func NewJobController() *JobController {
+	return &JobController{
+		jobService: service.NewJobService(),
+	}
+}
+
+var jobController JobController
+
+func init() {
+	jobController = *NewJobController()
+}
+
+func SubmitClusterJob(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var request entity.JobRequest
+	if err := ctx.ShouldBind(&request); err != nil {
+		logger.GetLogger().Errorf("JobRequest bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	job, err := jobController.jobService.Submit(uint(id), request)
+	if err != nil {
+		logger.GetLogger().Errorf("Submit job on cluster %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(job, nil)
+}
+
+func ListJobs(ctx *gin.Context) {
+	clusterID := ginx.QueryInt64(ctx, "cluster_id", 0)
+	jobs, err := jobController.jobService.List(uint(clusterID))
+	if err != nil {
+		logger.GetLogger().Errorf("List jobs failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(jobs, nil)
+}
+
+func GetJob(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	job, err := jobController.jobService.Get(uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Get job %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(job, nil)
+}
+
+func GetJobLogs(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	logs, err := jobController.jobService.Logs(uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Get logs of job %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(logs, nil)
+}
+
+func CancelJob(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	err := jobController.jobService.Cancel(uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Cancel job %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data("Cancel job success", nil)
+}
+
+// AttachJob streams the log of a job over a websocket, starting with the lines already produced.
+// With ?format=events every line is sent as a JSON entity.ProgressEvent instead of plain text.
+func AttachJob(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	ws, err := aop.UpGrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		logger.GetLogger().Errorf("Create websocket channel failed: %s", err.Error())
+		return
+	}
+	defer ws.Close()
+	streamJob(ws, uint(id), ctx.Query("format") == "events")
+}
+
+// streamJob writes the history and the live output of a job to ws until the job ends
+// or the client goes away. Leaving does not affect the job itself.
+func streamJob(ws *websocket.Conn, id uint, events bool) {
+	job, err := jobController.jobService.Get(id)
+	if err != nil {
+		logger.GetLogger().Errorf("Attach to job %d failed: %s", id, err.Error())
+		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
+		return
+	}
+	history, live, detach, err := jobController.jobService.Attach(id)
+	if err != nil {
+		logger.GetLogger().Errorf("Attach to job %d failed: %s", id, err.Error())
+		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
+		return
+	}
+	defer detach()
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	parser := utils.NewProgressParser(job.Type)
+	write := func(log entity.JobLog) error {
+		if !events {
+			return ws.WriteMessage(websocket.TextMessage, []byte(log.Message))
+		}
+		if log.Message == utils.PipelineDone {
+			return nil
+		}
+		event := parser.Parse(log.Message, log.CreatedAt, log.IsError)
+		event.Seq = log.Seq
+		return ws.WriteJSON(event)
+	}
+	last := 0
+	for _, log := range history {
+		if err := write(log); err != nil {
+			return
+		}
+		last = log.Seq
+	}
+	for {
+		select {
+		case log, ok := <-live:
+			if !ok {
+				finishStream(ws, id, events, parser)
+				return
+			}
+			if log.Seq <= last {
+				continue
+			}
+			if err := write(log); err != nil {
+				return
+			}
+			last = log.Seq
+		case <-gone:
+			logger.GetLogger().Infof("Client detached from job %d", id)
+			return
+		}
+	}
+}
+
+// finishStream reports the final state of a job once its output is complete.
+func finishStream(ws *websocket.Conn, id uint, events bool, parser *utils.ProgressParser) {
+	job, err := jobController.jobService.Get(id)
+	if err != nil {
+		return
+	}
+	if events {
+		percent := parser.Percent()
+		if job.Status == entity.JobSucceeded {
+			percent = 100
+		}
+		ws.WriteJSON(entity.ProgressEvent{
+			Type:      entity.EventJob,
+			Status:    job.Status,
+			Timestamp: time.Now(),
+			Percent:   percent,
+			Message:   job.Error,
+			IsError:   job.Status != entity.JobSucceeded,
+		})
+		return
+	}
+	if job.Error != "" {
+		ws.WriteMessage(websocket.TextMessage, []byte(job.Error))
+	}
+	ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Job %d %s", id, job.Status)))
+}
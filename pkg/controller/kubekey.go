@@ -8,7 +8,6 @@ import (
 	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/logger"
 	"github.com/whoisfisher/mykubespray/pkg/service"
-	"github.com/whoisfisher/mykubespray/pkg/utils"
 )
 
 type KubekeyController struct {
@@ -29,109 +28,45 @@ func init() {
 }
 
 func CreateCluster(ctx *gin.Context) {
-	var conf entity.KubekeyConf
-	ws, err := aop.UpGrader.Upgrade(ctx.Writer, ctx.Request, nil)
-	if err != nil {
-		logger.GetLogger().Errorf("Create websocket channel failed: %s", err.Error())
-		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
-	}
-	err = ws.ReadJSON(&conf)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to read kkconf info: %s", err.Error())
-		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
-	}
-	logChan := make(chan utils.LogEntry)
-	go func() {
-		for logEntry := range logChan {
-			if logEntry.IsError {
-				logger.GetLogger().Errorf("%s\n", logEntry.Message)
-				ws.WriteMessage(websocket.TextMessage, []byte(logEntry.Message))
-			} else {
-				logger.GetLogger().Infof("%s\n", logEntry.Message)
-				ws.WriteMessage(websocket.TextMessage, []byte(logEntry.Message))
-			}
-		}
-	}()
-	kubekeyController.kubekeyService.CreateCluster(conf, logChan)
+	serveClusterOperation(ctx, entity.JobCreateCluster)
 }
 
 func DeleteCluster(ctx *gin.Context) {
-	var conf entity.KubekeyConf
-	ws, err := aop.UpGrader.Upgrade(ctx.Writer, ctx.Request, nil)
-	if err != nil {
-		logger.GetLogger().Errorf("Create websocket channel failed: %s", err.Error())
-		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
-	}
-	err = ws.ReadJSON(&conf)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to read kkconf info: %s", err.Error())
-		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
-	}
-	logChan := make(chan utils.LogEntry)
-	go func() {
-		for logEntry := range logChan {
-			if logEntry.IsError {
-				logger.GetLogger().Errorf("%s\n", logEntry.Message)
-				ws.WriteMessage(websocket.TextMessage, []byte(logEntry.Message))
-			} else {
-				logger.GetLogger().Infof("%s\n", logEntry.Message)
-				ws.WriteMessage(websocket.TextMessage, []byte(logEntry.Message))
-			}
-		}
-	}()
-	kubekeyController.kubekeyService.DeleteCluster(conf, logChan)
+	serveClusterOperation(ctx, entity.JobDeleteCluster)
 }
 
 func AddNodeToCluster(ctx *gin.Context) {
-	var conf entity.KubekeyConf
-	ws, err := aop.UpGrader.Upgrade(ctx.Writer, ctx.Request, nil)
-	if err != nil {
-		logger.GetLogger().Errorf("Create websocket channel failed: %s", err.Error())
-		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
-	}
-	err = ws.ReadJSON(&conf)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to read kkconf info: %s", err.Error())
-		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
-	}
-	logChan := make(chan utils.LogEntry)
-	go func() {
-		for logEntry := range logChan {
-			if logEntry.IsError {
-				logger.GetLogger().Errorf("%s\n", logEntry.Message)
-				ws.WriteMessage(websocket.TextMessage, []byte(logEntry.Message))
-			} else {
-				logger.GetLogger().Infof("%s\n", logEntry.Message)
-				ws.WriteMessage(websocket.TextMessage, []byte(logEntry.Message))
-			}
-		}
-	}()
-	kubekeyController.kubekeyService.AddNodeToCluster(conf, logChan)
+	serveClusterOperation(ctx, entity.JobAddNodes)
 }
 
 func DeleteNodeFromCluster(ctx *gin.Context) {
-	var conf entity.KubekeyConf
+	serveClusterOperation(ctx, entity.JobDeleteNodes)
+}
+
+// serveClusterOperation upgrades the request to a websocket, reads the target cluster,
+// submits the operation as a job and streams its output back to the client.
+// The job keeps running if the client disconnects and can be re-attached with /jobs/:id/attach.
+// ?format=events switches the stream to JSON progress events.
+func serveClusterOperation(ctx *gin.Context, jobType string) {
+	var op entity.ClusterOperation
 	ws, err := aop.UpGrader.Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
 		logger.GetLogger().Errorf("Create websocket channel failed: %s", err.Error())
+		return
+	}
+	defer ws.Close()
+	err = ws.ReadJSON(&op)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to read cluster operation: %s", err.Error())
 		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
+		return
 	}
-	err = ws.ReadJSON(&conf)
+	job, err := jobController.jobService.Submit(op.ClusterID, entity.JobRequest{Type: jobType, Nodes: op.Nodes})
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to read kkconf info: %s", err.Error())
+		logger.GetLogger().Errorf("Cluster operation on %d failed: %s", op.ClusterID, err.Error())
 		ws.WriteMessage(websocket.TextMessage, []byte(err.Error()))
+		return
 	}
-	logChan := make(chan utils.LogEntry)
-	go func() {
-		for logEntry := range logChan {
-			if logEntry.IsError {
-				logger.GetLogger().Errorf("%s\n", logEntry.Message)
-				ws.WriteMessage(websocket.TextMessage, []byte(logEntry.Message))
-			} else {
-				logger.GetLogger().Infof("%s\n", logEntry.Message)
-				ws.WriteMessage(websocket.TextMessage, []byte(logEntry.Message))
-			}
-		}
-	}()
-	kubekeyController.kubekeyService.DeleteNodeFromCluster(conf, logChan)
+	ws.WriteJSON(job)
+	streamJob(ws, job.ID, ctx.Query("format") == "events")
 }
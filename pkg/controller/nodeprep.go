@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+)
+
+type NodePrepController struct {
+	Ctx             context.Context
+	nodePrepService service.NodePrepService
+}
+
+func NewNodePrepController() *NodePrepController {
+	return &NodePrepController{
+		nodePrepService: service.NewNodePrepService(),
+	}
+}
+
+var nodePrepController NodePrepController
+
+func init() {
+	nodePrepController = *NewNodePrepController()
+}
+
+// PrepareClusterNodes prepares the hosts of a cluster for Kubernetes, or only reports drift with Check set.
+func PrepareClusterNodes(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var request entity.NodePrepRequest
+	if err := ctx.ShouldBind(&request); err != nil {
+		logger.GetLogger().Errorf("NodePrepRequest bind failed: %s", err.Error())
+		dangerous(err)
+	}
+	reports, err := nodePrepController.nodePrepService.Prepare(ctx.Request.Context(), uint(id), request)
+	if err != nil {
+		logger.GetLogger().Errorf("Prepare nodes of cluster %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(reports, nil)
+}
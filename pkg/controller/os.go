@@ -30,12 +30,12 @@ func MountDisk(ctx *gin.Context) {
 	var diskConf entity.DiskConf
 	if err := ctx.ShouldBind(&diskConf); err != nil {
 		logger.GetLogger().Errorf("DiskConf bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	err := osController.osService.Mount(diskConf)
+	err := osController.osService.Mount(ctx.Request.Context(), diskConf)
 	if err != nil {
 		logger.GetLogger().Errorf("Mount disk failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
 	ginx.NewRender(ctx).Data("Mount disk success", nil)
 }
@@ -44,12 +44,12 @@ func AddHosts(ctx *gin.Context) {
 	var recordConf entity.RecordConf
 	if err := ctx.ShouldBind(&recordConf); err != nil {
 		logger.GetLogger().Errorf("RecordConf bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	err := osController.osService.AddHost(recordConf)
+	err := osController.osService.AddHost(ctx.Request.Context(), recordConf)
 	if err != nil {
 		logger.GetLogger().Errorf("add hosts failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
 	ginx.NewRender(ctx).Data("add hosts success", nil)
 }
@@ -58,12 +58,12 @@ func CopyFile(ctx *gin.Context) {
 	var certConf entity.CertConf
 	if err := ctx.ShouldBind(&certConf); err != nil {
 		logger.GetLogger().Errorf("RecordConf bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	err := osController.osService.CopyFile(certConf)
+	err := osController.osService.CopyFile(ctx.Request.Context(), certConf)
 	if err != nil {
 		logger.GetLogger().Errorf("copy cert failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
 	ginx.NewRender(ctx).Data("copy cert success", nil)
 }
@@ -72,12 +72,12 @@ func ChangeExpiredPassword(ctx *gin.Context) {
 	var passwordConf entity.PasswordConf
 	if err := ctx.ShouldBind(&passwordConf); err != nil {
 		logger.GetLogger().Errorf("PasswordConf bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	err := osController.osService.ChangeExpiredPassword(passwordConf)
+	err := osController.osService.ChangeExpiredPassword(ctx.Request.Context(), passwordConf)
 	if err != nil {
 		logger.GetLogger().Errorf("update password failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
 	ginx.NewRender(ctx).Data("update password success", nil)
 }
@@ -86,12 +86,12 @@ func CheckPasswordInfo(ctx *gin.Context) {
 	var passwordConf entity.Host
 	if err := ctx.ShouldBind(&passwordConf); err != nil {
 		logger.GetLogger().Errorf("PasswordConf bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	info, err := osController.osService.CheckPasswordInfo(passwordConf)
+	info, err := osController.osService.CheckPasswordInfo(ctx.Request.Context(), passwordConf)
 	if err != nil {
 		logger.GetLogger().Errorf("check password failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
 	ginx.NewRender(ctx).Data(info, nil)
 }
@@ -100,12 +100,12 @@ func UpdatePassword(ctx *gin.Context) {
 	var passwordConf entity.PasswordConf
 	if err := ctx.ShouldBind(&passwordConf); err != nil {
 		logger.GetLogger().Errorf("PasswordConf bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	err := osController.osService.UpdatePassword(passwordConf)
+	err := osController.osService.UpdatePassword(ctx.Request.Context(), passwordConf)
 	if err != nil {
 		logger.GetLogger().Errorf("update password failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
 	ginx.NewRender(ctx).Data("update password success", nil)
 }
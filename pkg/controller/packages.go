@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+)
+
+type PackageController struct {
+	Ctx            context.Context
+	packageService service.PackageService
+}
+
+func NewPackageController() *PackageController {
+	return &PackageController{
+		packageService: service.NewPackageService(),
+	}
+}
+
+var packageController PackageController
+
+func init() {
+	packageController = *NewPackageController()
+}
+
+// InstallClusterPackages installs the OS packages on the hosts of a cluster, or only reports the missing
+// ones with Verify set.
+func InstallClusterPackages(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var request entity.PackageRequest
+	if err := ctx.ShouldBind(&request); err != nil {
+		logger.GetLogger().Errorf("PackageRequest bind failed: %s", err.Error())
+		dangerous(err)
+	}
+	reports, err := packageController.packageService.Install(ctx.Request.Context(), uint(id), request)
+	if err != nil {
+		logger.GetLogger().Errorf("Install packages on cluster %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(reports, nil)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+	"net/http"
+)
+
+type PlanController struct {
+	Ctx         context.Context
+	planService service.PlanService
+}
+
+func NewPlanController() *PlanController {
+	return &PlanController{
+		planService: service.NewPlanService(),
+	}
+}
+
+var planController PlanController
+
+func init() {
+	planController = *NewPlanController()
+}
+
+func PlanCluster(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var conf entity.KubekeyConf
+	if err := ctx.ShouldBind(&conf); err != nil {
+		logger.GetLogger().Errorf("KubekeyConf bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	plan, err := planController.planService.Plan(uint(id), conf)
+	if err != nil {
+		logger.GetLogger().Errorf("Plan cluster %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(plan, nil)
+}
+
+func ApplyClusterPlan(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var apply entity.PlanApply
+	if err := ctx.ShouldBind(&apply); err != nil {
+		logger.GetLogger().Errorf("PlanApply bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	job, err := planController.planService.Apply(uint(id), apply)
+	if errors.Is(err, service.ErrStalePlan) || errors.Is(err, service.ErrPlanApplying) {
+		ginx.Bomb(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		logger.GetLogger().Errorf("Apply plan on cluster %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(job, nil)
+}
@@ -30,12 +30,12 @@ func AddDNSParallel(ctx *gin.Context) {
 	var addDNSParallel entity.AddDNSParallel
 	if err := ctx.ShouldBind(&addDNSParallel); err != nil {
 		logger.GetLogger().Errorf("AddDNSParallel bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	err := poolController.poolService.AddDNS(addDNSParallel.DNS, addDNSParallel.Hosts)
+	err := poolController.poolService.AddDNS(ctx.Request.Context(), addDNSParallel.DNS, addDNSParallel.Hosts, addDNSParallel.Rollout)
 	if err != nil {
 		logger.GetLogger().Errorf("Add /etc/resolv.conf failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
 	ginx.NewRender(ctx).Data("Add /etc/resolv.conf success", nil)
 }
@@ -44,12 +44,12 @@ func AddHostsParallel(ctx *gin.Context) {
 	var addHostsParallel entity.AddHostsParallel
 	if err := ctx.ShouldBind(&addHostsParallel); err != nil {
 		logger.GetLogger().Errorf("AddHostsParallel bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	err := poolController.poolService.AddHosts(addHostsParallel.Record, addHostsParallel.Hosts)
+	err := poolController.poolService.AddHosts(ctx.Request.Context(), addHostsParallel.Record, addHostsParallel.Hosts, addHostsParallel.Rollout)
 	if err != nil {
 		logger.GetLogger().Errorf("Add /etc/hosts failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
 	ginx.NewRender(ctx).Data("Add /etc/hosts success", nil)
 }
@@ -58,12 +58,12 @@ func CopyFileParallel(ctx *gin.Context) {
 	var copyFileParallel entity.CopyFileParallel
 	if err := ctx.ShouldBind(&copyFileParallel); err != nil {
 		logger.GetLogger().Errorf("CopyFileParallel bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	err := poolController.poolService.CopyFile(copyFileParallel.SrcFile, copyFileParallel.DestFile, copyFileParallel.Hosts)
+	err := poolController.poolService.CopyFile(ctx.Request.Context(), copyFileParallel.SrcFile, copyFileParallel.DestFile, copyFileParallel.Hosts, copyFileParallel.Rollout)
 	if err != nil {
 		logger.GetLogger().Errorf("Copy keycloak certificate failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
 	ginx.NewRender(ctx).Data("Copy keycloak certificate success", nil)
 }
@@ -72,12 +72,16 @@ func ExecuteCommandParallel(ctx *gin.Context) {
 	var commandParallel entity.CommandParallel
 	if err := ctx.ShouldBind(&commandParallel); err != nil {
 		logger.GetLogger().Errorf("CommandParallel bind failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	err := poolController.poolService.ExecuteCommand(commandParallel.Command, commandParallel.Hosts)
+	results, err := poolController.poolService.ExecuteCommand(ctx.Request.Context(), commandParallel.Command, commandParallel.Hosts, commandParallel.Rollout)
 	if err != nil {
 		logger.GetLogger().Errorf("Execute command failed: %s", err.Error())
-		ginx.Dangerous(err)
+		dangerous(err)
 	}
-	ginx.NewRender(ctx).Data("Execute command success", nil)
+	ginx.NewRender(ctx).Data(results, nil)
+}
+
+func GetPoolStats(ctx *gin.Context) {
+	ginx.NewRender(ctx).Data(poolController.poolService.Stats(), nil)
 }
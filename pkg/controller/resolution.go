@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+)
+
+type NameResolutionController struct {
+	Ctx                   context.Context
+	nameResolutionService service.NameResolutionService
+}
+
+func NewNameResolutionController() *NameResolutionController {
+	return &NameResolutionController{
+		nameResolutionService: service.NewNameResolutionService(),
+	}
+}
+
+var nameResolutionController NameResolutionController
+
+func init() {
+	nameResolutionController = *NewNameResolutionController()
+}
+
+func GetClusterNameResolution(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	resolution, err := nameResolutionController.nameResolutionService.Get(uint(id))
+	if err != nil {
+		logger.GetLogger().Errorf("Get name resolution of cluster %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(resolution, nil)
+}
+
+func SetClusterNameResolution(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var resolution entity.NameResolution
+	if err := ctx.ShouldBind(&resolution); err != nil {
+		logger.GetLogger().Errorf("NameResolution bind failed: %s", err.Error())
+		dangerous(err)
+	}
+	if err := nameResolutionController.nameResolutionService.Set(uint(id), resolution); err != nil {
+		logger.GetLogger().Errorf("Set name resolution of cluster %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(resolution, nil)
+}
+
+// SyncClusterNameResolution reconciles /etc/hosts and the resolver of the hosts of a cluster, or only
+// reports drift with Check set.
+func SyncClusterNameResolution(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var request entity.NameResolutionSyncRequest
+	if err := ctx.ShouldBind(&request); err != nil {
+		logger.GetLogger().Errorf("NameResolutionSyncRequest bind failed: %s", err.Error())
+		dangerous(err)
+	}
+	reports, err := nameResolutionController.nameResolutionService.Sync(ctx.Request.Context(), uint(id), request)
+	if err != nil {
+		logger.GetLogger().Errorf("Sync name resolution of cluster %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(reports, nil)
+}
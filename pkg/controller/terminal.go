@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/aop"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// terminalHeartbeatTimeout closes terminals whose client sent no frame, not even a ping, for that long.
+const terminalHeartbeatTimeout = 90 * time.Second
+
+type TerminalController struct {
+	Ctx             context.Context
+	terminalService service.TerminalService
+}
+
+func NewTerminalController() *TerminalController {
+	return &TerminalController{
+		terminalService: service.NewTerminalService(),
+	}
+}
+
+var terminalController TerminalController
+
+func init() {
+	terminalController = *NewTerminalController()
+}
+
+// OpenTerminal upgrades to a websocket that carries a shell on a host of a cluster, see entity.TerminalMessage.
+func OpenTerminal(ctx *gin.Context) {
+	clusterID := ginx.UrlParamInt64(ctx, "id")
+	hostName := ginx.UrlParamStr(ctx, "host")
+	cols := ginx.QueryInt(ctx, "cols", 80)
+	rows := ginx.QueryInt(ctx, "rows", 24)
+	username := ctx.GetString("username")
+	// The shell is opened before the upgrade, so that a failure, e.g. a host key to approve, is an HTTP error.
+	terminal, session, err := terminalController.terminalService.Open(uint(clusterID), hostName, username, ctx.ClientIP(), cols, rows)
+	if err != nil {
+		logger.GetLogger().Errorf("Open terminal on %s failed: %s", hostName, err.Error())
+		dangerous(err)
+	}
+	ws, err := aop.UpGrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		logger.GetLogger().Errorf("Create websocket channel failed: %s", err.Error())
+		terminal.Close()
+		terminalController.terminalService.Close(session, -1, "websocket upgrade failed")
+		return
+	}
+	defer ws.Close()
+	conn := &terminalConn{ws: ws}
+	exitCode, reason := serveTerminal(conn, terminal, session, terminalController.terminalService.IdleTimeout())
+	terminal.Close()
+	if err := terminalController.terminalService.Close(session, exitCode, reason); err != nil {
+		logger.GetLogger().Errorf("Record end of terminal session %d failed: %s", session.ID, err.Error())
+	}
+}
+
+func ListTerminalSessions(ctx *gin.Context) {
+	sessions, err := terminalController.terminalService.ListSessions(uint(ginx.UrlParamInt64(ctx, "id")))
+	if err != nil {
+		logger.GetLogger().Errorf("List terminal sessions failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(sessions, nil)
+}
+
+// terminalConn serializes the frames written to a websocket.
+type terminalConn struct {
+	ws    *websocket.Conn
+	mutex sync.Mutex
+}
+
+func (conn *terminalConn) send(message entity.TerminalMessage) error {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	conn.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return conn.ws.WriteJSON(message)
+}
+
+// serveTerminal relays frames between the websocket and terminal until the shell exits, the client
+// goes away or nothing was typed for idleTimeout. Output does not count, a command that keeps printing
+// would otherwise hold an abandoned session open. It returns the exit status of the shell,
+// -1 if it did not exit, and why the session ended.
+func serveTerminal(conn *terminalConn, terminal *utils.Terminal, session *entity.TerminalSession, idleTimeout time.Duration) (int, string) {
+	var lastActivity, bytesIn, bytesOut atomic.Int64
+	touch := func() { lastActivity.Store(time.Now().UnixNano()) }
+	touch()
+
+	exited := make(chan int, 1)
+	go func() {
+		buf := make([]byte, 32*1024)
+		pending := 0
+		for {
+			n, err := terminal.Read(buf[pending:])
+			if n > 0 {
+				n += pending
+				complete := completeRunes(buf[:n])
+				if conn.send(entity.TerminalMessage{Type: entity.TerminalOutput, Data: string(buf[:complete])}) != nil {
+					break
+				}
+				bytesOut.Add(int64(complete))
+				pending = copy(buf, buf[complete:n])
+			}
+			if err != nil {
+				break
+			}
+		}
+		code, _ := terminal.Wait()
+		exited <- code
+	}()
+
+	disconnected := make(chan string, 1)
+	go func() {
+		for {
+			conn.ws.SetReadDeadline(time.Now().Add(terminalHeartbeatTimeout))
+			var message entity.TerminalMessage
+			if err := conn.ws.ReadJSON(&message); err != nil {
+				disconnected <- "client disconnected"
+				return
+			}
+			switch message.Type {
+			case entity.TerminalInput:
+				touch()
+				bytesIn.Add(int64(len(message.Data)))
+				if _, err := terminal.Write([]byte(message.Data)); err != nil {
+					disconnected <- "shell closed its input"
+					return
+				}
+			case entity.TerminalResize:
+				if message.Cols > 0 && message.Rows > 0 {
+					terminal.Resize(message.Cols, message.Rows)
+				}
+			case entity.TerminalPing:
+				conn.send(entity.TerminalMessage{Type: entity.TerminalPong})
+			default:
+				conn.send(entity.TerminalMessage{Type: entity.TerminalError, Data: fmt.Sprintf("unknown frame type %q", message.Type)})
+			}
+		}
+	}()
+
+	var idle <-chan time.Time
+	if idleTimeout > 0 {
+		ticker := time.NewTicker(min(idleTimeout, 10*time.Second))
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+	exitCode, reason := -1, ""
+	for reason == "" {
+		select {
+		case code := <-exited:
+			exitCode, reason = code, "shell exited"
+			conn.send(entity.TerminalMessage{Type: entity.TerminalExit, ExitCode: &code})
+		case reason = <-disconnected:
+		case <-idle:
+			if time.Since(time.Unix(0, lastActivity.Load())) >= idleTimeout {
+				reason = "idle timeout"
+				conn.send(entity.TerminalMessage{Type: entity.TerminalError, Data: fmt.Sprintf("Closed after %s without input", idleTimeout)})
+			}
+		}
+	}
+	session.BytesIn = bytesIn.Load()
+	session.BytesOut = bytesOut.Load()
+	return exitCode, reason
+}
+
+// completeRunes returns the length of p without a UTF-8 sequence cut off at its end, which is sent
+// with the next output frame instead.
+func completeRunes(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if utf8.FullRune(p[i:]) {
+				return len(p)
+			}
+			return i
+		}
+	}
+	return len(p)
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/service"
+)
+
+type UpgradeController struct {
+	Ctx            context.Context
+	upgradeService service.UpgradeService
+}
+
+func NewUpgradeController() *UpgradeController {
+	return &UpgradeController{
+		upgradeService: service.NewUpgradeService(),
+	}
+}
+
+var upgradeController UpgradeController
+
+func init() {
+	upgradeController = *NewUpgradeController()
+}
+
+func PlanClusterUpgrade(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var request entity.UpgradeRequest
+	if err := ctx.ShouldBind(&request); err != nil {
+		logger.GetLogger().Errorf("UpgradeRequest bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	plan, err := upgradeController.upgradeService.Plan(ctx.Request.Context(), uint(id), request.Version)
+	if err != nil {
+		logger.GetLogger().Errorf("Plan upgrade of cluster %d failed: %s", id, err.Error())
+		dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(plan, nil)
+}
+
+func UpgradeCluster(ctx *gin.Context) {
+	id := ginx.UrlParamInt64(ctx, "id")
+	var request entity.UpgradeRequest
+	if err := ctx.ShouldBind(&request); err != nil {
+		logger.GetLogger().Errorf("UpgradeRequest bind failed: %s", err.Error())
+		ginx.Dangerous(err)
+	}
+	job, err := jobController.jobService.Submit(uint(id), entity.JobRequest{Type: entity.JobUpgrade, Version: request.Version})
+	if err != nil {
+		logger.GetLogger().Errorf("Upgrade cluster %d failed: %s", id, err.Error())
+		ginx.Dangerous(err)
+	}
+	ginx.NewRender(ctx).Data(job, nil)
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"time"
+)
+
+// ReplaceClusterCerts stores the result of the latest certificate check of a cluster.
+func ReplaceClusterCerts(clusterID uint, certs []entity.ClusterCert) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("cluster_id = ?", clusterID).Delete(&entity.ClusterCert{}).Error; err != nil {
+			return err
+		}
+		for i := range certs {
+			certs[i].ID = 0
+			certs[i].ClusterID = clusterID
+			if err := tx.Create(&certs[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func ListClusterCerts(clusterID uint) ([]entity.ClusterCert, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	var certs []entity.ClusterCert
+	if err := db.Where("cluster_id = ?", clusterID).Order("expires_at").Find(&certs).Error; err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// ListCertsExpiringBefore returns the stored certificates of all clusters that expire before deadline.
+func ListCertsExpiringBefore(deadline time.Time) ([]entity.ClusterCert, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	var certs []entity.ClusterCert
+	if err := db.Where("expires_at < ?", deadline).Order("expires_at").Find(&certs).Error; err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
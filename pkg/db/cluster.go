@@ -0,0 +1,250 @@
+package db
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+)
+
+var ErrNotInitialized = errors.New("database is not initialized")
+
+func getDB() (*gorm.DB, error) {
+	if DB == nil {
+		return nil, ErrNotInitialized
+	}
+	return DB, nil
+}
+
+func CreateCluster(cluster *entity.Cluster) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		hosts := cluster.Hosts
+		cluster.Hosts = nil
+		if err := tx.Create(cluster).Error; err != nil {
+			return err
+		}
+		if err := createHosts(tx, cluster.ID, hosts); err != nil {
+			return err
+		}
+		cluster.Hosts = hosts
+		return nil
+	})
+}
+
+func ListClusters() ([]entity.Cluster, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	var clusters []entity.Cluster
+	if err := db.Preload("Hosts").Preload("Hosts.Roles").Order("id").Find(&clusters).Error; err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
+
+func GetCluster(id uint) (*entity.Cluster, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	cluster := &entity.Cluster{}
+	if err := db.Preload("Hosts").Preload("Hosts.Roles").First(cluster, id).Error; err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// UpdateCluster replaces the cluster attributes and its whole host inventory.
+func UpdateCluster(cluster *entity.Cluster) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		hosts := cluster.Hosts
+		cluster.Hosts = nil
+		if err := tx.Save(cluster).Error; err != nil {
+			return err
+		}
+		if err := deleteHosts(tx, cluster.ID); err != nil {
+			return err
+		}
+		if err := createHosts(tx, cluster.ID, hosts); err != nil {
+			return err
+		}
+		cluster.Hosts = hosts
+		return nil
+	})
+}
+
+// UpdateClusterVersion records the Kubernetes version a cluster runs after an upgrade.
+func UpdateClusterVersion(id uint, version string) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Model(&entity.Cluster{}).Where("id = ?", id).Update("kubernetes_version", version).Error
+}
+
+func DeleteCluster(id uint) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteHosts(tx, id); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("cluster_id = ?", id).Delete(&entity.ClusterCert{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("cluster_id = ?", id).Delete(&entity.NameResolutionRecord{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&entity.Cluster{}, id).Error
+	})
+}
+
+func GetClusterHost(clusterID, hostID uint) (*entity.ClusterHost, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	host := &entity.ClusterHost{}
+	if err := db.Preload("Roles").Where("cluster_id = ?", clusterID).First(host, hostID).Error; err != nil {
+		return nil, err
+	}
+	return host, nil
+}
+
+// GetHost returns a host of any cluster.
+func GetHost(hostID uint) (*entity.ClusterHost, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	host := &entity.ClusterHost{}
+	if err := db.Preload("Roles").First(host, hostID).Error; err != nil {
+		return nil, err
+	}
+	return host, nil
+}
+
+func CreateClusterHost(host *entity.ClusterHost) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		hosts := []entity.ClusterHost{*host}
+		if err := createHosts(tx, host.ClusterID, hosts); err != nil {
+			return err
+		}
+		*host = hosts[0]
+		return nil
+	})
+}
+
+// UpdateClusterHost saves the host attributes and replaces its role assignments.
+func UpdateClusterHost(host *entity.ClusterHost) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		roles := host.Roles
+		host.Roles = nil
+		if err := tx.Save(host).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("host_id = ?", host.ID).Delete(&entity.ClusterRole{}).Error; err != nil {
+			return err
+		}
+		for i := range roles {
+			roles[i].ID = 0
+			roles[i].ClusterID = host.ClusterID
+			roles[i].HostID = host.ID
+			if err := tx.Create(&roles[i]).Error; err != nil {
+				return err
+			}
+		}
+		host.Roles = roles
+		return nil
+	})
+}
+
+func DeleteClusterHost(clusterID, hostID uint) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("cluster_id = ? AND host_id = ?", clusterID, hostID).Delete(&entity.ClusterRole{}).Error; err != nil {
+			return err
+		}
+		if err := deleteHostFacts(tx, tx.Where("cluster_id = ? AND id = ?", clusterID, hostID)); err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("cluster_id = ?", clusterID).Delete(&entity.ClusterHost{}, hostID).Error
+	})
+}
+
+func DeleteClusterHostByName(clusterID uint, name string) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	host := &entity.ClusterHost{}
+	if err := db.Where("cluster_id = ? AND name = ?", clusterID, name).First(host).Error; err != nil {
+		return err
+	}
+	return DeleteClusterHost(clusterID, host.ID)
+}
+
+func createHosts(tx *gorm.DB, clusterID uint, hosts []entity.ClusterHost) error {
+	for i := range hosts {
+		roles := hosts[i].Roles
+		hosts[i].ID = 0
+		hosts[i].ClusterID = clusterID
+		hosts[i].Roles = nil
+		if err := tx.Create(&hosts[i]).Error; err != nil {
+			return err
+		}
+		for j := range roles {
+			roles[j].ID = 0
+			roles[j].ClusterID = clusterID
+			roles[j].HostID = hosts[i].ID
+			if err := tx.Create(&roles[j]).Error; err != nil {
+				return err
+			}
+		}
+		hosts[i].Roles = roles
+	}
+	return nil
+}
+
+func deleteHosts(tx *gorm.DB, clusterID uint) error {
+	if err := deleteHostFacts(tx, tx.Where("cluster_id = ?", clusterID)); err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("cluster_id = ?", clusterID).Delete(&entity.ClusterRole{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("cluster_id = ?", clusterID).Delete(&entity.ClusterHost{}).Error
+}
+
+// deleteHostFacts deletes the facts of the hosts selected by query.
+func deleteHostFacts(tx *gorm.DB, query *gorm.DB) error {
+	var hostIDs []uint
+	if err := query.Model(&entity.ClusterHost{}).Pluck("id", &hostIDs).Error; err != nil {
+		return err
+	}
+	if len(hostIDs) == 0 {
+		return nil
+	}
+	return tx.Unscoped().Where("host_id IN (?)", hostIDs).Delete(&entity.HostFactsRecord{}).Error
+}
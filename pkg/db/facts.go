@@ -0,0 +1,42 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+)
+
+// GetHostFacts returns the facts stored for a host, nil if none were gathered yet.
+func GetHostFacts(hostID uint) (*entity.HostFactsRecord, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	record := &entity.HostFactsRecord{}
+	if err := db.Where("host_id = ?", hostID).First(record).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// SaveHostFacts replaces the facts stored for the host of record.
+func SaveHostFacts(record *entity.HostFactsRecord) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		current := &entity.HostFactsRecord{}
+		err := tx.Where("host_id = ?", record.HostID).First(current).Error
+		switch {
+		case err == nil:
+			record.ID = current.ID
+			record.CreatedAt = current.CreatedAt
+		case !gorm.IsRecordNotFoundError(err):
+			return err
+		}
+		return tx.Save(record).Error
+	})
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+)
+
+// HostKeyStore keeps the SSH host keys in the database.
+type HostKeyStore struct{}
+
+func (HostKeyStore) ListHostKeys(host string) ([]entity.HostKey, error) {
+	return ListHostKeys(host)
+}
+
+func (HostKeyStore) SaveHostKey(key *entity.HostKey) error {
+	return SaveHostKey(key)
+}
+
+// ListHostKeys returns the keys of host, or of every host when host is empty.
+func ListHostKeys(host string) ([]entity.HostKey, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	query := db.Order("host").Order("id")
+	if host != "" {
+		query = query.Where("host = ?", host)
+	}
+	var keys []entity.HostKey
+	if err := query.Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func GetHostKey(id uint) (*entity.HostKey, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	key := &entity.HostKey{}
+	if err := db.First(key, id).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func SaveHostKey(key *entity.HostKey) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Save(key).Error
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"time"
+)
+
+func CreateJob(job *entity.Job) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Create(job).Error
+}
+
+func UpdateJob(job *entity.Job) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Save(job).Error
+}
+
+func GetJob(id uint) (*entity.Job, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	job := &entity.Job{}
+	if err := db.First(job, id).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ListJobs returns jobs ordered from newest to oldest, optionally restricted to one cluster.
+func ListJobs(clusterID uint) ([]entity.Job, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	query := db.Order("id desc")
+	if clusterID > 0 {
+		query = query.Where("cluster_id = ?", clusterID)
+	}
+	var jobs []entity.Job
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func CreateJobLog(log *entity.JobLog) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Create(log).Error
+}
+
+func ListJobLogs(jobID uint) ([]entity.JobLog, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	var logs []entity.JobLog
+	if err := db.Where("job_id = ?", jobID).Order("seq").Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// FailUnfinishedJobs marks jobs left pending or running by a previous process as failed.
+func FailUnfinishedJobs(reason string) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Model(&entity.Job{}).
+		Where("status IN (?)", []string{entity.JobPending, entity.JobRunning}).
+		Updates(map[string]interface{}{"status": entity.JobFailed, "error": reason, "ended_at": time.Now()}).Error
+}
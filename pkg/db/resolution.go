@@ -0,0 +1,42 @@
+package db
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+)
+
+// GetNameResolution returns the name resolution stored for a cluster, nil if none was set.
+func GetNameResolution(clusterID uint) (*entity.NameResolutionRecord, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	record := &entity.NameResolutionRecord{}
+	if err := db.Where("cluster_id = ?", clusterID).First(record).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return record, nil
+}
+
+// SaveNameResolution replaces the name resolution stored for the cluster of record.
+func SaveNameResolution(record *entity.NameResolutionRecord) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		current := &entity.NameResolutionRecord{}
+		err := tx.Where("cluster_id = ?", record.ClusterID).First(current).Error
+		switch {
+		case err == nil:
+			record.ID = current.ID
+			record.CreatedAt = current.CreatedAt
+		case !gorm.IsRecordNotFoundError(err):
+			return err
+		}
+		return tx.Save(record).Error
+	})
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+)
+
+func SaveTerminalSession(session *entity.TerminalSession) error {
+	db, err := getDB()
+	if err != nil {
+		return err
+	}
+	return db.Save(session).Error
+}
+
+// ListTerminalSessions returns the terminal sessions of a cluster, or of every cluster when clusterID is 0, newest first.
+func ListTerminalSessions(clusterID uint) ([]entity.TerminalSession, error) {
+	db, err := getDB()
+	if err != nil {
+		return nil, err
+	}
+	query := db.Order("id desc")
+	if clusterID != 0 {
+		query = query.Where("cluster_id = ?", clusterID)
+	}
+	var sessions []entity.TerminalSession
+	if err := query.Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// ClusterCert is one row of the kk certs check-expiration table, kept from the last check of a cluster.
+type ClusterCert struct {
+	gorm.Model
+	ClusterID    uint      `json:"cluster_id" gorm:"not null;index"`
+	Name         string    `json:"name" gorm:"not null"`
+	Node         string    `json:"node"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+	ResidualTime string    `json:"residual_time"`
+	ResidualDays int       `json:"residual_days" gorm:"-"`
+	CA           string    `json:"ca"`
+	IsCA         bool      `json:"is_ca"`
+	CheckedAt    time.Time `json:"checked_at"`
+	ClusterName  string    `json:"cluster_name,omitempty" gorm:"-"`
+}
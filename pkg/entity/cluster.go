@@ -0,0 +1,102 @@
+package entity
+
+import "github.com/jinzhu/gorm"
+
+const (
+	RoleEtcd         = "etcd"
+	RoleControlPlane = "control-plane"
+	RoleWorker       = "worker"
+	RoleRegistry     = "registry"
+)
+
+// Cluster is the persisted inventory of a kubernetes cluster.
+type Cluster struct {
+	gorm.Model
+	Name               string        `json:"name" gorm:"not null;unique_index"`
+	VIPServer          string        `json:"vip_server"`
+	KubePodsCIDR       string        `json:"kube_pods_cidr"`
+	KubeServiceCIDR    string        `json:"kube_service_cidr"`
+	ContainerManager   string        `json:"container_manager"`
+	ProxyMode          string        `json:"proxy_mode"`
+	IPIPMode           string        `json:"ipip_mode"`
+	VxlanMode          string        `json:"vxlan_mode"`
+	KKPath             string        `json:"kk_path"`
+	TaichuPackagePath  string        `json:"taichu_package_path"`
+	KubernetesVersion  string        `json:"kubernetes_version"`
+	NtpServers         string        `json:"ntp_servers"`
+	RegistryName       string        `json:"registry_name"`
+	RegistryUrl        string        `json:"registry_url"`
+	RegistryUser       string        `json:"registry_user"`
+	RegistryPassword   string        `json:"-"`
+	RegistryType       string        `json:"registry_type"`
+	RegistryKeyPath    string        `json:"registry_key_path"`
+	RegistryCertPath   string        `json:"registry_cert_path"`
+	RegistrySkipTLS    bool          `json:"registry_skip_tls"`
+	RegistryPlainHttp  bool          `json:"registry_plain_http"`
+	InsecureRegistries string        `json:"insecure_registries"`
+	ControlPlaneDomain string        `json:"control_plane_domain"`
+	NetworkPlugin      string        `json:"network_plugin"`
+	EnableMultus       bool          `json:"enable_multus"`
+	EtcdType           string        `json:"etcd_type"`
+	Timezone           string        `json:"timezone"`
+	ExtraSANs          string        `json:"extra_sans" gorm:"column:extra_sans"`
+	NamespaceOverride  string        `json:"namespace_override"`
+	RegistryMirrors    string        `json:"registry_mirrors"`
+	Addons             string        `json:"addons" gorm:"type:text"`
+	Provisioner        string        `json:"provisioner"`
+	KubesprayPath      string        `json:"kubespray_path"`
+	KubesprayImage     string        `json:"kubespray_image"`
+	OfflineTemplate    string        `json:"offline_template"`
+	FilesRepo          string        `json:"files_repo"`
+	YumRepo            string        `json:"yum_repo"`
+	DebianRepo         string        `json:"debian_repo"`
+	UbuntuRepo         string        `json:"ubuntu_repo"`
+	Hosts              []ClusterHost `json:"hosts" gorm:"foreignkey:ClusterID"`
+}
+
+// ClusterHost is a machine belonging to a cluster inventory.
+type ClusterHost struct {
+	gorm.Model
+	ClusterID       uint          `json:"cluster_id" gorm:"not null;index"`
+	Name            string        `json:"name" gorm:"not null"`
+	Address         string        `json:"address"`
+	InternalAddress string        `json:"internal_address"`
+	User            string        `json:"user"`
+	Password        string        `json:"-"`
+	Port            int32         `json:"port"`
+	Arch            string        `json:"arch"`
+	PrivateKey      string        `json:"private_key"`
+	JumpHosts       string        `json:"-" gorm:"type:text"`
+	BecomeMethod    string        `json:"become_method"`
+	BecomePassword  string        `json:"-"`
+	Roles           []ClusterRole `json:"roles" gorm:"foreignkey:HostID"`
+}
+
+// ClusterRole assigns a role (etcd, control-plane, worker, registry) to a host.
+type ClusterRole struct {
+	gorm.Model
+	ClusterID uint   `json:"cluster_id" gorm:"not null;index"`
+	HostID    uint   `json:"host_id" gorm:"not null;index"`
+	Role      string `json:"role" gorm:"not null"`
+}
+
+// ClusterHostConf is the payload used to add or update a single host of a cluster.
+type ClusterHostConf struct {
+	Host  Host
+	Roles []string
+}
+
+// ClusterOperation is the message a websocket client sends to start an operation on a stored cluster.
+type ClusterOperation struct {
+	ClusterID uint
+	Nodes     []string
+}
+
+func (host ClusterHost) HasRole(role string) bool {
+	for _, r := range host.Roles {
+		if r.Role == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// CommandResult is the outcome of a command run on a host. Command is redacted, passwords of the host
+// and password arguments are replaced by ******.
+type CommandResult struct {
+	Host     string        `json:"host"`
+	Command  string        `json:"command"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	// Error is set when the command could not be run to completion, ExitCode is -1 then.
+	Error string `json:"error,omitempty"`
+}
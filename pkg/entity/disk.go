@@ -0,0 +1,61 @@
+package entity
+
+const (
+	DiskLayoutLVM       = "lvm"
+	DiskLayoutPartition = "partition"
+)
+
+const (
+	FilesystemXFS  = "xfs"
+	FilesystemExt4 = "ext4"
+)
+
+const (
+	DiskCommandPlanned = "planned"
+	DiskCommandOK      = "ok"
+	DiskCommandFailed  = "failed"
+	DiskCommandSkipped = "skipped"
+)
+
+// DiskProvisionRequest turns an unused disk into a filesystem mounted at Mountpoint, e.g. /var/lib/etcd,
+// with an fstab entry by UUID. The lvm layout creates a PV, the VG VGName and the LV LVName of Size, or
+// of all the disk when Size is empty. The partition layout creates a single partition over the disk.
+// Layout defaults to lvm, Filesystem to xfs and MountOptions to defaults. With DryRun the commands are
+// only planned.
+type DiskProvisionRequest struct {
+	Device       string
+	Layout       string
+	VGName       string
+	LVName       string
+	Size         string
+	Filesystem   string
+	Mountpoint   string
+	MountOptions string
+	DryRun       bool
+}
+
+// DiskGrowRequest grows the LV LVName of VGName and its filesystem by Size, or by all free space of the
+// VG when Size is empty. Device, if set, is an unused disk added to the VG first.
+type DiskGrowRequest struct {
+	VGName string
+	LVName string
+	Device string
+	Size   string
+	DryRun bool
+}
+
+// DiskReport lists the commands run on a host in order, or the commands planned in a dry run. The
+// commands after a failed one are skipped.
+type DiskReport struct {
+	Host     string        `json:"host"`
+	DryRun   bool          `json:"dry_run"`
+	Error    string        `json:"error,omitempty"`
+	Commands []DiskCommand `json:"commands"`
+}
+
+// DiskCommand is a command of a DiskReport, see DiskCommandPlanned and the other statuses.
+type DiskCommand struct {
+	Command string `json:"command"`
+	Status  string `json:"status"`
+	Output  string `json:"output,omitempty"`
+}
@@ -0,0 +1,105 @@
+package entity
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// HostFacts describe the hardware and operating system of a host. Sizes are in bytes. Facts that
+// could not be gathered are left empty.
+type HostFacts struct {
+	HostID       uint               `json:"host_id"`
+	GatheredAt   time.Time          `json:"gathered_at"`
+	Hostname     string             `json:"hostname"`
+	Kernel       string             `json:"kernel"`
+	Arch         string             `json:"arch"`
+	OS           OSFacts            `json:"os"`
+	CPU          CPUFacts           `json:"cpu"`
+	Memory       MemoryFacts        `json:"memory"`
+	Swap         SwapFacts          `json:"swap"`
+	BlockDevices []BlockDevice      `json:"block_devices"`
+	Filesystems  []Filesystem       `json:"filesystems"`
+	Interfaces   []NetworkInterface `json:"interfaces"`
+	// SELinux is enforcing, permissive or disabled, empty when SELinux is not available.
+	SELinux string `json:"selinux"`
+	// AppArmor is enabled or disabled, empty when AppArmor is not available.
+	AppArmor string        `json:"apparmor"`
+	Firewall FirewallFacts `json:"firewall"`
+	TimeSync TimeSyncFacts `json:"time_sync"`
+}
+
+// OSFacts come from /etc/os-release.
+type OSFacts struct {
+	ID         string `json:"id"`
+	Version    string `json:"version"`
+	PrettyName string `json:"pretty_name"`
+}
+
+type CPUFacts struct {
+	Model string `json:"model"`
+	Cores int    `json:"cores"`
+}
+
+type MemoryFacts struct {
+	Total     int64 `json:"total"`
+	Available int64 `json:"available"`
+}
+
+type SwapFacts struct {
+	Total int64 `json:"total"`
+	Used  int64 `json:"used"`
+}
+
+// BlockDevice is a device as listed by lsblk, with its partitions and holders as children.
+type BlockDevice struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Size       int64         `json:"size"`
+	Model      string        `json:"model,omitempty"`
+	Rotational bool          `json:"rotational"`
+	ReadOnly   bool          `json:"read_only"`
+	FSType     string        `json:"fs_type,omitempty"`
+	Mountpoint string        `json:"mountpoint,omitempty"`
+	Children   []BlockDevice `json:"children,omitempty"`
+}
+
+// Filesystem is a mounted filesystem. Pseudo filesystems such as tmpfs and overlay are left out.
+type Filesystem struct {
+	Source     string `json:"source"`
+	Type       string `json:"type"`
+	Mountpoint string `json:"mountpoint"`
+	Size       int64  `json:"size"`
+	Used       int64  `json:"used"`
+	Available  int64  `json:"available"`
+}
+
+// NetworkInterface is a network interface with its addresses in CIDR notation.
+type NetworkInterface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac,omitempty"`
+	MTU       int      `json:"mtu"`
+	State     string   `json:"state"`
+	Addresses []string `json:"addresses"`
+}
+
+// FirewallFacts name the firewall service that is running, if any.
+type FirewallFacts struct {
+	Service string `json:"service,omitempty"`
+	Active  bool   `json:"active"`
+}
+
+// TimeSyncFacts name the time synchronization service that is running, if any, and whether the clock
+// is synchronized.
+type TimeSyncFacts struct {
+	Service      string `json:"service,omitempty"`
+	Active       bool   `json:"active"`
+	Synchronized bool   `json:"synchronized"`
+}
+
+// HostFactsRecord stores the last facts gathered from a cluster host as JSON.
+type HostFactsRecord struct {
+	gorm.Model
+	HostID     uint `gorm:"not null;unique_index"`
+	GatheredAt time.Time
+	Facts      string `gorm:"type:mediumtext"`
+}
@@ -14,4 +14,30 @@ type Host struct {
 	PrivateKey      string
 	AuthMethods     []ssh.AuthMethod
 	IsDeleted       bool
+	JumpHosts       []JumpHost
+	Become          Become
+}
+
+// JumpHost is a gateway on the way to a host. Connections go through the jump hosts of a host in order.
+type JumpHost struct {
+	Address    string
+	Port       int32
+	User       string
+	Password   string
+	PrivateKey string
+}
+
+const (
+	BecomeNone           = "none"
+	BecomeSudo           = "sudo"
+	BecomeSudoNoPassword = "sudo_nopasswd"
+	BecomeSu             = "su"
+	BecomeDoas           = "doas"
+)
+
+// Become is how commands that need root are escalated on a host whose SSH user is not root.
+// An empty Method means sudo. Password defaults to the SSH password of the host.
+type Become struct {
+	Method   string
+	Password string
 }
@@ -0,0 +1,40 @@
+package entity
+
+import "github.com/jinzhu/gorm"
+
+const (
+	HostKeyModeInsecure   = "insecure"
+	HostKeyModeTOFU       = "tofu"
+	HostKeyModeStrict     = "strict"
+	HostKeyModeKnownHosts = "known_hosts"
+)
+
+const (
+	HostKeyTrusted = "trusted"
+	HostKeyPending = "pending"
+	HostKeyRevoked = "revoked"
+)
+
+const (
+	HostKeySourceTOFU       = "tofu"
+	HostKeySourceKnownHosts = "known_hosts"
+	HostKeySourceSeen       = "seen"
+)
+
+// HostKey is an SSH host key presented by a host. Host is in known_hosts form, e.g. 10.0.0.1 or [10.0.0.1]:2222.
+// Only trusted keys are accepted; keys seen for the first time in strict mode or replacing a trusted key
+// are kept as pending until approved.
+type HostKey struct {
+	gorm.Model
+	Host        string `json:"host" gorm:"not null;index"`
+	KeyType     string `json:"key_type"`
+	Fingerprint string `json:"fingerprint" gorm:"not null"`
+	PublicKey   string `json:"public_key" gorm:"type:text"`
+	Status      string `json:"status" gorm:"not null"`
+	Source      string `json:"source"`
+}
+
+// KnownHostsImport carries the content of a known_hosts file.
+type KnownHostsImport struct {
+	KnownHosts string
+}
@@ -0,0 +1,60 @@
+package entity
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+const (
+	JobCreateCluster = "create-cluster"
+	JobDeleteCluster = "delete-cluster"
+	JobAddNodes      = "add-nodes"
+	JobDeleteNodes   = "delete-nodes"
+	JobRenewCerts    = "renew-certs"
+	JobApplyPlan     = "apply-plan"
+	JobUpgrade       = "upgrade-cluster"
+)
+
+// Job records a long-running operation executed against a cluster.
+type Job struct {
+	gorm.Model
+	Type      string     `json:"type" gorm:"not null"`
+	ClusterID uint       `json:"cluster_id" gorm:"index"`
+	Status    string     `json:"status" gorm:"not null;index"`
+	Params    string     `json:"params" gorm:"type:text"`
+	Error     string     `json:"error" gorm:"type:text"`
+	StartedAt *time.Time `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+}
+
+// JobLog is a single output line produced by a job.
+type JobLog struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	JobID     uint      `json:"job_id" gorm:"not null;index"`
+	Seq       int       `json:"seq"`
+	Message   string    `json:"message" gorm:"type:text"`
+	IsError   bool      `json:"is_error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JobRequest starts an operation on a stored cluster.
+// DrainTimeout limits the drain of each node removed by a delete-nodes job, in seconds.
+// Version is the target of an upgrade-cluster job.
+type JobRequest struct {
+	Type         string
+	Nodes        []string
+	DrainTimeout int
+	Version      string
+}
+
+func (job Job) Finished() bool {
+	return job.Status == JobSucceeded || job.Status == JobFailed || job.Status == JobCancelled
+}
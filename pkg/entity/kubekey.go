@@ -18,34 +18,77 @@ type KubekeyConf struct {
 	KKPath            string
 	TaichuPackagePath string
 	KubernetesVersion string
+	// ControlPlaneDomain is the DNS name of the control-plane endpoint, defaults to DefaultControlPlaneDomain.
+	ControlPlaneDomain string
+	// NetworkPlugin is one of calico, cilium, flannel or kube-ovn, defaults to calico.
+	NetworkPlugin     string
+	EnableMultus      bool
+	EtcdType          string
+	Timezone          string
+	ExtraSANs         []string
+	NamespaceOverride string
+	RegistryMirrors   []string
+	Addons            []Addon
+	// Provisioner selects the backend that installs the cluster, kubekey or kubespray. Defaults to kubekey.
+	Provisioner string
+	Kubespray   KubesprayConf
 }
 
-type KubekeyTemplate struct {
-	ClusterName       string
-	HostList          string
-	EtcdList          string
-	ControlPlaneList  string
-	WorkerList        string
-	NtpServerList     string
-	Registry          string
-	VIPServer         string
-	KubePodsCIDR      string
-	KubeServiceCIDR   string
-	ContainerManager  string
-	ProxyMode         string
-	IPIPMode          string
-	VxlanMode         string
-	KKPath            string
-	TaichuPackagePath string
-	RegistryType      string
-	RegistryUrI       string
-	RegistryUser      string
-	RegistryPassword  string
-	RegistryKeyPath   string
-	RegistryCertPath  string
-	RegistrySkipTLS   bool
-	RegistryPlainHttp bool
-	RegistryNodeName  string
-	KubernetesVersion string
-	InsecureRegistry  string
+const (
+	ProvisionerKubekey   = "kubekey"
+	ProvisionerKubespray = "kubespray"
+)
+
+// KubesprayConf locates kubespray on the bastion and the offline repositories its playbooks download from.
+type KubesprayConf struct {
+	// Path is the kubespray checkout containing cluster.yml.
+	Path string
+	// Image runs the playbooks in this container image instead of the ansible installed on the bastion.
+	Image string
+	// OfflineTemplate is the local offline.yml used as a base for the group vars, defaults to offline.yml of the conf dir.
+	OfflineTemplate string
+	FilesRepo       string
+	YumRepo         string
+	DebianRepo      string
+	UbuntuRepo      string
+}
+
+const (
+	NetworkPluginCalico  = "calico"
+	NetworkPluginCilium  = "cilium"
+	NetworkPluginFlannel = "flannel"
+	NetworkPluginKubeOvn = "kube-ovn"
+)
+
+const (
+	DefaultControlPlaneDomain = "lb.cars.local"
+	DefaultNetworkPlugin      = NetworkPluginCalico
+	DefaultEtcdType           = "kubekey"
+	DefaultTimezone           = "Asia/Shanghai"
+	DefaultNamespaceOverride  = "carsio"
+)
+
+// Addon is an extra workload kk installs once the cluster is up, either from a chart or from manifests.
+type Addon struct {
+	Name      string
+	Namespace string
+	Chart     *AddonChart
+	YamlPaths []string
+}
+
+type AddonChart struct {
+	Name       string
+	Repo       string
+	Path       string
+	Version    string
+	ValuesFile string
+	Values     []string
+}
+
+func IsSupportedNetworkPlugin(plugin string) bool {
+	switch plugin {
+	case NetworkPluginCalico, NetworkPluginCilium, NetworkPluginFlannel, NetworkPluginKubeOvn:
+		return true
+	}
+	return false
 }
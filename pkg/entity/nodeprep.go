@@ -0,0 +1,66 @@
+package entity
+
+const (
+	SELinuxEnforcing  = "enforcing"
+	SELinuxPermissive = "permissive"
+	SELinuxDisabled   = "disabled"
+)
+
+const (
+	FirewallDisabled = "disabled"
+	FirewallOpen     = "open"
+)
+
+const (
+	NodePrepOK      = "ok"
+	NodePrepChanged = "changed"
+	NodePrepDrift   = "drift"
+	NodePrepFailed  = "failed"
+	NodePrepSkipped = "skipped"
+)
+
+// NodePrepConf is the state a node is brought to before Kubernetes is installed on it.
+// Empty fields keep what the node has, except SELinux and Firewall which default to permissive
+// and disabled. OpenPorts, e.g. 6443/tcp, are opened when Firewall is open. Sysctl is applied
+// on top of the settings Kubernetes needs.
+type NodePrepConf struct {
+	Hostname  string
+	Timezone  string
+	SELinux   string
+	Firewall  string
+	OpenPorts []string
+	Sysctl    map[string]string
+}
+
+// NodePrepRequest prepares the hosts of a cluster, all of them when Hosts is empty. With Check
+// nothing is changed and the steps report drift instead. SetHostname sets the hostname of every
+// host to its inventory name, the timezone is the one of the cluster.
+type NodePrepRequest struct {
+	Hosts       []string
+	Check       bool
+	SetHostname bool
+	SELinux     string
+	Firewall    string
+	OpenPorts   []string
+	Sysctl      map[string]string
+	Rollout     Rollout
+}
+
+// NodePrepReport is the outcome of preparing a node. Changed is set when a step changed the node,
+// Drift when a step found it differs from the wanted state in check mode.
+type NodePrepReport struct {
+	Host         string         `json:"host"`
+	Distribution string         `json:"distribution"`
+	Check        bool           `json:"check"`
+	Changed      bool           `json:"changed"`
+	Drift        bool           `json:"drift"`
+	Error        string         `json:"error,omitempty"`
+	Steps        []NodePrepStep `json:"steps"`
+}
+
+// NodePrepStep is the outcome of a step, see NodePrepOK and the other statuses.
+type NodePrepStep struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
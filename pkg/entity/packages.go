@@ -0,0 +1,50 @@
+package entity
+
+const (
+	PackagePresent   = "present"
+	PackageInstalled = "installed"
+	PackageMissing   = "missing"
+	PackageFailed    = "failed"
+)
+
+// PackageConf is what is installed on a node. Repo is the URL of the offline repository, or the
+// path an ISO is mounted at. $ID, $VERSION_ID and $ARCH in it are replaced with the os-release ID
+// and VERSION_ID and the amd64 or arm64 architecture of the node, which is how offline/prepare-repo.sh
+// lays out the file server, e.g. http://10.0.0.1:8080/repository/$ID-$VERSION_ID/$ARCH. Without Repo
+// the repositories the node has are used. Packages replaces the list shipped for the distribution
+// in ListDir, e.g. centos7.packages.
+type PackageConf struct {
+	Repo     string
+	Packages []string
+	ListDir  string
+}
+
+// PackageRequest installs the packages on the hosts of a cluster, all of them when Hosts is empty.
+// With Verify nothing is changed and packages that are not installed are reported missing.
+type PackageRequest struct {
+	Hosts    []string
+	Verify   bool
+	Repo     string
+	Packages []string
+	Rollout  Rollout
+}
+
+// PackageReport is the outcome of installing the packages on a node.
+type PackageReport struct {
+	Host         string          `json:"host"`
+	Distribution string          `json:"distribution"`
+	Manager      string          `json:"manager"`
+	Repo         string          `json:"repo,omitempty"`
+	Verify       bool            `json:"verify"`
+	Error        string          `json:"error,omitempty"`
+	Packages     []PackageStatus `json:"packages"`
+}
+
+// PackageStatus is the state of a package, see PackagePresent and the other statuses. Version is
+// the installed version.
+type PackageStatus struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Version string `json:"version,omitempty"`
+	Message string `json:"message,omitempty"`
+}
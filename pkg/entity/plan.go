@@ -0,0 +1,37 @@
+package entity
+
+// Plan describes what applying a requested configuration to a stored cluster would change.
+// Config is the file the provisioner would write, with secrets masked, which Warnings point out.
+type Plan struct {
+	ClusterID       uint          `json:"cluster_id"`
+	Hash            string        `json:"hash"`
+	AddedNodes      []string      `json:"added_nodes"`
+	RemovedNodes    []string      `json:"removed_nodes"`
+	RoleChanges     []RoleChange  `json:"role_changes"`
+	RegistryChanges []FieldChange `json:"registry_changes"`
+	NetworkChanges  []FieldChange `json:"network_changes"`
+	Warnings        []string      `json:"warnings"`
+	Config          string        `json:"config"`
+}
+
+type RoleChange struct {
+	Node   string   `json:"node"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// PlanApply confirms a plan by its hash. Conf must be the configuration the plan was computed from.
+type PlanApply struct {
+	Hash string
+	Conf KubekeyConf
+}
+
+func (plan Plan) HasNodeChanges() bool {
+	return len(plan.AddedNodes) > 0 || len(plan.RemovedNodes) > 0
+}
@@ -1,22 +1,54 @@
 package entity
 
 type AddHostsParallel struct {
-	Hosts  []Host
-	Record Record
+	Hosts   []Host
+	Record  Record
+	Rollout Rollout
 }
 
 type AddDNSParallel struct {
-	Hosts []Host
-	DNS   string
+	Hosts   []Host
+	DNS     string
+	Rollout Rollout
 }
 
 type CopyFileParallel struct {
 	Hosts    []Host
 	SrcFile  string
 	DestFile string
+	Rollout  Rollout
+}
+
+// Rollout controls how a parallel operation goes through its hosts. Batches are run one after
+// another with sizes like "1" or "10%", the last size repeats. Zero values mean no limit.
+type Rollout struct {
+	Parallelism        int      `json:"parallelism"`
+	Batches            []string `json:"batches"`
+	MaxFailures        int      `json:"max_failures"`
+	MaxFailurePercent  int      `json:"max_failure_percent"`
+	HostTimeoutSeconds int      `json:"host_timeout_seconds"`
 }
 
 type CommandParallel struct {
 	Hosts   []Host
 	Command string
+	Rollout Rollout
+}
+
+// SSHPoolStats describes the connections of the shared SSH pool.
+type SSHPoolStats struct {
+	Connections int                `json:"connections"`
+	Gateways    int                `json:"gateways"`
+	Dials       int64              `json:"dials"`
+	Reconnects  int64              `json:"reconnects"`
+	Evictions   int64              `json:"evictions"`
+	MaxSessions int                `json:"max_sessions"`
+	Hosts       []SSHPoolHostStats `json:"hosts"`
+}
+
+type SSHPoolHostStats struct {
+	Host        string `json:"host"`
+	Sessions    int    `json:"sessions"`
+	IdleSeconds int64  `json:"idle_seconds"`
+	Gateway     string `json:"gateway,omitempty"`
 }
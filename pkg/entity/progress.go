@@ -0,0 +1,33 @@
+package entity
+
+import "time"
+
+const (
+	EventModule   = "module"
+	EventResult   = "result"
+	EventPipeline = "pipeline"
+	EventLog      = "log"
+	EventJob      = "job"
+)
+
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// ProgressEvent is a typed view of a line of provisioner output, sent to clients as a JSON frame.
+// Percent is an estimate based on the number of modules the operation usually runs.
+type ProgressEvent struct {
+	Type      string    `json:"type"`
+	Seq       int       `json:"seq,omitempty"`
+	Pipeline  string    `json:"pipeline,omitempty"`
+	Module    string    `json:"module,omitempty"`
+	Task      string    `json:"task,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Percent   int       `json:"percent"`
+	Message   string    `json:"message"`
+	IsError   bool      `json:"is_error,omitempty"`
+}
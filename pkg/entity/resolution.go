@@ -0,0 +1,47 @@
+package entity
+
+import "github.com/jinzhu/gorm"
+
+const (
+	ResolverResolvConf     = "resolv.conf"
+	ResolverResolved       = "systemd-resolved"
+	ResolverNetworkManager = "NetworkManager"
+)
+
+// NameResolution is the name resolution a cluster wants on its hosts, on top of the inventory hosts
+// and, with a VIP, the control-plane domain which are always resolved. Records are written to /etc/hosts,
+// Nameservers and Searches to the resolver configuration.
+type NameResolution struct {
+	Records     []Record `json:"records"`
+	Nameservers []string `json:"nameservers"`
+	Searches    []string `json:"searches"`
+}
+
+// NameResolutionSyncRequest reconciles the name resolution of the hosts of a cluster, all of them when
+// Hosts is empty. With Check nothing is changed and the differences are reported as drift.
+type NameResolutionSyncRequest struct {
+	Hosts   []string
+	Check   bool
+	Rollout Rollout
+}
+
+// NameResolutionReport is the outcome of reconciling the name resolution of a host. Added, Updated and
+// Removed list the entries of the managed blocks that changed, or would change in check mode.
+type NameResolutionReport struct {
+	Host     string   `json:"host"`
+	Resolver string   `json:"resolver"`
+	Check    bool     `json:"check"`
+	Changed  bool     `json:"changed"`
+	Drift    bool     `json:"drift"`
+	Added    []string `json:"added,omitempty"`
+	Updated  []string `json:"updated,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// NameResolutionRecord stores the name resolution of a cluster as JSON.
+type NameResolutionRecord struct {
+	gorm.Model
+	ClusterID  uint   `gorm:"not null;unique_index"`
+	Resolution string `gorm:"type:text"`
+}
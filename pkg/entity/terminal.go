@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Frame types of the web terminal protocol. The client sends input, resize and ping, the server
+// answers with output, pong, error and a final exit.
+const (
+	TerminalInput  = "input"
+	TerminalResize = "resize"
+	TerminalPing   = "ping"
+	TerminalOutput = "output"
+	TerminalPong   = "pong"
+	TerminalError  = "error"
+	TerminalExit   = "exit"
+)
+
+// TerminalMessage is a frame of the web terminal, sent as a JSON text message. Data carries the
+// keystrokes of input and the text of output and error frames, Cols and Rows the size of resize frames.
+type TerminalMessage struct {
+	Type     string `json:"type"`
+	Data     string `json:"data,omitempty"`
+	Cols     int    `json:"cols,omitempty"`
+	Rows     int    `json:"rows,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+}
+
+// TerminalSession records who opened a web terminal to which host, for audit.
+type TerminalSession struct {
+	gorm.Model
+	User        string     `json:"user" gorm:"not null;index"`
+	ClusterID   uint       `json:"cluster_id" gorm:"not null;index"`
+	Host        string     `json:"host" gorm:"not null"`
+	Address     string     `json:"address"`
+	RemoteAddr  string     `json:"remote_addr"`
+	EndedAt     *time.Time `json:"ended_at"`
+	ExitCode    int        `json:"exit_code"`
+	CloseReason string     `json:"close_reason"`
+	BytesIn     int64      `json:"bytes_in"`
+	BytesOut    int64      `json:"bytes_out"`
+}
@@ -0,0 +1,51 @@
+package entity
+
+import "fmt"
+
+// UpgradeRequest asks for the Kubernetes version a cluster should end up with.
+type UpgradeRequest struct {
+	Version string
+}
+
+// UpgradePlan is the rollout computed for an upgrade. Steps are the versions kk is run with,
+// one minor version at a time. A plan with deprecated APIs in use is blocked.
+type UpgradePlan struct {
+	ClusterID      uint            `json:"cluster_id"`
+	CurrentVersion string          `json:"current_version"`
+	TargetVersion  string          `json:"target_version"`
+	Steps          []string        `json:"steps"`
+	DeprecatedAPIs []DeprecatedAPI `json:"deprecated_apis"`
+	Blocked        bool            `json:"blocked"`
+}
+
+// DeprecatedAPI is an API requested since the API server started that is removed on the way to the target version.
+type DeprecatedAPI struct {
+	Group          string `json:"group"`
+	Version        string `json:"version"`
+	Resource       string `json:"resource"`
+	Subresource    string `json:"subresource"`
+	RemovedRelease string `json:"removed_release"`
+}
+
+func (api DeprecatedAPI) String() string {
+	gv := api.Version
+	if api.Group != "" {
+		gv = api.Group + "/" + api.Version
+	}
+	resource := api.Resource
+	if api.Subresource != "" {
+		resource = resource + "/" + api.Subresource
+	}
+	return fmt.Sprintf("%s %s (removed in %s)", gv, resource, api.RemovedRelease)
+}
+
+// ClusterHealth lists what keeps a cluster from being healthy at a given version.
+type ClusterHealth struct {
+	UnreadyNodes  []string `json:"unready_nodes"`
+	OutdatedNodes []string `json:"outdated_nodes"`
+	UnhealthyPods []string `json:"unhealthy_pods"`
+}
+
+func (health ClusterHealth) Healthy() bool {
+	return len(health.UnreadyNodes) == 0 && len(health.OutdatedNodes) == 0 && len(health.UnhealthyPods) == 0
+}
@@ -0,0 +1,39 @@
+package entity
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ValidationReport is the outcome of the pre-flight checks run against a cluster spec.
+type ValidationReport struct {
+	Passed bool             `json:"passed"`
+	Items  []ValidationItem `json:"items"`
+}
+
+// ValidationItem is a single finding. Host is empty for checks on the spec itself.
+type ValidationItem struct {
+	Check    string `json:"check"`
+	Host     string `json:"host,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// PreflightRequirements are the minimum resources and operating systems a node must have.
+type PreflightRequirements struct {
+	MinCPU       int
+	MinMemoryMB  int
+	MinDiskGB    int
+	SupportedOS  []string
+	ManifestDir  string
+	SkipHostScan bool
+}
+
+func (report *ValidationReport) Error(check, host, message string) {
+	report.Items = append(report.Items, ValidationItem{Check: check, Host: host, Severity: SeverityError, Message: message})
+	report.Passed = false
+}
+
+func (report *ValidationReport) Warning(check, host, message string) {
+	report.Items = append(report.Items, ValidationItem{Check: check, Host: host, Severity: SeverityWarning, Message: message})
+}
@@ -0,0 +1,231 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/db"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"sync"
+	"time"
+)
+
+// Func is the body of a job. It must stop when ctx is cancelled and write its output to logChan.
+type Func func(ctx context.Context, logChan chan utils.LogEntry) error
+
+type Manager struct {
+	mutex   sync.Mutex
+	running map[uint]*runningJob
+}
+
+type runningJob struct {
+	mutex       sync.Mutex
+	job         *entity.Job
+	cancel      context.CancelFunc
+	logs        []entity.JobLog
+	subscribers map[chan entity.JobLog]struct{}
+	finished    bool
+}
+
+var (
+	manager     *Manager
+	managerOnce sync.Once
+)
+
+var ErrJobNotRunning = errors.New("job is not running")
+
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		manager = &Manager{
+			running: make(map[uint]*runningJob),
+		}
+	})
+	return manager
+}
+
+// Recover marks the jobs interrupted by a restart as failed.
+func (m *Manager) Recover() error {
+	return db.FailUnfinishedJobs("interrupted by server restart")
+}
+
+// Running tells whether a job of jobType is running for the cluster.
+func (m *Manager) Running(jobType string, clusterID uint) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, rj := range m.running {
+		if rj.job.Type == jobType && rj.job.ClusterID == clusterID {
+			return true
+		}
+	}
+	return false
+}
+
+// Submit persists a new job and runs fn in the background.
+func (m *Manager) Submit(jobType string, clusterID uint, params string, fn Func) (*entity.Job, error) {
+	job := &entity.Job{
+		Type:      jobType,
+		ClusterID: clusterID,
+		Status:    entity.JobPending,
+		Params:    params,
+	}
+	if err := db.CreateJob(job); err != nil {
+		logger.GetLogger().Errorf("Failed to create job %s: %s", jobType, err.Error())
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rj := &runningJob{
+		job:         job,
+		cancel:      cancel,
+		subscribers: make(map[chan entity.JobLog]struct{}),
+	}
+	m.mutex.Lock()
+	m.running[job.ID] = rj
+	m.mutex.Unlock()
+	snapshot := *job
+	go m.run(ctx, rj, fn)
+	return &snapshot, nil
+}
+
+func (m *Manager) run(ctx context.Context, rj *runningJob, fn Func) {
+	defer func() {
+		m.mutex.Lock()
+		delete(m.running, rj.job.ID)
+		m.mutex.Unlock()
+	}()
+
+	now := time.Now()
+	rj.mutex.Lock()
+	rj.job.Status = entity.JobRunning
+	rj.job.StartedAt = &now
+	m.save(rj.job)
+	rj.mutex.Unlock()
+
+	logChan := make(chan utils.LogEntry)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for entry := range logChan {
+			rj.append(entry)
+		}
+	}()
+
+	err := m.call(ctx, fn, logChan)
+	close(logChan)
+	<-done
+
+	end := time.Now()
+	rj.mutex.Lock()
+	defer rj.mutex.Unlock()
+	rj.job.EndedAt = &end
+	switch {
+	case ctx.Err() != nil:
+		rj.job.Status = entity.JobCancelled
+		rj.job.Error = "cancelled by user"
+	case err != nil:
+		rj.job.Status = entity.JobFailed
+		rj.job.Error = err.Error()
+	default:
+		rj.job.Status = entity.JobSucceeded
+	}
+	m.save(rj.job)
+	rj.finished = true
+	for sub := range rj.subscribers {
+		close(sub)
+	}
+	rj.subscribers = nil
+	rj.cancel()
+	logger.GetLogger().Infof("Job %d (%s) finished with status %s", rj.job.ID, rj.job.Type, rj.job.Status)
+}
+
+// call runs fn and turns a panic into an error so that a broken job never stays running.
+func (m *Manager) call(ctx context.Context, fn Func, logChan chan utils.LogEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.GetLogger().Errorf("Recovered from panic in job: %v", r)
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(ctx, logChan)
+}
+
+func (m *Manager) save(job *entity.Job) {
+	if err := db.UpdateJob(job); err != nil {
+		logger.GetLogger().Errorf("Failed to update job %d: %s", job.ID, err.Error())
+	}
+}
+
+func (rj *runningJob) append(entry utils.LogEntry) {
+	rj.mutex.Lock()
+	defer rj.mutex.Unlock()
+	log := entity.JobLog{
+		JobID:     rj.job.ID,
+		Seq:       len(rj.logs) + 1,
+		Message:   entry.Message,
+		IsError:   entry.IsError,
+		CreatedAt: time.Now(),
+	}
+	if err := db.CreateJobLog(&log); err != nil {
+		logger.GetLogger().Errorf("Failed to store log of job %d: %s", rj.job.ID, err.Error())
+	}
+	rj.logs = append(rj.logs, log)
+	for sub := range rj.subscribers {
+		select {
+		case sub <- log:
+		default:
+			logger.GetLogger().Warnf("Subscriber of job %d is too slow, dropping line %d", rj.job.ID, log.Seq)
+		}
+	}
+}
+
+// Cancel stops a running job.
+func (m *Manager) Cancel(id uint) error {
+	m.mutex.Lock()
+	rj, ok := m.running[id]
+	m.mutex.Unlock()
+	if !ok {
+		return ErrJobNotRunning
+	}
+	rj.cancel()
+	return nil
+}
+
+// Attach returns the log produced so far and a channel with the lines that follow.
+// The channel is closed when the job finishes; detach must be called when the caller stops reading.
+func (m *Manager) Attach(id uint) ([]entity.JobLog, <-chan entity.JobLog, func(), error) {
+	m.mutex.Lock()
+	rj, ok := m.running[id]
+	m.mutex.Unlock()
+	if !ok {
+		if _, err := db.GetJob(id); err != nil {
+			return nil, nil, nil, err
+		}
+		logs, err := db.ListJobLogs(id)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		live := make(chan entity.JobLog)
+		close(live)
+		return logs, live, func() {}, nil
+	}
+	rj.mutex.Lock()
+	defer rj.mutex.Unlock()
+	history := make([]entity.JobLog, len(rj.logs))
+	copy(history, rj.logs)
+	live := make(chan entity.JobLog, 1024)
+	if rj.finished {
+		close(live)
+		return history, live, func() {}, nil
+	}
+	rj.subscribers[live] = struct{}{}
+	detach := func() {
+		rj.mutex.Lock()
+		defer rj.mutex.Unlock()
+		if _, ok := rj.subscribers[live]; ok {
+			delete(rj.subscribers, live)
+			close(live)
+		}
+	}
+	return history, live, detach, nil
+}
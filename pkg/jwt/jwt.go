@@ -58,3 +58,30 @@ func ExtractTokenMetadata(r *http.Request) (*entity.KubekeyConf, error) {
 
 	return nil, errors.New("token is invalid")
 }
+
+// ExtractUsername verifies the token of r and returns the user it was issued to. Browsers cannot set
+// headers on websocket requests, so the token may also be passed as the token query parameter.
+func ExtractUsername(r *http.Request) (string, error) {
+	signKey := viper.GetString("jwt.secret")
+	if signKey == "" {
+		return "", errors.New("jwt.secret is not configured")
+	}
+	tokenString := ExtractToken(r)
+	if tokenString == "" {
+		tokenString = r.URL.Query().Get("token")
+	}
+	token, err := VerifyToken(signKey, tokenString)
+	if err != nil {
+		return "", err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", errors.New("token is invalid")
+	}
+	for _, claim := range []string{"preferred_username", "username", "sub"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			return name, nil
+		}
+	}
+	return "", errors.New("token does not name a user")
+}
@@ -42,6 +42,8 @@ func configWebsocketRouter(rg *gin.RouterGroup) {
 	rg.GET("/cluster/delete", controller.DeleteCluster)
 	rg.GET("/cluster/nodes/add", controller.AddNodeToCluster)
 	rg.GET("/cluster/node/delete", controller.DeleteNodeFromCluster)
+	rg.GET("/jobs/:id/attach", controller.AttachJob)
+	rg.GET("/clusters/:id/hosts/:host/terminal", aop.UserAuth(), controller.OpenTerminal)
 }
 
 func configHttpRouter(rg *gin.RouterGroup, version string) {
@@ -67,6 +69,7 @@ func configHttpRouter(rg *gin.RouterGroup, version string) {
 	rg.POST("/server/hostsparallel", controller.AddHostsParallel)
 	rg.POST("/server/dnsparallel", controller.AddDNSParallel)
 	rg.POST("/server/execmdparallel", controller.ExecuteCommandParallel)
+	rg.GET("/server/pool/stats", controller.GetPoolStats)
 	rg.POST("/server/password/expired", controller.ChangeExpiredPassword)
 	rg.POST("/server/checkpassword", controller.CheckPasswordInfo)
 	rg.POST("/server/updatepassword", controller.UpdatePassword)
@@ -75,4 +78,42 @@ func configHttpRouter(rg *gin.RouterGroup, version string) {
 	rg.POST("/kubernetes/apply", controller.ApplyYAMLs)
 	rg.POST("/kubernetes/helm/repo", controller.AddRepo)
 	rg.POST("/kubernetes/helm/chart", controller.InstallChart)
+	rg.POST("/clusters", controller.CreateClusterInventory)
+	rg.POST("/clusters/validate", controller.ValidateKubekeyConf)
+	rg.GET("/clusters", controller.ListClusterInventories)
+	rg.GET("/clusters/:id", controller.GetClusterInventory)
+	rg.PUT("/clusters/:id", controller.UpdateClusterInventory)
+	rg.DELETE("/clusters/:id", controller.DeleteClusterInventory)
+	rg.POST("/clusters/:id/validate", controller.ValidateClusterInventory)
+	rg.POST("/clusters/:id/prepare", controller.PrepareClusterNodes)
+	rg.POST("/clusters/:id/packages", controller.InstallClusterPackages)
+	rg.GET("/clusters/:id/resolution", controller.GetClusterNameResolution)
+	rg.PUT("/clusters/:id/resolution", controller.SetClusterNameResolution)
+	rg.POST("/clusters/:id/resolution/sync", controller.SyncClusterNameResolution)
+	rg.POST("/clusters/:id/plan", controller.PlanCluster)
+	rg.POST("/clusters/:id/apply", controller.ApplyClusterPlan)
+	rg.POST("/clusters/:id/upgrade/plan", controller.PlanClusterUpgrade)
+	rg.POST("/clusters/:id/upgrade", controller.UpgradeCluster)
+	rg.GET("/hostkeys", controller.ListHostKeys)
+	rg.POST("/hostkeys/import", controller.ImportKnownHosts)
+	rg.POST("/hostkeys/:id/approve", controller.ApproveHostKey)
+	rg.POST("/hostkeys/:id/revoke", controller.RevokeHostKey)
+	rg.POST("/clusters/:id/hosts", controller.AddClusterHost)
+	rg.PUT("/clusters/:id/hosts/:hostId", controller.UpdateClusterHost)
+	rg.DELETE("/clusters/:id/hosts/:hostId", controller.DeleteClusterHost)
+	rg.GET("/hosts/:id/facts", controller.GetHostFacts)
+	rg.POST("/hosts/:id/facts/refresh", controller.RefreshHostFacts)
+	rg.GET("/hosts/:id/disks", controller.ListUnusedDisks)
+	rg.POST("/hosts/:id/disks", controller.ProvisionDisk)
+	rg.POST("/hosts/:id/disks/grow", controller.GrowDisk)
+	rg.POST("/clusters/:id/jobs", controller.SubmitClusterJob)
+	rg.GET("/clusters/:id/certs", controller.ListClusterCerts)
+	rg.GET("/clusters/:id/terminal/sessions", controller.ListTerminalSessions)
+	rg.POST("/clusters/:id/certs/check", controller.CheckClusterCerts)
+	rg.POST("/clusters/:id/certs/renew", controller.RenewClusterCerts)
+	rg.GET("/certs/expiring", controller.ListExpiringCerts)
+	rg.GET("/jobs", controller.ListJobs)
+	rg.GET("/jobs/:id", controller.GetJob)
+	rg.GET("/jobs/:id/logs", controller.GetJobLogs)
+	rg.POST("/jobs/:id/cancel", controller.CancelJob)
 }
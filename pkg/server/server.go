@@ -4,14 +4,21 @@ import (
 	"context"
 	"fmt"
 	"github.com/spf13/viper"
+	"github.com/whoisfisher/mykubespray/pkg/db"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/httpx"
+	"github.com/whoisfisher/mykubespray/pkg/job"
 	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/migrate"
 	"github.com/whoisfisher/mykubespray/pkg/router"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
+	"time"
 )
 
 type Server struct {
@@ -87,6 +94,15 @@ func (server Server) initialize() (func(), error) {
 	fns := Functions{}
 	_, cancel := context.WithCancel(context.Background())
 	fns.Add(cancel)
+	if err := server.initDatabase(); err != nil {
+		logger.GetLogger().Errorf("Failed to initialize database: %s", err.Error())
+		return nil, err
+	}
+	if err := server.initHostKeys(); err != nil {
+		logger.GetLogger().Errorf("Failed to initialize host key verification: %s", err.Error())
+		return nil, err
+	}
+	server.initSSHPool()
 	route := router.New(server.Version)
 	go func() {
 		err := http.ListenAndServe(":6060", nil)
@@ -100,6 +116,73 @@ func (server Server) initialize() (func(), error) {
 	return fns.Ret(), nil
 }
 
+func (server Server) initDatabase() error {
+	host := viper.GetString("db.host")
+	if host == "" {
+		logger.GetLogger().Warnf("Database is not configured, cluster inventory is unavailable")
+		return nil
+	}
+	// The passwords of the inventory are stored encrypted with encrypt.key.
+	if err := utils.CheckEncryptKey(); err != nil {
+		return err
+	}
+	migratePhase := &migrate.InitMigrateDBPhase{
+		Host:     host,
+		Port:     viper.GetInt("db.port"),
+		Name:     viper.GetString("db.name"),
+		User:     viper.GetString("db.user"),
+		Password: viper.GetString("db.password"),
+	}
+	if err := migratePhase.Init(); err != nil {
+		return fmt.Errorf("phase %s failed: %w", migratePhase.PhaseName(), err)
+	}
+	dbPhase := &db.InitDBPhase{
+		Host:         host,
+		Port:         viper.GetInt("db.port"),
+		Name:         viper.GetString("db.name"),
+		User:         viper.GetString("db.user"),
+		Password:     viper.GetString("db.password"),
+		MaxOpenConns: viper.GetInt("db.max_open_conns"),
+		MaxIdleConns: viper.GetInt("db.max_idle_conns"),
+	}
+	if err := dbPhase.Init(); err != nil {
+		return fmt.Errorf("phase %s failed: %w", dbPhase.PhaseName(), err)
+	}
+	if err := job.GetManager().Recover(); err != nil {
+		return fmt.Errorf("failed to recover jobs: %w", err)
+	}
+	return nil
+}
+
+// initHostKeys sets up SSH host key verification, persisting the keys in the database when there is one.
+func (server Server) initHostKeys() error {
+	viper.SetDefault("ssh.host_key_mode", entity.HostKeyModeTOFU)
+	viper.SetDefault("ssh.known_hosts_file", "~/.ssh/known_hosts")
+	knownHostsFile := viper.GetString("ssh.known_hosts_file")
+	if strings.HasPrefix(knownHostsFile, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		knownHostsFile = filepath.Join(home, knownHostsFile[2:])
+	}
+	var store utils.HostKeyStore = utils.NewMemoryHostKeyStore()
+	if viper.GetString("db.host") != "" {
+		store = db.HostKeyStore{}
+	}
+	return utils.ConfigureHostKeys(viper.GetString("ssh.host_key_mode"), knownHostsFile, store)
+}
+
+// initSSHPool applies the ssh.* dial and pool settings to the shared connection pool.
+func (server Server) initSSHPool() {
+	utils.ConfigureSSHDialTimeout(time.Duration(viper.GetInt("ssh.dial_timeout_seconds")) * time.Second)
+	utils.ConfigureSSHPool(utils.PoolOptions{
+		KeepaliveInterval: time.Duration(viper.GetInt("ssh.keepalive_interval_seconds")) * time.Second,
+		IdleTimeout:       time.Duration(viper.GetInt("ssh.idle_timeout_seconds")) * time.Second,
+		MaxSessions:       viper.GetInt("ssh.max_sessions"),
+	})
+}
+
 type Functions struct {
 	List []func()
 }
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"github.com/whoisfisher/mykubespray/pkg/db"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"time"
+)
+
+type CertService interface {
+	Check(ctx context.Context, clusterID uint) ([]entity.ClusterCert, error)
+	List(clusterID uint) ([]entity.ClusterCert, error)
+	ListExpiring(days int) ([]entity.ClusterCert, error)
+	Renew(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error
+}
+
+type certService struct {
+	kubekeyService KubekeyService
+}
+
+func NewCertService() certService {
+	return certService{
+		kubekeyService: NewKubekeyService(),
+	}
+}
+
+// Check runs kk against the cluster and stores the result for ListExpiring.
+func (cs certService) Check(ctx context.Context, clusterID uint) ([]entity.ClusterCert, error) {
+	certs, err := cs.kubekeyService.CheckCertExpiration(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ReplaceClusterCerts(clusterID, certs); err != nil {
+		logger.GetLogger().Errorf("Failed to store certificates of cluster %d: %s", clusterID, err.Error())
+		return nil, err
+	}
+	return certs, nil
+}
+
+// List returns the certificates recorded by the last check of a cluster.
+func (cs certService) List(clusterID uint) ([]entity.ClusterCert, error) {
+	certs, err := db.ListClusterCerts(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	return withResidualDays(certs), nil
+}
+
+// ListExpiring returns the certificates of all clusters that expire within days, based on their last check.
+func (cs certService) ListExpiring(days int) ([]entity.ClusterCert, error) {
+	certs, err := db.ListCertsExpiringBefore(time.Now().AddDate(0, 0, days))
+	if err != nil {
+		return nil, err
+	}
+	clusters, err := db.ListClusters()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string)
+	for _, cluster := range clusters {
+		names[cluster.ID] = cluster.Name
+	}
+	for i := range certs {
+		certs[i].ClusterName = names[certs[i].ClusterID]
+	}
+	return withResidualDays(certs), nil
+}
+
+// Renew renews the certificates and refreshes the stored expiration dates.
+func (cs certService) Renew(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error {
+	if err := cs.kubekeyService.RenewCerts(ctx, clusterID, logChan); err != nil {
+		return err
+	}
+	logChan <- utils.LogEntry{Message: "Checking certificate expiration after renewal"}
+	certs, err := cs.Check(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		logChan <- utils.LogEntry{Message: cert.Name + " on " + cert.Node + " expires " + cert.ExpiresAt.Format(time.RFC3339)}
+	}
+	return nil
+}
+
+func withResidualDays(certs []entity.ClusterCert) []entity.ClusterCert {
+	now := time.Now()
+	for i := range certs {
+		certs[i].ResidualDays = utils.ResidualDays(certs[i].ExpiresAt, now)
+	}
+	return certs
+}
@@ -0,0 +1,509 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/db"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"strings"
+)
+
+type ClusterService interface {
+	CreateCluster(conf entity.KubekeyConf) (*entity.Cluster, error)
+	ListClusters() ([]entity.Cluster, error)
+	GetCluster(id uint) (*entity.Cluster, error)
+	UpdateCluster(id uint, conf entity.KubekeyConf) (*entity.Cluster, error)
+	DeleteCluster(id uint) error
+	AddHost(clusterID uint, conf entity.ClusterHostConf) (*entity.ClusterHost, error)
+	UpdateHost(clusterID, hostID uint, conf entity.ClusterHostConf) (*entity.ClusterHost, error)
+	DeleteHost(clusterID, hostID uint) error
+	GetKubekeyConf(id uint) (*entity.KubekeyConf, error)
+}
+
+type clusterService struct {
+}
+
+func NewClusterService() clusterService {
+	return clusterService{}
+}
+
+func (cs clusterService) CreateCluster(conf entity.KubekeyConf) (*entity.Cluster, error) {
+	cluster, err := toCluster(conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.CreateCluster(cluster); err != nil {
+		logger.GetLogger().Errorf("Failed to create cluster %s: %s", conf.ClusterName, err.Error())
+		return nil, err
+	}
+	return cluster, nil
+}
+
+func (cs clusterService) ListClusters() ([]entity.Cluster, error) {
+	return db.ListClusters()
+}
+
+func (cs clusterService) GetCluster(id uint) (*entity.Cluster, error) {
+	return db.GetCluster(id)
+}
+
+func (cs clusterService) UpdateCluster(id uint, conf entity.KubekeyConf) (*entity.Cluster, error) {
+	current, err := db.GetCluster(id)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := toCluster(conf)
+	if err != nil {
+		return nil, err
+	}
+	cluster.Model = current.Model
+	if cluster.RegistryPassword == "" {
+		cluster.RegistryPassword = current.RegistryPassword
+	}
+	for i := range cluster.Hosts {
+		for _, host := range current.Hosts {
+			if host.Name != cluster.Hosts[i].Name {
+				continue
+			}
+			if cluster.Hosts[i].Password == "" {
+				cluster.Hosts[i].Password = host.Password
+			}
+			if cluster.Hosts[i].BecomePassword == "" {
+				cluster.Hosts[i].BecomePassword = host.BecomePassword
+			}
+			cluster.Hosts[i].JumpHosts, err = keepJumpHostPasswords(cluster.Hosts[i].JumpHosts, host.JumpHosts)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := db.UpdateCluster(cluster); err != nil {
+		logger.GetLogger().Errorf("Failed to update cluster %d: %s", id, err.Error())
+		return nil, err
+	}
+	return cluster, nil
+}
+
+func (cs clusterService) DeleteCluster(id uint) error {
+	return db.DeleteCluster(id)
+}
+
+func (cs clusterService) AddHost(clusterID uint, conf entity.ClusterHostConf) (*entity.ClusterHost, error) {
+	if _, err := db.GetCluster(clusterID); err != nil {
+		return nil, err
+	}
+	host, err := toClusterHost(conf.Host, conf.Roles)
+	if err != nil {
+		return nil, err
+	}
+	host.ClusterID = clusterID
+	if err := db.CreateClusterHost(host); err != nil {
+		logger.GetLogger().Errorf("Failed to add host %s to cluster %d: %s", conf.Host.Name, clusterID, err.Error())
+		return nil, err
+	}
+	return host, nil
+}
+
+func (cs clusterService) UpdateHost(clusterID, hostID uint, conf entity.ClusterHostConf) (*entity.ClusterHost, error) {
+	current, err := db.GetClusterHost(clusterID, hostID)
+	if err != nil {
+		return nil, err
+	}
+	host, err := toClusterHost(conf.Host, conf.Roles)
+	if err != nil {
+		return nil, err
+	}
+	host.Model = current.Model
+	host.ClusterID = clusterID
+	if conf.Host.Password == "" {
+		host.Password = current.Password
+	}
+	if conf.Host.Become.Password == "" {
+		host.BecomePassword = current.BecomePassword
+	}
+	host.JumpHosts, err = keepJumpHostPasswords(host.JumpHosts, current.JumpHosts)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.UpdateClusterHost(host); err != nil {
+		logger.GetLogger().Errorf("Failed to update host %d of cluster %d: %s", hostID, clusterID, err.Error())
+		return nil, err
+	}
+	return host, nil
+}
+
+func (cs clusterService) DeleteHost(clusterID, hostID uint) error {
+	return db.DeleteClusterHost(clusterID, hostID)
+}
+
+// GetKubekeyConf loads a stored cluster and converts it back into the configuration kk expects.
+func (cs clusterService) GetKubekeyConf(id uint) (*entity.KubekeyConf, error) {
+	cluster, err := db.GetCluster(id)
+	if err != nil {
+		return nil, err
+	}
+	return toKubekeyConf(cluster)
+}
+
+func toCluster(conf entity.KubekeyConf) (*entity.Cluster, error) {
+	if conf.ClusterName == "" {
+		return nil, fmt.Errorf("cluster name cannot be empty")
+	}
+	if conf.NetworkPlugin != "" && !entity.IsSupportedNetworkPlugin(conf.NetworkPlugin) {
+		return nil, fmt.Errorf("unsupported network plugin %s", conf.NetworkPlugin)
+	}
+	switch conf.Provisioner {
+	case "", entity.ProvisionerKubekey:
+	case entity.ProvisionerKubespray:
+		if conf.Kubespray.Path == "" {
+			return nil, fmt.Errorf("kubespray path cannot be empty")
+		}
+	default:
+		return nil, fmt.Errorf("unknown provisioner %s", conf.Provisioner)
+	}
+	addons, err := json.Marshal(conf.Addons)
+	if err != nil {
+		return nil, err
+	}
+	cluster := &entity.Cluster{
+		Name:               conf.ClusterName,
+		VIPServer:          conf.VIPServer,
+		KubePodsCIDR:       conf.KubePodsCIDR,
+		KubeServiceCIDR:    conf.KubeServiceCIDR,
+		ContainerManager:   conf.ContainerManager,
+		ProxyMode:          conf.ProxyMode,
+		IPIPMode:           conf.IPIPMode,
+		VxlanMode:          conf.VxlanMode,
+		KKPath:             conf.KKPath,
+		TaichuPackagePath:  conf.TaichuPackagePath,
+		KubernetesVersion:  conf.KubernetesVersion,
+		NtpServers:         strings.Join(conf.NtpServers, ","),
+		ControlPlaneDomain: conf.ControlPlaneDomain,
+		NetworkPlugin:      conf.NetworkPlugin,
+		EnableMultus:       conf.EnableMultus,
+		EtcdType:           conf.EtcdType,
+		Timezone:           conf.Timezone,
+		ExtraSANs:          strings.Join(conf.ExtraSANs, ","),
+		NamespaceOverride:  conf.NamespaceOverride,
+		RegistryMirrors:    strings.Join(conf.RegistryMirrors, ","),
+		Addons:             string(addons),
+		Provisioner:        conf.Provisioner,
+		KubesprayPath:      conf.Kubespray.Path,
+		KubesprayImage:     conf.Kubespray.Image,
+		OfflineTemplate:    conf.Kubespray.OfflineTemplate,
+		FilesRepo:          conf.Kubespray.FilesRepo,
+		YumRepo:            conf.Kubespray.YumRepo,
+		DebianRepo:         conf.Kubespray.DebianRepo,
+		UbuntuRepo:         conf.Kubespray.UbuntuRepo,
+	}
+	registry := conf.Registry
+	for _, host := range conf.Hosts {
+		if host.Registry != nil {
+			registry = *host.Registry
+		}
+	}
+	if err := setClusterRegistry(cluster, registry); err != nil {
+		return nil, err
+	}
+	for _, host := range conf.Hosts {
+		var roles []string
+		if containsString(conf.Etcds, host.Name) {
+			roles = append(roles, entity.RoleEtcd)
+		}
+		if containsString(conf.ContronPlanes, host.Name) {
+			roles = append(roles, entity.RoleControlPlane)
+		}
+		if containsString(conf.Workers, host.Name) {
+			roles = append(roles, entity.RoleWorker)
+		}
+		if host.Registry != nil || (registry.NodeName != "" && registry.NodeName == host.Name) {
+			roles = append(roles, entity.RoleRegistry)
+		}
+		clusterHost, err := toClusterHost(host, roles)
+		if err != nil {
+			return nil, err
+		}
+		cluster.Hosts = append(cluster.Hosts, *clusterHost)
+	}
+	return cluster, nil
+}
+
+func setClusterRegistry(cluster *entity.Cluster, registry entity.Registry) error {
+	cluster.RegistryName = registry.Name
+	cluster.RegistryUrl = registry.Url
+	cluster.RegistryUser = registry.User
+	cluster.RegistryType = registry.Type
+	cluster.RegistryKeyPath = registry.KeyPath
+	cluster.RegistryCertPath = registry.CertPath
+	cluster.RegistrySkipTLS = registry.SkipTLS
+	cluster.RegistryPlainHttp = registry.PlainHttp
+	cluster.InsecureRegistries = strings.Join(registry.InsecureRegistries, ",")
+	if registry.Password != "" {
+		password, err := utils.StringEncrypt(registry.Password)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to encrypt registry password: %s", err.Error())
+			return err
+		}
+		cluster.RegistryPassword = password
+	}
+	return nil
+}
+
+func toClusterHost(host entity.Host, roles []string) (*entity.ClusterHost, error) {
+	if host.Name == "" {
+		return nil, fmt.Errorf("host name cannot be empty")
+	}
+	clusterHost := &entity.ClusterHost{
+		Name:            host.Name,
+		Address:         host.Address,
+		InternalAddress: host.InternalAddress,
+		User:            host.User,
+		Port:            host.Port,
+		Arch:            host.Arch,
+		PrivateKey:      host.PrivateKey,
+		BecomeMethod:    host.Become.Method,
+	}
+	if host.Password != "" {
+		password, err := utils.StringEncrypt(host.Password)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to encrypt password of host %s: %s", host.Name, err.Error())
+			return nil, err
+		}
+		clusterHost.Password = password
+	}
+	switch host.Become.Method {
+	case "", entity.BecomeNone, entity.BecomeSudo, entity.BecomeSudoNoPassword, entity.BecomeSu, entity.BecomeDoas:
+	default:
+		return nil, fmt.Errorf("unknown become method %s for host %s", host.Become.Method, host.Name)
+	}
+	if host.Become.Password != "" {
+		password, err := utils.StringEncrypt(host.Become.Password)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to encrypt become password of host %s: %s", host.Name, err.Error())
+			return nil, err
+		}
+		clusterHost.BecomePassword = password
+	}
+	jumpHosts, err := encodeJumpHosts(host.JumpHosts)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to encode jump hosts of host %s: %s", host.Name, err.Error())
+		return nil, err
+	}
+	clusterHost.JumpHosts = jumpHosts
+	for _, role := range roles {
+		switch role {
+		case entity.RoleEtcd, entity.RoleControlPlane, entity.RoleWorker, entity.RoleRegistry:
+			clusterHost.Roles = append(clusterHost.Roles, entity.ClusterRole{Role: role})
+		default:
+			return nil, fmt.Errorf("unknown role %s for host %s", role, host.Name)
+		}
+	}
+	return clusterHost, nil
+}
+
+func toKubekeyConf(cluster *entity.Cluster) (*entity.KubekeyConf, error) {
+	conf := &entity.KubekeyConf{
+		ClusterName:        cluster.Name,
+		VIPServer:          cluster.VIPServer,
+		KubePodsCIDR:       cluster.KubePodsCIDR,
+		KubeServiceCIDR:    cluster.KubeServiceCIDR,
+		ContainerManager:   cluster.ContainerManager,
+		ProxyMode:          cluster.ProxyMode,
+		IPIPMode:           cluster.IPIPMode,
+		VxlanMode:          cluster.VxlanMode,
+		KKPath:             cluster.KKPath,
+		TaichuPackagePath:  cluster.TaichuPackagePath,
+		KubernetesVersion:  cluster.KubernetesVersion,
+		NtpServers:         splitList(cluster.NtpServers),
+		ControlPlaneDomain: cluster.ControlPlaneDomain,
+		NetworkPlugin:      cluster.NetworkPlugin,
+		EnableMultus:       cluster.EnableMultus,
+		EtcdType:           cluster.EtcdType,
+		Timezone:           cluster.Timezone,
+		ExtraSANs:          splitList(cluster.ExtraSANs),
+		NamespaceOverride:  cluster.NamespaceOverride,
+		RegistryMirrors:    splitList(cluster.RegistryMirrors),
+		Provisioner:        cluster.Provisioner,
+		Kubespray: entity.KubesprayConf{
+			Path:            cluster.KubesprayPath,
+			Image:           cluster.KubesprayImage,
+			OfflineTemplate: cluster.OfflineTemplate,
+			FilesRepo:       cluster.FilesRepo,
+			YumRepo:         cluster.YumRepo,
+			DebianRepo:      cluster.DebianRepo,
+			UbuntuRepo:      cluster.UbuntuRepo,
+		},
+	}
+	if cluster.Addons != "" {
+		if err := json.Unmarshal([]byte(cluster.Addons), &conf.Addons); err != nil {
+			logger.GetLogger().Errorf("Failed to decode addons of cluster %s: %s", cluster.Name, err.Error())
+			return nil, err
+		}
+	}
+	registry := entity.Registry{
+		Name:               cluster.RegistryName,
+		Url:                cluster.RegistryUrl,
+		User:               cluster.RegistryUser,
+		Type:               cluster.RegistryType,
+		KeyPath:            cluster.RegistryKeyPath,
+		CertPath:           cluster.RegistryCertPath,
+		SkipTLS:            cluster.RegistrySkipTLS,
+		PlainHttp:          cluster.RegistryPlainHttp,
+		InsecureRegistries: splitList(cluster.InsecureRegistries),
+	}
+	if cluster.RegistryPassword != "" {
+		password, err := utils.StringDecrypt(cluster.RegistryPassword)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to decrypt registry password: %s", err.Error())
+			return nil, err
+		}
+		registry.Password = password
+	}
+	for _, clusterHost := range cluster.Hosts {
+		host := entity.Host{
+			Name:            clusterHost.Name,
+			Address:         clusterHost.Address,
+			InternalAddress: clusterHost.InternalAddress,
+			User:            clusterHost.User,
+			Port:            clusterHost.Port,
+			Arch:            clusterHost.Arch,
+			PrivateKey:      clusterHost.PrivateKey,
+			Become:          entity.Become{Method: clusterHost.BecomeMethod},
+		}
+		if clusterHost.Password != "" {
+			password, err := utils.StringDecrypt(clusterHost.Password)
+			if err != nil {
+				logger.GetLogger().Errorf("Failed to decrypt password of host %s: %s", clusterHost.Name, err.Error())
+				return nil, err
+			}
+			host.Password = password
+		}
+		if clusterHost.BecomePassword != "" {
+			password, err := utils.StringDecrypt(clusterHost.BecomePassword)
+			if err != nil {
+				logger.GetLogger().Errorf("Failed to decrypt become password of host %s: %s", clusterHost.Name, err.Error())
+				return nil, err
+			}
+			host.Become.Password = password
+		}
+		jumpHosts, err := decodeJumpHosts(clusterHost.JumpHosts)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to decode jump hosts of host %s: %s", clusterHost.Name, err.Error())
+			return nil, err
+		}
+		host.JumpHosts = jumpHosts
+		if clusterHost.HasRole(entity.RoleEtcd) {
+			conf.Etcds = append(conf.Etcds, host.Name)
+		}
+		if clusterHost.HasRole(entity.RoleControlPlane) {
+			conf.ContronPlanes = append(conf.ContronPlanes, host.Name)
+		}
+		if clusterHost.HasRole(entity.RoleWorker) {
+			conf.Workers = append(conf.Workers, host.Name)
+		}
+		if clusterHost.HasRole(entity.RoleRegistry) {
+			registry.NodeName = host.Name
+			hostRegistry := registry
+			host.Registry = &hostRegistry
+		}
+		conf.Hosts = append(conf.Hosts, host)
+	}
+	conf.Registry = registry
+	return conf, nil
+}
+
+// encodeJumpHosts stores the jump hosts of a host as JSON with encrypted passwords.
+func encodeJumpHosts(jumpHosts []entity.JumpHost) (string, error) {
+	if len(jumpHosts) == 0 {
+		return "", nil
+	}
+	encoded := make([]entity.JumpHost, len(jumpHosts))
+	for i, jumpHost := range jumpHosts {
+		if jumpHost.Address == "" {
+			return "", fmt.Errorf("jump host address cannot be empty")
+		}
+		if jumpHost.Password != "" {
+			password, err := utils.StringEncrypt(jumpHost.Password)
+			if err != nil {
+				return "", err
+			}
+			jumpHost.Password = password
+		}
+		encoded[i] = jumpHost
+	}
+	data, err := json.Marshal(encoded)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func decodeJumpHosts(value string) ([]entity.JumpHost, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var jumpHosts []entity.JumpHost
+	if err := json.Unmarshal([]byte(value), &jumpHosts); err != nil {
+		return nil, err
+	}
+	for i := range jumpHosts {
+		if jumpHosts[i].Password == "" {
+			continue
+		}
+		password, err := utils.StringDecrypt(jumpHosts[i].Password)
+		if err != nil {
+			return nil, err
+		}
+		jumpHosts[i].Password = password
+	}
+	return jumpHosts, nil
+}
+
+// keepJumpHostPasswords fills the passwords left empty in the encoded jump hosts with the stored ones,
+// matching jump hosts by user and address.
+func keepJumpHostPasswords(value, current string) (string, error) {
+	if value == "" || current == "" {
+		return value, nil
+	}
+	var jumpHosts, stored []entity.JumpHost
+	if err := json.Unmarshal([]byte(value), &jumpHosts); err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal([]byte(current), &stored); err != nil {
+		return "", err
+	}
+	for i := range jumpHosts {
+		for _, previous := range stored {
+			if jumpHosts[i].Password == "" && previous.Address == jumpHosts[i].Address && previous.User == jumpHosts[i].User {
+				jumpHosts[i].Password = previous.Password
+			}
+		}
+	}
+	data, err := json.Marshal(jumpHosts)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func containsString(list []string, item string) bool {
+	for _, elem := range list {
+		if elem == item {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
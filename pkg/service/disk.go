@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"github.com/whoisfisher/mykubespray/pkg/db"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+)
+
+type DiskService interface {
+	ListUnused(ctx context.Context, hostID uint) ([]entity.BlockDevice, error)
+	Provision(ctx context.Context, hostID uint, request entity.DiskProvisionRequest) (*entity.DiskReport, error)
+	Grow(ctx context.Context, hostID uint, request entity.DiskGrowRequest) (*entity.DiskReport, error)
+}
+
+type diskService struct {
+	clusterService ClusterService
+}
+
+func NewDiskService() diskService {
+	return diskService{clusterService: NewClusterService()}
+}
+
+// provisioner returns a DiskProvisioner on a cluster host.
+func (ds diskService) provisioner(hostID uint) (*utils.DiskProvisioner, error) {
+	clusterHost, err := db.GetHost(hostID)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := ds.clusterService.GetKubekeyConf(clusterHost.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+	host, err := findHost(conf, clusterHost.Name)
+	if err != nil {
+		return nil, err
+	}
+	executor, err := utils.GetSSHExecutorPool().Executor(*host)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewDiskProvisioner(utils.OSClient{SSExecutor: *executor}), nil
+}
+
+// ListUnused returns the disks of a host that can be provisioned.
+func (ds diskService) ListUnused(ctx context.Context, hostID uint) ([]entity.BlockDevice, error) {
+	provisioner, err := ds.provisioner(hostID)
+	if err != nil {
+		return nil, err
+	}
+	return provisioner.UnusedDisks(ctx)
+}
+
+// Provision formats and mounts an unused disk of a host, see entity.DiskProvisionRequest. Commands that
+// failed are reported, not returned as an error.
+func (ds diskService) Provision(ctx context.Context, hostID uint, request entity.DiskProvisionRequest) (*entity.DiskReport, error) {
+	provisioner, err := ds.provisioner(hostID)
+	if err != nil {
+		return nil, err
+	}
+	report, err := provisioner.Provision(ctx, request)
+	if err != nil {
+		logger.GetLogger().Errorf("Cannot provision %s on host %d: %s", request.Device, hostID, err.Error())
+		return nil, err
+	}
+	return report, nil
+}
+
+// Grow grows an LV of a host and its filesystem, see entity.DiskGrowRequest. Commands that failed are
+// reported, not returned as an error.
+func (ds diskService) Grow(ctx context.Context, hostID uint, request entity.DiskGrowRequest) (*entity.DiskReport, error) {
+	provisioner, err := ds.provisioner(hostID)
+	if err != nil {
+		return nil, err
+	}
+	report, err := provisioner.Grow(ctx, request)
+	if err != nil {
+		logger.GetLogger().Errorf("Cannot grow %s/%s on host %d: %s", request.VGName, request.LVName, hostID, err.Error())
+		return nil, err
+	}
+	return report, nil
+}
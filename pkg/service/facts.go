@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/whoisfisher/mykubespray/pkg/db"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+)
+
+type HostFactsService interface {
+	Get(ctx context.Context, hostID uint) (*entity.HostFacts, error)
+	Refresh(ctx context.Context, hostID uint) (*entity.HostFacts, error)
+}
+
+type hostFactsService struct {
+	clusterService ClusterService
+}
+
+func NewHostFactsService() hostFactsService {
+	return hostFactsService{clusterService: NewClusterService()}
+}
+
+// Get returns the stored facts of a host, gathering them if they never were.
+func (hs hostFactsService) Get(ctx context.Context, hostID uint) (*entity.HostFacts, error) {
+	record, err := db.GetHostFacts(hostID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return hs.Refresh(ctx, hostID)
+	}
+	facts := &entity.HostFacts{}
+	if err := json.Unmarshal([]byte(record.Facts), facts); err != nil {
+		logger.GetLogger().Errorf("Failed to decode facts of host %d: %s", hostID, err.Error())
+		return nil, err
+	}
+	facts.HostID = hostID
+	facts.GatheredAt = record.GatheredAt
+	return facts, nil
+}
+
+// Refresh gathers the facts of a host and stores them.
+func (hs hostFactsService) Refresh(ctx context.Context, hostID uint) (*entity.HostFacts, error) {
+	clusterHost, err := db.GetHost(hostID)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := hs.clusterService.GetKubekeyConf(clusterHost.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+	host, err := findHost(conf, clusterHost.Name)
+	if err != nil {
+		return nil, err
+	}
+	executor, err := utils.GetSSHExecutorPool().Executor(*host)
+	if err != nil {
+		return nil, err
+	}
+	facts, err := executor.GatherFacts(ctx)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to gather facts of %s: %s", host.Name, err.Error())
+		return nil, err
+	}
+	facts.HostID = hostID
+	data, err := json.Marshal(facts)
+	if err != nil {
+		return nil, err
+	}
+	record := &entity.HostFactsRecord{HostID: hostID, GatheredAt: facts.GatheredAt, Facts: string(data)}
+	if err := db.SaveHostFacts(record); err != nil {
+		logger.GetLogger().Errorf("Failed to store facts of %s: %s", host.Name, err.Error())
+		return nil, err
+	}
+	return facts, nil
+}
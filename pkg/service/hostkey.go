@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+)
+
+type HostKeyService interface {
+	List(host string) ([]entity.HostKey, error)
+	Approve(id uint) (*entity.HostKey, error)
+	Revoke(id uint) (*entity.HostKey, error)
+	Import(request entity.KnownHostsImport) ([]entity.HostKey, error)
+}
+
+type hostKeyService struct{}
+
+func NewHostKeyService() hostKeyService {
+	return hostKeyService{}
+}
+
+// List returns the keys of host, or of every host when host is empty, from the store SSH
+// connections use, which is the database unless none is configured.
+func (hs hostKeyService) List(host string) ([]entity.HostKey, error) {
+	return utils.ConfiguredHostKeyStore().ListHostKeys(host)
+}
+
+// Approve trusts a key and revokes the other trusted keys of its host, which is how a legitimate
+// key change (e.g. a reinstalled node) is accepted.
+func (hs hostKeyService) Approve(id uint) (*entity.HostKey, error) {
+	store := utils.ConfiguredHostKeyStore()
+	key, err := getHostKey(store, id)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.ListHostKeys(key.Host)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].ID != key.ID && keys[i].Status == entity.HostKeyTrusted {
+			keys[i].Status = entity.HostKeyRevoked
+			if err := store.SaveHostKey(&keys[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	key.Status = entity.HostKeyTrusted
+	return key, store.SaveHostKey(key)
+}
+
+func (hs hostKeyService) Revoke(id uint) (*entity.HostKey, error) {
+	store := utils.ConfiguredHostKeyStore()
+	key, err := getHostKey(store, id)
+	if err != nil {
+		return nil, err
+	}
+	key.Status = entity.HostKeyRevoked
+	return key, store.SaveHostKey(key)
+}
+
+func (hs hostKeyService) Import(request entity.KnownHostsImport) ([]entity.HostKey, error) {
+	if request.KnownHosts == "" {
+		return nil, fmt.Errorf("known_hosts content cannot be empty")
+	}
+	return utils.ImportKnownHosts(utils.ConfiguredHostKeyStore(), []byte(request.KnownHosts))
+}
+
+func getHostKey(store utils.HostKeyStore, id uint) (*entity.HostKey, error) {
+	keys, err := store.ListHostKeys("")
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].ID == id {
+			return &keys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("host key %d not found", id)
+}
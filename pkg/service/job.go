@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/db"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/job"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"time"
+)
+
+type JobService interface {
+	Submit(clusterID uint, request entity.JobRequest) (*entity.Job, error)
+	List(clusterID uint) ([]entity.Job, error)
+	Get(id uint) (*entity.Job, error)
+	Logs(id uint) ([]entity.JobLog, error)
+	Cancel(id uint) error
+	Attach(id uint) ([]entity.JobLog, <-chan entity.JobLog, func(), error)
+}
+
+type jobService struct {
+	kubekeyService KubekeyService
+	certService    CertService
+	nodeService    NodeService
+	upgradeService UpgradeService
+}
+
+func NewJobService() jobService {
+	return jobService{
+		kubekeyService: NewKubekeyService(),
+		certService:    NewCertService(),
+		nodeService:    NewNodeService(),
+		upgradeService: NewUpgradeService(),
+	}
+}
+
+// Submit starts the requested kk operation on a stored cluster in the background.
+func (js jobService) Submit(clusterID uint, request entity.JobRequest) (*entity.Job, error) {
+	if _, err := db.GetCluster(clusterID); err != nil {
+		return nil, err
+	}
+	var fn job.Func
+	switch request.Type {
+	case entity.JobCreateCluster:
+		fn = func(ctx context.Context, logChan chan utils.LogEntry) error {
+			return js.kubekeyService.CreateCluster(ctx, clusterID, logChan)
+		}
+	case entity.JobDeleteCluster:
+		fn = func(ctx context.Context, logChan chan utils.LogEntry) error {
+			return js.kubekeyService.DeleteCluster(ctx, clusterID, logChan)
+		}
+	case entity.JobAddNodes:
+		fn = func(ctx context.Context, logChan chan utils.LogEntry) error {
+			return js.kubekeyService.AddNodeToCluster(ctx, clusterID, logChan)
+		}
+	case entity.JobDeleteNodes:
+		if err := js.nodeService.CheckRemoval(clusterID, request.Nodes); err != nil {
+			return nil, err
+		}
+		nodes := request.Nodes
+		drainTimeout := time.Duration(request.DrainTimeout) * time.Second
+		fn = func(ctx context.Context, logChan chan utils.LogEntry) error {
+			return js.nodeService.RemoveNodes(ctx, clusterID, nodes, drainTimeout, logChan)
+		}
+	case entity.JobRenewCerts:
+		fn = func(ctx context.Context, logChan chan utils.LogEntry) error {
+			return js.certService.Renew(ctx, clusterID, logChan)
+		}
+	case entity.JobUpgrade:
+		if request.Version == "" {
+			return nil, fmt.Errorf("target version cannot be empty")
+		}
+		version := request.Version
+		fn = func(ctx context.Context, logChan chan utils.LogEntry) error {
+			return js.upgradeService.Upgrade(ctx, clusterID, version, logChan)
+		}
+	default:
+		return nil, fmt.Errorf("unknown job type %s", request.Type)
+	}
+	params, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	return job.GetManager().Submit(request.Type, clusterID, string(params), fn)
+}
+
+func (js jobService) List(clusterID uint) ([]entity.Job, error) {
+	return db.ListJobs(clusterID)
+}
+
+func (js jobService) Get(id uint) (*entity.Job, error) {
+	return db.GetJob(id)
+}
+
+func (js jobService) Logs(id uint) ([]entity.JobLog, error) {
+	if _, err := db.GetJob(id); err != nil {
+		return nil, err
+	}
+	return db.ListJobLogs(id)
+}
+
+func (js jobService) Cancel(id uint) error {
+	return job.GetManager().Cancel(id)
+}
+
+func (js jobService) Attach(id uint) ([]entity.JobLog, <-chan entity.JobLog, func(), error) {
+	return job.GetManager().Attach(id)
+}
@@ -1,165 +1,208 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/db"
 	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
 	"github.com/whoisfisher/mykubespray/pkg/utils"
 )
 
 type KubekeyService interface {
 	//GenerateConfig() error
-	CreateCluster(conf entity.KubekeyConf, logChan chan utils.LogEntry) error
-	DeleteCluster(conf entity.KubekeyConf, logChan chan utils.LogEntry) error
-	AddNodeToCluster(conf entity.KubekeyConf, logChan chan utils.LogEntry) error
-	DeleteNodeFromCluster(conf entity.KubekeyConf, logChan chan utils.LogEntry) error
+	CreateCluster(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error
+	DeleteCluster(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error
+	AddNodeToCluster(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error
+	DeleteNodeFromCluster(ctx context.Context, clusterID uint, nodeName string, logChan chan utils.LogEntry) error
+	CheckCertExpiration(ctx context.Context, clusterID uint) ([]entity.ClusterCert, error)
+	RenewCerts(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error
+	UpgradeCluster(ctx context.Context, clusterID uint, version string, logChan chan utils.LogEntry) error
 }
 
 type kubekeyService struct {
+	clusterService   ClusterService
+	preflightService PreflightService
 }
 
 func NewKubekeyService() kubekeyService {
-	return kubekeyService{}
+	return kubekeyService{
+		clusterService:   NewClusterService(),
+		preflightService: NewPreflightService(),
+	}
+}
+
+// newClient loads the stored inventory of a cluster and prepares its provisioner on the registry host.
+// The returned release func closes the SSH connection.
+func (ks kubekeyService) newClient(clusterID uint) (utils.Provisioner, func(), error) {
+	conf, err := ks.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to load cluster %d: %s", clusterID, err.Error())
+		return nil, nil, err
+	}
+	return ks.newClientForConf(conf)
 }
 
-func (ks kubekeyService) CreateCluster(conf entity.KubekeyConf, logChan chan utils.LogEntry) error {
-	sshConfig := utils.SSHConfig{}
-	registryHost := entity.Host{}
-	for _, host := range conf.Hosts {
+func (ks kubekeyService) newClientForConf(conf *entity.KubekeyConf) (utils.Provisioner, func(), error) {
+	var registryHost *entity.Host
+	for i, host := range conf.Hosts {
 		if host.Registry != nil {
-			sshConfig.Host = host.Address
-			sshConfig.Port = host.Port
-			sshConfig.User = host.User
-			sshConfig.Password = host.Password
-			sshConfig.PrivateKey = host.PrivateKey
-			sshConfig.AuthMethods = host.AuthMethods
-			conf.Registry = *host.Registry
-			registryHost = host
+			registryHost = &conf.Hosts[i]
 		}
 	}
-	//connection, err := utils.NewSSHConnection(sshConfig)
-	//if err != nil {
-	//	logger.GetLogger().Errorf("Failed to create SSH connection: %s", err)
-	//	return err
-	//}
+	if registryHost == nil {
+		return nil, nil, fmt.Errorf("cluster %s has no registry host", conf.ClusterName)
+	}
 	osCOnf := utils.OSConf{}
 	localExecutor := utils.NewLocalExecutor()
-	//sshExecutor := utils.NewSSHExecutor(*connection)
-	sshExecutor := utils.NewExecutor(registryHost)
+	connection, err := utils.NewConnection(*registryHost)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to registry host %s: %w", registryHost.Address, err)
+	}
+	sshExecutor := &utils.SSHExecutor{Connection: *connection, Host: *registryHost}
+	release := func() {
+		sshExecutor.Connection.Client.Close()
+	}
 	osclient := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	client := utils.NewKubekeyClient(conf, *osclient)
-	if len(conf.VIPServer) > 0 {
-		client.GenerateConfigWithVIP()
-	} else {
-		client.GenerateConfig()
+	var client utils.Provisioner
+	switch conf.Provisioner {
+	case entity.ProvisionerKubespray:
+		client = utils.NewKubesprayClient(*conf, *osclient)
+	default:
+		client = utils.NewKubekeyClient(*conf, *osclient)
 	}
-	client.CreateCluster(logChan)
-	return nil
+	err = client.GenerateConfig()
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return client, release, nil
 }
 
-func (ks kubekeyService) DeleteCluster(conf entity.KubekeyConf, logChan chan utils.LogEntry) error {
-	sshConfig := utils.SSHConfig{}
-	registryHost := entity.Host{}
-	for _, host := range conf.Hosts {
-		if host.Registry != nil {
-			sshConfig.Host = host.Address
-			sshConfig.Port = host.Port
-			sshConfig.User = host.User
-			sshConfig.Password = host.Password
-			sshConfig.PrivateKey = host.PrivateKey
-			sshConfig.AuthMethods = host.AuthMethods
-			conf.Registry = *host.Registry
-			registryHost = host
-		}
+func (ks kubekeyService) CreateCluster(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error {
+	if err := ks.preflight(ctx, clusterID, logChan); err != nil {
+		return err
 	}
-	//connection, err := utils.NewSSHConnection(sshConfig)
-	//if err != nil {
-	//	logger.GetLogger().Errorf("Failed to create SSH connection: %s", err)
-	//	return err
-	//}
-	osCOnf := utils.OSConf{}
-	localExecutor := utils.NewLocalExecutor()
-	//sshExecutor := utils.NewSSHExecutor(*connection)
-	sshExecutor := utils.NewExecutor(registryHost)
-	osclient := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	client := utils.NewKubekeyClient(conf, *osclient)
-	if len(conf.VIPServer) > 0 {
-		client.GenerateConfigWithVIP()
-	} else {
-		client.GenerateConfig()
+	client, release, err := ks.newClient(clusterID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return client.CreateCluster(ctx, logChan)
+}
+
+func (ks kubekeyService) DeleteCluster(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error {
+	client, release, err := ks.newClient(clusterID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return client.DeleteCluster(ctx, logChan)
+}
+
+func (ks kubekeyService) AddNodeToCluster(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error {
+	client, release, err := ks.newClient(clusterID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return client.AddNode(ctx, logChan)
+}
+
+func (ks kubekeyService) DeleteNodeFromCluster(ctx context.Context, clusterID uint, nodeName string, logChan chan utils.LogEntry) error {
+	if nodeName == "" {
+		return fmt.Errorf("node name cannot be empty")
+	}
+	client, release, err := ks.newClient(clusterID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	err = client.DeleteNode(ctx, nodeName, logChan)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	err = db.DeleteClusterHostByName(clusterID, nodeName)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to remove node %s from inventory of cluster %d: %s", nodeName, clusterID, err.Error())
+		return err
 	}
-	client.DeleteCluster(logChan)
 	return nil
 }
 
-func (ks kubekeyService) AddNodeToCluster(conf entity.KubekeyConf, logChan chan utils.LogEntry) error {
-	sshConfig := utils.SSHConfig{}
-	registryHost := entity.Host{}
-	for _, host := range conf.Hosts {
-		if host.Registry != nil {
-			sshConfig.Host = host.Address
-			sshConfig.Port = host.Port
-			sshConfig.User = host.User
-			sshConfig.Password = host.Password
-			sshConfig.PrivateKey = host.PrivateKey
-			sshConfig.AuthMethods = host.AuthMethods
-			conf.Registry = *host.Registry
-			registryHost = host
-		}
+func (ks kubekeyService) CheckCertExpiration(ctx context.Context, clusterID uint) ([]entity.ClusterCert, error) {
+	client, release, err := ks.newClient(clusterID)
+	if err != nil {
+		return nil, err
 	}
-	//connection, err := utils.NewSSHConnection(sshConfig)
-	//if err != nil {
-	//	logger.GetLogger().Errorf("Failed to create SSH connection: %s", err)
-	//	return err
-	//}
-	osCOnf := utils.OSConf{}
-	localExecutor := utils.NewLocalExecutor()
-	//sshExecutor := utils.NewSSHExecutor(*connection)
-	sshExecutor := utils.NewExecutor(registryHost)
-	osclient := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	client := utils.NewKubekeyClient(conf, *osclient)
-	if len(conf.VIPServer) > 0 {
-		client.GenerateConfigWithVIP()
-	} else {
-		client.GenerateConfig()
+	defer release()
+	kubekeyClient, ok := client.(*utils.KubekeyClient)
+	if !ok {
+		return nil, fmt.Errorf("certificate check is only supported by the kubekey provisioner")
+	}
+	return kubekeyClient.CheckCertExpiration(ctx)
+}
+
+func (ks kubekeyService) RenewCerts(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error {
+	client, release, err := ks.newClient(clusterID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	kubekeyClient, ok := client.(*utils.KubekeyClient)
+	if !ok {
+		return fmt.Errorf("certificate renewal is only supported by the kubekey provisioner")
+	}
+	return kubekeyClient.RenewCert(ctx, logChan)
+}
+
+// UpgradeCluster runs the provisioner upgrade with the cluster spec set to version. The stored version
+// is updated once the provisioner succeeds.
+func (ks kubekeyService) UpgradeCluster(ctx context.Context, clusterID uint, version string, logChan chan utils.LogEntry) error {
+	conf, err := ks.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return err
+	}
+	conf.KubernetesVersion = version
+	client, release, err := ks.newClientForConf(conf)
+	if err != nil {
+		return err
+	}
+	defer release()
+	err = client.UpgradeCluster(ctx, logChan)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	err = db.UpdateClusterVersion(clusterID, version)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to store version %s of cluster %d: %s", version, clusterID, err.Error())
+		return err
 	}
-	client.AddNode(logChan)
 	return nil
 }
 
-func (ks kubekeyService) DeleteNodeFromCluster(conf entity.KubekeyConf, logChan chan utils.LogEntry) error {
-	deleteNode := ""
-	sshConfig := utils.SSHConfig{}
-	registryHost := entity.Host{}
-	for _, host := range conf.Hosts {
-		if host.Registry != nil {
-			sshConfig.Host = host.Address
-			sshConfig.Port = host.Port
-			sshConfig.User = host.User
-			sshConfig.Password = host.Password
-			sshConfig.PrivateKey = host.PrivateKey
-			sshConfig.AuthMethods = host.AuthMethods
-			conf.Registry = *host.Registry
-			registryHost = host
-		}
-		if host.IsDeleted {
-			deleteNode = host.Name
+// preflight validates the cluster before kk starts and writes every finding to logChan.
+func (ks kubekeyService) preflight(ctx context.Context, clusterID uint, logChan chan utils.LogEntry) error {
+	logChan <- utils.LogEntry{Message: "Running preflight checks"}
+	report, err := ks.preflightService.Validate(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	for _, item := range report.Items {
+		message := fmt.Sprintf("[%s] %s", item.Check, item.Message)
+		if item.Host != "" {
+			message = fmt.Sprintf("[%s] %s: %s", item.Check, item.Host, item.Message)
 		}
+		logChan <- utils.LogEntry{Message: message, IsError: item.Severity == entity.SeverityError}
 	}
-	//connection, err := utils.NewSSHConnection(sshConfig)
-	//if err != nil {
-	//	logger.GetLogger().Errorf("Failed to create SSH connection: %s", err)
-	//	return err
-	//}
-	osCOnf := utils.OSConf{}
-	localExecutor := utils.NewLocalExecutor()
-	//sshExecutor := utils.NewSSHExecutor(*connection)
-	sshExecutor := utils.NewExecutor(registryHost)
-	osclient := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	client := utils.NewKubekeyClient(conf, *osclient)
-	if len(conf.VIPServer) > 0 {
-		client.GenerateConfigWithVIP()
-	} else {
-		client.GenerateConfig()
+	if !report.Passed {
+		return fmt.Errorf("preflight checks failed for cluster %d", clusterID)
 	}
-	client.DeleteNode(deleteNode, logChan)
 	return nil
 }
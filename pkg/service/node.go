@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"github.com/whoisfisher/mykubespray/pkg/utils/kubernetes"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"strings"
+	"time"
+)
+
+const adminKubeconfig = "/etc/kubernetes/admin.conf"
+
+type NodeService interface {
+	CheckRemoval(clusterID uint, nodes []string) error
+	RemoveNodes(ctx context.Context, clusterID uint, nodes []string, drainTimeout time.Duration, logChan chan utils.LogEntry) error
+}
+
+type nodeService struct {
+	clusterService ClusterService
+	kubekeyService KubekeyService
+}
+
+func NewNodeService() nodeService {
+	return nodeService{
+		clusterService: NewClusterService(),
+		kubekeyService: NewKubekeyService(),
+	}
+}
+
+// CheckRemoval refuses a removal that would leave the cluster without a control plane or without etcd quorum.
+func (ns nodeService) CheckRemoval(clusterID uint, nodes []string) error {
+	conf, err := ns.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return err
+	}
+	return checkRemoval(*conf, nodes)
+}
+
+func checkRemoval(conf entity.KubekeyConf, nodes []string) error {
+	if len(nodes) == 0 {
+		return fmt.Errorf("no node to delete")
+	}
+	removed := make(map[string]bool)
+	for _, node := range nodes {
+		if removed[node] {
+			return fmt.Errorf("node %s is listed more than once", node)
+		}
+		removed[node] = true
+	}
+	known := make(map[string]bool)
+	for _, host := range conf.Hosts {
+		known[host.Name] = true
+		if removed[host.Name] && host.Registry != nil {
+			return fmt.Errorf("node %s is the registry host of cluster %s and cannot be removed", host.Name, conf.ClusterName)
+		}
+	}
+	for _, node := range nodes {
+		if !known[node] {
+			return fmt.Errorf("node %s does not belong to cluster %s", node, conf.ClusterName)
+		}
+	}
+	if remaining(conf.ContronPlanes, removed) == 0 {
+		return fmt.Errorf("removing %s would leave cluster %s without control-plane node", strings.Join(nodes, ", "), conf.ClusterName)
+	}
+	members := len(conf.Etcds)
+	if left := remaining(conf.Etcds, removed); members > 0 && left < members/2+1 {
+		return fmt.Errorf("removing %s would leave %d of %d etcd members, quorum needs %d", strings.Join(nodes, ", "), left, members, members/2+1)
+	}
+	return nil
+}
+
+func remaining(members []string, removed map[string]bool) int {
+	count := 0
+	for _, member := range members {
+		if !removed[member] {
+			count++
+		}
+	}
+	return count
+}
+
+// RemoveNodes removes nodes one after the other. Each node is cordoned and drained through the
+// Kubernetes API before the provisioner deletes it, and the Node object must be gone afterwards.
+func (ns nodeService) RemoveNodes(ctx context.Context, clusterID uint, nodes []string, drainTimeout time.Duration, logChan chan utils.LogEntry) error {
+	conf, err := ns.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return err
+	}
+	if err := checkRemoval(*conf, nodes); err != nil {
+		return err
+	}
+	if drainTimeout <= 0 {
+		viper.SetDefault("drain.timeout_seconds", 600)
+		drainTimeout = time.Duration(viper.GetInt("drain.timeout_seconds")) * time.Second
+	}
+	viper.SetDefault("drain.node_deleted_timeout_seconds", 120)
+	deletedTimeout := time.Duration(viper.GetInt("drain.node_deleted_timeout_seconds")) * time.Second
+	client, err := clusterKubernetesClient(*conf, nodes)
+	if err != nil {
+		return err
+	}
+	for i, node := range nodes {
+		progress := func(format string, args ...interface{}) {
+			logChan <- utils.LogEntry{Message: fmt.Sprintf("[%d/%d] [%s] %s", i+1, len(nodes), node, fmt.Sprintf(format, args...))}
+		}
+		progress("cordoning and draining, timeout %s", drainTimeout)
+		out := &logWriter{prefix: fmt.Sprintf("[%s] ", node), logChan: logChan}
+		errOut := &logWriter{prefix: fmt.Sprintf("[%s] ", node), logChan: logChan, isError: true}
+		err := client.CordonAndDrain(ctx, node, drainTimeout, out, errOut)
+		if apierrors.IsNotFound(err) {
+			progress("not registered in kubernetes, skipping drain")
+		} else if err != nil {
+			logger.GetLogger().Errorf("Failed to drain node %s of cluster %d: %s", node, clusterID, err.Error())
+			return err
+		}
+		progress("removing from cluster")
+		if err := ns.kubekeyService.DeleteNodeFromCluster(ctx, clusterID, node, logChan); err != nil {
+			return err
+		}
+		progress("waiting for the node object to be deleted")
+		if err := client.WaitNodeDeleted(ctx, node, deletedTimeout); err != nil {
+			return fmt.Errorf("node %s is still registered in kubernetes after removal: %w", node, err)
+		}
+		progress("removed")
+	}
+	return nil
+}
+
+// clusterKubernetesClient connects to the API server through the admin kubeconfig of a control-plane node
+// which is not in excluded.
+func clusterKubernetesClient(conf entity.KubekeyConf, excluded []string) (*kubernetes.K8sClient, error) {
+	removed := make(map[string]bool)
+	for _, node := range excluded {
+		removed[node] = true
+	}
+	controlPlanes := make(map[string]bool)
+	for _, name := range conf.ContronPlanes {
+		controlPlanes[name] = true
+	}
+	var lastErr error
+	for _, host := range conf.Hosts {
+		if !controlPlanes[host.Name] || removed[host.Name] {
+			continue
+		}
+		kubeconfig, err := fetchKubeconfig(host)
+		if err != nil {
+			logger.GetLogger().Warnf("Failed to read kubeconfig from %s: %s", host.Name, err.Error())
+			lastErr = err
+			continue
+		}
+		return kubernetes.NewK8sClient(entity.K8sConfig{Kubeconfig: string(kubeconfig)})
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("no control-plane node of cluster %s provides a kubeconfig: %w", conf.ClusterName, lastErr)
+	}
+	return nil, fmt.Errorf("no control-plane node of cluster %s provides a kubeconfig", conf.ClusterName)
+}
+
+// fetchKubeconfig reads the admin kubeconfig of a control-plane host and points it to the host itself,
+// since the control plane domain is usually only resolvable inside the cluster.
+func fetchKubeconfig(host entity.Host) ([]byte, error) {
+	connection, err := utils.NewConnection(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", host.Address, err)
+	}
+	executor := &utils.SSHExecutor{Connection: *connection, Host: host}
+	defer executor.Connection.Client.Close()
+	kubeconfig, err := executor.AsRoot().ExecuteShortCMD("cat " + adminKubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	address := host.InternalAddress
+	if address == "" {
+		address = host.Address
+	}
+	return kubernetes.RewriteKubeconfigServer(kubeconfig, fmt.Sprintf("https://%s:6443", address))
+}
+
+// logWriter forwards the output of the drain helper to a job log line by line.
+type logWriter struct {
+	prefix  string
+	logChan chan utils.LogEntry
+	isError bool
+}
+
+func (writer *logWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line != "" {
+			writer.logChan <- utils.LogEntry{Message: writer.prefix + line, IsError: writer.isError}
+		}
+	}
+	return len(p), nil
+}
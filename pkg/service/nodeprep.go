@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+)
+
+type NodePrepService interface {
+	Prepare(ctx context.Context, clusterID uint, request entity.NodePrepRequest) ([]*entity.NodePrepReport, error)
+}
+
+type nodePrepService struct {
+	clusterService ClusterService
+}
+
+func NewNodePrepService() nodePrepService {
+	return nodePrepService{clusterService: NewClusterService()}
+}
+
+// Prepare brings the hosts of a cluster to the state Kubernetes expects, or with request.Check only
+// reports how they differ from it. It returns a report for every host in the order of the inventory,
+// failures are reported there.
+func (ns nodePrepService) Prepare(ctx context.Context, clusterID uint, request entity.NodePrepRequest) ([]*entity.NodePrepReport, error) {
+	conf, err := ns.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	hosts := conf.Hosts
+	if len(request.Hosts) > 0 {
+		hosts = nil
+		for _, name := range request.Hosts {
+			host, err := findHost(conf, name)
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, *host)
+		}
+	}
+	prepConf := entity.NodePrepConf{
+		Timezone:  conf.Timezone,
+		SELinux:   request.SELinux,
+		Firewall:  request.Firewall,
+		OpenPorts: request.OpenPorts,
+		Sysctl:    request.Sysctl,
+	}
+	if err := utils.ValidateNodePrepConf(prepConf); err != nil {
+		return nil, err
+	}
+	options, err := utils.NewFanOutOptions(request.Rollout)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.FanOutReports(ctx, "prepare node", hosts, options, func(ctx context.Context, host entity.Host, osClient utils.OSClient) (*entity.NodePrepReport, string) {
+		hostConf := prepConf
+		if request.SetHostname {
+			hostConf.Hostname = host.Name
+		}
+		report := utils.NewNodePrep(hostConf, osClient).Run(ctx, request.Check)
+		return report, report.Error
+	}, func(host entity.Host, reason string) *entity.NodePrepReport {
+		return &entity.NodePrepReport{Host: host.Name, Check: request.Check, Error: reason}
+	}), nil
+}
@@ -1,18 +1,20 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/logger"
 	"github.com/whoisfisher/mykubespray/pkg/utils"
 )
 
 type OSService interface {
-	Mount(conf entity.DiskConf) error
-	AddHost(conf entity.RecordConf) error
-	CopyFile(conf entity.CertConf) error
-	ChangeExpiredPassword(conf entity.PasswordConf) error
-	CheckPasswordInfo(conf entity.Host) (*entity.PasswordInfo, error)
-	UpdatePassword(conf entity.PasswordConf) error
+	Mount(ctx context.Context, conf entity.DiskConf) error
+	AddHost(ctx context.Context, conf entity.RecordConf) error
+	CopyFile(ctx context.Context, conf entity.CertConf) error
+	ChangeExpiredPassword(ctx context.Context, conf entity.PasswordConf) error
+	CheckPasswordInfo(ctx context.Context, conf entity.Host) (*entity.PasswordInfo, error)
+	UpdatePassword(ctx context.Context, conf entity.PasswordConf) error
 }
 
 type osService struct {
@@ -22,7 +24,7 @@ func NewOSService() osService {
 	return osService{}
 }
 
-func (os osService) Mount(conf entity.DiskConf) error {
+func (os osService) Mount(ctx context.Context, conf entity.DiskConf) error {
 	sshConfig := utils.SSHConfig{}
 	sshConfig.Host = conf.Host.Address
 	sshConfig.Port = conf.Host.Port
@@ -40,36 +42,26 @@ func (os osService) Mount(conf entity.DiskConf) error {
 	//sshExecutor := utils.NewSSHExecutor(*connection)
 	sshExecutor := utils.NewExecutor(conf.Host)
 	client := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	data, err := client.QueryVGName()
+	data, err := client.QueryVGNameContext(ctx)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to query pv: %s", err)
 		return err
 	}
-	conf.LVS = *data
-	err = client.CreatePV(conf)
+	// the root LV and its filesystem grow by the whole device
+	request := entity.DiskGrowRequest{VGName: data.VGName, LVName: data.LVName, Device: conf.Device}
+	report, err := utils.NewDiskProvisioner(*client).Grow(ctx, request)
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to create pv: %s", err)
+		logger.GetLogger().Errorf("Failed to grow /dev/%s/%s: %s", data.VGName, data.LVName, err)
 		return err
 	}
-	err = client.ExtendVG(conf)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to extend vg: %s", err)
-		return err
-	}
-	err = client.ExtendLVPercent100(conf)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to extend lv: %s", err)
-		return err
-	}
-	err = client.XGrowFS(conf)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to xfs-growfs /dev/mapper/%s-%s: %s", conf.VGName, conf.LVName, err)
-		return err
+	if report.Error != "" {
+		logger.GetLogger().Errorf("Failed to grow /dev/%s/%s: %s", data.VGName, data.LVName, report.Error)
+		return errors.New(report.Error)
 	}
 	return nil
 }
 
-func (os osService) AddHost(conf entity.RecordConf) error {
+func (os osService) AddHost(ctx context.Context, conf entity.RecordConf) error {
 	sshConfig := utils.SSHConfig{}
 	sshConfig.Host = conf.Host.Address
 	sshConfig.Port = conf.Host.Port
@@ -87,10 +79,10 @@ func (os osService) AddHost(conf entity.RecordConf) error {
 	//sshExecutor := utils.NewSSHExecutor(*connection)
 	sshExecutor := utils.NewExecutor(conf.Host)
 	client := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	return client.AddHost(conf.Record)
+	return client.AddHostContext(ctx, conf.Record)
 }
 
-func (os osService) CopyFile(conf entity.CertConf) error {
+func (os osService) CopyFile(ctx context.Context, conf entity.CertConf) error {
 	sshConfig := utils.SSHConfig{}
 	sshConfig.Host = conf.Host.Address
 	sshConfig.Port = conf.Host.Port
@@ -108,10 +100,10 @@ func (os osService) CopyFile(conf entity.CertConf) error {
 	//sshExecutor := utils.NewSSHExecutor(*connection)
 	sshExecutor := utils.NewExecutor(conf.Host)
 	client := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	return client.CopyFile(conf.CertPath, conf.DestPath)
+	return client.CopyFileContext(ctx, conf.CertPath, conf.DestPath)
 }
 
-func (os osService) ChangeExpiredPassword(conf entity.PasswordConf) error {
+func (os osService) ChangeExpiredPassword(ctx context.Context, conf entity.PasswordConf) error {
 	sshConfig := utils.SSHConfig{}
 	sshConfig.Host = conf.Host.Address
 	sshConfig.Port = conf.Host.Port
@@ -123,10 +115,10 @@ func (os osService) ChangeExpiredPassword(conf entity.PasswordConf) error {
 	localExecutor := utils.NewLocalExecutor()
 	sshExecutor := utils.NewExecutor(conf.Host)
 	client := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	return client.ChangeExpiredPassword(conf.Host.Password, conf.NewPassword)
+	return client.ChangeExpiredPasswordContext(ctx, conf.Host.Password, conf.NewPassword)
 }
 
-func (os osService) CheckPasswordInfo(conf entity.Host) (*entity.PasswordInfo, error) {
+func (os osService) CheckPasswordInfo(ctx context.Context, conf entity.Host) (*entity.PasswordInfo, error) {
 	sshConfig := utils.SSHConfig{}
 	sshConfig.Host = conf.Address
 	sshConfig.Port = conf.Port
@@ -138,10 +130,10 @@ func (os osService) CheckPasswordInfo(conf entity.Host) (*entity.PasswordInfo, e
 	localExecutor := utils.NewLocalExecutor()
 	sshExecutor := utils.NewExecutor(conf)
 	client := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	return client.CheckPasswordInfo()
+	return client.CheckPasswordInfoContext(ctx)
 }
 
-func (os osService) UpdatePassword(conf entity.PasswordConf) error {
+func (os osService) UpdatePassword(ctx context.Context, conf entity.PasswordConf) error {
 	sshConfig := utils.SSHConfig{}
 	sshConfig.Host = conf.Address
 	sshConfig.Port = conf.Port
@@ -153,5 +145,5 @@ func (os osService) UpdatePassword(conf entity.PasswordConf) error {
 	localExecutor := utils.NewLocalExecutor()
 	sshExecutor := utils.NewExecutor(conf.Host)
 	client := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
-	return client.UpdatePasswordInfo(conf.Host.Password, conf.NewPassword)
+	return client.UpdatePasswordInfoContext(ctx, conf.Host.Password, conf.NewPassword)
 }
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"github.com/spf13/viper"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+)
+
+type PackageService interface {
+	Install(ctx context.Context, clusterID uint, request entity.PackageRequest) ([]*entity.PackageReport, error)
+}
+
+type packageService struct {
+	clusterService ClusterService
+}
+
+func NewPackageService() packageService {
+	return packageService{clusterService: NewClusterService()}
+}
+
+// Install installs the packages of their distribution on the hosts of a cluster from the offline
+// repository, or with request.Verify only reports the missing ones. It returns a report for every
+// host in the order of the inventory, failures are reported there.
+func (ps packageService) Install(ctx context.Context, clusterID uint, request entity.PackageRequest) ([]*entity.PackageReport, error) {
+	conf, err := ps.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	hosts := conf.Hosts
+	if len(request.Hosts) > 0 {
+		hosts = nil
+		for _, name := range request.Hosts {
+			host, err := findHost(conf, name)
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, *host)
+		}
+	}
+	viper.SetDefault("packages.list_dir", utils.ConfDir())
+	packageConf := entity.PackageConf{
+		Repo:     request.Repo,
+		Packages: request.Packages,
+		ListDir:  viper.GetString("packages.list_dir"),
+	}
+	if err := utils.ValidatePackageConf(packageConf); err != nil {
+		return nil, err
+	}
+	options, err := utils.NewFanOutOptions(request.Rollout)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.FanOutReports(ctx, "install packages", hosts, options, func(ctx context.Context, host entity.Host, osClient utils.OSClient) (*entity.PackageReport, string) {
+		report := utils.NewPackageInstaller(packageConf, osClient).Run(ctx, request.Verify)
+		return report, report.Error
+	}, func(host entity.Host, reason string) *entity.PackageReport {
+		return &entity.PackageReport{Host: host.Name, Verify: request.Verify, Error: reason}
+	}), nil
+}
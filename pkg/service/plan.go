@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/job"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrStalePlan    = errors.New("plan is out of date, compute a new plan")
+	ErrPlanApplying = errors.New("a plan is being applied to the cluster already")
+)
+
+// applyLocks serializes the applies of a cluster, so that a plan is checked and submitted at once.
+var applyLocks sync.Map
+
+const maskedSecret = "******"
+
+// planKey keys the plan hashes, so that a hash does not let anyone guess the passwords in the
+// configuration. Plans of an earlier process are stale.
+var planKey = func() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate the plan key: %v", err))
+	}
+	return key
+}()
+
+type PlanService interface {
+	Plan(clusterID uint, conf entity.KubekeyConf) (*entity.Plan, error)
+	Apply(clusterID uint, apply entity.PlanApply) (*entity.Job, error)
+}
+
+type planService struct {
+	clusterService ClusterService
+	kubekeyService KubekeyService
+	nodeService    NodeService
+}
+
+func NewPlanService() planService {
+	return planService{
+		clusterService: NewClusterService(),
+		kubekeyService: NewKubekeyService(),
+		nodeService:    NewNodeService(),
+	}
+}
+
+// Plan compares the stored inventory of a cluster with conf. No host is contacted.
+func (ps planService) Plan(clusterID uint, conf entity.KubekeyConf) (*entity.Plan, error) {
+	current, err := ps.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	if conf.ClusterName != current.ClusterName {
+		return nil, fmt.Errorf("cluster name cannot change from %s to %s", current.ClusterName, conf.ClusterName)
+	}
+	requested := mergeSecrets(*current, conf)
+	plan := &entity.Plan{ClusterID: clusterID}
+	diffNodes(plan, *current, requested)
+	diffRegistry(plan, current.Registry, requested.Registry)
+	diffNetwork(plan, *current, requested)
+	if len(plan.NetworkChanges) > 0 {
+		plan.Warnings = append(plan.Warnings, "network changes are stored but not applied to a running cluster")
+	}
+	if len(plan.RoleChanges) > 0 {
+		plan.Warnings = append(plan.Warnings, "role changes of existing nodes are stored but not applied to a running cluster")
+	}
+	masked, hasSecrets := maskSecrets(requested)
+	if hasSecrets {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("passwords in config are masked as %s, the applied configuration holds the real ones", maskedSecret))
+	}
+	config, err := renderConfig(masked)
+	if err != nil {
+		return nil, err
+	}
+	plan.Config = string(config)
+	plan.Hash, err = planHash(clusterID, *current, requested)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Apply runs a plan previously returned by Plan. The plan is recomputed and must still have the confirmed hash.
+// Only one plan is applied to a cluster at a time.
+func (ps planService) Apply(clusterID uint, apply entity.PlanApply) (*entity.Job, error) {
+	lock, _ := applyLocks.LoadOrStore(clusterID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	if job.GetManager().Running(entity.JobApplyPlan, clusterID) {
+		return nil, ErrPlanApplying
+	}
+	plan, err := ps.Plan(clusterID, apply.Conf)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(plan.Hash), []byte(apply.Hash)) {
+		return nil, ErrStalePlan
+	}
+	if len(plan.RemovedNodes) > 0 {
+		if err := ps.nodeService.CheckRemoval(clusterID, plan.RemovedNodes); err != nil {
+			return nil, err
+		}
+	}
+	conf := apply.Conf
+	params, err := json.Marshal(plan)
+	if err != nil {
+		return nil, err
+	}
+	return job.GetManager().Submit(entity.JobApplyPlan, clusterID, string(params), func(ctx context.Context, logChan chan utils.LogEntry) error {
+		if len(plan.RemovedNodes) > 0 {
+			logChan <- utils.LogEntry{Message: fmt.Sprintf("Removing nodes %s", strings.Join(plan.RemovedNodes, ", "))}
+			if err := ps.nodeService.RemoveNodes(ctx, clusterID, plan.RemovedNodes, 0, logChan); err != nil {
+				return err
+			}
+		}
+		logChan <- utils.LogEntry{Message: "Updating cluster inventory"}
+		if _, err := ps.clusterService.UpdateCluster(clusterID, conf); err != nil {
+			return err
+		}
+		if len(plan.AddedNodes) > 0 {
+			logChan <- utils.LogEntry{Message: fmt.Sprintf("Adding nodes %s", strings.Join(plan.AddedNodes, ", "))}
+			return ps.kubekeyService.AddNodeToCluster(ctx, clusterID, logChan)
+		}
+		return nil
+	})
+}
+
+// mergeSecrets fills the passwords left empty in conf with the stored ones, as UpdateCluster does,
+// and takes the registry from the registry host the same way toCluster does.
+func mergeSecrets(current, conf entity.KubekeyConf) entity.KubekeyConf {
+	passwords := make(map[string]string)
+	becomePasswords := make(map[string]string)
+	for _, host := range current.Hosts {
+		passwords[host.Name] = host.Password
+		becomePasswords[host.Name] = host.Become.Password
+	}
+	hosts := make([]entity.Host, len(conf.Hosts))
+	for i, host := range conf.Hosts {
+		if host.Password == "" && host.PrivateKey == "" {
+			host.Password = passwords[host.Name]
+		}
+		if host.Become.Password == "" {
+			host.Become.Password = becomePasswords[host.Name]
+		}
+		if host.Registry != nil {
+			registry := *host.Registry
+			if registry.Password == "" {
+				registry.Password = current.Registry.Password
+			}
+			registry.NodeName = host.Name
+			host.Registry = &registry
+			conf.Registry = registry
+		}
+		hosts[i] = host
+	}
+	conf.Hosts = hosts
+	if conf.Registry.Password == "" {
+		conf.Registry.Password = current.Registry.Password
+	}
+	return conf
+}
+
+// maskSecrets returns conf with its passwords masked and whether it has any.
+func maskSecrets(conf entity.KubekeyConf) (entity.KubekeyConf, bool) {
+	masked := false
+	mask := func(secret *string) {
+		if *secret != "" {
+			*secret = maskedSecret
+			masked = true
+		}
+	}
+	hosts := make([]entity.Host, len(conf.Hosts))
+	for i, host := range conf.Hosts {
+		mask(&host.Password)
+		mask(&host.Become.Password)
+		if host.Registry != nil {
+			registry := *host.Registry
+			mask(&registry.Password)
+			host.Registry = &registry
+		}
+		hosts[i] = host
+	}
+	conf.Hosts = hosts
+	mask(&conf.Registry.Password)
+	return conf, masked
+}
+
+// renderConfig renders what the provisioner of conf would write, without a connection to any host.
+func renderConfig(conf entity.KubekeyConf) ([]byte, error) {
+	if conf.Provisioner != entity.ProvisionerKubespray {
+		return utils.NewKubekeyClient(conf, utils.OSClient{}).RenderConfig()
+	}
+	client := utils.NewKubesprayClient(conf, utils.OSClient{})
+	var files []string
+	for _, render := range []func() ([]byte, error){client.RenderInventory, client.RenderClusterVars, client.RenderOfflineVars} {
+		content, err := render()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, string(content))
+	}
+	return []byte(strings.Join(files, "\n---\n")), nil
+}
+
+func planHash(clusterID uint, current, requested entity.KubekeyConf) (string, error) {
+	data, err := json.Marshal(struct {
+		ClusterID uint
+		Current   entity.KubekeyConf
+		Requested entity.KubekeyConf
+	}{clusterID, current, requested})
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, planKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func nodeRoles(conf entity.KubekeyConf) map[string][]string {
+	roles := make(map[string][]string)
+	for _, host := range conf.Hosts {
+		roles[host.Name] = []string{}
+	}
+	add := func(names []string, role string) {
+		for _, name := range names {
+			roles[name] = append(roles[name], role)
+		}
+	}
+	add(conf.Etcds, entity.RoleEtcd)
+	add(conf.ContronPlanes, entity.RoleControlPlane)
+	add(conf.Workers, entity.RoleWorker)
+	return roles
+}
+
+func diffNodes(plan *entity.Plan, current, requested entity.KubekeyConf) {
+	before := nodeRoles(current)
+	after := nodeRoles(requested)
+	for name, roles := range after {
+		previous, ok := before[name]
+		if !ok {
+			plan.AddedNodes = append(plan.AddedNodes, name)
+			continue
+		}
+		if strings.Join(previous, ",") != strings.Join(roles, ",") {
+			plan.RoleChanges = append(plan.RoleChanges, entity.RoleChange{Node: name, Before: previous, After: roles})
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			plan.RemovedNodes = append(plan.RemovedNodes, name)
+		}
+	}
+	sort.Strings(plan.AddedNodes)
+	sort.Strings(plan.RemovedNodes)
+	sort.Slice(plan.RoleChanges, func(i, j int) bool {
+		return plan.RoleChanges[i].Node < plan.RoleChanges[j].Node
+	})
+}
+
+func diffRegistry(plan *entity.Plan, current, requested entity.Registry) {
+	fields := []entity.FieldChange{
+		{Field: "url", Before: current.Url, After: requested.Url},
+		{Field: "user", Before: current.User, After: requested.User},
+		{Field: "type", Before: current.Type, After: requested.Type},
+		{Field: "node", Before: current.NodeName, After: requested.NodeName},
+		{Field: "skip_tls", Before: strconv.FormatBool(current.SkipTLS), After: strconv.FormatBool(requested.SkipTLS)},
+		{Field: "plain_http", Before: strconv.FormatBool(current.PlainHttp), After: strconv.FormatBool(requested.PlainHttp)},
+		{Field: "insecure_registries", Before: strings.Join(current.InsecureRegistries, ","), After: strings.Join(requested.InsecureRegistries, ",")},
+	}
+	if current.Password != requested.Password {
+		fields = append(fields, entity.FieldChange{Field: "password", Before: maskedSecret, After: maskedSecret + " (changed)"})
+	}
+	for _, field := range fields {
+		if field.Before != field.After {
+			plan.RegistryChanges = append(plan.RegistryChanges, field)
+		}
+	}
+}
+
+func diffNetwork(plan *entity.Plan, current, requested entity.KubekeyConf) {
+	fields := []entity.FieldChange{
+		{Field: "kube_pods_cidr", Before: current.KubePodsCIDR, After: requested.KubePodsCIDR},
+		{Field: "kube_service_cidr", Before: current.KubeServiceCIDR, After: requested.KubeServiceCIDR},
+		{Field: "network_plugin", Before: current.NetworkPlugin, After: requested.NetworkPlugin},
+		{Field: "enable_multus", Before: strconv.FormatBool(current.EnableMultus), After: strconv.FormatBool(requested.EnableMultus)},
+		{Field: "proxy_mode", Before: current.ProxyMode, After: requested.ProxyMode},
+		{Field: "ipip_mode", Before: current.IPIPMode, After: requested.IPIPMode},
+		{Field: "vxlan_mode", Before: current.VxlanMode, After: requested.VxlanMode},
+		{Field: "vip_server", Before: current.VIPServer, After: requested.VIPServer},
+		{Field: "control_plane_domain", Before: current.ControlPlaneDomain, After: requested.ControlPlaneDomain},
+	}
+	for _, field := range fields {
+		if field.Before != field.After {
+			plan.NetworkChanges = append(plan.NetworkChanges, field)
+		}
+	}
+}
@@ -1,16 +1,19 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"strings"
 )
 
 type PoolService interface {
-	CopyFile(srcFile, destFile string, hosts []entity.Host) error
-	AddHosts(record entity.Record, hosts []entity.Host) error
-	ExecuteCommand(command string, hosts []entity.Host) error
-	AddDNS(dns string, hosts []entity.Host) error
+	CopyFile(ctx context.Context, srcFile, destFile string, hosts []entity.Host, rollout entity.Rollout) error
+	AddHosts(ctx context.Context, record entity.Record, hosts []entity.Host, rollout entity.Rollout) error
+	ExecuteCommand(ctx context.Context, command string, hosts []entity.Host, rollout entity.Rollout) ([]*entity.CommandResult, error)
+	AddDNS(ctx context.Context, dns string, hosts []entity.Host, rollout entity.Rollout) error
+	Stats() entity.SSHPoolStats
 }
 
 type poolService struct {
@@ -20,38 +23,72 @@ func NewPoolService() poolService {
 	return poolService{}
 }
 
-func (pool poolService) CopyFile(srcFile, destFile string, hosts []entity.Host) error {
-	execPool := utils.NewSSHExecutorPool()
-	result := execPool.CopyFileParallel(srcFile, destFile, hosts)
-	if result.OverallSuccess {
-		return nil
+func (pool poolService) CopyFile(ctx context.Context, srcFile, destFile string, hosts []entity.Host, rollout entity.Rollout) error {
+	options, err := utils.NewFanOutOptions(rollout)
+	if err != nil {
+		return err
 	}
-	return errors.New("add keycloak cert failed")
+	execPool := utils.GetSSHExecutorPool()
+	result := execPool.CopyFileParallel(ctx, srcFile, destFile, hosts, options)
+	return fanOutError("add keycloak cert failed", result)
 }
 
-func (pool poolService) AddHosts(record entity.Record, hosts []entity.Host) error {
-	execPool := utils.NewSSHExecutorPool()
-	result := execPool.AddHostsParallel(record, hosts)
-	if result.OverallSuccess {
-		return nil
+func (pool poolService) AddHosts(ctx context.Context, record entity.Record, hosts []entity.Host, rollout entity.Rollout) error {
+	options, err := utils.NewFanOutOptions(rollout)
+	if err != nil {
+		return err
 	}
-	return errors.New("add /etc/hosts failed")
+	execPool := utils.GetSSHExecutorPool()
+	result := execPool.AddHostsParallel(ctx, record, hosts, options)
+	return fanOutError("add /etc/hosts failed", result)
 }
 
-func (pool poolService) AddDNS(dns string, hosts []entity.Host) error {
-	execPool := utils.NewSSHExecutorPool()
-	result := execPool.AddDNSParallel(dns, hosts)
-	if result.OverallSuccess {
-		return nil
+func (pool poolService) AddDNS(ctx context.Context, dns string, hosts []entity.Host, rollout entity.Rollout) error {
+	options, err := utils.NewFanOutOptions(rollout)
+	if err != nil {
+		return err
 	}
-	return errors.New("add /etc/resolv.conf failed")
+	execPool := utils.GetSSHExecutorPool()
+	result := execPool.AddDNSParallel(ctx, dns, hosts, options)
+	return fanOutError("add /etc/resolv.conf failed", result)
 }
 
-func (pool poolService) ExecuteCommand(command string, hosts []entity.Host) error {
-	execPool := utils.NewSSHExecutorPool()
-	result := execPool.ExecuteCommandParallel(command, hosts)
+// ExecuteCommand runs command on hosts and returns the result of every host in the order of hosts.
+// Hosts skipped because the run stopped early have exit code -1.
+func (pool poolService) ExecuteCommand(ctx context.Context, command string, hosts []entity.Host, rollout entity.Rollout) ([]*entity.CommandResult, error) {
+	options, err := utils.NewFanOutOptions(rollout)
+	if err != nil {
+		return nil, err
+	}
+	execPool := utils.GetSSHExecutorPool()
+	result := execPool.ExecuteCommandParallel(ctx, command, hosts, options)
+	results := make([]*entity.CommandResult, 0, len(hosts))
+	for _, machineResult := range result.Results {
+		results = append(results, machineResult.Result)
+	}
+	for _, host := range result.Skipped {
+		results = append(results, &entity.CommandResult{Host: host, ExitCode: -1, Error: "skipped, the run stopped early"})
+	}
+	return results, nil
+}
+
+func (pool poolService) Stats() entity.SSHPoolStats {
+	return utils.GetSSHExecutorPool().Stats()
+}
+
+// fanOutError returns nil if result succeeded on all hosts, or an error listing the hosts that failed or were skipped.
+func fanOutError(message string, result *utils.CopyResult) error {
 	if result.OverallSuccess {
 		return nil
 	}
-	return errors.New("execute command failed")
+	var failed []string
+	for _, machineResult := range result.Results {
+		if !machineResult.Success {
+			failed = append(failed, machineResult.Error)
+		}
+	}
+	if len(result.Skipped) > 0 {
+		failed = append(failed, fmt.Sprintf("skipped %s", strings.Join(result.Skipped, ", ")))
+	}
+	return fmt.Errorf("%s: %s", message, strings.Join(failed, "; "))
 }
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"github.com/spf13/viper"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+)
+
+type PreflightService interface {
+	Validate(ctx context.Context, clusterID uint) (*entity.ValidationReport, error)
+	ValidateConf(ctx context.Context, conf entity.KubekeyConf) *entity.ValidationReport
+}
+
+type preflightService struct {
+	clusterService ClusterService
+}
+
+func NewPreflightService() preflightService {
+	return preflightService{
+		clusterService: NewClusterService(),
+	}
+}
+
+func (ps preflightService) Validate(ctx context.Context, clusterID uint) (*entity.ValidationReport, error) {
+	conf, err := ps.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	return ps.ValidateConf(ctx, *conf), nil
+}
+
+func (ps preflightService) ValidateConf(ctx context.Context, conf entity.KubekeyConf) *entity.ValidationReport {
+	return utils.NewPreflight(conf, preflightRequirements()).Validate(ctx)
+}
+
+// The preflight defaults are what kk needs at least.
+func init() {
+	viper.SetDefault("preflight.min_cpu", 2)
+	viper.SetDefault("preflight.min_memory_mb", 4096)
+	viper.SetDefault("preflight.min_disk_gb", 40)
+	viper.SetDefault("preflight.manifest_dir", utils.ConfDir())
+	viper.SetDefault("preflight.supported_os", []string{"centos:7", "debian:10", "ubuntu:22.04", "kylin:v10", "uos:20"})
+}
+
+// preflightRequirements reads the preflight section of the configuration.
+func preflightRequirements() entity.PreflightRequirements {
+	return entity.PreflightRequirements{
+		MinCPU:      viper.GetInt("preflight.min_cpu"),
+		MinMemoryMB: viper.GetInt("preflight.min_memory_mb"),
+		MinDiskGB:   viper.GetInt("preflight.min_disk_gb"),
+		ManifestDir: viper.GetString("preflight.manifest_dir"),
+		SupportedOS: viper.GetStringSlice("preflight.supported_os"),
+	}
+}
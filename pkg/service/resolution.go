@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/whoisfisher/mykubespray/pkg/db"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+)
+
+type NameResolutionService interface {
+	Get(clusterID uint) (*entity.NameResolution, error)
+	Set(clusterID uint, resolution entity.NameResolution) error
+	Sync(ctx context.Context, clusterID uint, request entity.NameResolutionSyncRequest) ([]*entity.NameResolutionReport, error)
+}
+
+type nameResolutionService struct {
+	clusterService ClusterService
+}
+
+func NewNameResolutionService() nameResolutionService {
+	return nameResolutionService{clusterService: NewClusterService()}
+}
+
+// Get returns the name resolution stored for a cluster, an empty one if none was set.
+func (ns nameResolutionService) Get(clusterID uint) (*entity.NameResolution, error) {
+	if _, err := db.GetCluster(clusterID); err != nil {
+		return nil, err
+	}
+	record, err := db.GetNameResolution(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	resolution := &entity.NameResolution{}
+	if record == nil {
+		return resolution, nil
+	}
+	if err := json.Unmarshal([]byte(record.Resolution), resolution); err != nil {
+		return nil, err
+	}
+	return resolution, nil
+}
+
+// Set replaces the name resolution of a cluster. The hosts are not changed before Sync.
+func (ns nameResolutionService) Set(clusterID uint, resolution entity.NameResolution) error {
+	if _, err := db.GetCluster(clusterID); err != nil {
+		return err
+	}
+	if err := utils.ValidateNameResolution(resolution); err != nil {
+		return err
+	}
+	data, err := json.Marshal(resolution)
+	if err != nil {
+		return err
+	}
+	return db.SaveNameResolution(&entity.NameResolutionRecord{ClusterID: clusterID, Resolution: string(data)})
+}
+
+// Sync reconciles the name resolution of the hosts of a cluster, or with request.Check only reports how
+// they differ from it. The inventory hosts and, with a VIP, the control-plane domain are resolved
+// through /etc/hosts in addition to the stored records, which take precedence. It returns a report for
+// every host in the order of the inventory, failures are reported there.
+func (ns nameResolutionService) Sync(ctx context.Context, clusterID uint, request entity.NameResolutionSyncRequest) ([]*entity.NameResolutionReport, error) {
+	conf, err := ns.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := ns.Get(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	resolution := *stored
+	resolution.Records = clusterRecords(conf, stored.Records)
+	if err := utils.ValidateNameResolution(resolution); err != nil {
+		return nil, err
+	}
+	hosts := conf.Hosts
+	if len(request.Hosts) > 0 {
+		hosts = nil
+		for _, name := range request.Hosts {
+			host, err := findHost(conf, name)
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, *host)
+		}
+	}
+	options, err := utils.NewFanOutOptions(request.Rollout)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.FanOutReports(ctx, "sync name resolution", hosts, options, func(ctx context.Context, host entity.Host, osClient utils.OSClient) (*entity.NameResolutionReport, string) {
+		report := utils.NewNameResolver(clusterID, resolution, osClient).Run(ctx, request.Check)
+		return report, report.Error
+	}, func(host entity.Host, reason string) *entity.NameResolutionReport {
+		return &entity.NameResolutionReport{Host: host.Name, Check: request.Check, Error: reason}
+	}), nil
+}
+
+// clusterRecords returns the records of the inventory hosts, of the control-plane domain when the
+// cluster has a VIP, and records, which replace the others of the same domain.
+func clusterRecords(conf *entity.KubekeyConf, records []entity.Record) []entity.Record {
+	var all []entity.Record
+	for _, host := range conf.Hosts {
+		address := host.InternalAddress
+		if address == "" {
+			address = host.Address
+		}
+		all = append(all, entity.Record{IP: address, Domain: host.Name})
+	}
+	if conf.VIPServer != "" {
+		domain := conf.ControlPlaneDomain
+		if domain == "" {
+			domain = entity.DefaultControlPlaneDomain
+		}
+		all = append(all, entity.Record{IP: conf.VIPServer, Domain: domain})
+	}
+	explicit := make(map[string]bool)
+	for _, record := range records {
+		explicit[record.Domain] = true
+	}
+	var merged []entity.Record
+	for _, record := range all {
+		if !explicit[record.Domain] {
+			merged = append(merged, record)
+		}
+	}
+	return append(merged, records...)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"github.com/whoisfisher/mykubespray/pkg/db"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"time"
+)
+
+type TerminalService interface {
+	Open(clusterID uint, hostName, user, remoteAddr string, cols, rows int) (*utils.Terminal, *entity.TerminalSession, error)
+	Close(session *entity.TerminalSession, exitCode int, reason string) error
+	IdleTimeout() time.Duration
+	ListSessions(clusterID uint) ([]entity.TerminalSession, error)
+}
+
+type terminalService struct {
+	clusterService ClusterService
+}
+
+func NewTerminalService() terminalService {
+	return terminalService{clusterService: NewClusterService()}
+}
+
+// Open starts a shell on a host of a cluster for user and records the session.
+func (ts terminalService) Open(clusterID uint, hostName, user, remoteAddr string, cols, rows int) (*utils.Terminal, *entity.TerminalSession, error) {
+	conf, err := ts.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return nil, nil, err
+	}
+	host, err := findHost(conf, hostName)
+	if err != nil {
+		return nil, nil, err
+	}
+	executor, err := utils.GetSSHExecutorPool().Executor(*host)
+	if err != nil {
+		return nil, nil, err
+	}
+	terminal, err := executor.OpenTerminal(cols, rows)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to open terminal on %s: %s", hostName, err.Error())
+		return nil, nil, err
+	}
+	session := &entity.TerminalSession{
+		User:       user,
+		ClusterID:  clusterID,
+		Host:       host.Name,
+		Address:    host.Address,
+		RemoteAddr: remoteAddr,
+	}
+	if err := db.SaveTerminalSession(session); err != nil {
+		logger.GetLogger().Errorf("Failed to record terminal session of %s on %s: %s", user, hostName, err.Error())
+		terminal.Close()
+		return nil, nil, err
+	}
+	logger.GetLogger().Infof("Terminal session %d of %s on %s opened", session.ID, user, hostName)
+	return terminal, session, nil
+}
+
+// Close records the end of a session. BytesIn and BytesOut are expected to be set by the caller.
+func (ts terminalService) Close(session *entity.TerminalSession, exitCode int, reason string) error {
+	now := time.Now()
+	session.EndedAt = &now
+	session.ExitCode = exitCode
+	session.CloseReason = reason
+	logger.GetLogger().Infof("Terminal session %d of %s on %s closed: %s", session.ID, session.User, session.Host, reason)
+	return db.SaveTerminalSession(session)
+}
+
+// IdleTimeout is how long a terminal may go without input before it is closed.
+func (ts terminalService) IdleTimeout() time.Duration {
+	viper.SetDefault("terminal.idle_timeout_seconds", 900)
+	return time.Duration(viper.GetInt("terminal.idle_timeout_seconds")) * time.Second
+}
+
+func (ts terminalService) ListSessions(clusterID uint) ([]entity.TerminalSession, error) {
+	return db.ListTerminalSessions(clusterID)
+}
+
+// findHost returns the host of a cluster named name.
+func findHost(conf *entity.KubekeyConf, name string) (*entity.Host, error) {
+	for i := range conf.Hosts {
+		if conf.Hosts[i].Name == name {
+			return &conf.Hosts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("host %s not found in cluster %s", name, conf.ClusterName)
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"github.com/whoisfisher/mykubespray/pkg/utils"
+	"github.com/whoisfisher/mykubespray/pkg/utils/etcd"
+	"github.com/whoisfisher/mykubespray/pkg/utils/oss"
+	"k8s.io/apimachinery/pkg/util/version"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type UpgradeService interface {
+	Plan(ctx context.Context, clusterID uint, version string) (*entity.UpgradePlan, error)
+	Upgrade(ctx context.Context, clusterID uint, version string, logChan chan utils.LogEntry) error
+}
+
+type upgradeService struct {
+	clusterService ClusterService
+	kubekeyService KubekeyService
+}
+
+func NewUpgradeService() upgradeService {
+	return upgradeService{
+		clusterService: NewClusterService(),
+		kubekeyService: NewKubekeyService(),
+	}
+}
+
+// Plan reads the running version of a cluster and computes the rollout to version.
+func (us upgradeService) Plan(ctx context.Context, clusterID uint, version string) (*entity.UpgradePlan, error) {
+	conf, err := us.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	client, err := clusterKubernetesClient(*conf, nil)
+	if err != nil {
+		return nil, err
+	}
+	current, err := client.ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version of cluster %s: %w", conf.ClusterName, err)
+	}
+	available, err := availableVersions(preflightRequirements().ManifestDir)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := upgradePath(current, version, available)
+	if err != nil {
+		return nil, err
+	}
+	deprecated, err := client.DeprecatedAPIsInUse(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.UpgradePlan{
+		ClusterID:      clusterID,
+		CurrentVersion: current,
+		TargetVersion:  steps[len(steps)-1],
+		Steps:          steps,
+		DeprecatedAPIs: deprecated,
+		Blocked:        len(deprecated) > 0,
+	}, nil
+}
+
+// Upgrade backs up etcd and runs the plan one step at a time. After every step all nodes must be ready
+// at the new version and the pods of kube-system healthy, otherwise the rollout stops there.
+func (us upgradeService) Upgrade(ctx context.Context, clusterID uint, version string, logChan chan utils.LogEntry) error {
+	plan, err := us.Plan(ctx, clusterID, version)
+	if err != nil {
+		return err
+	}
+	logChan <- utils.LogEntry{Message: fmt.Sprintf("Upgrading from %s to %s through %s", plan.CurrentVersion, plan.TargetVersion, strings.Join(plan.Steps, ", "))}
+	if plan.Blocked {
+		for _, api := range plan.DeprecatedAPIs {
+			logChan <- utils.LogEntry{Message: fmt.Sprintf("Deprecated API in use: %s", api), IsError: true}
+		}
+		return fmt.Errorf("%d deprecated APIs removed before %s are still in use", len(plan.DeprecatedAPIs), plan.TargetVersion)
+	}
+	conf, err := us.clusterService.GetKubekeyConf(clusterID)
+	if err != nil {
+		return err
+	}
+	client, err := clusterKubernetesClient(*conf, nil)
+	if err != nil {
+		return err
+	}
+	health, err := client.ClusterHealth(ctx, "")
+	if err != nil {
+		return err
+	}
+	if !health.Healthy() {
+		reportHealth(logChan, health)
+		return fmt.Errorf("cluster %s is not healthy, upgrade not started", conf.ClusterName)
+	}
+	logChan <- utils.LogEntry{Message: "Backing up etcd"}
+	if err := backupEtcd(ctx, *conf); err != nil {
+		return fmt.Errorf("etcd backup failed, upgrade not started: %w", err)
+	}
+	viper.SetDefault("upgrade.health_timeout_seconds", 900)
+	timeout := time.Duration(viper.GetInt("upgrade.health_timeout_seconds")) * time.Second
+	for i, step := range plan.Steps {
+		logChan <- utils.LogEntry{Message: fmt.Sprintf("[%d/%d] Upgrading to %s", i+1, len(plan.Steps), step)}
+		if err := us.kubekeyService.UpgradeCluster(ctx, clusterID, step, logChan); err != nil {
+			return fmt.Errorf("upgrade halted at %s: %w", step, err)
+		}
+		logChan <- utils.LogEntry{Message: fmt.Sprintf("[%d/%d] Waiting for nodes and system pods at %s", i+1, len(plan.Steps), step)}
+		health, err := client.WaitClusterHealthy(ctx, step, timeout)
+		if err != nil {
+			reportHealth(logChan, health)
+			return fmt.Errorf("upgrade halted at %s, cluster not healthy after %s", step, timeout)
+		}
+		logChan <- utils.LogEntry{Message: fmt.Sprintf("[%d/%d] Cluster healthy at %s", i+1, len(plan.Steps), step)}
+	}
+	return nil
+}
+
+func reportHealth(logChan chan utils.LogEntry, health *entity.ClusterHealth) {
+	for _, node := range health.UnreadyNodes {
+		logChan <- utils.LogEntry{Message: fmt.Sprintf("Node %s is not ready", node), IsError: true}
+	}
+	for _, node := range health.OutdatedNodes {
+		logChan <- utils.LogEntry{Message: fmt.Sprintf("Node %s runs an outdated kubelet", node), IsError: true}
+	}
+	for _, pod := range health.UnhealthyPods {
+		logChan <- utils.LogEntry{Message: fmt.Sprintf("Pod kube-system/%s is not healthy", pod), IsError: true}
+	}
+}
+
+// availableVersions lists the Kubernetes versions with a kk manifest in dir.
+func availableVersions(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "manifest-v*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, file := range files {
+		name := filepath.Base(file)
+		versions = append(versions, strings.TrimSuffix(strings.TrimPrefix(name, "manifest-"), ".yaml"))
+	}
+	return versions, nil
+}
+
+// upgradePath returns the versions to upgrade through, one minor version at a time, taking the
+// latest available patch of every intermediate minor version.
+func upgradePath(current, target string, available []string) ([]string, error) {
+	from, err := version.ParseGeneric(current)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current version %s: %w", current, err)
+	}
+	to, err := version.ParseGeneric(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target version %s: %w", target, err)
+	}
+	if !from.LessThan(to) {
+		return nil, fmt.Errorf("target version %s is not newer than %s", target, current)
+	}
+	if from.Major() != to.Major() {
+		return nil, fmt.Errorf("cannot upgrade from %s to another major version %s", current, target)
+	}
+	latest := make(map[uint]*version.Version)
+	names := make(map[string]string)
+	found := false
+	for _, item := range available {
+		v, err := version.ParseGeneric(item)
+		if err != nil || v.Major() != to.Major() {
+			continue
+		}
+		names[v.String()] = item
+		if v.EqualTo(to) {
+			found = true
+		}
+		if previous, ok := latest[v.Minor()]; !ok || previous.LessThan(v) {
+			latest[v.Minor()] = v
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no manifest for version %s, available versions are %s", target, strings.Join(sortedVersions(available), ", "))
+	}
+	// The manifest names the version the way the nodes report it, e.g. v1.25.10 for a target of 1.25.10.
+	target = names[to.String()]
+	if from.Minor() == to.Minor() {
+		return []string{target}, nil
+	}
+	var steps []string
+	for minor := from.Minor() + 1; minor < to.Minor(); minor++ {
+		v, ok := latest[minor]
+		if !ok {
+			return nil, fmt.Errorf("no manifest for %d.%d, upgrades must go one minor version at a time", to.Major(), minor)
+		}
+		steps = append(steps, names[v.String()])
+	}
+	return append(steps, target), nil
+}
+
+func sortedVersions(versions []string) []string {
+	sorted := append([]string{}, versions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, errA := version.ParseGeneric(sorted[i])
+		b, errB := version.ParseGeneric(sorted[j])
+		if errA != nil || errB != nil {
+			return sorted[i] < sorted[j]
+		}
+		return a.LessThan(b)
+	})
+	return sorted
+}
+
+// backupEtcd saves an etcd snapshot of the first etcd member to the storage of the etcd_backup section.
+func backupEtcd(ctx context.Context, conf entity.KubekeyConf) error {
+	endpoint := viper.GetString("etcd_backup.s3.endpoint")
+	if endpoint == "" {
+		return fmt.Errorf("etcd backup storage is not configured, set etcd_backup.s3 in the config file")
+	}
+	if len(conf.Etcds) == 0 {
+		return fmt.Errorf("cluster %s has no etcd member", conf.ClusterName)
+	}
+	var member *entity.Host
+	for i, host := range conf.Hosts {
+		if host.Name == conf.Etcds[0] {
+			member = &conf.Hosts[i]
+		}
+	}
+	if member == nil {
+		return fmt.Errorf("etcd member %s is not in the inventory of cluster %s", conf.Etcds[0], conf.ClusterName)
+	}
+	viper.SetDefault("etcd_backup.backup_dir", "/data/etcd-backup")
+	viper.SetDefault("etcd_backup.local_path", "/tmp")
+	viper.SetDefault("etcd_backup.s3.bucket", "etcd")
+	viper.SetDefault("etcd_backup.s3.region", "us-east-1")
+	uploader, err := oss.NewS3(endpoint,
+		viper.GetString("etcd_backup.s3.access_key_id"),
+		viper.GetString("etcd_backup.s3.secret_access_key"),
+		viper.GetString("etcd_backup.s3.bucket"),
+		viper.GetString("etcd_backup.s3.region"),
+		viper.GetBool("etcd_backup.s3.use_ssl"))
+	if err != nil {
+		return err
+	}
+	manager, err := etcd.NewBackupManager(*member, viper.GetString("etcd_backup.backup_dir"), viper.GetString("etcd_backup.local_path"), conf.ClusterName, uploader)
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+	err = manager.BackupEtcdContext(ctx)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to back up etcd of cluster %s: %s", conf.ClusterName, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpgradePath(t *testing.T) {
+	available := []string{"v1.24.9", "v1.24.17", "v1.25.3", "v1.25.10", "v1.26.5", "v1.26.15", "v1.27.4"}
+	tests := []struct {
+		current  string
+		target   string
+		expected []string
+	}{
+		{"v1.25.3", "v1.25.10", []string{"v1.25.10"}},
+		{"v1.25.3", "1.25.10", []string{"v1.25.10"}},
+		{"v1.24.9", "v1.25.10", []string{"v1.25.10"}},
+		{"v1.24.9", "v1.27.4", []string{"v1.25.10", "v1.26.15", "v1.27.4"}},
+		{"v1.24.9", "1.27.4", []string{"v1.25.10", "v1.26.15", "v1.27.4"}},
+		{"v1.25.3", "v1.28.0", nil},
+		{"v1.26.5", "v1.25.10", nil},
+		{"v1.26.5", "v1.26.5", nil},
+		{"v1.22.1", "v1.25.10", nil},
+		{"v1.23.1", "v1.25.10", []string{"v1.24.17", "v1.25.10"}},
+		{"v1.25.3", "latest", nil},
+	}
+	for _, test := range tests {
+		steps, err := upgradePath(test.current, test.target, available)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("Expected %s to %s to be rejected, got %v", test.current, test.target, steps)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(steps, test.expected) {
+			t.Errorf("Expected %s to %s through %v, got %v, %v", test.current, test.target, test.expected, steps, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"io"
+	"strings"
+	"sync"
+)
+
+// becomeMarker is printed by commands escalated with su or doas once the password is accepted,
+// which tells the password prompt apart from the output of the command.
+const becomeMarker = "__mykubespray_become__"
+
+// escalation is a command wrapped to run as root.
+type escalation struct {
+	command string
+	// password goes to stdin before any input, or in answer to the prompt when prompt is set.
+	password string
+	prompt   bool
+}
+
+// escalate wraps command for the become method. The password is never part of the command.
+func escalate(become entity.Become, password, command string) escalation {
+	switch become.Method {
+	case entity.BecomeNone:
+		return escalation{command: command}
+	case entity.BecomeSudoNoPassword:
+		return escalation{command: "sudo -n -- sh -c " + shellQuote(command)}
+	case entity.BecomeSu:
+		return escalation{
+			command:  fmt.Sprintf("su -c %s root", shellQuote("echo "+becomeMarker+"; "+command)),
+			password: password,
+			prompt:   true,
+		}
+	case entity.BecomeDoas:
+		if password == "" {
+			return escalation{command: "doas -n -- sh -c " + shellQuote(command)}
+		}
+		return escalation{
+			command:  "doas -- sh -c " + shellQuote("echo "+becomeMarker+"; "+command),
+			password: password,
+			prompt:   true,
+		}
+	default:
+		if password == "" {
+			return escalation{command: "sudo -n -- sh -c " + shellQuote(command)}
+		}
+		// -k makes sudo ask for the password even with cached credentials, so it always consumes
+		// the first line of stdin.
+		return escalation{command: "sudo -S -k -p '' -- sh -c " + shellQuote(command), password: password}
+	}
+}
+
+// identity caches the name of the SSH user of a connection and whether sudo asks it for a password.
+type identity struct {
+	mutex          sync.Mutex
+	user           string
+	sudoProbed     bool
+	sudoNoPassword bool
+}
+
+// promptResponder is the output of a command escalated with su or doas on a terminal. It answers
+// the password prompt and drops everything up to becomeMarker, then passes the output on without
+// carriage returns and feeds input to the command.
+type promptResponder struct {
+	out      io.Writer
+	stdin    io.WriteCloser
+	password string
+	input    io.Reader
+	mutex    sync.Mutex
+	pending  []byte
+	answered bool
+	started  bool
+}
+
+func (responder *promptResponder) Write(p []byte) (int, error) {
+	responder.mutex.Lock()
+	defer responder.mutex.Unlock()
+	n := len(p)
+	if !responder.started {
+		responder.pending = append(responder.pending, p...)
+		i := bytes.Index(responder.pending, []byte(becomeMarker))
+		if i < 0 {
+			if !responder.answered && bytes.Contains(bytes.ToLower(responder.pending), []byte("password")) {
+				responder.answered = true
+				io.WriteString(responder.stdin, responder.password+"\n")
+			}
+			return n, nil
+		}
+		responder.started = true
+		p = responder.pending[i+len(becomeMarker):]
+		p = bytes.TrimPrefix(bytes.TrimPrefix(p, []byte("\r")), []byte("\n"))
+		responder.pending = nil
+		go func() {
+			if responder.input != nil {
+				io.Copy(responder.stdin, responder.input)
+			}
+			responder.stdin.Close()
+		}()
+	}
+	_, err := responder.out.Write(bytes.ReplaceAll(p, []byte("\r"), nil))
+	return n, err
+}
+
+// failure returns what the command printed before it failed to escalate, e.g. an authentication error.
+func (responder *promptResponder) failure() string {
+	responder.mutex.Lock()
+	defer responder.mutex.Unlock()
+	return strings.TrimSpace(string(bytes.ReplaceAll(responder.pending, []byte("\r"), nil)))
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"strings"
+	"time"
+)
+
+var certTimeLayouts = []string{
+	"Jan 02, 2006 15:04 MST",
+	"Jan 2, 2006 15:04 MST",
+	"Jan 02, 2006 15:04:05 MST",
+	time.RFC3339,
+}
+
+// ParseCertExpiration extracts the certificate and certificate authority tables printed by
+// kk certs check-expiration. Columns are located by their offset in the header line because
+// kk leaves cells such as the authority of kubeconfig files empty. Log lines around the tables are ignored.
+func ParseCertExpiration(output string) []entity.ClusterCert {
+	var certs []entity.ClusterCert
+	var header []certColumn
+	now := time.Now()
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if columns := parseCertHeader(line); columns != nil {
+			header = columns
+			continue
+		}
+		if header == nil || strings.TrimSpace(line) == "" {
+			header = nil
+			continue
+		}
+		cert := entity.ClusterCert{CheckedAt: now}
+		valid := false
+		for i, column := range header {
+			value := certCell(line, header, i)
+			switch column.name {
+			case "CERTIFICATE", "CERTIFICATE AUTHORITY":
+				if i == 0 {
+					cert.Name = value
+					cert.IsCA = column.name == "CERTIFICATE AUTHORITY"
+				} else {
+					cert.CA = value
+				}
+			case "EXPIRES":
+				cert.ExpiresAt, valid = parseCertTime(value)
+			case "RESIDUAL TIME":
+				cert.ResidualTime = value
+			case "NODE":
+				cert.Node = value
+			}
+		}
+		if valid && cert.Name != "" {
+			cert.ResidualDays = ResidualDays(cert.ExpiresAt, now)
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
+
+// ResidualDays is the number of whole days left before expires, negative once expired.
+func ResidualDays(expires, now time.Time) int {
+	return int(expires.Sub(now).Hours() / 24)
+}
+
+type certColumn struct {
+	name  string
+	start int
+}
+
+var certHeaderNames = []string{"CERTIFICATE AUTHORITY", "CERTIFICATE", "EXPIRES", "RESIDUAL TIME", "NODE"}
+
+func parseCertHeader(line string) []certColumn {
+	if !strings.HasPrefix(line, "CERTIFICATE") || !strings.Contains(line, "EXPIRES") {
+		return nil
+	}
+	var columns []certColumn
+	rest := line
+	offset := 0
+	for len(strings.TrimSpace(rest)) > 0 {
+		trimmed := strings.TrimLeft(rest, " \t")
+		offset += len(rest) - len(trimmed)
+		rest = trimmed
+		matched := ""
+		for _, name := range certHeaderNames {
+			if strings.HasPrefix(rest, name) {
+				matched = name
+				break
+			}
+		}
+		if matched == "" {
+			return nil
+		}
+		columns = append(columns, certColumn{name: matched, start: offset})
+		rest = rest[len(matched):]
+		offset += len(matched)
+	}
+	return columns
+}
+
+func certCell(line string, header []certColumn, i int) string {
+	start := header[i].start
+	if start >= len(line) {
+		return ""
+	}
+	end := len(line)
+	if i+1 < len(header) && header[i+1].start < end {
+		end = header[i+1].start
+	}
+	return strings.TrimSpace(line[start:end])
+}
+
+func parseCertTime(value string) (time.Time, bool) {
+	for _, layout := range certTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"strings"
+	"testing"
+	"time"
+)
+
+// kkCheckExpiration is the output of kk certs check-expiration for a cluster with one control-plane node.
+const kkCheckExpiration = `08:41:02 CST [GreetingsModule] Greetings
+08:41:02 CST message: [master1]
+Greetings, KubeKey!
+08:41:02 CST success: [master1]
+08:41:02 CST [CheckCertsModule] Check cluster certs
+08:41:03 CST success: [master1]
+08:41:03 CST [PrintClusterCertsModule] Display cluster certs form
+CERTIFICATE                    EXPIRES                  RESIDUAL TIME   CERTIFICATE AUTHORITY   NODE
+apiserver.crt                  Mar 05, 2025 02:17 UTC   364d            ca                      master1
+apiserver-kubelet-client.crt   Mar 05, 2025 02:17 UTC   364d            ca                      master1
+front-proxy-client.crt         Mar 05, 2025 02:17 UTC   364d            front-proxy-ca          master1
+admin.conf                     Mar 05, 2025 02:17 UTC   364d                                    master1
+controller-manager.conf        Mar 05, 2025 02:17 UTC   364d                                    master1
+
+CERTIFICATE AUTHORITY   EXPIRES                  RESIDUAL TIME   NODE
+ca.crt                  Mar 03, 2034 02:17 UTC   9y              master1
+front-proxy-ca.crt      Mar 03, 2034 02:17 UTC   9y              master1
+08:41:03 CST success: [LocalHost]
+08:41:03 CST Pipeline[CheckCertsPipeline] execute successfully
+`
+
+func TestParseCertExpiration(t *testing.T) {
+	leaf := time.Date(2025, time.March, 5, 2, 17, 0, 0, time.UTC)
+	root := time.Date(2034, time.March, 3, 2, 17, 0, 0, time.UTC)
+	kkCerts := []entity.ClusterCert{
+		{Name: "apiserver.crt", ExpiresAt: leaf, ResidualTime: "364d", CA: "ca", Node: "master1"},
+		{Name: "apiserver-kubelet-client.crt", ExpiresAt: leaf, ResidualTime: "364d", CA: "ca", Node: "master1"},
+		{Name: "front-proxy-client.crt", ExpiresAt: leaf, ResidualTime: "364d", CA: "front-proxy-ca", Node: "master1"},
+		{Name: "admin.conf", ExpiresAt: leaf, ResidualTime: "364d", Node: "master1"},
+		{Name: "controller-manager.conf", ExpiresAt: leaf, ResidualTime: "364d", Node: "master1"},
+		{Name: "ca.crt", ExpiresAt: root, ResidualTime: "9y", Node: "master1", IsCA: true},
+		{Name: "front-proxy-ca.crt", ExpiresAt: root, ResidualTime: "9y", Node: "master1", IsCA: true},
+	}
+	tests := []struct {
+		name     string
+		output   string
+		expected []entity.ClusterCert
+	}{
+		{name: "kk output", output: kkCheckExpiration, expected: kkCerts},
+		{name: "CRLF line endings", output: strings.ReplaceAll(kkCheckExpiration, "\n", "\r\n"), expected: kkCerts},
+		{
+			name: "expired certificate and unparsable date",
+			output: "CERTIFICATE     EXPIRES                  RESIDUAL TIME   CERTIFICATE AUTHORITY   NODE\n" +
+				"apiserver.crt   Jan 7, 2023 09:05 UTC    <invalid>       ca                      master2\n" +
+				"etcd.crt        never                    -               ca                      master2\n",
+			expected: []entity.ClusterCert{
+				{Name: "apiserver.crt", ExpiresAt: time.Date(2023, time.January, 7, 9, 5, 0, 0, time.UTC), ResidualTime: "<invalid>", CA: "ca", Node: "master2"},
+			},
+		},
+		{
+			name:   "no table",
+			output: "08:41:02 CST [GreetingsModule] Greetings\nerror: Pipeline[CheckCertsPipeline] execute failed\n",
+		},
+	}
+	for _, test := range tests {
+		certs := ParseCertExpiration(test.output)
+		if len(certs) != len(test.expected) {
+			t.Errorf("%s: expected %d certificates, got %+v", test.name, len(test.expected), certs)
+			continue
+		}
+		for i, expected := range test.expected {
+			cert := certs[i]
+			if cert.Name != expected.Name || !cert.ExpiresAt.Equal(expected.ExpiresAt) || cert.ResidualTime != expected.ResidualTime ||
+				cert.CA != expected.CA || cert.Node != expected.Node || cert.IsCA != expected.IsCA {
+				t.Errorf("%s: expected certificate %d to be %+v, got %+v", test.name, i, expected, cert)
+			}
+		}
+	}
+}
+
+func TestResidualDays(t *testing.T) {
+	now := time.Date(2024, time.March, 6, 2, 17, 0, 0, time.UTC)
+	for expires, expected := range map[time.Time]int{now.Add(364 * 24 * time.Hour): 364, now.Add(36 * time.Hour): 1, now.Add(-49 * time.Hour): -2} {
+		if days := ResidualDays(expires, now); days != expected {
+			t.Errorf("Expected %s to be %d days away, got %d", expires, expected, days)
+		}
+	}
+}
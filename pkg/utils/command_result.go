@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"golang.org/x/crypto/ssh"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const redacted = "******"
+
+// passwordArgument matches password options and assignments such as --password=x or PASSWORD x.
+// -p x is left alone, it means something else for most commands.
+var passwordArgument = regexp.MustCompile(`(?i)((?:--)?[a-z_-]*password[a-z_-]*(?:=|\s+))('[^']*'|"[^"]*"|\S+)`)
+
+// CommandError is returned by Output for commands that exit with a non-zero status.
+type CommandError struct {
+	Result *entity.CommandResult
+}
+
+func (e *CommandError) Error() string {
+	stderr := strings.TrimSpace(e.Result.Stderr)
+	if stderr == "" {
+		stderr = strings.TrimSpace(e.Result.Stdout)
+	}
+	return fmt.Sprintf("command %q on %s exited with status %d: %s", e.Result.Command, e.Result.Host, e.Result.ExitCode, stderr)
+}
+
+// Run runs command and reports its stdout, stderr and exit status.
+func (executor *SSHExecutor) Run(command string) (*entity.CommandResult, error) {
+	return executor.RunContext(context.Background(), command)
+}
+
+// RunContext runs command and reports its stdout, stderr and exit status. A non-zero exit status is not
+// an error, err is only set when the command could not be run to completion. Stdout and stderr are
+// merged when the become method of the host needs a terminal.
+func (executor *SSHExecutor) RunContext(ctx context.Context, command string) (*entity.CommandResult, error) {
+	result := &entity.CommandResult{Host: executor.address(), Command: executor.redact(command)}
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	err := executor.run(ctx, command, nil, &stdout, &stderr)
+	result.Duration = time.Since(start)
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitStatus()
+		err = nil
+	default:
+		result.ExitCode = -1
+		result.Error = err.Error()
+	}
+	logger.GetLogger().Debugf("%s on %s exited with status %d in %s", result.Command, result.Host, result.ExitCode, result.Duration)
+	return result, err
+}
+
+// Output runs command and returns its stdout. A non-zero exit status is returned as *CommandError.
+func (executor *SSHExecutor) Output(command string) (string, error) {
+	return executor.OutputContext(context.Background(), command)
+}
+
+// OutputContext is Output with a context, see RunContext.
+func (executor *SSHExecutor) OutputContext(ctx context.Context, command string) (string, error) {
+	result, err := executor.RunContext(ctx, command)
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return result.Stdout, &CommandError{Result: result}
+	}
+	return result.Stdout, nil
+}
+
+// address names the host in results, the address of the host or of the connection if the executor
+// was created from a bare connection.
+func (executor *SSHExecutor) address() string {
+	if executor.Host.Address != "" {
+		return executor.Host.Address
+	}
+	if executor.Connection.Client != nil {
+		return executor.Connection.Client.RemoteAddr().String()
+	}
+	return ""
+}
+
+func (executor *SSHExecutor) redact(command string) string {
+	return redact(executor.Host, command)
+}
+
+// redact hides the passwords of host and password arguments in command.
+func redact(host entity.Host, command string) string {
+	secrets := []string{host.Password, host.Become.Password}
+	for _, jumpHost := range host.JumpHosts {
+		secrets = append(secrets, jumpHost.Password)
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			command = strings.ReplaceAll(command, secret, redacted)
+		}
+	}
+	return passwordArgument.ReplaceAllString(command, "${1}"+redacted)
+}
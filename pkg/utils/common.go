@@ -19,6 +19,9 @@ type LogEntry struct {
 	IsError bool   // 是否为错误日志
 }
 
+// PipelineDone is the last LogEntry ExecuteCommand sends once the remote command has exited.
+const PipelineDone = "Pipeline Done"
+
 func DecodeBytes(data []byte, decoder *encoding.Decoder) (string, error) {
 	reader := transform.NewReader(bytes.NewReader(data), decoder)
 	decodedData, err := io.ReadAll(reader)
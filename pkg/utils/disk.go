@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"regexp"
+	"strings"
+)
+
+// diskListCommand lists the block devices by path, see parseLsblk.
+const diskListCommand = "lsblk -J -b -p -o NAME,TYPE,SIZE,MODEL,ROTA,RO,FSTYPE,MOUNTPOINT"
+
+var (
+	devicePattern       = regexp.MustCompile(`^/dev/[a-zA-Z0-9_.:/\-]+$`)
+	lvmNamePattern      = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.+\-]*$`)
+	diskSizePattern     = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[kKmMgGtTpP]?$`)
+	mountpointPattern   = regexp.MustCompile(`^(/[a-zA-Z0-9_.\-]+)+$`)
+	mountOptionsPattern = regexp.MustCompile(`^[a-zA-Z0-9_=,.:\-]+$`)
+)
+
+// DiskProvisioner lists, provisions and grows the disks of a host. The commands that change the host are
+// planned first, so that a dry run shows exactly what would run.
+type DiskProvisioner struct {
+	OSClient OSClient
+}
+
+func NewDiskProvisioner(osClient OSClient) *DiskProvisioner {
+	return &DiskProvisioner{OSClient: osClient}
+}
+
+// ValidateDiskProvisionRequest applies the defaults of request and rejects settings that cannot be applied.
+func ValidateDiskProvisionRequest(request *entity.DiskProvisionRequest) error {
+	if request.Layout == "" {
+		request.Layout = entity.DiskLayoutLVM
+	}
+	if request.Filesystem == "" {
+		request.Filesystem = entity.FilesystemXFS
+	}
+	if request.MountOptions == "" {
+		request.MountOptions = "defaults"
+	}
+	if !devicePattern.MatchString(request.Device) {
+		return fmt.Errorf("invalid device %s, expected e.g. /dev/sdb", request.Device)
+	}
+	switch request.Layout {
+	case entity.DiskLayoutLVM:
+		if !lvmNamePattern.MatchString(request.VGName) || !lvmNamePattern.MatchString(request.LVName) {
+			return fmt.Errorf("invalid VG %q or LV %q", request.VGName, request.LVName)
+		}
+		if request.Size != "" && !diskSizePattern.MatchString(request.Size) {
+			return fmt.Errorf("invalid size %s, expected e.g. 50G", request.Size)
+		}
+	case entity.DiskLayoutPartition:
+		if request.Size != "" {
+			return fmt.Errorf("the partition layout always uses the whole disk, size is only supported with lvm")
+		}
+	default:
+		return fmt.Errorf("unknown layout %s", request.Layout)
+	}
+	switch request.Filesystem {
+	case entity.FilesystemXFS, entity.FilesystemExt4:
+	default:
+		return fmt.Errorf("unsupported filesystem %s, expected xfs or ext4", request.Filesystem)
+	}
+	if !mountpointPattern.MatchString(request.Mountpoint) {
+		return fmt.Errorf("invalid mountpoint %s, expected e.g. /var/lib/containerd", request.Mountpoint)
+	}
+	if !mountOptionsPattern.MatchString(request.MountOptions) {
+		return fmt.Errorf("invalid mount options %s", request.MountOptions)
+	}
+	return nil
+}
+
+// ValidateDiskGrowRequest rejects settings that cannot be applied.
+func ValidateDiskGrowRequest(request entity.DiskGrowRequest) error {
+	if !lvmNamePattern.MatchString(request.VGName) || !lvmNamePattern.MatchString(request.LVName) {
+		return fmt.Errorf("invalid VG %q or LV %q", request.VGName, request.LVName)
+	}
+	if request.Device != "" && !devicePattern.MatchString(request.Device) {
+		return fmt.Errorf("invalid device %s, expected e.g. /dev/sdb", request.Device)
+	}
+	if request.Size != "" && !diskSizePattern.MatchString(request.Size) {
+		return fmt.Errorf("invalid size %s, expected e.g. 20G", request.Size)
+	}
+	return nil
+}
+
+func (provisioner *DiskProvisioner) root() *SSHExecutor {
+	return provisioner.OSClient.SSExecutor.AsRoot()
+}
+
+// UnusedDisks returns the disks without partitions, filesystem, PV or mount. Their names are device paths.
+func (provisioner *DiskProvisioner) UnusedDisks(ctx context.Context) ([]entity.BlockDevice, error) {
+	output, err := provisioner.OSClient.SSExecutor.OutputContext(ctx, diskListCommand)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := parseLsblk(output)
+	if err != nil {
+		return nil, err
+	}
+	var disks []entity.BlockDevice
+	for _, device := range devices {
+		if device.Type == "disk" && !device.ReadOnly && device.FSType == "" && device.Mountpoint == "" && len(device.Children) == 0 {
+			disks = append(disks, device)
+		}
+	}
+	return disks, nil
+}
+
+// checkUnused fails unless device is an unused disk.
+func (provisioner *DiskProvisioner) checkUnused(ctx context.Context, device string) error {
+	disks, err := provisioner.UnusedDisks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, disk := range disks {
+		if disk.Name == device {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not an unused disk, it has partitions, a filesystem, a PV or is mounted", device)
+}
+
+// Provision plans the commands of request and runs them unless it is a dry run. Requests that cannot
+// be applied to the host are rejected before anything runs, failed commands are reported.
+func (provisioner *DiskProvisioner) Provision(ctx context.Context, request entity.DiskProvisionRequest) (*entity.DiskReport, error) {
+	if err := ValidateDiskProvisionRequest(&request); err != nil {
+		return nil, err
+	}
+	if err := provisioner.checkUnused(ctx, request.Device); err != nil {
+		return nil, err
+	}
+	result, err := provisioner.OSClient.SSExecutor.RunContext(ctx, "mountpoint -q "+request.Mountpoint)
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode == 0 {
+		return nil, fmt.Errorf("%s is mounted already", request.Mountpoint)
+	}
+	fstab, err := provisioner.OSClient.SSExecutor.OutputContext(ctx, fmt.Sprintf(`awk '!/^[[:space:]]*#/ && $2 == "%s"' /etc/fstab`, request.Mountpoint))
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(fstab) != "" {
+		return nil, fmt.Errorf("/etc/fstab mounts %s already: %s", request.Mountpoint, strings.TrimSpace(fstab))
+	}
+
+	var commands []string
+	var target string
+	if request.Layout == entity.DiskLayoutLVM {
+		result, err := provisioner.root().RunContext(ctx, "vgs "+request.VGName)
+		if err != nil {
+			return nil, err
+		}
+		if result.ExitCode == 0 {
+			return nil, fmt.Errorf("VG %s exists already", request.VGName)
+		}
+		extent := "-l 100%FREE"
+		if request.Size != "" {
+			extent = "-L " + request.Size
+		}
+		target = fmt.Sprintf("/dev/%s/%s", request.VGName, request.LVName)
+		commands = append(commands,
+			"pvcreate "+request.Device,
+			fmt.Sprintf("vgcreate %s %s", request.VGName, request.Device),
+			fmt.Sprintf("lvcreate -y -n %s %s %s", request.LVName, extent, request.VGName),
+		)
+	} else {
+		target = partitionPath(request.Device, 1)
+		commands = append(commands,
+			fmt.Sprintf("parted -s %s mklabel gpt mkpart primary %s 0%% 100%%", request.Device, request.Filesystem),
+			"udevadm settle",
+		)
+	}
+	if request.Filesystem == entity.FilesystemXFS {
+		commands = append(commands, "mkfs.xfs "+target)
+	} else {
+		commands = append(commands, "mkfs.ext4 -q "+target)
+	}
+	// The filesystem is mounted by UUID before it goes into /etc/fstab, so that a filesystem that does not
+	// mount never leaves an entry behind that would stop the next boot.
+	uuid := fmt.Sprintf(`"$(blkid -s UUID -o value %s)"`, target)
+	commands = append(commands,
+		"mkdir -p "+request.Mountpoint,
+		"test -n "+uuid,
+		fmt.Sprintf("mount -o %s UUID=%s %s", request.MountOptions, uuid, request.Mountpoint),
+		fmt.Sprintf(`printf 'UUID=%%s %s %s %s 0 0\n' %s >> /etc/fstab`, request.Mountpoint, request.Filesystem, request.MountOptions, uuid),
+	)
+	return provisioner.run(ctx, commands, request.DryRun), nil
+}
+
+// Grow plans the commands that grow an LV and its filesystem and runs them unless it is a dry run. The
+// filesystem is grown with xfs_growfs or resize2fs, depending on what it is.
+func (provisioner *DiskProvisioner) Grow(ctx context.Context, request entity.DiskGrowRequest) (*entity.DiskReport, error) {
+	if err := ValidateDiskGrowRequest(request); err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("/dev/%s/%s", request.VGName, request.LVName)
+	result, err := provisioner.root().RunContext(ctx, fmt.Sprintf("lvs %s/%s", request.VGName, request.LVName))
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("LV %s/%s does not exist", request.VGName, request.LVName)
+	}
+	filesystem, mountpoint, err := provisioner.filesystem(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var commands []string
+	if request.Device != "" {
+		if err := provisioner.checkUnused(ctx, request.Device); err != nil {
+			return nil, err
+		}
+		commands = append(commands, "pvcreate "+request.Device, fmt.Sprintf("vgextend %s %s", request.VGName, request.Device))
+	}
+	extent := "-l +100%FREE"
+	if request.Size != "" {
+		extent = "-L +" + request.Size
+	}
+	commands = append(commands, fmt.Sprintf("lvextend %s %s", extent, path))
+	switch filesystem {
+	case "xfs":
+		if mountpoint == "" {
+			return nil, fmt.Errorf("the xfs filesystem on %s can only be grown while it is mounted", path)
+		}
+		commands = append(commands, "xfs_growfs "+mountpoint)
+	case "ext2", "ext3", "ext4":
+		commands = append(commands, "resize2fs "+path)
+	case "":
+		return nil, fmt.Errorf("%s has no filesystem", path)
+	default:
+		return nil, fmt.Errorf("growing %s filesystems is not supported", filesystem)
+	}
+	return provisioner.run(ctx, commands, request.DryRun), nil
+}
+
+// filesystem returns the type of the filesystem on device and where it is mounted, if it is.
+func (provisioner *DiskProvisioner) filesystem(ctx context.Context, device string) (string, string, error) {
+	// xfs /var/lib/etcd
+	output, err := provisioner.root().OutputContext(ctx, fmt.Sprintf("findmnt -n -o FSTYPE,TARGET --source %s || true", device))
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if fields := strings.Fields(lines[0]); len(fields) == 2 {
+		return fields[0], fields[1], nil
+	}
+	output, err = provisioner.root().OutputContext(ctx, fmt.Sprintf("blkid -s TYPE -o value %s || true", device))
+	return strings.TrimSpace(output), "", err
+}
+
+// partitionPath returns the path of a partition of disk, /dev/sdb1 or /dev/nvme0n1p1.
+func partitionPath(disk string, number int) string {
+	if last := disk[len(disk)-1]; last >= '0' && last <= '9' {
+		return fmt.Sprintf("%sp%d", disk, number)
+	}
+	return fmt.Sprintf("%s%d", disk, number)
+}
+
+// run runs commands as root in order until one fails, or only plans them with dryRun.
+func (provisioner *DiskProvisioner) run(ctx context.Context, commands []string, dryRun bool) *entity.DiskReport {
+	report := &entity.DiskReport{Host: provisioner.OSClient.SSExecutor.Host.Name, DryRun: dryRun}
+	for _, command := range commands {
+		step := entity.DiskCommand{Command: command, Status: entity.DiskCommandPlanned}
+		switch {
+		case dryRun:
+		case report.Error != "":
+			step.Status = entity.DiskCommandSkipped
+		default:
+			output, err := provisioner.root().OutputContext(ctx, command)
+			step.Status, step.Output = entity.DiskCommandOK, strings.TrimSpace(output)
+			if err != nil {
+				step.Status, step.Output = entity.DiskCommandFailed, err.Error()
+				report.Error = fmt.Sprintf("%s failed", command)
+				logger.GetLogger().Errorf("Failed to provision disks of %s: %s", report.Host, err.Error())
+			}
+		}
+		report.Commands = append(report.Commands, step)
+	}
+	return report
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils/sshtest"
+	"strings"
+	"testing"
+)
+
+const testLsblk = `{"blockdevices": [
+	{"name":"/dev/sda", "type":"disk", "size":53687091200, "model":"QEMU HARDDISK", "rota":true, "ro":false, "fstype":null, "mountpoint":null,
+		"children": [{"name":"/dev/sda1", "type":"part", "size":53686042624, "model":null, "rota":true, "ro":false, "fstype":"xfs", "mountpoint":"/"}]},
+	{"name":"/dev/sdb", "type":"disk", "size":107374182400, "model":"QEMU HARDDISK", "rota":true, "ro":false, "fstype":null, "mountpoint":null},
+	{"name":"/dev/sdc", "type":"disk", "size":107374182400, "model":"QEMU HARDDISK", "rota":true, "ro":false, "fstype":"LVM2_member", "mountpoint":null},
+	{"name":"/dev/sr0", "type":"rom", "size":1073741312, "model":"QEMU DVD-ROM", "rota":true, "ro":false, "fstype":null, "mountpoint":null}
+]}`
+
+func TestDiskProvisionDryRun(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("root", "secret")
+	server.Respond(`lsblk .*`, sshtest.Response{Stdout: testLsblk})
+	server.Respond(`mountpoint -q .*|vgs .*`, sshtest.Response{ExitCode: 1})
+	server.Respond(`awk .* /etc/fstab`, sshtest.Response{})
+	provisioner := NewDiskProvisioner(OSClient{SSExecutor: *connect(t, server.Host("root", "secret"))})
+
+	disks, err := provisioner.UnusedDisks(context.Background())
+	if err != nil || len(disks) != 1 || disks[0].Name != "/dev/sdb" {
+		t.Fatalf("Expected /dev/sdb to be the only unused disk, got %+v, %v", disks, err)
+	}
+
+	request := entity.DiskProvisionRequest{Device: "/dev/sdb", VGName: "data", LVName: "etcd", Mountpoint: "/var/lib/etcd", DryRun: true}
+	report, err := provisioner.Provision(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected a plan, got %v", err)
+	}
+	var planned []string
+	for _, command := range report.Commands {
+		if command.Status != entity.DiskCommandPlanned {
+			t.Errorf("Expected %q to be planned, got %s", command.Command, command.Status)
+		}
+		planned = append(planned, command.Command)
+	}
+	expected := []string{
+		"pvcreate /dev/sdb",
+		"vgcreate data /dev/sdb",
+		"lvcreate -y -n etcd -l 100%FREE data",
+		"mkfs.xfs /dev/data/etcd",
+		"mkdir -p /var/lib/etcd",
+		`test -n "$(blkid -s UUID -o value /dev/data/etcd)"`,
+		`mount -o defaults UUID="$(blkid -s UUID -o value /dev/data/etcd)" /var/lib/etcd`,
+		`printf 'UUID=%s /var/lib/etcd xfs defaults 0 0\n' "$(blkid -s UUID -o value /dev/data/etcd)" >> /etc/fstab`,
+	}
+	if strings.Join(planned, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the plan\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(planned, "\n"))
+	}
+	for _, command := range server.Commands() {
+		if strings.HasPrefix(command, "pvcreate") || strings.HasPrefix(command, "mkfs") {
+			t.Errorf("Expected a dry run not to change the host, got %q", command)
+		}
+	}
+
+	request.Device = "/dev/sdc"
+	if _, err := provisioner.Provision(context.Background(), request); err == nil {
+		t.Errorf("Expected a PV to be rejected")
+	}
+}
+
+func TestDiskProvisionWithoutUUIDLeavesFstabAlone(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("root", "secret")
+	server.Respond(`lsblk .*`, sshtest.Response{Stdout: testLsblk})
+	server.Respond(`mountpoint -q .*|vgs .*|test -n .*`, sshtest.Response{ExitCode: 1})
+	server.Respond(`awk .* /etc/fstab|pvcreate .*|vgcreate .*|lvcreate .*|mkfs.xfs .*`, sshtest.Response{})
+	provisioner := NewDiskProvisioner(OSClient{SSExecutor: *connect(t, server.Host("root", "secret"))})
+
+	request := entity.DiskProvisionRequest{Device: "/dev/sdb", VGName: "data", LVName: "etcd", Mountpoint: "/var/lib/etcd"}
+	report, err := provisioner.Provision(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Expected a report, got %v", err)
+	}
+	if !strings.HasPrefix(report.Error, "test -n ") {
+		t.Errorf("Expected the missing UUID to fail the run, got %q", report.Error)
+	}
+	for _, command := range server.Commands() {
+		if strings.HasPrefix(command, "mount ") || strings.Contains(command, "/etc/fstab") && !strings.HasPrefix(command, "awk") {
+			t.Errorf("Expected nothing to be mounted or added to /etc/fstab, got %q", command)
+		}
+	}
+}
+
+func TestDiskGrowPicksResize2fsForExt4(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("root", "secret")
+	server.Respond(`lvs centos/root|lvextend .*|resize2fs .*`, sshtest.Response{})
+	server.Respond(`findmnt .*`, sshtest.Response{Stdout: "ext4 /\n"})
+	provisioner := NewDiskProvisioner(OSClient{SSExecutor: *connect(t, server.Host("root", "secret"))})
+
+	report, err := provisioner.Grow(context.Background(), entity.DiskGrowRequest{VGName: "centos", LVName: "root", Size: "20G"})
+	if err != nil || report.Error != "" {
+		t.Fatalf("Expected the LV to grow, got %+v, %v", report, err)
+	}
+	commands := server.Commands()
+	if got := strings.Join(commands[len(commands)-2:], "\n"); got != "lvextend -L +20G /dev/centos/root\nresize2fs /dev/centos/root" {
+		t.Errorf("Expected lvextend and resize2fs, got %q", got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/spf13/viper"
 	"io"
@@ -71,6 +72,18 @@ func aesDecryptWithSalt(key, ciphertext []byte) ([]byte, error) {
 	return ciphertext, nil
 }
 
+// CheckEncryptKey reports why encrypt.key cannot encrypt the passwords kept in the database.
+func CheckEncryptKey() error {
+	switch len(viper.GetString("encrypt.key")) {
+	case 0:
+		return errors.New("encrypt.key is not configured")
+	case 16, 24, 32:
+		return nil
+	default:
+		return errors.New("encrypt.key must be 16, 24 or 32 bytes long")
+	}
+}
+
 func StringEncrypt(text string) (string, error) {
 	key := viper.GetString("encrypt.key")
 	pass := []byte(text)
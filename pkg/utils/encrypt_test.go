@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"github.com/spf13/viper"
+	"testing"
+)
+
+func TestCheckEncryptKey(t *testing.T) {
+	defer viper.Set("encrypt.key", "")
+	for key, valid := range map[string]bool{"": false, "short": false, "0123456789abcdef": true, "0123456789abcdef01234567": true} {
+		viper.Set("encrypt.key", key)
+		if err := CheckEncryptKey(); (err == nil) != valid {
+			t.Errorf("Expected key %q to be valid=%v, got %v", key, valid, err)
+		}
+	}
+
+	viper.Set("encrypt.key", "0123456789abcdef")
+	encrypted, err := StringEncrypt("secret")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if decrypted, err := StringDecrypt(encrypted); err != nil || decrypted != "secret" {
+		t.Errorf("Expected the password back, got %q, %v", decrypted, err)
+	}
+}
@@ -20,11 +20,17 @@ type BackupManager struct {
 	S3Uploader  *oss.S3Uploader
 }
 
-func NewBackupManager(host entity.Host, backupDir, localPath, clusterName string, uploader *oss.S3Uploader) *BackupManager {
+// NewBackupManager connects to the etcd member host. The connection is closed by Close.
+func NewBackupManager(host entity.Host, backupDir, localPath, clusterName string, uploader *oss.S3Uploader) (*BackupManager, error) {
+	connection, err := utils.NewConnection(host)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to connect to etcd member %s: %v", host.Address, err)
+		return nil, fmt.Errorf("Failed to connect to etcd member %s: %w", host.Address, err)
+	}
 	osCOnf := utils.OSConf{}
 	localExecutor := utils.NewLocalExecutor()
-	sshExecutor := utils.NewExecutor(host)
-	osclient := utils.NewOSClient(osCOnf, *sshExecutor, *localExecutor)
+	sshExecutor := utils.SSHExecutor{Connection: *connection, Host: host}
+	osclient := utils.NewOSClient(osCOnf, sshExecutor, *localExecutor)
 
 	return &BackupManager{
 		OSClient:    osclient,
@@ -33,10 +39,20 @@ func NewBackupManager(host entity.Host, backupDir, localPath, clusterName string
 		BackupDir:   backupDir,
 		LocalPath:   localPath,
 		S3Uploader:  uploader,
-	}
+	}, nil
+}
+
+// Close closes the connection to the etcd member.
+func (bm *BackupManager) Close() error {
+	return bm.OSClient.SSExecutor.Connection.Client.Close()
 }
 
 func (bm *BackupManager) BackupEtcd() error {
+	return bm.BackupEtcdContext(context.Background())
+}
+
+// BackupEtcdContext is BackupEtcd, stopping the snapshot and the transfers when ctx is done.
+func (bm *BackupManager) BackupEtcdContext(ctx context.Context) error {
 	fileName := fmt.Sprintf("etcd-backup-%s.db", time.Now().Format("20060102150405"))
 	backupPath := fmt.Sprintf("%s/%s", bm.BackupDir, bm.ClusterName)
 	if !bm.OSClient.SSExecutor.DirIsExist(backupPath) {
@@ -54,21 +70,20 @@ func (bm *BackupManager) BackupEtcd() error {
 		return fmt.Errorf("Error getting backup command: %w", err)
 	}
 
-	output, err := bm.OSClient.SSExecutor.ExecuteShortCommand(cmd)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create snapshot for etcd : %v, output: %s", err, output)
-		return fmt.Errorf("Failed to create snapshot for etcd : %w, output: %s", err, output)
+	if _, err := bm.OSClient.SSExecutor.OutputContext(ctx, cmd); err != nil {
+		logger.GetLogger().Errorf("Failed to create snapshot for etcd : %v", err)
+		return fmt.Errorf("Failed to create snapshot for etcd : %w", err)
 	}
 
 	logger.GetLogger().Infof("etcd snapshot saved to: %s", backupFilePath)
 
 	bm.LocalPath = fmt.Sprintf("%s/%s", bm.LocalPath, fileName)
-	err = bm.OSClient.SSExecutor.Download(backupFilePath, bm.LocalPath)
+	err = bm.OSClient.SSExecutor.DownloadContext(ctx, backupFilePath, bm.LocalPath)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to fetch backup file %s to %s: %v", backupFilePath, bm.LocalPath, err)
 		return fmt.Errorf("Failed to fetch backup file %s to %s: %w", backupFilePath, bm.LocalPath, err)
 	}
-	if _, err := bm.S3Uploader.SimpleUpload(context.TODO(), bm.LocalPath, backupFilePath); err != nil {
+	if _, err := bm.S3Uploader.SimpleUpload(ctx, bm.LocalPath, backupFilePath); err != nil {
 		logger.GetLogger().Errorf("Failed to upload backup file to S3: %v", err)
 		return fmt.Errorf("Failed to upload backup file to S3: %w", err)
 	}
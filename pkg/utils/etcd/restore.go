@@ -189,10 +189,9 @@ func (rm *RestoreManager) restoreEtcdSnapshot(snapshotPath string) error {
 		logger.GetLogger().Errorf("Error getting restore command %s: %v", rm.OSClient.SSExecutor.Host.Name, err)
 		return fmt.Errorf("Error getting restore command %s: %w", rm.OSClient.SSExecutor.Host.Name, err)
 	}
-	output, err := rm.OSClient.SSExecutor.ExecuteShortCommand(command)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to restore snapshot for etcd %s : %v, %s", rm.OSClient.SSExecutor.Host.Name, err, output)
-		return fmt.Errorf("Failed to restore snapshot for etcd %s: %w, %s", rm.OSClient.SSExecutor.Host.Name, err, output)
+	if _, err := rm.OSClient.SSExecutor.Output(command); err != nil {
+		logger.GetLogger().Errorf("Failed to restore snapshot for etcd %s : %v", rm.OSClient.SSExecutor.Host.Name, err)
+		return fmt.Errorf("Failed to restore snapshot for etcd %s: %w", rm.OSClient.SSExecutor.Host.Name, err)
 	}
 
 	logger.GetLogger().Infof("Successfully to restore snapshot %s: %s", rm.OSClient.SSExecutor.Host.Name, snapshotPath)
@@ -218,10 +217,7 @@ func (rm *RestoreManager) PauseKubeAPI() error {
 	manifestPath := "/etc/kubernetes/manifests/kube-apiserver.yaml"
 	tempPath := fmt.Sprintf("/etc/kubernetes/manifests/kube-apiserver.yaml.bak")
 	command := fmt.Sprintf("mv -f %s %s", manifestPath, tempPath)
-	if rm.OSClient.WhoAmI() != "root" {
-		command = utils.SudoPrefixWithPassword(command, rm.OSClient.SSExecutor.Host.Password)
-	}
-	err := rm.OSClient.SSExecutor.ExecuteCommandWithoutReturn(command)
+	err := rm.OSClient.SSExecutor.AsRoot().ExecuteCommandWithoutReturn(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Backup and stop kube-apiserver failure: %v", err)
 		return fmt.Errorf("Backup and stop kube-apiserver failure: %w", err)
@@ -235,10 +231,7 @@ func (rm *RestoreManager) ResumeKubeAPI() error {
 	tempPath := fmt.Sprintf("/etc/kubernetes/manifests/kube-apiserver.yaml.bak")
 
 	command := fmt.Sprintf("mv -f %s %s", tempPath, manifestPath)
-	if rm.OSClient.WhoAmI() != "root" {
-		command = utils.SudoPrefixWithPassword(command, rm.OSClient.SSExecutor.Host.Password)
-	}
-	err := rm.OSClient.SSExecutor.ExecuteCommandWithoutReturn(command)
+	err := rm.OSClient.SSExecutor.AsRoot().ExecuteCommandWithoutReturn(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Restore and start kube-apiserver failure %s: %v", rm.OSClient.SSExecutor.Host.Name, err)
 		return fmt.Errorf("Restore and start kube-apiserver failure %s: %w", rm.OSClient.SSExecutor.Host.Name, err)
@@ -305,10 +298,7 @@ func (rm *RestoreManager) BackupEtcdDir() error {
 	}
 
 	command := fmt.Sprintf("mv -f %s %s", manifestPath, tempPath)
-	if rm.OSClient.WhoAmI() != "root" {
-		command = utils.SudoPrefixWithPassword(command, rm.OSClient.SSExecutor.Host.Password)
-	}
-	err := rm.OSClient.SSExecutor.ExecuteCommandWithoutReturn(command)
+	err := rm.OSClient.SSExecutor.AsRoot().ExecuteCommandWithoutReturn(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Backup %s to %s failure", manifestPath, tempPath)
 		return fmt.Errorf("Backup %s to %s failure", manifestPath, tempPath)
@@ -424,11 +414,10 @@ func (rm *RestoreManager) checkApiServerStatus() error {
 	timeout := time.After(60 * time.Second)
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
-	res, err := rm.OSClient.SSExecutor.ExecuteShortCommand(command)
+	result, err := rm.OSClient.SSExecutor.Run(command)
 	if err != nil {
 		logger.GetLogger().Infof("Please wait for a moment, checking kube-apiserver status: %v.", err)
-	}
-	if len(res) > 0 {
+	} else if result.ExitCode == 0 {
 		logger.GetLogger().Infof("Successfully start kube-apiserver.")
 		return nil
 	}
@@ -439,11 +428,10 @@ func (rm *RestoreManager) checkApiServerStatus() error {
 			logger.GetLogger().Errorf("Timeout while waiting to start kube-apiserver")
 			return fmt.Errorf("Timeout while waiting to start kube-apiserver")
 		case <-ticker.C:
-			res, err := rm.OSClient.SSExecutor.ExecuteShortCommand(command)
+			result, err := rm.OSClient.SSExecutor.Run(command)
 			if err != nil {
 				logger.GetLogger().Infof("Please wait for a moment, checking kube-apiserver status: %v.", err)
-			}
-			if len(res) > 0 {
+			} else if result.ExitCode == 0 {
 				logger.GetLogger().Infof("Successfully start kube-apiserver.")
 				return nil
 			} else {
@@ -458,10 +446,10 @@ func (rm *RestoreManager) checkNodeStatus() error {
 	timeout := time.After(300 * time.Second)
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
-	res, err := rm.OSClient.SSExecutor.ExecuteShortCommand(command)
+	result, err := rm.OSClient.SSExecutor.Run(command)
 	if err != nil {
 		logger.GetLogger().Infof("Please wait for a moment, checking node %s status: %v", rm.OSClient.SSExecutor.Host.Name, err)
-	} else if len(res) > 0 {
+	} else if result.ExitCode == 0 {
 		logger.GetLogger().Infof("The node is already in a ready state.")
 		return nil
 	}
@@ -472,10 +460,10 @@ func (rm *RestoreManager) checkNodeStatus() error {
 			logger.GetLogger().Errorf("Timeout while checking node %s status", rm.OSClient.SSExecutor.Host.Name)
 			return fmt.Errorf("Timeout while checking node %s status", rm.OSClient.SSExecutor.Host.Name)
 		case <-ticker.C:
-			res, err := rm.OSClient.SSExecutor.ExecuteShortCommand(command)
+			result, err := rm.OSClient.SSExecutor.Run(command)
 			if err != nil {
 				logger.GetLogger().Infof("Please wait for a moment, checking node %s status: %v", rm.OSClient.SSExecutor.Host.Name, err)
-			} else if len(res) > 0 {
+			} else if result.ExitCode == 0 {
 				logger.GetLogger().Infof("The node is already in a ready state.")
 				return nil
 			}
@@ -493,10 +481,10 @@ func (rm *RestoreManager) checkEtcdClusterStatus() error {
 		return fmt.Errorf("Error getting health command %s: %w", rm.OSClient.SSExecutor.Host.Name, err)
 	}
 	logger.GetLogger().Infof(command)
-	res, err := rm.OSClient.SSExecutor.ExecuteShortCommand(command)
+	result, err := rm.OSClient.SSExecutor.Run(command)
 	if err != nil {
 		logger.GetLogger().Infof("Please wait for a moment, checking node %s status: %v", rm.OSClient.SSExecutor.Host.Name, err)
-	} else if len(res) > 0 {
+	} else if result.ExitCode == 0 {
 		logger.GetLogger().Infof("The node is already in a ready state %s.", rm.OSClient.SSExecutor.Host.Name)
 		return nil
 	}
@@ -507,10 +495,10 @@ func (rm *RestoreManager) checkEtcdClusterStatus() error {
 			logger.GetLogger().Errorf("Timeout while checking node %s status", rm.OSClient.SSExecutor.Host.Name)
 			return fmt.Errorf("Timeout while checking node %s status", rm.OSClient.SSExecutor.Host.Name)
 		case <-ticker.C:
-			res, err := rm.OSClient.SSExecutor.ExecuteShortCommand(command)
+			result, err := rm.OSClient.SSExecutor.Run(command)
 			if err != nil {
 				logger.GetLogger().Infof("Please wait for a moment, checking node %s status: %v", rm.OSClient.SSExecutor.Host.Name, err)
-			} else if len(res) > 0 {
+			} else if result.ExitCode == 0 {
 				logger.GetLogger().Infof("The node is already in a ready state.")
 				return nil
 			}
@@ -0,0 +1,298 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// factsSection starts the output of a section of factsScript.
+const factsSection = "@@facts:"
+
+// factsScript prints every fact in one run, each section after a factsSection line. It runs as the
+// SSH user, none of the facts need root.
+const factsScript = `
+section() { echo; echo "@@facts:$1"; }
+section hostname; hostname
+section kernel; uname -r
+section arch; uname -m
+section os-release; cat /etc/os-release
+section cpu-model; grep -m1 -E '^(model name|Model|cpu model|Processor)[[:space:]]*:' /proc/cpuinfo
+section cpu-cores; grep -c '^processor' /proc/cpuinfo
+section meminfo; cat /proc/meminfo
+section lsblk; lsblk -J -b -o NAME,TYPE,SIZE,MODEL,ROTA,RO,FSTYPE,MOUNTPOINT
+section df; df -P -T -B1 -x tmpfs -x devtmpfs -x overlay -x squashfs
+section links; ip -o link show
+section addresses; ip -o addr show
+section selinux; getenforce
+section apparmor; cat /sys/module/apparmor/parameters/enabled
+section firewall; for s in firewalld ufw nftables iptables; do echo "$s $(systemctl is-active $s)"; done
+section timesync; for s in chronyd chrony ntpd ntp systemd-timesyncd; do echo "$s $(systemctl is-active $s)"; done
+section synchronized; timedatectl status | grep -i synchronized
+exit 0
+`
+
+// GatherFacts collects the facts of the host in a single command.
+func (executor *SSHExecutor) GatherFacts(ctx context.Context) (*entity.HostFacts, error) {
+	result, err := executor.RunContext(ctx, "sh -c "+shellQuote(factsScript)+" 2>/dev/null")
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, &CommandError{Result: result}
+	}
+	facts, err := parseFacts(result.Stdout)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse facts of %s: %w", result.Host, err)
+	}
+	facts.GatheredAt = time.Now()
+	return facts, nil
+}
+
+// GatherFacts collects the facts of the host.
+func (client *OSClient) GatherFacts(ctx context.Context) (*entity.HostFacts, error) {
+	return client.SSExecutor.GatherFacts(ctx)
+}
+
+// parseFacts parses the output of factsScript.
+func parseFacts(output string) (*entity.HostFacts, error) {
+	sections := make(map[string]string)
+	var name string
+	var content strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, factsSection) {
+			if name != "" {
+				sections[name] = strings.TrimSpace(content.String())
+			}
+			name = strings.TrimPrefix(line, factsSection)
+			content.Reset()
+			continue
+		}
+		content.WriteString(line)
+		content.WriteString("\n")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no facts in output")
+	}
+	sections[name] = strings.TrimSpace(content.String())
+
+	facts := &entity.HostFacts{
+		Hostname: sections["hostname"],
+		Kernel:   sections["kernel"],
+		Arch:     sections["arch"],
+		SELinux:  strings.ToLower(sections["selinux"]),
+	}
+	release := parseKeyValues(sections["os-release"], "=")
+	facts.OS = entity.OSFacts{ID: release["ID"], Version: release["VERSION_ID"], PrettyName: release["PRETTY_NAME"]}
+	if _, model, ok := strings.Cut(sections["cpu-model"], ":"); ok {
+		facts.CPU.Model = strings.TrimSpace(model)
+	}
+	facts.CPU.Cores, _ = strconv.Atoi(sections["cpu-cores"])
+	meminfo := parseMeminfo(sections["meminfo"])
+	facts.Memory = entity.MemoryFacts{Total: meminfo["MemTotal"], Available: meminfo["MemAvailable"]}
+	facts.Swap = entity.SwapFacts{Total: meminfo["SwapTotal"], Used: meminfo["SwapTotal"] - meminfo["SwapFree"]}
+	switch sections["apparmor"] {
+	case "Y":
+		facts.AppArmor = "enabled"
+	case "N":
+		facts.AppArmor = "disabled"
+	}
+	if sections["lsblk"] != "" {
+		devices, err := parseLsblk(sections["lsblk"])
+		if err != nil {
+			return nil, err
+		}
+		facts.BlockDevices = devices
+	}
+	facts.Filesystems = parseDf(sections["df"])
+	facts.Interfaces = parseInterfaces(sections["links"], sections["addresses"])
+	if service, ok := activeService(sections["firewall"]); ok {
+		facts.Firewall = entity.FirewallFacts{Service: service, Active: true}
+	}
+	if service, ok := activeService(sections["timesync"]); ok {
+		facts.TimeSync = entity.TimeSyncFacts{Service: service, Active: true}
+	}
+	// "System clock synchronized: yes", or "NTP synchronized: yes" on older systemd
+	facts.TimeSync.Synchronized = strings.HasSuffix(strings.ToLower(sections["synchronized"]), ": yes")
+	return facts, nil
+}
+
+// parseKeyValues parses lines of key, separator and value. Quotes around values are removed.
+func parseKeyValues(content, separator string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := strings.Cut(line, separator)
+		if !ok {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+	return values
+}
+
+// parseMeminfo returns the sizes in /proc/meminfo in bytes.
+func parseMeminfo(content string) map[string]int64 {
+	sizes := make(map[string]int64)
+	for key, value := range parseKeyValues(content, ":") {
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			size *= 1024
+		}
+		sizes[key] = size
+	}
+	return sizes
+}
+
+// lsblkValue is a value in the JSON output of lsblk, which older versions print as strings, e.g. "1"
+// for true, and newer versions as numbers and booleans.
+type lsblkValue string
+
+func (value *lsblkValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		*value = lsblkValue(s)
+		return nil
+	}
+	if string(data) != "null" {
+		*value = lsblkValue(data)
+	}
+	return nil
+}
+
+func (value lsblkValue) int64() int64 {
+	n, _ := strconv.ParseInt(string(value), 10, 64)
+	return n
+}
+
+func (value lsblkValue) bool() bool {
+	return value == "1" || value == "true"
+}
+
+type lsblkDevice struct {
+	Name       lsblkValue    `json:"name"`
+	Type       lsblkValue    `json:"type"`
+	Size       lsblkValue    `json:"size"`
+	Model      lsblkValue    `json:"model"`
+	Rota       lsblkValue    `json:"rota"`
+	RO         lsblkValue    `json:"ro"`
+	FSType     lsblkValue    `json:"fstype"`
+	Mountpoint lsblkValue    `json:"mountpoint"`
+	Children   []lsblkDevice `json:"children"`
+}
+
+func parseLsblk(content string) ([]entity.BlockDevice, error) {
+	var output struct {
+		BlockDevices []lsblkDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal([]byte(content), &output); err != nil {
+		return nil, fmt.Errorf("invalid lsblk output: %w", err)
+	}
+	return toBlockDevices(output.BlockDevices), nil
+}
+
+func toBlockDevices(devices []lsblkDevice) []entity.BlockDevice {
+	var blockDevices []entity.BlockDevice
+	for _, device := range devices {
+		blockDevices = append(blockDevices, entity.BlockDevice{
+			Name:       string(device.Name),
+			Type:       string(device.Type),
+			Size:       device.Size.int64(),
+			Model:      strings.TrimSpace(string(device.Model)),
+			Rotational: device.Rota.bool(),
+			ReadOnly:   device.RO.bool(),
+			FSType:     string(device.FSType),
+			Mountpoint: string(device.Mountpoint),
+			Children:   toBlockDevices(device.Children),
+		})
+	}
+	return blockDevices
+}
+
+// parseDf parses the output of df -P -T -B1.
+func parseDf(content string) []entity.Filesystem {
+	var filesystems []entity.Filesystem
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 7 || fields[0] == "Filesystem" {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[2], 10, 64)
+		used, _ := strconv.ParseInt(fields[3], 10, 64)
+		available, _ := strconv.ParseInt(fields[4], 10, 64)
+		filesystems = append(filesystems, entity.Filesystem{
+			Source:     fields[0],
+			Type:       fields[1],
+			Mountpoint: strings.Join(fields[6:], " "),
+			Size:       size,
+			Used:       used,
+			Available:  available,
+		})
+	}
+	return filesystems
+}
+
+// parseInterfaces parses the output of ip -o link show and ip -o addr show, e.g.
+//
+//	2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc mq state UP mode DEFAULT group default qlen 1000\    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff
+//	2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global eth0\       valid_lft forever preferred_lft forever
+func parseInterfaces(links, addresses string) []entity.NetworkInterface {
+	var interfaces []entity.NetworkInterface
+	index := make(map[string]int)
+	for _, line := range strings.Split(links, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		name := strings.TrimSuffix(fields[1], ":")
+		if at := strings.Index(name, "@"); at > 0 {
+			name = name[:at]
+		}
+		networkInterface := entity.NetworkInterface{Name: name}
+		for i := 2; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "mtu":
+				networkInterface.MTU, _ = strconv.Atoi(fields[i+1])
+			case "state":
+				networkInterface.State = fields[i+1]
+			case "link/ether":
+				networkInterface.MAC = fields[i+1]
+			}
+		}
+		index[name] = len(interfaces)
+		interfaces = append(interfaces, networkInterface)
+	}
+	for _, line := range strings.Split(addresses, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || (fields[2] != "inet" && fields[2] != "inet6") {
+			continue
+		}
+		if i, ok := index[fields[1]]; ok {
+			interfaces[i].Addresses = append(interfaces[i].Addresses, fields[3])
+		}
+	}
+	return interfaces
+}
+
+// activeService returns the first service listed as active in lines of service name and state.
+func activeService(content string) (string, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == "active" {
+			return fields[0], true
+		}
+	}
+	return "", false
+}
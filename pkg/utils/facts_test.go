@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"github.com/whoisfisher/mykubespray/pkg/utils/sshtest"
+	"testing"
+)
+
+const factsOutput = `
+@@facts:hostname
+node1
+@@facts:kernel
+5.14.0-362.8.1.el9_3.x86_64
+@@facts:arch
+x86_64
+@@facts:os-release
+NAME="Rocky Linux"
+VERSION_ID="9.3"
+ID="rocky"
+PRETTY_NAME="Rocky Linux 9.3 (Blue Onyx)"
+@@facts:cpu-model
+model name	: Intel(R) Xeon(R) Gold 6248 CPU @ 2.50GHz
+@@facts:cpu-cores
+8
+@@facts:meminfo
+MemTotal:       16266796 kB
+MemAvailable:   12873236 kB
+SwapTotal:       2097148 kB
+SwapFree:        1048574 kB
+@@facts:lsblk
+{"blockdevices": [{"name":"sda", "type":"disk", "size":"107374182400", "model":"QEMU HARDDISK   ", "rota":"1", "ro":"0", "fstype":null, "mountpoint":null,
+  "children": [{"name":"sda1", "type":"part", "size":"107373133824", "model":null, "rota":"1", "ro":"0", "fstype":"xfs", "mountpoint":"/"}]}]}
+@@facts:df
+Filesystem     Type     1-blocks        Used    Available Capacity Mounted on
+/dev/sda1      xfs  107321753600 10737418240  96584335360      11% /
+@@facts:links
+1: lo: <LOOPBACK,UP,LOWER_UP> mtu 65536 qdisc noqueue state UNKNOWN mode DEFAULT group default qlen 1000\    link/loopback 00:00:00:00:00:00 brd 00:00:00:00:00:00
+2: eth0: <BROADCAST,MULTICAST,UP,LOWER_UP> mtu 1500 qdisc mq state UP mode DEFAULT group default qlen 1000\    link/ether 52:54:00:12:34:56 brd ff:ff:ff:ff:ff:ff
+@@facts:addresses
+1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global eth0\       valid_lft forever preferred_lft forever
+@@facts:selinux
+Enforcing
+@@facts:apparmor
+@@facts:firewall
+firewalld active
+ufw inactive
+@@facts:timesync
+chronyd active
+@@facts:synchronized
+System clock synchronized: yes
+`
+
+func TestGatherFacts(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.Respond(`(?s)sh -c .*`, sshtest.Response{Stdout: factsOutput})
+	executor := connect(t, server.Host("deploy", "secret"))
+
+	facts, err := executor.GatherFacts(context.Background())
+	if err != nil {
+		t.Fatalf("Expected facts, got %v", err)
+	}
+	if len(server.Execs()) != 1 {
+		t.Errorf("Expected a single command, got %v", server.Commands())
+	}
+	if facts.Hostname != "node1" || facts.Arch != "x86_64" || facts.OS.ID != "rocky" || facts.OS.Version != "9.3" {
+		t.Errorf("Unexpected system facts %+v", facts)
+	}
+	if facts.CPU.Cores != 8 || facts.CPU.Model != "Intel(R) Xeon(R) Gold 6248 CPU @ 2.50GHz" {
+		t.Errorf("Unexpected CPU facts %+v", facts.CPU)
+	}
+	if facts.Memory.Total != 16266796*1024 || facts.Swap.Used != 1048574*1024 {
+		t.Errorf("Unexpected memory facts %+v, %+v", facts.Memory, facts.Swap)
+	}
+	if len(facts.BlockDevices) != 1 || facts.BlockDevices[0].Size != 107374182400 || !facts.BlockDevices[0].Rotational ||
+		facts.BlockDevices[0].Model != "QEMU HARDDISK" || facts.BlockDevices[0].Children[0].Mountpoint != "/" {
+		t.Errorf("Unexpected block devices %+v", facts.BlockDevices)
+	}
+	if len(facts.Filesystems) != 1 || facts.Filesystems[0].Mountpoint != "/" || facts.Filesystems[0].Available != 96584335360 {
+		t.Errorf("Unexpected filesystems %+v", facts.Filesystems)
+	}
+	if len(facts.Interfaces) != 2 || facts.Interfaces[1].MTU != 1500 || facts.Interfaces[1].MAC != "52:54:00:12:34:56" ||
+		len(facts.Interfaces[1].Addresses) != 1 || facts.Interfaces[1].Addresses[0] != "10.0.0.5/24" {
+		t.Errorf("Unexpected interfaces %+v", facts.Interfaces)
+	}
+	if facts.SELinux != "enforcing" || facts.AppArmor != "" {
+		t.Errorf("Unexpected security facts %q, %q", facts.SELinux, facts.AppArmor)
+	}
+	if facts.Firewall.Service != "firewalld" || !facts.TimeSync.Active || facts.TimeSync.Service != "chronyd" || !facts.TimeSync.Synchronized {
+		t.Errorf("Unexpected service facts %+v, %+v", facts.Firewall, facts.TimeSync)
+	}
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultParallelism caps the hosts FanOut works on at once when FanOutOptions.Parallelism is not set.
+const DefaultParallelism = 20
+
+type MachineResult struct {
+	Machine string
+	Success bool
+	Error   string
+	// Result is set by the command operations.
+	Result *entity.CommandResult
+}
+
+type CopyResult struct {
+	OverallSuccess bool
+	// Results are in the order of the hosts. Results[i] belongs to the i-th host.
+	Results []MachineResult
+	// Skipped are the hosts that were not started because the run stopped early. They follow the hosts of Results.
+	Skipped []string
+}
+
+// Batch is the size of a serial batch, Count hosts or Percent of all hosts.
+type Batch struct {
+	Count   int
+	Percent int
+}
+
+// ParseBatch parses a batch size like "1" or "10%".
+func ParseBatch(size string) (Batch, error) {
+	size = strings.TrimSpace(size)
+	if percent, ok := strings.CutSuffix(size, "%"); ok {
+		value, err := strconv.Atoi(percent)
+		if err != nil || value <= 0 || value > 100 {
+			return Batch{}, fmt.Errorf("invalid batch size %q, percentages have to be between 1%% and 100%%", size)
+		}
+		return Batch{Percent: value}, nil
+	}
+	value, err := strconv.Atoi(size)
+	if err != nil || value <= 0 {
+		return Batch{}, fmt.Errorf("invalid batch size %q, expected a positive count or a percentage", size)
+	}
+	return Batch{Count: value}, nil
+}
+
+// size returns the hosts in the batch out of total, at least one.
+func (batch Batch) size(total int) int {
+	if batch.Count > 0 {
+		return batch.Count
+	}
+	return max(1, total*batch.Percent/100)
+}
+
+// FanOutOptions controls how FanOut goes through the hosts.
+type FanOutOptions struct {
+	// Parallelism caps the hosts worked on at once. 0 means DefaultParallelism.
+	Parallelism int
+	// Batches are run one after another, each starts once the previous one is done. The last batch
+	// repeats until all hosts are done. No batches means a single batch of all hosts.
+	Batches []Batch
+	// MaxFailures stops the run once that many hosts failed. 0 means no limit.
+	MaxFailures int
+	// MaxFailurePercent stops the run once that share of all hosts failed. 0 means no limit.
+	MaxFailurePercent int
+	// HostTimeout bounds the work on a single host. 0 means no limit.
+	HostTimeout time.Duration
+}
+
+// NewFanOutOptions converts the rollout of a request.
+func NewFanOutOptions(rollout entity.Rollout) (FanOutOptions, error) {
+	options := FanOutOptions{
+		Parallelism:       rollout.Parallelism,
+		MaxFailures:       rollout.MaxFailures,
+		MaxFailurePercent: rollout.MaxFailurePercent,
+		HostTimeout:       time.Duration(rollout.HostTimeoutSeconds) * time.Second,
+	}
+	if options.Parallelism < 0 || options.MaxFailures < 0 || options.HostTimeout < 0 {
+		return options, fmt.Errorf("parallelism, max_failures and host_timeout_seconds must not be negative")
+	}
+	if options.MaxFailurePercent < 0 || options.MaxFailurePercent > 100 {
+		return options, fmt.Errorf("max_failure_percent must be between 0 and 100")
+	}
+	for _, size := range rollout.Batches {
+		batch, err := ParseBatch(size)
+		if err != nil {
+			return options, err
+		}
+		options.Batches = append(options.Batches, batch)
+	}
+	return options, nil
+}
+
+// exceeded tells whether failures out of total hosts reach one of the failure thresholds.
+func (options FanOutOptions) exceeded(failures, total int) bool {
+	if failures == 0 {
+		return false
+	}
+	if options.MaxFailures > 0 && failures >= options.MaxFailures {
+		return true
+	}
+	return options.MaxFailurePercent > 0 && failures*100 >= options.MaxFailurePercent*total
+}
+
+// HostOperation does the work of a fan-out on one host. ctx is done when the host timed out or the run was cancelled.
+type HostOperation func(ctx context.Context, host entity.Host) MachineResult
+
+// FanOut runs operation on hosts in batches, at most options.Parallelism at once. Hosts are started in
+// order. Once a failure threshold is reached or ctx is done no more hosts are started, the running
+// ones are waited for and the rest are reported as skipped. name describes the operation in the log.
+func FanOut(ctx context.Context, name string, hosts []entity.Host, options FanOutOptions, operation HostOperation) *CopyResult {
+	return fanOut(ctx, name, hosts, options, func(ctx context.Context, index int) MachineResult {
+		return operation(ctx, hosts[index])
+	})
+}
+
+// fanOut is FanOut with operations given the index of their host.
+func fanOut(ctx context.Context, name string, hosts []entity.Host, options FanOutOptions, operation func(ctx context.Context, index int) MachineResult) *CopyResult {
+	parallelism := options.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+	results := make([]MachineResult, len(hosts))
+	slots := make(chan struct{}, parallelism)
+	var mutex sync.Mutex
+	var failures int
+	stopped := false
+
+	started := 0
+	for batchIndex := 0; started < len(hosts) && !stopped; batchIndex++ {
+		end := len(hosts)
+		if len(options.Batches) > 0 {
+			batch := options.Batches[min(batchIndex, len(options.Batches)-1)]
+			end = min(started+batch.size(len(hosts)), len(hosts))
+		}
+		var wg sync.WaitGroup
+		for ; started < end; started++ {
+			slots <- struct{}{}
+			mutex.Lock()
+			stopped = stopped || ctx.Err() != nil
+			stop := stopped
+			mutex.Unlock()
+			if stop {
+				<-slots
+				break
+			}
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				result := runHost(ctx, hosts[index], options.HostTimeout, func(ctx context.Context) MachineResult {
+					return operation(ctx, index)
+				})
+				if result.Machine == "" {
+					result.Machine = hosts[index].Address
+				}
+				mutex.Lock()
+				defer mutex.Unlock()
+				results[index] = result
+				if result.Success {
+					logger.GetLogger().Infof("Successfully %s on %s", name, result.Machine)
+					return
+				}
+				logger.GetLogger().Errorf("Failed to %s on %s: %s", name, result.Machine, result.Error)
+				failures++
+				if !stopped && options.exceeded(failures, len(hosts)) {
+					logger.GetLogger().Errorf("Stopping %s after %d of %d hosts failed", name, failures, len(hosts))
+					stopped = true
+				}
+			}(started)
+		}
+		wg.Wait()
+	}
+
+	copyResult := &CopyResult{Results: results[:started]}
+	for _, host := range hosts[started:] {
+		copyResult.Skipped = append(copyResult.Skipped, host.Address)
+	}
+	if len(copyResult.Skipped) > 0 {
+		logger.GetLogger().Warnf("Skipped %s on %d hosts: %s", name, len(copyResult.Skipped), strings.Join(copyResult.Skipped, ", "))
+	}
+	copyResult.OverallSuccess = failures == 0 && len(copyResult.Skipped) == 0
+	return copyResult
+}
+
+// runHost runs operation on host with a ctx that is done after timeout. operation is waited for even
+// then, so that it neither outlives its slot nor writes results after FanOut returned. A host that
+// failed once its ctx was done is reported as stopped.
+func runHost(ctx context.Context, host entity.Host, timeout time.Duration, operation func(ctx context.Context) MachineResult) MachineResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	result := operation(ctx)
+	if err := ctx.Err(); err != nil && !result.Success {
+		result.Machine = host.Address
+		result.Error = fmt.Sprintf("Stopped on %s: %v", host.Address, err)
+	}
+	return result
+}
+
+// FanOutReports runs run with FanOut on a pooled connection to every host and returns the reports in the
+// order of the hosts. run returns why a host failed, nothing when it did not. Hosts that could not be
+// connected or were not started get the report failed returns for the reason.
+func FanOutReports[R any](ctx context.Context, name string, hosts []entity.Host, options FanOutOptions, run func(ctx context.Context, host entity.Host, osClient OSClient) (R, string), failed func(host entity.Host, reason string) R) []R {
+	reports := make([]R, len(hosts))
+	reported := make([]bool, len(hosts))
+	result := fanOut(ctx, name, hosts, options, func(ctx context.Context, index int) MachineResult {
+		host := hosts[index]
+		executor, err := GetSSHExecutorPool().Executor(host)
+		if err != nil {
+			return MachineResult{Machine: host.Name, Error: err.Error()}
+		}
+		report, reason := run(ctx, host, OSClient{SSExecutor: *executor})
+		reports[index], reported[index] = report, true
+		return MachineResult{Machine: host.Name, Success: reason == "", Error: reason}
+	})
+	for i, host := range hosts {
+		if reported[i] {
+			continue
+		}
+		reason := "skipped, the run stopped early"
+		if i < len(result.Results) {
+			reason = result.Results[i].Error
+		}
+		reports[i] = failed(host, reason)
+	}
+	return reports
+}
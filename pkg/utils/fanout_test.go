@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils/sshtest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func fanOutHosts(count int) []entity.Host {
+	hosts := make([]entity.Host, count)
+	for i := range hosts {
+		hosts[i] = entity.Host{Address: fmt.Sprintf("10.0.0.%d", i+1)}
+	}
+	return hosts
+}
+
+func succeed(ctx context.Context, host entity.Host) MachineResult {
+	return MachineResult{Machine: host.Address, Success: true}
+}
+
+func fail(ctx context.Context, host entity.Host) MachineResult {
+	return MachineResult{Machine: host.Address, Error: "failed"}
+}
+
+func TestParseBatch(t *testing.T) {
+	for size, expected := range map[string]Batch{"1": {Count: 1}, " 5 ": {Count: 5}, "10%": {Percent: 10}, "100%": {Percent: 100}} {
+		if batch, err := ParseBatch(size); err != nil || batch != expected {
+			t.Errorf("Expected %q to parse as %+v, got %+v, %v", size, expected, batch, err)
+		}
+	}
+	for _, size := range []string{"", "0", "-1", "x", "0%", "101%", "%"} {
+		if batch, err := ParseBatch(size); err == nil {
+			t.Errorf("Expected %q to be rejected, got %+v", size, batch)
+		}
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	tests := []struct {
+		batch    Batch
+		total    int
+		expected int
+	}{
+		{Batch{Count: 3}, 10, 3},
+		{Batch{Count: 30}, 10, 30},
+		{Batch{Percent: 50}, 10, 5},
+		{Batch{Percent: 25}, 10, 2},
+		{Batch{Percent: 10}, 3, 1},
+	}
+	for _, test := range tests {
+		if size := test.batch.size(test.total); size != test.expected {
+			t.Errorf("Expected %+v of %d hosts to be %d, got %d", test.batch, test.total, test.expected, size)
+		}
+	}
+}
+
+func TestExceeded(t *testing.T) {
+	tests := []struct {
+		options  FanOutOptions
+		failures int
+		expected bool
+	}{
+		{FanOutOptions{}, 10, false},
+		{FanOutOptions{MaxFailures: 2}, 0, false},
+		{FanOutOptions{MaxFailures: 2}, 1, false},
+		{FanOutOptions{MaxFailures: 2}, 2, true},
+		{FanOutOptions{MaxFailurePercent: 30}, 2, false},
+		{FanOutOptions{MaxFailurePercent: 30}, 3, true},
+		{FanOutOptions{MaxFailures: 5, MaxFailurePercent: 10}, 1, true},
+	}
+	for _, test := range tests {
+		if exceeded := test.options.exceeded(test.failures, 10); exceeded != test.expected {
+			t.Errorf("Expected %d of 10 failures with %+v to be exceeded=%v", test.failures, test.options, test.expected)
+		}
+	}
+}
+
+func TestFanOutKeepsHostOrder(t *testing.T) {
+	hosts := fanOutHosts(30)
+	result := FanOut(context.Background(), "test", hosts, FanOutOptions{Parallelism: 7}, succeed)
+	if !result.OverallSuccess || len(result.Results) != len(hosts) || len(result.Skipped) != 0 {
+		t.Fatalf("Expected all hosts to succeed, got %+v", result)
+	}
+	for i, host := range hosts {
+		if result.Results[i].Machine != host.Address {
+			t.Errorf("Expected result %d to belong to %s, got %s", i, host.Address, result.Results[i].Machine)
+		}
+	}
+}
+
+func TestFanOutParallelism(t *testing.T) {
+	var running, peak atomic.Int32
+	operation := func(ctx context.Context, host entity.Host) MachineResult {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := peak.Load()
+			if current <= previous || peak.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return succeed(ctx, host)
+	}
+	FanOut(context.Background(), "test", fanOutHosts(20), FanOutOptions{Parallelism: 3}, operation)
+	if peak.Load() != 3 {
+		t.Errorf("Expected at most 3 hosts at once, got %d", peak.Load())
+	}
+}
+
+func TestFanOutBatches(t *testing.T) {
+	var mutex sync.Mutex
+	var events []string
+	operation := func(ctx context.Context, host entity.Host) MachineResult {
+		mutex.Lock()
+		events = append(events, "start "+host.Address)
+		mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mutex.Lock()
+		events = append(events, "end "+host.Address)
+		mutex.Unlock()
+		return succeed(ctx, host)
+	}
+	hosts := fanOutHosts(6)
+	FanOut(context.Background(), "test", hosts, FanOutOptions{Batches: []Batch{{Count: 1}, {Percent: 50}}}, operation)
+
+	// The first batch holds one host, the last one repeats with half of the hosts.
+	batches := [][]string{{"10.0.0.1"}, {"10.0.0.2", "10.0.0.3", "10.0.0.4"}, {"10.0.0.5", "10.0.0.6"}}
+	position := 0
+	for _, batch := range batches {
+		var starts, ends []string
+		for _, event := range events[position : position+2*len(batch)] {
+			if address, ok := strings.CutPrefix(event, "start "); ok {
+				starts = append(starts, address)
+			} else {
+				ends = append(ends, strings.TrimPrefix(event, "end "))
+			}
+		}
+		if len(starts) != len(batch) || len(ends) != len(batch) {
+			t.Fatalf("Expected batch %v to be done before the next one started, got %v", batch, events)
+		}
+		position += 2 * len(batch)
+	}
+}
+
+func TestFanOutStopsAtMaxFailures(t *testing.T) {
+	hosts := fanOutHosts(5)
+	result := FanOut(context.Background(), "test", hosts, FanOutOptions{Parallelism: 1, MaxFailures: 2}, fail)
+	if result.OverallSuccess || len(result.Results) != 2 {
+		t.Fatalf("Expected the run to stop after 2 failures, got %+v", result)
+	}
+	if expected := []string{"10.0.0.3", "10.0.0.4", "10.0.0.5"}; !reflect.DeepEqual(result.Skipped, expected) {
+		t.Errorf("Expected %v to be skipped in order, got %v", expected, result.Skipped)
+	}
+}
+
+func TestFanOutStopsAtMaxFailurePercent(t *testing.T) {
+	hosts := fanOutHosts(10)
+	result := FanOut(context.Background(), "test", hosts, FanOutOptions{Batches: []Batch{{Count: 2}}, MaxFailurePercent: 20}, fail)
+	if len(result.Results) != 2 || len(result.Skipped) != 8 || result.Skipped[0] != "10.0.0.3" {
+		t.Errorf("Expected the run to stop after the first batch, got %+v", result)
+	}
+}
+
+func TestFanOutCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := FanOut(ctx, "test", fanOutHosts(3), FanOutOptions{}, succeed)
+	if result.OverallSuccess || len(result.Results) != 0 || len(result.Skipped) != 3 {
+		t.Errorf("Expected every host to be skipped, got %+v", result)
+	}
+}
+
+func TestFanOutHostTimeoutWaitsForOperation(t *testing.T) {
+	var returned atomic.Bool
+	operation := func(ctx context.Context, host entity.Host) MachineResult {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		returned.Store(true)
+		return MachineResult{Machine: host.Address, Error: ctx.Err().Error()}
+	}
+	result := FanOut(context.Background(), "test", fanOutHosts(1), FanOutOptions{HostTimeout: 10 * time.Millisecond}, operation)
+	if !returned.Load() {
+		t.Errorf("Expected the operation to be waited for")
+	}
+	if result.OverallSuccess || !strings.HasPrefix(result.Results[0].Error, "Stopped on 10.0.0.1") {
+		t.Errorf("Expected the host to be reported as stopped, got %+v", result.Results)
+	}
+}
+
+func TestFanOutReportsByIndex(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	// The reports are collected through the shared pool, a fresh one is closed before the server.
+	ConfigureSSHPool(PoolOptions{})
+	defer ConfigureSSHPool(PoolOptions{})
+	host := server.Host("deploy", "secret")
+	unreachable := host
+	unreachable.Name, unreachable.Port = "unreachable", 1
+	hosts := []entity.Host{host, host, unreachable, host}
+
+	run := func(ctx context.Context, host entity.Host, osClient OSClient) (string, string) {
+		return "ran on " + osClient.SSExecutor.WhoAmI(), ""
+	}
+	failed := func(host entity.Host, reason string) string {
+		return "failed: " + reason
+	}
+	reports := FanOutReports(context.Background(), "test", hosts, FanOutOptions{Parallelism: 1, MaxFailures: 1}, run, failed)
+	if len(reports) != 4 || reports[0] != "ran on deploy" || reports[1] != "ran on deploy" {
+		t.Fatalf("Expected a report for the host named twice, got %q", reports)
+	}
+	if !strings.HasPrefix(reports[2], "failed: ") || reports[2] == "failed: skipped, the run stopped early" {
+		t.Errorf("Expected the connection error to be reported, got %q", reports[2])
+	}
+	if reports[3] != "failed: skipped, the run stopped early" {
+		t.Errorf("Expected the last host to be skipped, got %q", reports[3])
+	}
+}
@@ -5,6 +5,28 @@ import (
 	"regexp"
 )
 
+const (
+	releaseConfDir = "/usr/local/lib/middleware/conf"
+	localConfDir   = "./pkg/conf"
+)
+
+var confDirs = []string{
+	localConfDir,
+	releaseConfDir,
+}
+
+// ConfDir returns the directory holding the bundled manifests, package lists and templates, the release
+// one wins when installed.
+func ConfDir() string {
+	path := localConfDir
+	for _, d := range confDirs {
+		if Exists(d) {
+			path = d
+		}
+	}
+	return path
+}
+
 func Exists(path string) bool {
 	_, err := os.Stat(path)
 	if err != nil {
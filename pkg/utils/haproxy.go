@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/logger"
@@ -29,11 +30,11 @@ func (client *HaproxyClient) InstallHaproxy(logChan chan LogEntry) error {
 		return err
 	}
 	if os == "ubuntu" {
-		command = "sudo apt install haproxy -y"
+		command = "apt install haproxy -y"
 	} else if os == "centos" {
-		command = "sudo yum install haproxy -y"
+		command = "yum install haproxy -y"
 	}
-	err = client.OSClient.SSExecutor.ExecuteCommand(command, logChan)
+	err = client.OSClient.SSExecutor.AsRoot().ExecuteCommand(command, logChan)
 	if err != nil {
 		logger.GetLogger().Printf("Failed to install haproxy: %s", err.Error())
 		return err
@@ -88,11 +89,7 @@ backend kube-apiserver
 		logger.GetLogger().Printf("Failed to generate template: %s", err.Error())
 		return err
 	}
-	command := fmt.Sprintf("bash -c \"echo '%s' > %s\"", rendered.String(), configFile)
-	if client.OSClient.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.OSClient.SSExecutor.Host.Password)
-	}
-	err = client.OSClient.SSExecutor.ExecuteCommandWithoutReturn(command)
+	err = client.OSClient.SSExecutor.PutFile(context.Background(), &rendered, RemoteFile{Path: configFile, Mode: 0644, Owner: "root:root", Backup: true})
 	if err != nil {
 		logger.GetLogger().Printf("Failed to generate haproxy config: %s", err.Error())
 		return err
@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrHostKeyChanged = errors.New("host key changed")
+	ErrHostKeyUnknown = errors.New("host key not trusted")
+	ErrHostKeyRevoked = errors.New("host key revoked")
+)
+
+// HostKeyError is returned by SSH connections whose host key is not accepted.
+// Expected holds the fingerprints trusted for the host when the key changed.
+type HostKeyError struct {
+	Host        string
+	Fingerprint string
+	Expected    []string
+	Err         error
+}
+
+func (e *HostKeyError) Error() string {
+	if len(e.Expected) > 0 {
+		return fmt.Sprintf("%s: %s presents %s, expected %s", e.Err.Error(), e.Host, e.Fingerprint, strings.Join(e.Expected, ", "))
+	}
+	return fmt.Sprintf("%s: %s presents %s", e.Err.Error(), e.Host, e.Fingerprint)
+}
+
+func (e *HostKeyError) Unwrap() error {
+	return e.Err
+}
+
+// HostKeyStore persists the host keys seen by the SSH connections.
+type HostKeyStore interface {
+	ListHostKeys(host string) ([]entity.HostKey, error)
+	SaveHostKey(key *entity.HostKey) error
+}
+
+// HostKeyVerifier checks the key of every SSH connection against a HostKeyStore.
+// In tofu mode the first key of a host is trusted; in strict and known_hosts mode only keys
+// imported or approved beforehand are. A changed key is never accepted without approval.
+type HostKeyVerifier struct {
+	Mode  string
+	Store HostKeyStore
+	mutex sync.Mutex
+}
+
+var hostKeyVerifier = &HostKeyVerifier{Mode: entity.HostKeyModeTOFU, Store: NewMemoryHostKeyStore()}
+
+// ConfigureHostKeys sets how SSH connections verify host keys. In known_hosts mode the keys of
+// knownHostsFile are imported as trusted first.
+func ConfigureHostKeys(mode, knownHostsFile string, store HostKeyStore) error {
+	switch mode {
+	case entity.HostKeyModeInsecure:
+		logger.GetLogger().Warnf("SSH host key verification is disabled")
+	case entity.HostKeyModeTOFU, entity.HostKeyModeStrict:
+	case entity.HostKeyModeKnownHosts:
+		content, err := os.ReadFile(knownHostsFile)
+		if err != nil {
+			return fmt.Errorf("failed to read known_hosts file %s: %w", knownHostsFile, err)
+		}
+		if _, err := ImportKnownHosts(store, content); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown host key mode %s", mode)
+	}
+	hostKeyVerifier = &HostKeyVerifier{Mode: mode, Store: store}
+	return nil
+}
+
+// ConfiguredHostKeyStore returns the store SSH connections verify host keys against.
+func ConfiguredHostKeyStore() HostKeyStore {
+	return hostKeyVerifier.Store
+}
+
+func hostKeyCallback() ssh.HostKeyCallback {
+	verifier := hostKeyVerifier
+	if verifier.Mode == entity.HostKeyModeInsecure {
+		return ssh.InsecureIgnoreHostKey()
+	}
+	return verifier.Verify
+}
+
+func (verifier *HostKeyVerifier) Verify(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	host := knownhosts.Normalize(hostname)
+	fingerprint := ssh.FingerprintSHA256(key)
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	keys, err := verifier.Store.ListHostKeys(host)
+	if err != nil {
+		return fmt.Errorf("failed to load host keys of %s: %w", host, err)
+	}
+	// Keys are compared with the trusted ones of the same type, a host presenting a key of another type
+	// than those trusted has not changed its key. Such a key is not trusted on first use either.
+	var trusted []string
+	var seen *entity.HostKey
+	otherTypes := false
+	for i, stored := range keys {
+		switch {
+		case stored.Fingerprint == fingerprint:
+			seen = &keys[i]
+		case stored.Status != entity.HostKeyTrusted:
+		case stored.KeyType == key.Type():
+			trusted = append(trusted, stored.Fingerprint)
+		default:
+			otherTypes = true
+		}
+	}
+	if seen != nil {
+		switch seen.Status {
+		case entity.HostKeyTrusted:
+			return nil
+		case entity.HostKeyRevoked:
+			return &HostKeyError{Host: host, Fingerprint: fingerprint, Err: ErrHostKeyRevoked}
+		}
+		if len(trusted) > 0 {
+			return &HostKeyError{Host: host, Fingerprint: fingerprint, Expected: trusted, Err: ErrHostKeyChanged}
+		}
+		return &HostKeyError{Host: host, Fingerprint: fingerprint, Err: ErrHostKeyUnknown}
+	}
+	record := newHostKey(host, key)
+	if len(trusted) == 0 && !otherTypes && verifier.Mode == entity.HostKeyModeTOFU {
+		record.Status = entity.HostKeyTrusted
+		record.Source = entity.HostKeySourceTOFU
+		logger.GetLogger().Infof("Trusting host key %s of %s on first use", fingerprint, host)
+		return verifier.Store.SaveHostKey(record)
+	}
+	if err := verifier.Store.SaveHostKey(record); err != nil {
+		logger.GetLogger().Errorf("Failed to record host key %s of %s: %s", fingerprint, host, err.Error())
+	}
+	if len(trusted) > 0 {
+		logger.GetLogger().Errorf("Host key of %s changed to %s", host, fingerprint)
+		return &HostKeyError{Host: host, Fingerprint: fingerprint, Expected: trusted, Err: ErrHostKeyChanged}
+	}
+	return &HostKeyError{Host: host, Fingerprint: fingerprint, Err: ErrHostKeyUnknown}
+}
+
+// hostKeyAlgorithms returns the host key algorithms to offer address, those of the key types trusted for
+// it, so that the server presents a key that can be checked. None means the defaults of x/crypto, which
+// prefer ECDSA while known_hosts often only holds the ed25519 key of a host.
+func hostKeyAlgorithms(address string) []string {
+	verifier := hostKeyVerifier
+	if verifier.Mode == entity.HostKeyModeInsecure {
+		return nil
+	}
+	keys, err := verifier.Store.ListHostKeys(knownhosts.Normalize(address))
+	if err != nil {
+		return nil
+	}
+	var algorithms []string
+	for _, stored := range keys {
+		if stored.Status != entity.HostKeyTrusted {
+			continue
+		}
+		for _, algorithm := range keyAlgorithms(stored.KeyType) {
+			if !slices.Contains(algorithms, algorithm) {
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	}
+	return algorithms
+}
+
+// keyAlgorithms returns the signature algorithms a key of keyType is presented with.
+func keyAlgorithms(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+func newHostKey(host string, key ssh.PublicKey) *entity.HostKey {
+	return &entity.HostKey{
+		Host:        host,
+		KeyType:     key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		PublicKey:   base64.StdEncoding.EncodeToString(key.Marshal()),
+		Status:      entity.HostKeyPending,
+		Source:      entity.HostKeySourceSeen,
+	}
+}
+
+// ImportKnownHosts stores the keys of a known_hosts file as trusted and returns the imported keys.
+// Hashed host names and @cert-authority lines cannot be mapped to a host and are skipped.
+func ImportKnownHosts(store HostKeyStore, content []byte) ([]entity.HostKey, error) {
+	var imported []entity.HostKey
+	rest := content
+	for len(rest) > 0 {
+		marker, hosts, key, _, next, err := ssh.ParseKnownHosts(rest)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return imported, fmt.Errorf("invalid known_hosts content: %w", err)
+		}
+		rest = next
+		if marker != "" {
+			continue
+		}
+		for _, host := range hosts {
+			if strings.HasPrefix(host, "|") {
+				continue
+			}
+			record, err := trustHostKey(store, knownhosts.Normalize(host), key)
+			if err != nil {
+				return imported, err
+			}
+			imported = append(imported, *record)
+		}
+	}
+	return imported, nil
+}
+
+func trustHostKey(store HostKeyStore, host string, key ssh.PublicKey) (*entity.HostKey, error) {
+	keys, err := store.ListHostKeys(host)
+	if err != nil {
+		return nil, err
+	}
+	record := newHostKey(host, key)
+	for _, stored := range keys {
+		if stored.Fingerprint == record.Fingerprint {
+			record = &stored
+			break
+		}
+	}
+	record.Status = entity.HostKeyTrusted
+	record.Source = entity.HostKeySourceKnownHosts
+	return record, store.SaveHostKey(record)
+}
+
+// MemoryHostKeyStore keeps host keys for the lifetime of the process. It is used until a database is configured.
+type MemoryHostKeyStore struct {
+	mutex sync.Mutex
+	keys  []entity.HostKey
+}
+
+func NewMemoryHostKeyStore() *MemoryHostKeyStore {
+	return &MemoryHostKeyStore{}
+}
+
+func (store *MemoryHostKeyStore) ListHostKeys(host string) ([]entity.HostKey, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var keys []entity.HostKey
+	for _, key := range store.keys {
+		if host == "" || key.Host == host {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (store *MemoryHostKeyStore) SaveHostKey(key *entity.HostKey) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for i := range store.keys {
+		if store.keys[i].ID == key.ID {
+			store.keys[i] = *key
+			return nil
+		}
+	}
+	key.ID = uint(len(store.keys) + 1)
+	store.keys = append(store.keys, *key)
+	return nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func testHostKeys(t *testing.T) (ssh.PublicKey, ssh.PublicKey) {
+	t.Helper()
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, err := ssh.NewPublicKey(edPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ssh.NewPublicKey(&ecPrivate.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return edKey, ecKey
+}
+
+func TestHostKeyOfAnotherTypeIsNotAChange(t *testing.T) {
+	edKey, ecKey := testHostKeys(t)
+	store := NewMemoryHostKeyStore()
+	if _, err := ImportKnownHosts(store, []byte("10.0.0.1 "+string(ssh.MarshalAuthorizedKey(edKey)))); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	verifier := &HostKeyVerifier{Mode: entity.HostKeyModeKnownHosts, Store: store}
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+	if err := verifier.Verify("10.0.0.1:22", remote, edKey); err != nil {
+		t.Errorf("Expected the imported key to be trusted, got %v", err)
+	}
+	if err := verifier.Verify("10.0.0.1:22", remote, ecKey); !errors.Is(err, ErrHostKeyUnknown) {
+		t.Errorf("Expected a key of another type to be unknown, got %v", err)
+	}
+	_, otherKey := testHostKeys(t)
+	trustHostKey(store, "10.0.0.1", ecKey)
+	if err := verifier.Verify("10.0.0.1:22", remote, otherKey); !errors.Is(err, ErrHostKeyChanged) {
+		t.Errorf("Expected another key of a trusted type to be a change, got %v", err)
+	}
+
+	tofu := &HostKeyVerifier{Mode: entity.HostKeyModeTOFU, Store: NewMemoryHostKeyStore()}
+	trustHostKey(tofu.Store, "10.0.0.2", edKey)
+	if err := tofu.Verify("10.0.0.2:22", remote, ecKey); !errors.Is(err, ErrHostKeyUnknown) {
+		t.Errorf("Expected a key of another type not to be trusted on first use, got %v", err)
+	}
+}
+
+func TestHostKeyAlgorithmsOfTrustedKeys(t *testing.T) {
+	edKey, _ := testHostKeys(t)
+	store := NewMemoryHostKeyStore()
+	trustHostKey(store, "10.0.0.1", edKey)
+	previous := hostKeyVerifier
+	hostKeyVerifier = &HostKeyVerifier{Mode: entity.HostKeyModeStrict, Store: store}
+	defer func() { hostKeyVerifier = previous }()
+
+	if algorithms := hostKeyAlgorithms("10.0.0.1:22"); !reflect.DeepEqual(algorithms, []string{ssh.KeyAlgoED25519}) {
+		t.Errorf("Expected only ed25519 to be offered, got %v", algorithms)
+	}
+	if algorithms := hostKeyAlgorithms("10.0.0.2:22"); len(algorithms) != 0 {
+		t.Errorf("Expected the defaults for an unknown host, got %v", algorithms)
+	}
+	if algorithms := keyAlgorithms(ssh.KeyAlgoRSA); len(algorithms) != 3 || algorithms[0] != ssh.KeyAlgoRSASHA512 {
+		t.Errorf("Expected RSA keys to be offered with SHA-2 signatures first, got %v", algorithms)
+	}
+}
@@ -1,6 +1,9 @@
 package utils
 
-import "os"
+import (
+	"context"
+	"os"
+)
 
 // Executor interface defines methods for executing commands and copying files.
 type Executor interface {
@@ -11,6 +14,8 @@ type Executor interface {
 	WriteFile(content []byte, path string, perm os.FileMode)
 	MkDirALL(path string, outputHandler func(string)) error
 	ExecuteShortCommand(command string) (string, error)
+	ExecuteCommandContext(ctx context.Context, command string, logChan chan LogEntry) error
+	ExecuteShortCommandContext(ctx context.Context, command string) (string, error)
 }
 
 // Connection interface defines methods for establishing a connection.
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/logger"
@@ -29,11 +30,11 @@ func (client *KeepalivedClient) InstallKeepalived(logChan chan LogEntry) error {
 		return err
 	}
 	if os == "ubuntu" {
-		command = "sudo apt install keepalived -y"
+		command = "apt install keepalived -y"
 	} else if os == "centos" {
-		command = "sudo yum install keepalived -y"
+		command = "yum install keepalived -y"
 	}
-	err = client.OSClient.SSExecutor.ExecuteCommand(command, logChan)
+	err = client.OSClient.SSExecutor.AsRoot().ExecuteCommand(command, logChan)
 	if err != nil {
 		logger.GetLogger().Printf("Failed to install keepalived: %s", err.Error())
 		return err
@@ -94,11 +95,7 @@ vrrp_instance keepalived-vip {
 		logger.GetLogger().Printf("Failed to generate template: %s", err.Error())
 		return err
 	}
-	command := fmt.Sprintf("bash -c \"echo '%s' > %s\"", rendered.String(), configFile)
-	if client.OSClient.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.OSClient.SSExecutor.Host.Password)
-	}
-	err = client.OSClient.SSExecutor.ExecuteCommandWithoutReturn(command)
+	err = client.OSClient.SSExecutor.PutFile(context.Background(), &rendered, RemoteFile{Path: configFile, Mode: 0644, Owner: "root:root", Backup: true})
 	if err != nil {
 		logger.GetLogger().Printf("Failed to generate Keepalived config: %s", err.Error())
 		return err
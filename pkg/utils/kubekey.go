@@ -1,14 +1,13 @@
 package utils
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/logger"
-	"log"
+	"github.com/whoisfisher/mykubespray/pkg/utils/kubekey/v1alpha2"
+	"gopkg.in/yaml.v2"
 	"path/filepath"
-	"strings"
-	"text/template"
 )
 
 type KubekeyClient struct {
@@ -23,261 +22,181 @@ func NewKubekeyClient(kubekeyConf entity.KubekeyConf, osClient OSClient) *Kubeke
 	}
 }
 
-func (client *KubekeyClient) ParseToTemplate() *entity.KubekeyTemplate {
-	template := &entity.KubekeyTemplate{}
-	for _, host := range client.KubekeyConf.Hosts {
+// BuildCluster converts the configuration into the v1alpha2 Cluster kk expects, applying defaults.
+func (client *KubekeyClient) BuildCluster() (*v1alpha2.Cluster, error) {
+	conf := client.KubekeyConf
+	cluster := &v1alpha2.Cluster{
+		APIVersion: v1alpha2.APIVersion,
+		Kind:       v1alpha2.Kind,
+		Metadata:   v1alpha2.Metadata{Name: conf.ClusterName},
+	}
+	spec := &cluster.Spec
+
+	var insecureRegistries []string
+	for _, host := range conf.Hosts {
+		hostCfg := v1alpha2.HostCfg{
+			Name:            host.Name,
+			Address:         host.Address,
+			InternalAddress: host.InternalAddress,
+			Port:            host.Port,
+			User:            host.User,
+			Arch:            host.Arch,
+		}
 		if len(host.Password) > 0 {
-			template.HostList += fmt.Sprintf("- {name: %s, address: %s, internalAddress: %s, port: %d, user: %s, password: %s, arch: %s}\n  ", host.Name, host.Address, host.InternalAddress, host.Port, host.User, host.Password, host.Arch)
+			hostCfg.Password = host.Password
 		} else if len(host.PrivateKey) > 0 {
-			template.HostList += fmt.Sprintf("- {name: %s, address: %s, internalAddress: %s, port: %d, user: %s, privateKeyPath: %s, arch: %s}\n  ", host.Name, host.Address, host.InternalAddress, host.Port, host.User, host.PrivateKey, host.Arch)
+			hostCfg.PrivateKeyPath = host.PrivateKey
 		} else {
-			logger.GetLogger().Errorf("Password or PrivateKeyPath cannot empty")
-			return nil
+			return nil, fmt.Errorf("password or private key of host %s cannot be empty", host.Name)
 		}
-
-		if host.Registry != nil && host.Registry.InsecureRegistries != nil {
-			for _, ir := range host.Registry.InsecureRegistries {
-				template.InsecureRegistry += fmt.Sprintf("%s", ir)
-				template.InsecureRegistry += ","
-			}
-			template.InsecureRegistry = template.InsecureRegistry[:len(template.InsecureRegistry)-1]
+		spec.Hosts = append(spec.Hosts, hostCfg)
+		if host.Registry != nil {
+			insecureRegistries = append(insecureRegistries, host.Registry.InsecureRegistries...)
 		}
 	}
-	template.HostList = strings.TrimSpace(template.HostList)
 
-	for _, cp := range client.KubekeyConf.Etcds {
-		template.EtcdList += fmt.Sprintf("- %s\n    ", cp)
+	if len(insecureRegistries) == 0 {
+		insecureRegistries = conf.Registry.InsecureRegistries
 	}
-	template.EtcdList = strings.TrimSpace(template.EtcdList)
 
-	for _, cp := range client.KubekeyConf.ContronPlanes {
-		template.ControlPlaneList += fmt.Sprintf("- %s\n    ", cp)
+	spec.RoleGroups = v1alpha2.RoleGroups{
+		Etcd:         conf.Etcds,
+		ControlPlane: conf.ContronPlanes,
+		Worker:       conf.Workers,
+	}
+	if conf.Registry.NodeName != "" {
+		spec.RoleGroups.Registry = []string{conf.Registry.NodeName}
 	}
-	template.ControlPlaneList = strings.TrimSpace(template.ControlPlaneList)
 
-	for _, cp := range client.KubekeyConf.Workers {
-		template.WorkerList += fmt.Sprintf("- %s\n    ", cp)
+	domain := defaultString(conf.ControlPlaneDomain, entity.DefaultControlPlaneDomain)
+	spec.ControlPlaneEndpoint = v1alpha2.ControlPlaneEndpoint{
+		Domain:  domain,
+		Address: conf.VIPServer,
+		Port:    6443,
+	}
+	if len(conf.VIPServer) == 0 {
+		spec.ControlPlaneEndpoint.InternalLoadbalancer = "haproxy"
 	}
-	template.WorkerList = strings.TrimSpace(template.WorkerList)
 
-	for _, ns := range client.KubekeyConf.NtpServers {
-		template.NtpServerList += fmt.Sprintf("- %s\n      ", ns)
+	spec.System = v1alpha2.System{
+		NtpServers: conf.NtpServers,
+		Timezone:   defaultString(conf.Timezone, entity.DefaultTimezone),
 	}
 
-	template.NtpServerList = strings.TrimSpace(template.NtpServerList)
-	template.Registry += fmt.Sprintf("- %s", client.KubekeyConf.Registry.NodeName)
-	template.RegistryType = client.KubekeyConf.Registry.Type
-	template.RegistryUrI = client.KubekeyConf.Registry.Url
-	template.RegistryUser = client.KubekeyConf.Registry.User
-	template.RegistryPassword = client.KubekeyConf.Registry.Password
-	template.RegistryCertPath = client.KubekeyConf.Registry.CertPath
-	template.RegistryKeyPath = client.KubekeyConf.Registry.KeyPath
-	template.RegistrySkipTLS = client.KubekeyConf.Registry.SkipTLS
-	template.RegistryPlainHttp = client.KubekeyConf.Registry.PlainHttp
-	template.RegistryNodeName = client.KubekeyConf.Registry.NodeName
-	template.ProxyMode = client.KubekeyConf.ProxyMode
-	template.IPIPMode = client.KubekeyConf.IPIPMode
-	template.VxlanMode = client.KubekeyConf.VxlanMode
-	template.ContainerManager = client.KubekeyConf.ContainerManager
-	template.ClusterName = client.KubekeyConf.ClusterName
-	template.KubernetesVersion = client.KubekeyConf.KubernetesVersion
-	template.KubeServiceCIDR = client.KubekeyConf.KubeServiceCIDR
-	template.KubePodsCIDR = client.KubekeyConf.KubePodsCIDR
-	template.KKPath = client.KubekeyConf.KKPath
-	template.TaichuPackagePath = client.KubekeyConf.TaichuPackagePath
-	template.VIPServer = client.KubekeyConf.VIPServer
-	return template
-}
+	sans := []string{domain}
+	for _, san := range conf.ExtraSANs {
+		if san != domain {
+			sans = append(sans, san)
+		}
+	}
+	spec.Kubernetes = v1alpha2.Kubernetes{
+		Version:                conf.KubernetesVersion,
+		ClusterName:            "cluster.local",
+		AutoRenewCerts:         true,
+		ContainerManager:       conf.ContainerManager,
+		ApiserverCertExtraSans: sans,
+		ProxyMode:              conf.ProxyMode,
+	}
 
-func (client *KubekeyClient) GenerateConfig() error {
-	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
-	configPath := filepath.Join(dirPath, client.KubekeyConf.ClusterName)
-	configPath = filepath.ToSlash(configPath)
-	path := filepath.Join(configPath, "config-sample.yaml")
-	path = filepath.ToSlash(path)
-	templateText := `
-apiVersion: kubekey.kubesphere.io/v1alpha2
-kind: Cluster
-metadata:
-  name: {{ .ClusterName }}
-spec:
-  hosts:
-  {{ .HostList }}
-  roleGroups:
-    etcd:
-    {{ .EtcdList }}
-    control-plane: 
-    {{ .ControlPlaneList }}
-    worker:
-    {{ .WorkerList }}
-    registry:
-    {{ .Registry }}
-  controlPlaneEndpoint:
-    internalLoadbalancer: haproxy
-    domain: lb.cars.local
-    address: ""
-    port: 6443
-  system:
-    ntpServers:
-      {{ .NtpServerList }}
-    timezone: "Asia/Shanghai"
-  kubernetes:
-    version: {{ .KubernetesVersion }}
-    clusterName: cluster.local
-    autoRenewCerts: true
-    containerManager: {{ .ContainerManager }}
-    apiserverCertExtraSans:  
-      - lb.cars.local
-    proxyMode: {{ .ProxyMode }}
-  etcd:
-    type: kubekey
-  network:
-    plugin: calico
-    calico:
-      ipipMode: {{ .IPIPMode }}
-      vxlanMode: {{ .VxlanMode }}
-    kubePodsCIDR: {{ .KubePodsCIDR }}
-    kubeServiceCIDR: {{ .KubeServiceCIDR }}
-    multusCNI:
-      enabled: false
-  registry:
-    {{- if .RegistryType }}
-    type: {{ .RegistryType }}
-    {{- end }}
-    auths:
-      "{{ .RegistryUrI }}":
-        username: {{ .RegistryUser }}
-        password: {{ .RegistryPassword }}
-        skipTLSVerify: {{ .RegistrySkipTLS }}
-        plainHTTP: {{ .RegistryPlainHttp }}
-    privateRegistry: "{{ .RegistryUrI }}"
-    namespaceOverride: "carsio"
-    registryMirrors: []
-    insecureRegistries: ["{{ .InsecureRegistry }}"]
-  addons: []
-`
-	kubekeyTemplate := client.ParseToTemplate()
-	tmpl, err := template.New("config-sample.yaml").Parse(templateText)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to generate template object: %s", err.Error())
-		return err
+	spec.Etcd = v1alpha2.EtcdCluster{Type: defaultString(conf.EtcdType, entity.DefaultEtcdType)}
+
+	plugin := defaultString(conf.NetworkPlugin, entity.DefaultNetworkPlugin)
+	if !entity.IsSupportedNetworkPlugin(plugin) {
+		return nil, fmt.Errorf("unsupported network plugin %s", plugin)
 	}
-	var rendered bytes.Buffer
-	err = tmpl.Execute(&rendered, kubekeyTemplate)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to generate template: %s", err.Error())
-		return err
+	spec.Network = v1alpha2.NetworkConfig{
+		Plugin:          kubekeyNetworkPlugin(plugin),
+		KubePodsCIDR:    conf.KubePodsCIDR,
+		KubeServiceCIDR: conf.KubeServiceCIDR,
+		MultusCNI:       v1alpha2.MultusCNI{Enabled: conf.EnableMultus},
 	}
-	err = client.OSClient.SSExecutor.MkDirALL(configPath, func(s string) {
-		logger.GetLogger().Infof(s)
-	})
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to generate dir %s: %s", configPath, err.Error())
-		return err
+	switch plugin {
+	case entity.NetworkPluginCalico:
+		spec.Network.Calico = &v1alpha2.CalicoCfg{IPIPMode: conf.IPIPMode, VXLANMode: conf.VxlanMode}
+	case entity.NetworkPluginFlannel:
+		spec.Network.Flannel = &v1alpha2.FlannelCfg{BackendMode: "vxlan"}
+	case entity.NetworkPluginKubeOvn:
+		spec.Network.KubeOvn = &v1alpha2.KubeOvnCfg{}
+	}
+
+	registry := conf.Registry
+	spec.Registry = v1alpha2.RegistryConfig{
+		Type:               registry.Type,
+		PrivateRegistry:    registry.Url,
+		NamespaceOverride:  defaultString(conf.NamespaceOverride, entity.DefaultNamespaceOverride),
+		RegistryMirrors:    conf.RegistryMirrors,
+		InsecureRegistries: insecureRegistries,
 	}
-	command := fmt.Sprintf("bash -c \"echo '%s' > %s\"", rendered.String(), path)
-	if client.OSClient.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.OSClient.SSExecutor.Host.Password)
+	if spec.Registry.RegistryMirrors == nil {
+		spec.Registry.RegistryMirrors = []string{}
 	}
-	err = client.OSClient.SSExecutor.ExecuteCommandWithoutReturn(command)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to generate kubekey config: %s", err.Error())
-		return err
+	if spec.Registry.InsecureRegistries == nil {
+		spec.Registry.InsecureRegistries = []string{}
 	}
-	return nil
+	if registry.Url != "" {
+		spec.Registry.Auths = map[string]v1alpha2.RegistryAuth{
+			registry.Url: {
+				Username:      registry.User,
+				Password:      registry.Password,
+				SkipTLSVerify: registry.SkipTLS,
+				PlainHTTP:     registry.PlainHttp,
+			},
+		}
+	}
+
+	spec.Addons = []v1alpha2.Addon{}
+	for _, addon := range conf.Addons {
+		item := v1alpha2.Addon{Name: addon.Name, Namespace: addon.Namespace}
+		if addon.Chart != nil {
+			item.Sources.Chart = &v1alpha2.Chart{
+				Name:       addon.Chart.Name,
+				Repo:       addon.Chart.Repo,
+				Path:       addon.Chart.Path,
+				Version:    addon.Chart.Version,
+				ValuesFile: addon.Chart.ValuesFile,
+				Values:     addon.Chart.Values,
+			}
+		}
+		if len(addon.YamlPaths) > 0 {
+			item.Sources.Yaml = &v1alpha2.Yaml{Path: addon.YamlPaths}
+		}
+		if item.Sources.Chart == nil && item.Sources.Yaml == nil {
+			return nil, fmt.Errorf("addon %s has neither a chart nor yaml sources", addon.Name)
+		}
+		spec.Addons = append(spec.Addons, item)
+	}
+	return cluster, nil
 }
 
-func (client *KubekeyClient) GenerateConfigWithVIP() error {
-	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
-	configPath := filepath.Join(dirPath, client.KubekeyConf.ClusterName)
-	configPath = filepath.ToSlash(configPath)
-	path := filepath.Join(configPath, "config-sample.yaml")
-	path = filepath.ToSlash(path)
-	templateText := `
-apiVersion: kubekey.kubesphere.io/v1alpha2
-kind: Cluster
-metadata:
-  name: {{ .ClusterName }}
-spec:
-  hosts:
-  {{ .HostList }}
-  roleGroups:
-    etcd:
-    {{ .EtcdList }}
-    control-plane: 
-    {{ .ControlPlaneList }}
-    worker:
-    {{ .WorkerList }}
-    registry:
-    {{ .Registry }}
-  controlPlaneEndpoint:
-    domain: lb.cars.local
-    address: "{{ .VIPServer }}"
-    port: 6443
-  system:
-    ntpServers:
-      {{ .NtpServerList }}
-    timezone: "Asia/Shanghai"
-  kubernetes:
-    version: {{ .KubernetesVersion }}
-    clusterName: cluster.local
-    autoRenewCerts: true
-    containerManager: {{ .ContainerManager }}
-    apiserverCertExtraSans:  
-      - lb.cars.local
-    proxyMode: {{ .ProxyMode }}
-  etcd:
-    type: kubekey
-  network:
-    plugin: calico
-    calico:
-      ipipMode: {{ .IPIPMode }}
-      vxlanMode: {{ .VxlanMode }}
-    kubePodsCIDR: {{ .KubePodsCIDR }}
-    kubeServiceCIDR: {{ .KubeServiceCIDR }}
-    multusCNI:
-      enabled: false
-  registry:
-    {{- if .RegistryType }}
-    type: {{ .RegistryType }}
-    {{- end }}
-    auths:
-      "{{ .RegistryUrI }}":
-        username: {{ .RegistryUser }}
-        password: {{ .RegistryPassword }}
-        skipTLSVerify: {{ .RegistrySkipTLS }}
-        plainHTTP: {{ .RegistryPlainHttp }}
-    privateRegistry: "{{ .RegistryUrI }}"
-    namespaceOverride: "carsio"
-    registryMirrors: []
-    insecureRegistries: ["{{ .InsecureRegistry }}"]
-  addons: []
-`
-	kubekeyTemplate := client.ParseToTemplate()
-	tmpl, err := template.New("config-sample.yaml").Parse(templateText)
+// RenderConfig returns the config-sample.yaml content for the cluster.
+func (client *KubekeyClient) RenderConfig() ([]byte, error) {
+	cluster, err := client.BuildCluster()
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to generate template object: %s", err.Error())
-		return err
+		logger.GetLogger().Errorf("Failed to build kubekey cluster %s: %s", client.KubekeyConf.ClusterName, err.Error())
+		return nil, err
 	}
-	var rendered bytes.Buffer
-	err = tmpl.Execute(&rendered, kubekeyTemplate)
+	data, err := yaml.Marshal(cluster)
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to generate template: %s", err.Error())
-		return err
+		logger.GetLogger().Errorf("Failed to marshal kubekey cluster %s: %s", client.KubekeyConf.ClusterName, err.Error())
+		return nil, err
 	}
-	err = client.OSClient.SSExecutor.MkDirALL(configPath, func(s string) {
-		log.Println(s)
-	})
+	return data, nil
+}
+
+// ConfigPath is where the generated config-sample.yaml of the cluster lives on the kk host.
+func (client *KubekeyClient) ConfigPath() string {
+	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
+	path := filepath.Join(dirPath, client.KubekeyConf.ClusterName, "config-sample.yaml")
+	return filepath.ToSlash(path)
+}
+
+// GenerateConfig renders the cluster configuration and writes it next to kk.
+func (client *KubekeyClient) GenerateConfig() error {
+	rendered, err := client.RenderConfig()
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to generate dir %s: %s", configPath, err.Error())
 		return err
 	}
-	//command := fmt.Sprintf("echo '%s' > %s", rendered.String(), path)
-	command := fmt.Sprintf("bash -c \"echo '%s' > %s\"", rendered.String(), path)
-	if client.OSClient.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.OSClient.SSExecutor.Host.Password)
-	}
-	err = client.OSClient.SSExecutor.ExecuteCommandWithoutReturn(command)
+	err = writeRemoteFile(&client.OSClient, client.ConfigPath(), rendered)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to generate kubekey config: %s", err.Error())
 		return err
@@ -285,14 +204,29 @@ spec:
 	return nil
 }
 
-func (client *KubekeyClient) CreateCluster(logChan chan LogEntry) error {
+// kubekeyNetworkPlugin returns the name kk knows a network plugin by, kube-ovn is kubeovn there.
+func kubekeyNetworkPlugin(plugin string) string {
+	if plugin == entity.NetworkPluginKubeOvn {
+		return "kubeovn"
+	}
+	return plugin
+}
+
+func defaultString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+func (client *KubekeyClient) CreateCluster(ctx context.Context, logChan chan LogEntry) error {
 	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
 	configPath := filepath.Join(dirPath, client.KubekeyConf.ClusterName)
 	configPath = filepath.ToSlash(configPath)
 	path := filepath.Join(configPath, "config-sample.yaml")
 	path = filepath.ToSlash(path)
 	command := fmt.Sprintf("kk create cluster -f %s -a %s --with-packages --yes", path, client.KubekeyConf.TaichuPackagePath)
-	err := client.OSClient.SSExecutor.ExecuteCommand(command, logChan)
+	err := client.OSClient.SSExecutor.ExecuteCommandContext(ctx, command, logChan)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to create cluster %s: %s", client.KubekeyConf.ClusterName, err.Error())
 		return err
@@ -300,14 +234,14 @@ func (client *KubekeyClient) CreateCluster(logChan chan LogEntry) error {
 	return nil
 }
 
-func (client *KubekeyClient) DeleteCluster(logChan chan LogEntry) error {
+func (client *KubekeyClient) DeleteCluster(ctx context.Context, logChan chan LogEntry) error {
 	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
 	configPath := filepath.Join(dirPath, client.KubekeyConf.ClusterName)
 	configPath = filepath.ToSlash(configPath)
 	path := filepath.Join(configPath, "config-sample.yaml")
 	path = filepath.ToSlash(path)
 	command := fmt.Sprintf("kk delete cluster -f %s --yes", path)
-	err := client.OSClient.SSExecutor.ExecuteCommand(command, logChan)
+	err := client.OSClient.SSExecutor.ExecuteCommandContext(ctx, command, logChan)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to delete cluster %s: %s", client.KubekeyConf.ClusterName, err.Error())
 		return err
@@ -315,14 +249,14 @@ func (client *KubekeyClient) DeleteCluster(logChan chan LogEntry) error {
 	return nil
 }
 
-func (client *KubekeyClient) AddNode(logChan chan LogEntry) error {
+func (client *KubekeyClient) AddNode(ctx context.Context, logChan chan LogEntry) error {
 	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
 	configPath := filepath.Join(dirPath, client.KubekeyConf.ClusterName)
 	configPath = filepath.ToSlash(configPath)
 	path := filepath.Join(configPath, "config-sample.yaml")
 	path = filepath.ToSlash(path)
 	command := fmt.Sprintf("kk add nodes -f %s --yes", path)
-	err := client.OSClient.SSExecutor.ExecuteCommand(command, logChan)
+	err := client.OSClient.SSExecutor.ExecuteCommandContext(ctx, command, logChan)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to add node to cluster %s: %s", client.KubekeyConf.ClusterName, err.Error())
 		return err
@@ -330,14 +264,14 @@ func (client *KubekeyClient) AddNode(logChan chan LogEntry) error {
 	return nil
 }
 
-func (client *KubekeyClient) DeleteNode(nodeName string, logChan chan LogEntry) error {
+func (client *KubekeyClient) DeleteNode(ctx context.Context, nodeName string, logChan chan LogEntry) error {
 	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
 	configPath := filepath.Join(dirPath, client.KubekeyConf.ClusterName)
 	configPath = filepath.ToSlash(configPath)
 	path := filepath.Join(configPath, "config-sample.yaml")
 	path = filepath.ToSlash(path)
 	command := fmt.Sprintf("kk delete node %s -f %s", nodeName, path)
-	err := client.OSClient.SSExecutor.ExecuteCommand(command, logChan)
+	err := client.OSClient.SSExecutor.ExecuteCommandContext(ctx, command, logChan)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to delete node %s from cluster %s: %s", nodeName, client.KubekeyConf.ClusterName, err.Error())
 		return err
@@ -345,29 +279,29 @@ func (client *KubekeyClient) DeleteNode(nodeName string, logChan chan LogEntry)
 	return nil
 }
 
-func (client *KubekeyClient) CheckCertExpirtation(logChan chan LogEntry) error {
-	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
-	configPath := filepath.Join(dirPath, client.KubekeyConf.ClusterName)
-	configPath = filepath.ToSlash(configPath)
-	path := filepath.Join(configPath, "config-sample.yaml")
-	path = filepath.ToSlash(path)
-	command := fmt.Sprintf("kk certs check-expirtation -f %s", path)
-	err := client.OSClient.SSExecutor.ExecuteCommand(command, logChan)
+// CheckCertExpiration runs kk certs check-expiration and parses its tables.
+func (client *KubekeyClient) CheckCertExpiration(ctx context.Context) ([]entity.ClusterCert, error) {
+	command := fmt.Sprintf("kk certs check-expiration -f %s", client.ConfigPath())
+	output, err := client.OSClient.SSExecutor.ExecuteShortCommandContext(ctx, command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to check cert expiration %s: %s", client.KubekeyConf.ClusterName, err.Error())
-		return err
+		return nil, err
 	}
-	return nil
+	certs := ParseCertExpiration(output)
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in kk output of cluster %s", client.KubekeyConf.ClusterName)
+	}
+	return certs, nil
 }
 
-func (client *KubekeyClient) RenewCert(logChan chan LogEntry) error {
+func (client *KubekeyClient) RenewCert(ctx context.Context, logChan chan LogEntry) error {
 	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
 	configPath := filepath.Join(dirPath, client.KubekeyConf.ClusterName)
 	configPath = filepath.ToSlash(configPath)
 	path := filepath.Join(configPath, "config-sample.yaml")
 	path = filepath.ToSlash(path)
 	command := fmt.Sprintf("kk certs renew -f %s", path)
-	err := client.OSClient.SSExecutor.ExecuteCommand(command, logChan)
+	err := client.OSClient.SSExecutor.ExecuteCommandContext(ctx, command, logChan)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to renew cert %s: %s", client.KubekeyConf.ClusterName, err.Error())
 		return err
@@ -375,14 +309,14 @@ func (client *KubekeyClient) RenewCert(logChan chan LogEntry) error {
 	return nil
 }
 
-func (client *KubekeyClient) UpgradeCluster(logChan chan LogEntry) error {
+func (client *KubekeyClient) UpgradeCluster(ctx context.Context, logChan chan LogEntry) error {
 	dirPath := filepath.Dir(client.KubekeyConf.KKPath)
 	configPath := filepath.Join(dirPath, client.KubekeyConf.ClusterName)
 	configPath = filepath.ToSlash(configPath)
 	path := filepath.Join(configPath, "config-sample.yaml")
 	path = filepath.ToSlash(path)
 	command := fmt.Sprintf("kk upgrade -f %s", path)
-	err := client.OSClient.SSExecutor.ExecuteCommand(command, logChan)
+	err := client.OSClient.SSExecutor.ExecuteCommandContext(ctx, command, logChan)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to upgrade %s: %s", client.KubekeyConf.ClusterName, err.Error())
 		return err
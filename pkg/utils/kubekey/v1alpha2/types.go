@@ -0,0 +1,141 @@
+// Package v1alpha2 models the kubekey.kubesphere.io/v1alpha2 Cluster kind consumed by kk.
+package v1alpha2
+
+const (
+	APIVersion = "kubekey.kubesphere.io/v1alpha2"
+	Kind       = "Cluster"
+)
+
+type Cluster struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   Metadata    `yaml:"metadata"`
+	Spec       ClusterSpec `yaml:"spec"`
+}
+
+type Metadata struct {
+	Name string `yaml:"name"`
+}
+
+type ClusterSpec struct {
+	Hosts                []HostCfg            `yaml:"hosts"`
+	RoleGroups           RoleGroups           `yaml:"roleGroups"`
+	ControlPlaneEndpoint ControlPlaneEndpoint `yaml:"controlPlaneEndpoint"`
+	System               System               `yaml:"system"`
+	Kubernetes           Kubernetes           `yaml:"kubernetes"`
+	Etcd                 EtcdCluster          `yaml:"etcd"`
+	Network              NetworkConfig        `yaml:"network"`
+	Registry             RegistryConfig       `yaml:"registry"`
+	Addons               []Addon              `yaml:"addons"`
+}
+
+type HostCfg struct {
+	Name            string `yaml:"name"`
+	Address         string `yaml:"address"`
+	InternalAddress string `yaml:"internalAddress"`
+	Port            int32  `yaml:"port,omitempty"`
+	User            string `yaml:"user"`
+	Password        string `yaml:"password,omitempty"`
+	PrivateKeyPath  string `yaml:"privateKeyPath,omitempty"`
+	Arch            string `yaml:"arch,omitempty"`
+}
+
+type RoleGroups struct {
+	Etcd         []string `yaml:"etcd"`
+	ControlPlane []string `yaml:"control-plane"`
+	Worker       []string `yaml:"worker"`
+	Registry     []string `yaml:"registry,omitempty"`
+}
+
+type ControlPlaneEndpoint struct {
+	InternalLoadbalancer string `yaml:"internalLoadbalancer,omitempty"`
+	Domain               string `yaml:"domain"`
+	Address              string `yaml:"address"`
+	Port                 int    `yaml:"port"`
+}
+
+type System struct {
+	NtpServers []string `yaml:"ntpServers,omitempty"`
+	Timezone   string   `yaml:"timezone,omitempty"`
+}
+
+type Kubernetes struct {
+	Version                string   `yaml:"version"`
+	ClusterName            string   `yaml:"clusterName"`
+	AutoRenewCerts         bool     `yaml:"autoRenewCerts"`
+	ContainerManager       string   `yaml:"containerManager,omitempty"`
+	ApiserverCertExtraSans []string `yaml:"apiserverCertExtraSans,omitempty"`
+	ProxyMode              string   `yaml:"proxyMode,omitempty"`
+}
+
+type EtcdCluster struct {
+	Type string `yaml:"type"`
+}
+
+type NetworkConfig struct {
+	Plugin          string      `yaml:"plugin"`
+	Calico          *CalicoCfg  `yaml:"calico,omitempty"`
+	KubePodsCIDR    string      `yaml:"kubePodsCIDR"`
+	KubeServiceCIDR string      `yaml:"kubeServiceCIDR"`
+	MultusCNI       MultusCNI   `yaml:"multusCNI"`
+	Flannel         *FlannelCfg `yaml:"flannel,omitempty"`
+	KubeOvn         *KubeOvnCfg `yaml:"kubeovn,omitempty"`
+}
+
+type CalicoCfg struct {
+	IPIPMode  string `yaml:"ipipMode,omitempty"`
+	VXLANMode string `yaml:"vxlanMode,omitempty"`
+}
+
+type FlannelCfg struct {
+	BackendMode string `yaml:"backendMode,omitempty"`
+}
+
+type KubeOvnCfg struct {
+	EnableSSL bool `yaml:"enableSSL"`
+}
+
+type MultusCNI struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type RegistryConfig struct {
+	Type               string                  `yaml:"type,omitempty"`
+	Auths              map[string]RegistryAuth `yaml:"auths,omitempty"`
+	PrivateRegistry    string                  `yaml:"privateRegistry"`
+	NamespaceOverride  string                  `yaml:"namespaceOverride"`
+	RegistryMirrors    []string                `yaml:"registryMirrors"`
+	InsecureRegistries []string                `yaml:"insecureRegistries"`
+}
+
+type RegistryAuth struct {
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+	SkipTLSVerify bool   `yaml:"skipTLSVerify"`
+	PlainHTTP     bool   `yaml:"plainHTTP"`
+	CertsPath     string `yaml:"certsPath,omitempty"`
+}
+
+type Addon struct {
+	Name      string  `yaml:"name"`
+	Namespace string  `yaml:"namespace,omitempty"`
+	Sources   Sources `yaml:"sources"`
+}
+
+type Sources struct {
+	Chart *Chart `yaml:"chart,omitempty"`
+	Yaml  *Yaml  `yaml:"yaml,omitempty"`
+}
+
+type Chart struct {
+	Name       string   `yaml:"name"`
+	Repo       string   `yaml:"repo,omitempty"`
+	Path       string   `yaml:"path,omitempty"`
+	Version    string   `yaml:"version,omitempty"`
+	ValuesFile string   `yaml:"valuesFile,omitempty"`
+	Values     []string `yaml:"values,omitempty"`
+}
+
+type Yaml struct {
+	Path []string `yaml:"path"`
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func kubekeyTestConf() entity.KubekeyConf {
+	return entity.KubekeyConf{
+		ClusterName: "prod",
+		Hosts: []entity.Host{
+			{Name: "master1", Address: "192.168.10.11", InternalAddress: "192.168.10.11", Port: 22, User: "root", Password: "secret", Arch: "amd64"},
+			{Name: "worker1", Address: "192.168.10.21", InternalAddress: "192.168.10.21", User: "root", PrivateKey: "/root/.ssh/id_rsa",
+				Registry: &entity.Registry{InsecureRegistries: []string{"dockerhub.kubekey.local"}}},
+		},
+		Etcds:             []string{"master1"},
+		ContronPlanes:     []string{"master1"},
+		Workers:           []string{"worker1"},
+		NtpServers:        []string{"ntp.aliyun.com"},
+		Registry:          entity.Registry{Type: "harbor", Url: "dockerhub.kubekey.local", User: "admin", Password: "Harbor12345", SkipTLS: true, NodeName: "worker1"},
+		KubePodsCIDR:      "10.233.64.0/18",
+		KubeServiceCIDR:   "10.233.0.0/18",
+		ContainerManager:  "containerd",
+		ProxyMode:         "ipvs",
+		IPIPMode:          "Always",
+		VxlanMode:         "Never",
+		KubernetesVersion: "v1.26.5",
+		ExtraSANs:         []string{"lb.cars.local", "192.168.10.100"},
+		Addons: []entity.Addon{
+			{Name: "nfs-client", Namespace: "kube-system", Chart: &entity.AddonChart{Name: "nfs-client-provisioner", Repo: "https://charts.kubesphere.io/main", Values: []string{"storageClass.defaultClass=true"}}},
+		},
+	}
+}
+
+func TestRenderConfigGolden(t *testing.T) {
+	rendered, err := NewKubekeyClient(kubekeyTestConf(), OSClient{}).RenderConfig()
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	golden, err := os.ReadFile(filepath.Join("testdata", "config-sample.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read the golden config: %v", err)
+	}
+	if string(rendered) != string(golden) {
+		t.Errorf("Expected the rendered config to match testdata/config-sample.yaml, got:\n%s", rendered)
+	}
+}
+
+func TestBuildClusterNetworkPlugins(t *testing.T) {
+	for plugin, expected := range map[string]string{"": "calico", "calico": "calico", "cilium": "cilium", "flannel": "flannel", "kube-ovn": "kubeovn"} {
+		conf := kubekeyTestConf()
+		conf.NetworkPlugin = plugin
+		cluster, err := NewKubekeyClient(conf, OSClient{}).BuildCluster()
+		if err != nil {
+			t.Fatalf("Failed to build with plugin %q: %v", plugin, err)
+		}
+		network := cluster.Spec.Network
+		if network.Plugin != expected {
+			t.Errorf("Expected plugin %q to be written as %q, got %q", plugin, expected, network.Plugin)
+		}
+		if (network.Calico != nil) != (expected == "calico") || (network.Flannel != nil) != (expected == "flannel") || (network.KubeOvn != nil) != (expected == "kubeovn") {
+			t.Errorf("Expected only the settings of %s, got %+v", expected, network)
+		}
+	}
+}
+
+func TestBuildClusterRejectsInvalidConf(t *testing.T) {
+	tests := map[string]func(conf *entity.KubekeyConf){
+		"unsupported network plugin": func(conf *entity.KubekeyConf) { conf.NetworkPlugin = "weave" },
+		"password or private key":    func(conf *entity.KubekeyConf) { conf.Hosts[0].Password = "" },
+		"neither a chart nor yaml":   func(conf *entity.KubekeyConf) { conf.Addons[0].Chart = nil },
+	}
+	for expected, change := range tests {
+		conf := kubekeyTestConf()
+		change(&conf)
+		if _, err := NewKubekeyClient(conf, OSClient{}).BuildCluster(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error about %s, got %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/kubectl/pkg/drain"
+	"time"
+)
+
+// CordonAndDrain marks a node unschedulable and evicts its pods. Evictions go through the
+// eviction API, so PodDisruptionBudgets are respected; DaemonSet pods are left in place.
+func (client *K8sClient) CordonAndDrain(ctx context.Context, nodeName string, timeout time.Duration, out, errOut io.Writer) error {
+	node, err := client.Clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	helper := &drain.Helper{
+		Ctx:                 ctx,
+		Client:              client.Clientset,
+		Force:               true,
+		GracePeriodSeconds:  -1,
+		IgnoreAllDaemonSets: true,
+		DeleteEmptyDirData:  true,
+		Timeout:             timeout,
+		Out:                 out,
+		ErrOut:              errOut,
+	}
+	if err := drain.RunCordonOrUncordon(helper, node, true); err != nil {
+		return fmt.Errorf("failed to cordon node %s: %w", nodeName, err)
+	}
+	if err := drain.RunNodeDrain(helper, nodeName); err != nil {
+		return fmt.Errorf("failed to drain node %s: %w", nodeName, err)
+	}
+	return nil
+}
+
+// WaitNodeDeleted waits until the Node object is gone from the API server.
+func (client *K8sClient) WaitNodeDeleted(ctx context.Context, nodeName string, timeout time.Duration) error {
+	return wait.PollUntilContextTimeout(ctx, 5*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		_, err := client.Clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+// RewriteKubeconfigServer points every cluster of a kubeconfig to server, e.g. when the
+// original endpoint is a domain only resolvable inside the cluster.
+func RewriteKubeconfigServer(kubeconfig []byte, server string) ([]byte, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, cluster := range config.Clusters {
+		cluster.Server = server
+	}
+	return clientcmd.Write(*config)
+}
@@ -0,0 +1,129 @@
+package kubernetes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const deprecatedAPIMetric = "apiserver_requested_deprecated_apis"
+
+var metricLabel = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// ServerVersion returns the version of the API server, e.g. v1.24.9.
+func (client *K8sClient) ServerVersion() (string, error) {
+	info, err := client.DiscoveryClient.ServerVersion()
+	if err != nil {
+		return "", err
+	}
+	return info.GitVersion, nil
+}
+
+// DeprecatedAPIsInUse returns the deprecated APIs requested since the API server started which are
+// removed in target or earlier, as reported by the apiserver_requested_deprecated_apis metric.
+func (client *K8sClient) DeprecatedAPIsInUse(ctx context.Context, target string) ([]entity.DeprecatedAPI, error) {
+	targetVersion, err := version.ParseGeneric(target)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := client.Clientset.CoreV1().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API server metrics: %w", err)
+	}
+	var apis []entity.DeprecatedAPI
+	scanner := bufio.NewScanner(bytes.NewReader(metrics))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, deprecatedAPIMetric+"{") {
+			continue
+		}
+		labels := make(map[string]string)
+		for _, match := range metricLabel.FindAllStringSubmatch(line, -1) {
+			labels[match[1]] = match[2]
+		}
+		if labels["removed_release"] == "" {
+			continue
+		}
+		removed, err := version.ParseGeneric(labels["removed_release"])
+		if err != nil || removed.Major() != targetVersion.Major() || removed.Minor() > targetVersion.Minor() {
+			continue
+		}
+		apis = append(apis, entity.DeprecatedAPI{
+			Group:          labels["group"],
+			Version:        labels["version"],
+			Resource:       labels["resource"],
+			Subresource:    labels["subresource"],
+			RemovedRelease: labels["removed_release"],
+		})
+	}
+	return apis, scanner.Err()
+}
+
+// ClusterHealth reports nodes which are not ready or whose kubelet is not at kubeletVersion,
+// and pods of kube-system which are neither completed nor running with all containers ready.
+func (client *K8sClient) ClusterHealth(ctx context.Context, kubeletVersion string) (*entity.ClusterHealth, error) {
+	health := &entity.ClusterHealth{}
+	nodes, err := client.Clientset.CoreV1().Nodes().List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for _, node := range nodes.Items {
+		ready := false
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady {
+				ready = condition.Status == corev1.ConditionTrue
+			}
+		}
+		if !ready {
+			health.UnreadyNodes = append(health.UnreadyNodes, node.Name)
+		}
+		if kubeletVersion != "" && node.Status.NodeInfo.KubeletVersion != kubeletVersion {
+			health.OutdatedNodes = append(health.OutdatedNodes, fmt.Sprintf("%s (%s)", node.Name, node.Status.NodeInfo.KubeletVersion))
+		}
+	}
+	pods, err := client.Clientset.CoreV1().Pods("kube-system").List(ctx, v1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of kube-system: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		ready := pod.Status.Phase == corev1.PodRunning
+		for _, status := range pod.Status.ContainerStatuses {
+			ready = ready && status.Ready
+		}
+		if !ready {
+			health.UnhealthyPods = append(health.UnhealthyPods, fmt.Sprintf("%s (%s)", pod.Name, pod.Status.Phase))
+		}
+	}
+	return health, nil
+}
+
+// WaitClusterHealthy polls ClusterHealth until the cluster is healthy at kubeletVersion or timeout expires.
+// The last health seen is returned in both cases.
+func (client *K8sClient) WaitClusterHealthy(ctx context.Context, kubeletVersion string, timeout time.Duration) (*entity.ClusterHealth, error) {
+	var health *entity.ClusterHealth
+	err := wait.PollUntilContextTimeout(ctx, DefaultPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		current, err := client.ClusterHealth(ctx, kubeletVersion)
+		if err != nil {
+			return false, nil
+		}
+		health = current
+		return health.Healthy(), nil
+	})
+	if health == nil {
+		health = &entity.ClusterHealth{}
+	}
+	return health, err
+}
@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// offlineTemplate is the offline.yml of the conf dir the group vars are based on by default.
+const offlineTemplate = "offline.yml"
+
+// KubesprayClient provisions a cluster by running the kubespray playbooks on the bastion.
+type KubesprayClient struct {
+	KubekeyConf entity.KubekeyConf
+	OSClient    OSClient
+}
+
+func NewKubesprayClient(kubekeyConf entity.KubekeyConf, osClient OSClient) *KubesprayClient {
+	return &KubesprayClient{
+		KubekeyConf: kubekeyConf,
+		OSClient:    osClient,
+	}
+}
+
+type inventoryHost struct {
+	AnsibleHost     string `yaml:"ansible_host"`
+	AnsiblePort     int32  `yaml:"ansible_port,omitempty"`
+	AnsibleUser     string `yaml:"ansible_user,omitempty"`
+	AnsibleSSHPass  string `yaml:"ansible_ssh_pass,omitempty"`
+	AnsibleSSHKey   string `yaml:"ansible_ssh_private_key_file,omitempty"`
+	AnsibleBecomePw string `yaml:"ansible_become_password,omitempty"`
+	IP              string `yaml:"ip,omitempty"`
+	AccessIP        string `yaml:"access_ip,omitempty"`
+}
+
+type inventoryGroup struct {
+	Hosts    map[string]struct{}       `yaml:"hosts,omitempty"`
+	Children map[string]inventoryGroup `yaml:"children,omitempty"`
+}
+
+type inventory struct {
+	All struct {
+		Hosts    map[string]inventoryHost  `yaml:"hosts"`
+		Children map[string]inventoryGroup `yaml:"children"`
+	} `yaml:"all"`
+}
+
+// InventoryDir is the kubespray inventory of the cluster on the bastion.
+func (client *KubesprayClient) InventoryDir() string {
+	return path.Join(client.KubekeyConf.Kubespray.Path, "inventory", client.KubekeyConf.ClusterName)
+}
+
+// RenderInventory returns the hosts.yaml of the cluster using the kubespray group names.
+func (client *KubesprayClient) RenderInventory() ([]byte, error) {
+	conf := client.KubekeyConf
+	inv := inventory{}
+	inv.All.Hosts = make(map[string]inventoryHost)
+	for _, host := range conf.Hosts {
+		item := inventoryHost{
+			AnsibleHost: host.Address,
+			AnsiblePort: host.Port,
+			AnsibleUser: host.User,
+			IP:          host.InternalAddress,
+			AccessIP:    host.InternalAddress,
+		}
+		if len(host.Password) > 0 {
+			item.AnsibleSSHPass = host.Password
+			if host.User != "root" {
+				item.AnsibleBecomePw = host.Password
+			}
+		} else if len(host.PrivateKey) > 0 {
+			item.AnsibleSSHKey = host.PrivateKey
+		} else {
+			return nil, fmt.Errorf("password or private key of host %s cannot be empty", host.Name)
+		}
+		inv.All.Hosts[host.Name] = item
+	}
+	group := func(members []string) inventoryGroup {
+		hosts := make(map[string]struct{})
+		for _, member := range members {
+			hosts[member] = struct{}{}
+		}
+		return inventoryGroup{Hosts: hosts}
+	}
+	inv.All.Children = map[string]inventoryGroup{
+		"kube_control_plane": group(conf.ContronPlanes),
+		"kube_node":          group(conf.Workers),
+		"etcd":               group(conf.Etcds),
+		"k8s_cluster": {
+			Children: map[string]inventoryGroup{
+				"kube_control_plane": {},
+				"kube_node":          {},
+			},
+		},
+		"calico_rr": {},
+	}
+	return yaml.Marshal(inv)
+}
+
+// RenderClusterVars returns the k8s_cluster group vars derived from the cluster spec.
+func (client *KubesprayClient) RenderClusterVars() ([]byte, error) {
+	conf := client.KubekeyConf
+	plugin := defaultString(conf.NetworkPlugin, entity.DefaultNetworkPlugin)
+	if !entity.IsSupportedNetworkPlugin(plugin) {
+		return nil, fmt.Errorf("unsupported network plugin %s", plugin)
+	}
+	domain := defaultString(conf.ControlPlaneDomain, entity.DefaultControlPlaneDomain)
+	vars := yaml.MapSlice{
+		{Key: "cluster_name", Value: "cluster.local"},
+		{Key: "kube_version", Value: conf.KubernetesVersion},
+		{Key: "kube_network_plugin", Value: plugin},
+		{Key: "kube_network_plugin_multus", Value: conf.EnableMultus},
+		{Key: "kube_pods_subnet", Value: conf.KubePodsCIDR},
+		{Key: "kube_service_addresses", Value: conf.KubeServiceCIDR},
+		{Key: "apiserver_loadbalancer_domain_name", Value: domain},
+		{Key: "supplementary_addresses_in_ssl_keys", Value: append([]string{domain}, conf.ExtraSANs...)},
+		{Key: "auto_renew_certificates", Value: true},
+	}
+	if conf.ContainerManager != "" {
+		vars = append(vars, yaml.MapItem{Key: "container_manager", Value: conf.ContainerManager})
+	}
+	if conf.ProxyMode != "" {
+		vars = append(vars, yaml.MapItem{Key: "kube_proxy_mode", Value: conf.ProxyMode})
+	}
+	if conf.VIPServer != "" {
+		vars = append(vars, yaml.MapItem{Key: "loadbalancer_apiserver", Value: yaml.MapSlice{
+			{Key: "address", Value: conf.VIPServer},
+			{Key: "port", Value: 6443},
+		}})
+	}
+	if len(conf.NtpServers) > 0 {
+		vars = append(vars,
+			yaml.MapItem{Key: "ntp_enabled", Value: true},
+			yaml.MapItem{Key: "ntp_servers", Value: conf.NtpServers},
+		)
+	}
+	if conf.Timezone != "" {
+		vars = append(vars, yaml.MapItem{Key: "ntp_timezone", Value: conf.Timezone})
+	}
+	if len(conf.RegistryMirrors) > 0 {
+		vars = append(vars, yaml.MapItem{Key: "containerd_registries_mirrors", Value: registryMirrors(conf.RegistryMirrors)})
+	}
+	return yaml.Marshal(vars)
+}
+
+func registryMirrors(mirrors []string) []yaml.MapSlice {
+	var items []yaml.MapSlice
+	for _, mirror := range mirrors {
+		items = append(items, yaml.MapSlice{
+			{Key: "prefix", Value: "docker.io"},
+			{Key: "mirrors", Value: []yaml.MapSlice{{
+				{Key: "host", Value: mirror},
+				{Key: "capabilities", Value: []string{"pull", "resolve"}},
+				{Key: "skip_verify", Value: true},
+			}}},
+		})
+	}
+	return items
+}
+
+var offlineSettings = []string{"registry_host", "files_repo", "yum_repo", "debian_repo", "ubuntu_repo"}
+
+// RenderOfflineVars fills the repositories of the offline.yml template with the ones of the cluster.
+func (client *KubesprayClient) RenderOfflineVars() ([]byte, error) {
+	conf := client.KubekeyConf
+	template := defaultString(conf.Kubespray.OfflineTemplate, path.Join(ConfDir(), offlineTemplate))
+	content, err := os.ReadFile(template)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to read offline template %s: %s", template, err.Error())
+		return nil, err
+	}
+	values := map[string]string{
+		"registry_host": conf.Registry.Url,
+		"files_repo":    conf.Kubespray.FilesRepo,
+		"yum_repo":      conf.Kubespray.YumRepo,
+		"debian_repo":   conf.Kubespray.DebianRepo,
+		"ubuntu_repo":   conf.Kubespray.UbuntuRepo,
+	}
+	rendered := string(content)
+	for _, key := range offlineSettings {
+		if values[key] == "" {
+			continue
+		}
+		pattern := regexp.MustCompile(`(?m)^` + key + `:.*$`)
+		rendered = pattern.ReplaceAllLiteralString(rendered, fmt.Sprintf("%s: %q", key, values[key]))
+	}
+	return []byte(rendered), nil
+}
+
+// GenerateConfig writes the inventory and group vars of the cluster into the kubespray checkout.
+func (client *KubesprayClient) GenerateConfig() error {
+	if client.KubekeyConf.Kubespray.Path == "" {
+		return fmt.Errorf("kubespray path of cluster %s cannot be empty", client.KubekeyConf.ClusterName)
+	}
+	files := []struct {
+		path   string
+		render func() ([]byte, error)
+	}{
+		{"hosts.yaml", client.RenderInventory},
+		{"group_vars/k8s_cluster/k8s-cluster.yml", client.RenderClusterVars},
+		{"group_vars/all/offline.yml", client.RenderOfflineVars},
+	}
+	for _, file := range files {
+		content, err := file.render()
+		if err != nil {
+			return err
+		}
+		err = writeRemoteFile(&client.OSClient, path.Join(client.InventoryDir(), file.path), content)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to generate kubespray %s: %s", file.path, err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// playbookCommand runs a playbook against the cluster inventory, in the kubespray image when one is configured.
+func (client *KubesprayClient) playbookCommand(playbook string, extraVars ...string) string {
+	conf := client.KubekeyConf.Kubespray
+	inventoryPath := path.Join("inventory", client.KubekeyConf.ClusterName, "hosts.yaml")
+	args := []string{"ansible-playbook", "-i", inventoryPath, "--become", "--become-user=root"}
+	for _, extraVar := range extraVars {
+		args = append(args, "-e", extraVar)
+	}
+	args = append(args, playbook)
+	if conf.Image != "" {
+		return fmt.Sprintf("docker run --rm --network host -v %s:/kubespray -w /kubespray %s %s", conf.Path, conf.Image, strings.Join(args, " "))
+	}
+	return fmt.Sprintf("cd %s && %s", conf.Path, strings.Join(args, " "))
+}
+
+func (client *KubesprayClient) runPlaybook(ctx context.Context, action, playbook string, logChan chan LogEntry, extraVars ...string) error {
+	command := client.playbookCommand(playbook, extraVars...)
+	err := client.OSClient.SSExecutor.ExecuteCommandContext(ctx, command, logChan)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to %s %s: %s", action, client.KubekeyConf.ClusterName, err.Error())
+		return err
+	}
+	return nil
+}
+
+func (client *KubesprayClient) CreateCluster(ctx context.Context, logChan chan LogEntry) error {
+	return client.runPlaybook(ctx, "create cluster", "cluster.yml", logChan)
+}
+
+func (client *KubesprayClient) DeleteCluster(ctx context.Context, logChan chan LogEntry) error {
+	return client.runPlaybook(ctx, "delete cluster", "reset.yml", logChan, "reset_confirmation=yes")
+}
+
+func (client *KubesprayClient) AddNode(ctx context.Context, logChan chan LogEntry) error {
+	return client.runPlaybook(ctx, "add node to cluster", "scale.yml", logChan)
+}
+
+func (client *KubesprayClient) DeleteNode(ctx context.Context, nodeName string, logChan chan LogEntry) error {
+	return client.runPlaybook(ctx, "delete node "+nodeName+" from cluster", "remove-node.yml", logChan, "node="+nodeName, "skip_confirmation=yes")
+}
+
+func (client *KubesprayClient) UpgradeCluster(ctx context.Context, logChan chan LogEntry) error {
+	return client.runPlaybook(ctx, "upgrade", "upgrade-cluster.yml", logChan)
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
@@ -24,7 +25,11 @@ func NewLocalExecutor() *LocalExecutor {
 // ExecuteCommand executes a command on the local system.
 
 func (executor *LocalExecutor) ExecuteShortCommand(command string) (string, error) {
-	cmd := exec.Command("sh", "-c", command)
+	return executor.ExecuteShortCommandContext(context.Background(), command)
+}
+
+func (executor *LocalExecutor) ExecuteShortCommandContext(ctx context.Context, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
 	res, err := cmd.CombinedOutput()
 	if err != nil {
 		log.Printf("Failed to create stderr pipe: %s", err.Error())
@@ -34,7 +39,11 @@ func (executor *LocalExecutor) ExecuteShortCommand(command string) (string, erro
 }
 
 func (executor *LocalExecutor) ExecuteCommand(command string, logChan chan LogEntry) error {
-	cmd := exec.Command("sh", "-c", command)
+	return executor.ExecuteCommandContext(context.Background(), command, logChan)
+}
+
+func (executor *LocalExecutor) ExecuteCommandContext(ctx context.Context, command string, logChan chan LogEntry) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
 	return executor.executeCommand(cmd, logChan)
 }
 
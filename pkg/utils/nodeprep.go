@@ -0,0 +1,593 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	modulesLoadFile = "/etc/modules-load.d/kubernetes.conf"
+	sysctlFile      = "/etc/sysctl.d/99-kubernetes.conf"
+)
+
+// nodeModules are the kernel modules container runtimes and kube-proxy need.
+var nodeModules = []string{"overlay", "br_netfilter"}
+
+// nodeSysctl are the kernel settings Kubernetes needs, see NodePrepConf.Sysctl.
+var nodeSysctl = map[string]string{
+	"net.bridge.bridge-nf-call-iptables":  "1",
+	"net.bridge.bridge-nf-call-ip6tables": "1",
+	"net.ipv4.ip_forward":                 "1",
+}
+
+// nodeDistributions are the distributions NodePrep supports by os-release ID, with the firewall they
+// ship with and whether they have SELinux.
+var nodeDistributions = map[string]struct {
+	firewall string
+	selinux  bool
+}{
+	"centos":    {firewall: "firewalld", selinux: true},
+	"rhel":      {firewall: "firewalld", selinux: true},
+	"rocky":     {firewall: "firewalld", selinux: true},
+	"kylin":     {firewall: "firewalld", selinux: true},
+	"uos":       {firewall: "firewalld", selinux: true},
+	"openeuler": {firewall: "firewalld", selinux: true},
+	"ubuntu":    {firewall: "ufw"},
+	"debian":    {firewall: "ufw"},
+}
+
+var (
+	firewallPortPattern = regexp.MustCompile(`^[0-9]+(-[0-9]+)?/(tcp|udp)$`)
+	sysctlKeyPattern    = regexp.MustCompile(`^[a-zA-Z0-9_.\-/]+$`)
+	hostnamePattern     = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.\-]*[a-zA-Z0-9])?$`)
+)
+
+// skip is returned by the check of a step that does not apply to a node.
+type skip string
+
+func (reason skip) Error() string {
+	return string(reason)
+}
+
+// nodePrepStep is a step of NodePrep. check describes how the node differs from the wanted state, or
+// returns nothing if it does not, and apply brings the node to that state.
+type nodePrepStep struct {
+	name  string
+	check func(ctx context.Context) (string, error)
+	apply func(ctx context.Context) error
+}
+
+// NodePrep brings a node to the state Kubernetes expects. Every step checks the node first and only
+// changes what differs, so running it again changes nothing.
+type NodePrep struct {
+	Conf     entity.NodePrepConf
+	OSClient OSClient
+}
+
+func NewNodePrep(conf entity.NodePrepConf, osClient OSClient) *NodePrep {
+	if conf.SELinux == "" {
+		conf.SELinux = entity.SELinuxPermissive
+	}
+	if conf.Firewall == "" {
+		conf.Firewall = entity.FirewallDisabled
+	}
+	return &NodePrep{
+		Conf:     conf,
+		OSClient: osClient,
+	}
+}
+
+// ValidateNodePrepConf rejects settings that cannot be applied.
+func ValidateNodePrepConf(conf entity.NodePrepConf) error {
+	switch conf.SELinux {
+	case "", entity.SELinuxEnforcing, entity.SELinuxPermissive, entity.SELinuxDisabled:
+	default:
+		return fmt.Errorf("unknown SELinux mode %s", conf.SELinux)
+	}
+	switch conf.Firewall {
+	case "", entity.FirewallDisabled, entity.FirewallOpen:
+	default:
+		return fmt.Errorf("unknown firewall mode %s", conf.Firewall)
+	}
+	for _, port := range conf.OpenPorts {
+		if !firewallPortPattern.MatchString(port) {
+			return fmt.Errorf("invalid port %s, expected e.g. 6443/tcp or 30000-32767/tcp", port)
+		}
+	}
+	for key, value := range conf.Sysctl {
+		if !sysctlKeyPattern.MatchString(key) || strings.ContainsAny(value, "\n\r") {
+			return fmt.Errorf("invalid sysctl setting %s = %s", key, value)
+		}
+	}
+	if conf.Hostname != "" && !hostnamePattern.MatchString(conf.Hostname) {
+		return fmt.Errorf("invalid hostname %s", conf.Hostname)
+	}
+	if strings.ContainsAny(conf.Timezone, " \n\r") {
+		return fmt.Errorf("invalid timezone %s", conf.Timezone)
+	}
+	return nil
+}
+
+// Run prepares the node. With check nothing is changed and steps that would change the node report drift.
+func (prep *NodePrep) Run(ctx context.Context, check bool) *entity.NodePrepReport {
+	report := &entity.NodePrepReport{Host: prep.OSClient.SSExecutor.Host.Name, Check: check}
+	if err := ValidateNodePrepConf(prep.Conf); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	release, err := prep.OSClient.SSExecutor.OutputContext(ctx, "cat /etc/os-release")
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to read /etc/os-release: %s", err.Error())
+		return report
+	}
+	id, version := parseOSIdentity(release)
+	report.Distribution = strings.TrimSpace(id + " " + version)
+	distribution, ok := nodeDistributions[id]
+	if !ok {
+		report.Error = fmt.Sprintf("%s is not a supported distribution", report.Distribution)
+		return report
+	}
+
+	steps := []nodePrepStep{prep.swapStep(), prep.modulesStep(), prep.sysctlStep()}
+	if distribution.selinux {
+		steps = append(steps, prep.selinuxStep())
+	}
+	steps = append(steps, prep.firewallStep(distribution.firewall), prep.hostnameStep(), prep.timezoneStep())
+	var failed []string
+	for _, step := range steps {
+		result := runNodePrepStep(ctx, step, check)
+		report.Steps = append(report.Steps, result)
+		switch result.Status {
+		case entity.NodePrepChanged:
+			report.Changed = true
+		case entity.NodePrepDrift:
+			report.Drift = true
+		case entity.NodePrepFailed:
+			failed = append(failed, step.name)
+		}
+		if ctx.Err() != nil {
+			report.Error = ctx.Err().Error()
+			return report
+		}
+	}
+	if len(failed) > 0 {
+		report.Error = fmt.Sprintf("failed steps: %s", strings.Join(failed, ", "))
+		logger.GetLogger().Errorf("Failed to prepare node %s: %s", report.Host, report.Error)
+		return report
+	}
+	logger.GetLogger().Infof("Prepared node %s, changed: %t, drift: %t", report.Host, report.Changed, report.Drift)
+	return report
+}
+
+// runNodePrepStep checks a step and applies it unless check is set. The step is checked again after it
+// was applied, so that a change that did not stick is reported as failed.
+func runNodePrepStep(ctx context.Context, step nodePrepStep, check bool) entity.NodePrepStep {
+	result := entity.NodePrepStep{Name: step.name}
+	drift, err := step.check(ctx)
+	var reason skip
+	switch {
+	case errors.As(err, &reason):
+		result.Status, result.Message = entity.NodePrepSkipped, reason.Error()
+		return result
+	case err != nil:
+		result.Status, result.Message = entity.NodePrepFailed, err.Error()
+		return result
+	case drift == "":
+		result.Status = entity.NodePrepOK
+		return result
+	case check:
+		result.Status, result.Message = entity.NodePrepDrift, drift
+		return result
+	}
+	if err := step.apply(ctx); err != nil {
+		result.Status, result.Message = entity.NodePrepFailed, fmt.Sprintf("%s: %s", drift, err.Error())
+		return result
+	}
+	if remaining, err := step.check(ctx); err != nil || remaining != "" {
+		result.Status, result.Message = entity.NodePrepFailed, fmt.Sprintf("still differs after the change: %s", remaining)
+		if err != nil {
+			result.Message = fmt.Sprintf("check after the change failed: %s", err.Error())
+		}
+		return result
+	}
+	result.Status, result.Message = entity.NodePrepChanged, drift
+	return result
+}
+
+func (prep *NodePrep) root() *SSHExecutor {
+	return prep.OSClient.SSExecutor.AsRoot()
+}
+
+// writeFile replaces a file with content unless it has that content already.
+func (prep *NodePrep) writeFile(ctx context.Context, path, content string) error {
+	differs, err := prep.fileDiffers(ctx, path, content)
+	if err != nil || !differs {
+		return err
+	}
+	return prep.OSClient.SSExecutor.PutFile(ctx, strings.NewReader(content), RemoteFile{Path: path, Mode: 0644})
+}
+
+// fileDiffers reports whether a file is missing or has other content.
+func (prep *NodePrep) fileDiffers(ctx context.Context, path, content string) (bool, error) {
+	current, err := prep.root().OutputContext(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", shellQuote(path)))
+	return current != content, err
+}
+
+func (prep *NodePrep) swapStep() nodePrepStep {
+	return nodePrepStep{
+		name: "swap",
+		check: func(ctx context.Context) (string, error) {
+			swaps, err := prep.root().OutputContext(ctx, "tail -n +2 /proc/swaps")
+			if err != nil {
+				return "", err
+			}
+			fstab, err := prep.root().OutputContext(ctx, `awk '!/^[[:space:]]*#/ && $3 == "swap" {print $1}' /etc/fstab`)
+			if err != nil {
+				return "", err
+			}
+			var drift []string
+			for _, line := range strings.Split(strings.TrimSpace(swaps), "\n") {
+				if fields := strings.Fields(line); len(fields) > 0 {
+					drift = append(drift, fmt.Sprintf("swap on %s", fields[0]))
+				}
+			}
+			for _, device := range strings.Fields(fstab) {
+				drift = append(drift, fmt.Sprintf("fstab mounts swap %s", device))
+			}
+			return strings.Join(drift, ", "), nil
+		},
+		apply: func(ctx context.Context) error {
+			_, err := prep.root().OutputContext(ctx, `swapoff -a && sed -ri 's/^([^#[:space:]]\S*\s+\S+\s+swap(\s|$))/#\1/' /etc/fstab`)
+			return err
+		},
+	}
+}
+
+func (prep *NodePrep) modulesStep() nodePrepStep {
+	content := strings.Join(nodeModules, "\n") + "\n"
+	return nodePrepStep{
+		name: "modules",
+		check: func(ctx context.Context) (string, error) {
+			var command []string
+			for _, module := range nodeModules {
+				command = append(command, fmt.Sprintf("test -d /sys/module/%s || echo %s", module, module))
+			}
+			missing, err := prep.root().OutputContext(ctx, strings.Join(command, "; "))
+			if err != nil {
+				return "", err
+			}
+			var drift []string
+			if modules := strings.Fields(missing); len(modules) > 0 {
+				drift = append(drift, fmt.Sprintf("%s not loaded", strings.Join(modules, ", ")))
+			}
+			differs, err := prep.fileDiffers(ctx, modulesLoadFile, content)
+			if err != nil {
+				return "", err
+			}
+			if differs {
+				drift = append(drift, fmt.Sprintf("%s not up to date", modulesLoadFile))
+			}
+			return strings.Join(drift, ", "), nil
+		},
+		apply: func(ctx context.Context) error {
+			if err := prep.writeFile(ctx, modulesLoadFile, content); err != nil {
+				return err
+			}
+			for _, module := range nodeModules {
+				if _, err := prep.root().OutputContext(ctx, "modprobe "+module); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// sysctl returns the wanted kernel settings by name, in the order they are written.
+func (prep *NodePrep) sysctl() ([]string, map[string]string) {
+	settings := make(map[string]string)
+	for key, value := range nodeSysctl {
+		settings[key] = value
+	}
+	for key, value := range prep.Conf.Sysctl {
+		settings[key] = strings.Join(strings.Fields(value), " ")
+	}
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, settings
+}
+
+func (prep *NodePrep) sysctlStep() nodePrepStep {
+	keys, settings := prep.sysctl()
+	var content strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&content, "%s = %s\n", key, settings[key])
+	}
+	return nodePrepStep{
+		name: "sysctl",
+		check: func(ctx context.Context) (string, error) {
+			var command []string
+			for _, key := range keys {
+				command = append(command, fmt.Sprintf(`printf '%%s=%%s\n' %[1]s "$(sysctl -n %[1]s 2>/dev/null)"`, shellQuote(key)))
+			}
+			output, err := prep.root().OutputContext(ctx, strings.Join(command, "; "))
+			if err != nil {
+				return "", err
+			}
+			var drift []string
+			for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+				key, value, _ := strings.Cut(line, "=")
+				value = strings.Join(strings.Fields(value), " ")
+				if wanted, ok := settings[key]; ok && value != wanted {
+					drift = append(drift, fmt.Sprintf("%s is %q, not %q", key, value, wanted))
+				}
+			}
+			differs, err := prep.fileDiffers(ctx, sysctlFile, content.String())
+			if err != nil {
+				return "", err
+			}
+			if differs {
+				drift = append(drift, fmt.Sprintf("%s not up to date", sysctlFile))
+			}
+			return strings.Join(drift, ", "), nil
+		},
+		apply: func(ctx context.Context) error {
+			if err := prep.writeFile(ctx, sysctlFile, content.String()); err != nil {
+				return err
+			}
+			_, err := prep.root().OutputContext(ctx, "sysctl -p "+sysctlFile)
+			return err
+		},
+	}
+}
+
+func (prep *NodePrep) selinuxStep() nodePrepStep {
+	wanted := prep.Conf.SELinux
+	// state returns the current and the configured mode.
+	state := func(ctx context.Context) (string, string, error) {
+		result, err := prep.root().RunContext(ctx, "command -v getenforce >/dev/null")
+		if err != nil {
+			return "", "", err
+		}
+		if result.ExitCode != 0 {
+			return "", "", skip("SELinux is not installed")
+		}
+		current, err := prep.root().OutputContext(ctx, "getenforce")
+		if err != nil {
+			return "", "", err
+		}
+		configured, err := prep.root().OutputContext(ctx, `awk -F= '/^SELINUX=/ {print $2}' /etc/selinux/config`)
+		if err != nil {
+			return "", "", err
+		}
+		return strings.ToLower(strings.TrimSpace(current)), strings.ToLower(strings.TrimSpace(configured)), nil
+	}
+	// A disabled SELinux can only be enabled, and an enabled one only disabled, by a reboot. The running
+	// mode is left alone then.
+	runtimeDiffers := func(current string) bool {
+		if current == entity.SELinuxDisabled || wanted == entity.SELinuxDisabled {
+			return false
+		}
+		return current != wanted
+	}
+	return nodePrepStep{
+		name: "selinux",
+		check: func(ctx context.Context) (string, error) {
+			current, configured, err := state(ctx)
+			if err != nil {
+				return "", err
+			}
+			var drift []string
+			if runtimeDiffers(current) || (wanted == entity.SELinuxDisabled && current == entity.SELinuxEnforcing) {
+				drift = append(drift, fmt.Sprintf("SELinux is %s", current))
+			}
+			if configured != wanted {
+				drift = append(drift, fmt.Sprintf("SELinux is configured %s, %s takes effect after a reboot", configured, wanted))
+			}
+			return strings.Join(drift, ", "), nil
+		},
+		apply: func(ctx context.Context) error {
+			current, configured, err := state(ctx)
+			if err != nil {
+				return err
+			}
+			if current == entity.SELinuxEnforcing && wanted != entity.SELinuxEnforcing {
+				if _, err := prep.root().OutputContext(ctx, "setenforce 0"); err != nil {
+					return err
+				}
+			} else if runtimeDiffers(current) {
+				if _, err := prep.root().OutputContext(ctx, "setenforce 1"); err != nil {
+					return err
+				}
+			}
+			if configured != wanted {
+				_, err = prep.root().OutputContext(ctx, fmt.Sprintf("sed -ri 's/^SELINUX=.*/SELINUX=%s/' /etc/selinux/config", wanted))
+			}
+			return err
+		},
+	}
+}
+
+func (prep *NodePrep) firewallStep(service string) nodePrepStep {
+	wanted := prep.Conf.Firewall
+	// state returns whether the firewall is running and the ports it lets through, nil unless wanted is open.
+	state := func(ctx context.Context) (bool, map[string]bool, error) {
+		command := "command -v firewall-cmd >/dev/null"
+		if service == "ufw" {
+			command = "command -v ufw >/dev/null"
+		}
+		result, err := prep.root().RunContext(ctx, command)
+		if err != nil {
+			return false, nil, err
+		}
+		if result.ExitCode != 0 {
+			return false, nil, skip(fmt.Sprintf("%s is not installed", service))
+		}
+		var active bool
+		if service == "ufw" {
+			status, err := prep.root().OutputContext(ctx, "ufw status")
+			if err != nil {
+				return false, nil, err
+			}
+			active = strings.Contains(status, "Status: active")
+			if !active || wanted != entity.FirewallOpen {
+				return active, nil, nil
+			}
+			open := make(map[string]bool)
+			for _, line := range strings.Split(status, "\n") {
+				if fields := strings.Fields(line); len(fields) > 1 && fields[1] == "ALLOW" {
+					open[strings.Replace(fields[0], ":", "-", 1)] = true
+				}
+			}
+			return true, open, nil
+		}
+		// A firewall that is to be disabled counts as active when it starts at boot.
+		command = "systemctl is-active firewalld"
+		if wanted == entity.FirewallDisabled {
+			command += " || systemctl is-enabled firewalld"
+		}
+		result, err = prep.root().RunContext(ctx, command)
+		if err != nil {
+			return false, nil, err
+		}
+		if result.ExitCode != 0 || wanted != entity.FirewallOpen {
+			return result.ExitCode == 0, nil, nil
+		}
+		ports, err := prep.root().OutputContext(ctx, "firewall-cmd --list-ports && firewall-cmd --permanent --list-ports")
+		if err != nil {
+			return false, nil, err
+		}
+		// Ports count as open when they are in both the running and the permanent configuration.
+		lines := strings.SplitN(ports, "\n", 2)
+		permanent := make(map[string]bool)
+		if len(lines) == 2 {
+			for _, port := range strings.Fields(lines[1]) {
+				permanent[port] = true
+			}
+		}
+		open := make(map[string]bool)
+		for _, port := range strings.Fields(lines[0]) {
+			open[port] = permanent[port]
+		}
+		return true, open, nil
+	}
+	// closed returns the ports to open.
+	closed := func(open map[string]bool) []string {
+		var ports []string
+		for _, port := range prep.Conf.OpenPorts {
+			if !open[port] {
+				ports = append(ports, port)
+			}
+		}
+		return ports
+	}
+	return nodePrepStep{
+		name: "firewall",
+		check: func(ctx context.Context) (string, error) {
+			active, open, err := state(ctx)
+			switch {
+			case err != nil:
+				return "", err
+			case wanted == entity.FirewallDisabled && active:
+				return fmt.Sprintf("%s is enabled", service), nil
+			case wanted == entity.FirewallOpen && active:
+				if ports := closed(open); len(ports) > 0 {
+					return fmt.Sprintf("%s blocks %s", service, strings.Join(ports, ", ")), nil
+				}
+			}
+			return "", nil
+		},
+		apply: func(ctx context.Context) error {
+			_, open, err := state(ctx)
+			if err != nil {
+				return err
+			}
+			var commands []string
+			switch {
+			case wanted == entity.FirewallDisabled && service == "ufw":
+				commands = []string{"ufw disable"}
+			case wanted == entity.FirewallDisabled:
+				commands = []string{"systemctl disable --now firewalld"}
+			case service == "ufw":
+				for _, port := range closed(open) {
+					commands = append(commands, fmt.Sprintf("ufw allow %s", strings.Replace(port, "-", ":", 1)))
+				}
+			default:
+				for _, port := range closed(open) {
+					commands = append(commands, fmt.Sprintf("firewall-cmd --permanent --add-port=%s", port))
+				}
+				commands = append(commands, "firewall-cmd --reload")
+			}
+			for _, command := range commands {
+				if _, err := prep.root().OutputContext(ctx, command); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func (prep *NodePrep) hostnameStep() nodePrepStep {
+	wanted := prep.Conf.Hostname
+	return nodePrepStep{
+		name: "hostname",
+		check: func(ctx context.Context) (string, error) {
+			if wanted == "" {
+				return "", skip("no hostname wanted")
+			}
+			current, err := prep.root().OutputContext(ctx, "hostname")
+			if err != nil {
+				return "", err
+			}
+			if current = strings.TrimSpace(current); current != wanted {
+				return fmt.Sprintf("hostname is %s, not %s", current, wanted), nil
+			}
+			return "", nil
+		},
+		apply: func(ctx context.Context) error {
+			_, err := prep.root().OutputContext(ctx, "hostnamectl set-hostname "+shellQuote(wanted))
+			return err
+		},
+	}
+}
+
+func (prep *NodePrep) timezoneStep() nodePrepStep {
+	wanted := prep.Conf.Timezone
+	return nodePrepStep{
+		name: "timezone",
+		check: func(ctx context.Context) (string, error) {
+			if wanted == "" {
+				return "", skip("no timezone wanted")
+			}
+			// Time zone: Asia/Shanghai (CST, +0800)
+			status, err := prep.root().OutputContext(ctx, "timedatectl status | grep 'Time zone'")
+			if err != nil {
+				return "", err
+			}
+			var current string
+			if _, zone, ok := strings.Cut(status, ":"); ok {
+				if fields := strings.Fields(zone); len(fields) > 0 {
+					current = fields[0]
+				}
+			}
+			if current != wanted {
+				return fmt.Sprintf("timezone is %s, not %s", current, wanted), nil
+			}
+			return "", nil
+		},
+		apply: func(ctx context.Context) error {
+			_, err := prep.root().OutputContext(ctx, "timedatectl set-timezone "+shellQuote(wanted))
+			return err
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils/sshtest"
+	"strings"
+	"testing"
+)
+
+func TestNodePrepCheckReportsDrift(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("root", "secret")
+	server.Respond(`cat /etc/os-release`, sshtest.Response{Stdout: "ID=ubuntu\nVERSION_ID=\"22.04\"\n"})
+	server.Respond(`tail -n \+2 /proc/swaps`, sshtest.Response{Stdout: "/swap.img file 2097148 0 -2\n"})
+	server.Respond(`awk .* /etc/fstab`, sshtest.Response{Stdout: "/swap.img\n"})
+	server.Respond(`test -d /sys/module/.*`, sshtest.Response{Stdout: "br_netfilter\n"})
+	server.Respond(`cat '/etc/.*`, sshtest.Response{})
+	server.Respond(`printf .*`, sshtest.Response{Stdout: "net.bridge.bridge-nf-call-ip6tables=\nnet.bridge.bridge-nf-call-iptables=\nnet.ipv4.ip_forward=1\n"})
+	server.Respond(`command -v ufw.*`, sshtest.Response{})
+	server.Respond(`ufw status`, sshtest.Response{Stdout: "Status: active\n"})
+	server.Respond(`hostname`, sshtest.Response{Stdout: "localhost\n"})
+	server.Respond(`timedatectl status .*`, sshtest.Response{Stdout: "                Time zone: Etc/UTC (UTC, +0000)\n"})
+	client := OSClient{SSExecutor: *connect(t, server.Host("root", "secret"))}
+
+	conf := entity.NodePrepConf{Hostname: "node1", Timezone: "Asia/Shanghai"}
+	report := NewNodePrep(conf, client).Run(context.Background(), true)
+	if report.Error != "" || !report.Drift || report.Changed || report.Distribution != "ubuntu 22.04" {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	statuses := make(map[string]string)
+	for _, step := range report.Steps {
+		statuses[step.Name] = step.Status
+	}
+	for _, name := range []string{"swap", "modules", "sysctl", "firewall", "hostname", "timezone"} {
+		if statuses[name] != entity.NodePrepDrift {
+			t.Errorf("Expected %s to drift, got %+v", name, report.Steps)
+		}
+	}
+	if _, ok := statuses["selinux"]; ok {
+		t.Errorf("Expected no SELinux step on ubuntu")
+	}
+	for _, command := range server.Commands() {
+		for _, change := range []string{"swapoff", "modprobe", "sysctl -p", "ufw disable", "hostnamectl", "set-timezone"} {
+			if strings.Contains(command, change) {
+				t.Errorf("Expected check mode not to change the node, got %q", command)
+			}
+		}
+	}
+	if uploads := server.Uploads(); len(uploads) > 0 {
+		t.Errorf("Expected check mode not to write files, got %v", uploads)
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/logger"
@@ -60,7 +61,7 @@ func NewOSClient(osConf OSConf, sshExecutor SSHExecutor, localExecutor LocalExec
 
 func (client *OSClient) GetOSConf() bool {
 	command := fmt.Sprintf("cat /etc/os-release")
-	output, err := client.SSExecutor.ExecuteShortCommand(command)
+	output, err := client.SSExecutor.Output(command)
 	if err != nil {
 		return false
 	}
@@ -74,7 +75,7 @@ func (client *OSClient) GetOSConf() bool {
 			client.OSConf.Version = strings.TrimPrefix(line, "VERSION_ID=")
 		}
 	}
-	res, err := client.SSExecutor.ExecuteShortCommand("arch")
+	res, err := client.SSExecutor.Output("arch")
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get os arch: %s", err.Error())
 		client.OSConf.Arch = "Unknown"
@@ -87,7 +88,7 @@ func (client *OSClient) GetOSConf() bool {
 
 func (client *OSClient) GetDistribution() (string, error) {
 	command := fmt.Sprintf("cat /etc/os-release")
-	output, err := client.SSExecutor.ExecuteShortCommand(command)
+	output, err := client.SSExecutor.Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get distribution: %s", err.Error())
 		return "", err
@@ -98,10 +99,7 @@ func (client *OSClient) GetDistribution() (string, error) {
 
 func (client *OSClient) DaemonReload() error {
 	command := fmt.Sprintf("systemctl daemon-reload")
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(command)
+	_, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to reload daemon: %s", err.Error())
 		return err
@@ -111,10 +109,7 @@ func (client *OSClient) DaemonReload() error {
 
 func (client *OSClient) RestartService(service string) error {
 	command := fmt.Sprintf("systemctl restart %s", service)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(command)
+	_, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to restart %s: %s", service, err.Error())
 		return err
@@ -124,10 +119,7 @@ func (client *OSClient) RestartService(service string) error {
 
 func (client *OSClient) StartService(service string) error {
 	command := fmt.Sprintf("systemctl start %s", service)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(command)
+	_, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to start %s: %s", service, err.Error())
 		return err
@@ -137,19 +129,13 @@ func (client *OSClient) StartService(service string) error {
 
 func (client *OSClient) QuickStartService(service string) {
 	command := fmt.Sprintf("systemctl start %s", service)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	client.SSExecutor.QuickExecuteShortCommand(command)
+	client.SSExecutor.AsRoot().QuickExecuteShortCommand(command)
 	return
 }
 
 func (client *OSClient) StopService(service string) error {
 	command := fmt.Sprintf("systemctl stop %s", service)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(command)
+	_, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to stop %s: %s", service, err.Error())
 		return err
@@ -159,10 +145,7 @@ func (client *OSClient) StopService(service string) error {
 
 func (client *OSClient) DisableService(service string) error {
 	command := fmt.Sprintf("systemctl disable %s", service)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(command)
+	_, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to disable %s: %s", service, err.Error())
 		return err
@@ -172,10 +155,7 @@ func (client *OSClient) DisableService(service string) error {
 
 func (client *OSClient) EnableService(service string) error {
 	command := fmt.Sprintf("systemctl enable %s", service)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(command)
+	_, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to enable %s: %s", service, err.Error())
 		return err
@@ -185,10 +165,7 @@ func (client *OSClient) EnableService(service string) error {
 
 func (client *OSClient) MaskService(service string) error {
 	command := fmt.Sprintf("systemctl mask %s", service)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(command)
+	_, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to mask %s: %s", service, err.Error())
 		return err
@@ -198,10 +175,7 @@ func (client *OSClient) MaskService(service string) error {
 
 func (client *OSClient) UNMaskService(service string) error {
 	command := fmt.Sprintf("systemctl unmask %s", service)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(command)
+	_, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to unmask %s: %s", service, err.Error())
 		return err
@@ -210,27 +184,18 @@ func (client *OSClient) UNMaskService(service string) error {
 }
 
 func (client *OSClient) StatusService(service string) bool {
-	command := fmt.Sprintf("systemctl status %s | grep -iE active", service)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	res, err := client.SSExecutor.ExecuteShortCommand(command)
+	command := fmt.Sprintf("systemctl is-active %s", service)
+	result, err := client.SSExecutor.AsRoot().Run(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to view %s status: %s", service, err.Error())
 		return false
 	}
-	if strings.Contains(res, "inactive") {
-		return false
-	}
-	return true
+	return result.ExitCode == 0
 }
 
 func (client *OSClient) GetCPUCores() bool {
 	command := "grep -c ^processor /proc/cpuinfo"
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	res, err := client.SSExecutor.ExecuteShortCommand(command)
+	res, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get cpu cores: %s", err.Error())
 		client.OSConf.CPUCores = "Unknown"
@@ -243,10 +208,7 @@ func (client *OSClient) GetCPUCores() bool {
 
 func (client *OSClient) GetCPU() bool {
 	command := "grep -iE \"^model\\s+name\\s+:\" /proc/cpuinfo | awk -F':' '{print $NF}' | sort -u"
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	res, err := client.SSExecutor.ExecuteShortCommand(command)
+	res, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get cpu info: %s", err.Error())
 		client.OSConf.CPU = "Unknown"
@@ -259,10 +221,7 @@ func (client *OSClient) GetCPU() bool {
 
 func (client *OSClient) GetAvailableCPU() string {
 	command := "top -bn1 | grep 'Cpu(s)' | awk '{print $8\"%\"}'"
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	res, err := client.SSExecutor.ExecuteShortCommand(command)
+	res, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get cpu info: %s", err.Error())
 		return ""
@@ -273,10 +232,7 @@ func (client *OSClient) GetAvailableCPU() string {
 
 func (client *OSClient) GetMemorySize() bool {
 	command := "free -m | grep Mem | awk '{print $2}'"
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	res, err := client.SSExecutor.ExecuteShortCommand(command)
+	res, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get memory info: %s", err.Error())
 		client.OSConf.MemorySize = "Unknown"
@@ -289,10 +245,7 @@ func (client *OSClient) GetMemorySize() bool {
 
 func (client *OSClient) GetAvailableMemory() string {
 	command := "free -m | grep Mem | awk '{print $4}'"
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	res, err := client.SSExecutor.ExecuteShortCommand(command)
+	res, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get memory info: %s", err.Error())
 		return ""
@@ -303,10 +256,7 @@ func (client *OSClient) GetAvailableMemory() string {
 
 func (client *OSClient) GetDiskSize() bool {
 	command := "df -h / | tail -n 1 | awk '{print $2}'"
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	res, err := client.SSExecutor.ExecuteShortCommand(command)
+	res, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get disk size: %s", err.Error())
 		client.OSConf.DiskSize = "Unknown"
@@ -319,10 +269,7 @@ func (client *OSClient) GetDiskSize() bool {
 
 func (client *OSClient) GetNetCardList() bool {
 	command := "ip addr show | grep -o '^[0-9]\\+: [a-zA-Z0-9]*' | awk '{print $2}'"
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	res, err := client.SSExecutor.ExecuteShortCommand(command)
+	res, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get netcard list: %s", err.Error())
 		client.OSConf.NetCardList = []string{"Unknown"}
@@ -334,10 +281,7 @@ func (client *OSClient) GetNetCardList() bool {
 
 func (client *OSClient) GetSpecifyNetCard(ipaddr string) string {
 	command := fmt.Sprintf("ip addr | grep -B 2 '%s' | head -n 1 | awk -F':' '{print $2}'", ipaddr)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	res, err := client.SSExecutor.ExecuteShortCommand(command)
+	res, err := client.SSExecutor.AsRoot().Output(command)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get netcard info for %s: %s", ipaddr, err.Error())
 		client.OSConf.SpecifyNetCard = res
@@ -348,33 +292,25 @@ func (client *OSClient) GetSpecifyNetCard(ipaddr string) string {
 
 func (client *OSClient) IsProcessExist(processName string) bool {
 	command := fmt.Sprintf("pgrep %s", processName)
-	if client.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(command)
+	result, err := client.SSExecutor.AsRoot().Run(command)
 	if err != nil {
-		logger.GetLogger().Warnf("The process %s is non-exist: %s", processName, err.Error())
+		logger.GetLogger().Errorf("Failed to look up process %s: %s", processName, err.Error())
+		return false
+	}
+	if result.ExitCode != 0 {
+		logger.GetLogger().Warnf("The process %s is non-exist: %s", processName, strings.TrimSpace(result.Stderr))
 		return false
 	}
 	return true
 }
 
 func (client *OSClient) WhoAmI() string {
-	command := fmt.Sprintf("whoami")
-	user, err := client.SSExecutor.ExecuteShortCommand(command)
-	if err != nil {
-		logger.GetLogger().Warnf("Read username failed: %v", err.Error())
-		return ""
-	}
-	return strings.TrimSpace(user)
+	return client.SSExecutor.WhoAmI()
 }
 
 func (client *OSClient) Chmod(file string, mode string) error {
 	cmd := fmt.Sprintf("chmod %s %s", mode, file)
-	if client.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, client.SSExecutor.Host.Password)
-	}
-	_, err := client.SSExecutor.ExecuteShortCommand(cmd)
+	_, err := client.SSExecutor.AsRoot().Output(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("Chmod %s failed: %v", file, err)
 		return err
@@ -384,7 +320,7 @@ func (client *OSClient) Chmod(file string, mode string) error {
 
 func (client *OSClient) ReadFile(file string) (string, error) {
 	cmd := fmt.Sprintf("cat %s", file)
-	data, err := client.SSExecutor.ExecuteShortCommand(cmd)
+	data, err := client.SSExecutor.Output(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("Read %s failed: %v", file, err)
 		return "", err
@@ -394,20 +330,16 @@ func (client *OSClient) ReadFile(file string) (string, error) {
 
 func (client *OSClient) ReadBytes(file string) ([]byte, error) {
 	cmd := fmt.Sprintf("cat %s", file)
-	data, err := client.SSExecutor.ExecuteShortCMD(cmd)
+	data, err := client.SSExecutor.Output(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("Read %s failed: %v", file, err)
 		return nil, err
 	}
-	return data, nil
+	return []byte(data), nil
 }
 
 func (client *OSClient) WriteFile(content, file string) error {
-	cmd := fmt.Sprintf("bash -c \"echo -e '%s' > %s\"", content, file)
-	if client.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, client.SSExecutor.Host.Password)
-	}
-	err := client.SSExecutor.ExecuteCommandWithoutReturn(cmd)
+	err := client.SSExecutor.PutFile(context.Background(), strings.NewReader(content), RemoteFile{Path: file, Mode: 0644})
 	if err != nil {
 		logger.GetLogger().Errorf("Write %s failed: %v", file, err)
 		return err
@@ -416,12 +348,14 @@ func (client *OSClient) WriteFile(content, file string) error {
 }
 
 func (client *OSClient) QueryVGName() (*entity.LVS, error) {
+	return client.QueryVGNameContext(context.Background())
+}
+
+// QueryVGNameContext is QueryVGName, cancelling lvs when ctx is done.
+func (client *OSClient) QueryVGNameContext(ctx context.Context) (*entity.LVS, error) {
 	lvs := &entity.LVS{}
 	cmd := "lvs"
-	if client.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, client.SSExecutor.Host.Password)
-	}
-	data, err := client.SSExecutor.ExecuteShortCommand(cmd)
+	data, err := client.SSExecutor.AsRoot().OutputContext(ctx, cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("Query VGName failed: %v", err)
 		return nil, err
@@ -430,7 +364,7 @@ func (client *OSClient) QueryVGName() (*entity.LVS, error) {
 	for _, line := range lines {
 		item := strings.TrimSpace(line)
 		if strings.HasPrefix(item, "root") {
-			items := strings.Split(item, " ")
+			items := strings.Fields(item)
 			lvs.LVName = strings.TrimSpace(items[0])
 			lvs.VGName = strings.TrimSpace(items[1])
 		}
@@ -440,10 +374,7 @@ func (client *OSClient) QueryVGName() (*entity.LVS, error) {
 
 func (client *OSClient) CreatePV(diskConf entity.DiskConf) error {
 	cmd := fmt.Sprintf("pvcreate %s", diskConf.Device)
-	if client.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, client.SSExecutor.Host.Password)
-	}
-	data, err := client.SSExecutor.ExecuteShortCommand(cmd)
+	data, err := client.SSExecutor.AsRoot().Output(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("pvcreate failed: %v,%s", err, data)
 		return err
@@ -454,10 +385,7 @@ func (client *OSClient) CreatePV(diskConf entity.DiskConf) error {
 
 func (client *OSClient) ExtendVG(diskConf entity.DiskConf) error {
 	cmd := fmt.Sprintf("vgextend %s %s", diskConf.VGName, diskConf.Device)
-	if client.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, client.SSExecutor.Host.Password)
-	}
-	data, err := client.SSExecutor.ExecuteShortCommand(cmd)
+	data, err := client.SSExecutor.AsRoot().Output(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("vgextend failed: %v,%s", err, data)
 		return err
@@ -467,10 +395,7 @@ func (client *OSClient) ExtendVG(diskConf entity.DiskConf) error {
 
 func (client *OSClient) ExtendLVPercent100(diskConf entity.DiskConf) error {
 	cmd := fmt.Sprintf("lvextend -l +100%%FREE /dev/mapper/%s-%s", diskConf.VGName, diskConf.LVName)
-	if client.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, client.SSExecutor.Host.Password)
-	}
-	data, err := client.SSExecutor.ExecuteShortCommand(cmd)
+	data, err := client.SSExecutor.AsRoot().Output(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("lvextend failed: %v,%s", err, data)
 		return err
@@ -480,10 +405,7 @@ func (client *OSClient) ExtendLVPercent100(diskConf entity.DiskConf) error {
 
 func (client *OSClient) ExtendLV(diskConf entity.DiskConf) error {
 	cmd := fmt.Sprintf("lvextend -L +%s /dev/mapper/%s-%s", diskConf.Size, diskConf.VGName, diskConf.LVName)
-	if client.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, client.SSExecutor.Host.Password)
-	}
-	data, err := client.SSExecutor.ExecuteShortCommand(cmd)
+	data, err := client.SSExecutor.AsRoot().Output(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("lvextend failed: %v,%s", err, data)
 		return err
@@ -493,10 +415,7 @@ func (client *OSClient) ExtendLV(diskConf entity.DiskConf) error {
 
 func (client *OSClient) XGrowFS(diskConf entity.DiskConf) error {
 	cmd := fmt.Sprintf("xfs_growfs /dev/mapper/%s-%s", diskConf.VGName, diskConf.LVName)
-	if client.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, client.SSExecutor.Host.Password)
-	}
-	data, err := client.SSExecutor.ExecuteShortCommand(cmd)
+	data, err := client.SSExecutor.AsRoot().Output(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("xfs_growfs failed: %v,%s", err, data)
 		return err
@@ -506,10 +425,7 @@ func (client *OSClient) XGrowFS(diskConf entity.DiskConf) error {
 
 func (client *OSClient) Resize2FS(diskConf entity.DiskConf) error {
 	cmd := fmt.Sprintf("resize2fs /dev/mapper/%s-%s", diskConf.VGName, diskConf.LVName)
-	if client.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, client.SSExecutor.Host.Password)
-	}
-	data, err := client.SSExecutor.ExecuteShortCommand(cmd)
+	data, err := client.SSExecutor.AsRoot().Output(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("xfs_growfs failed: %v,%s", err, data)
 		return err
@@ -518,8 +434,12 @@ func (client *OSClient) Resize2FS(diskConf entity.DiskConf) error {
 }
 
 func (client *OSClient) CopyFile(srcFile, destFile string) error {
+	return client.CopyFileContext(context.Background(), srcFile, destFile)
+}
+
+func (client *OSClient) CopyFileContext(ctx context.Context, srcFile, destFile string) error {
 	outputHandler := func(string) { logger.GetLogger().Infof("Copy file") }
-	return client.SSExecutor.CopyFile(srcFile, destFile, outputHandler)
+	return client.SSExecutor.CopyFileContext(ctx, srcFile, destFile, outputHandler)
 }
 
 func (client *OSClient) CopyMultiFile(files []entity.FileSrcDest) *CopyResult {
@@ -528,8 +448,12 @@ func (client *OSClient) CopyMultiFile(files []entity.FileSrcDest) *CopyResult {
 }
 
 func (client *OSClient) AddHost(record entity.Record) error {
+	return client.AddHostContext(context.Background(), record)
+}
+
+func (client *OSClient) AddHostContext(ctx context.Context, record entity.Record) error {
 	outputHandler := func(string) { logger.GetLogger().Infof("Add Hosts") }
-	return client.SSExecutor.AddHosts(record, outputHandler)
+	return client.SSExecutor.AddHostsContext(ctx, record, outputHandler)
 }
 
 func (client *OSClient) AddMultiHost(records []entity.Record) error {
@@ -538,25 +462,25 @@ func (client *OSClient) AddMultiHost(records []entity.Record) error {
 }
 
 func (client *OSClient) ChangeExpiredPassword(currentPassword, newPassword string) error {
-	return client.SSExecutor.ChangeExpiredPassword(currentPassword, newPassword)
+	return client.ChangeExpiredPasswordContext(context.Background(), currentPassword, newPassword)
 }
 
-func (client *OSClient) CheckPasswordInfo() (*entity.PasswordInfo, error) {
-	return client.SSExecutor.CheckPasswordInfo()
+func (client *OSClient) ChangeExpiredPasswordContext(ctx context.Context, currentPassword, newPassword string) error {
+	return client.SSExecutor.ChangeExpiredPasswordContext(ctx, currentPassword, newPassword)
 }
 
-func (client *OSClient) UpdatePasswordInfo(currentPassword, newPassword string) error {
-	return client.SSExecutor.UpdatePassword(currentPassword, newPassword)
+func (client *OSClient) CheckPasswordInfo() (*entity.PasswordInfo, error) {
+	return client.CheckPasswordInfoContext(context.Background())
 }
 
-func SudoPrefixWithEOF(cmd string) string {
-	return fmt.Sprintf("sudo -S -E /bin/bash <<EOF\n%s\nEOF", cmd)
+func (client *OSClient) CheckPasswordInfoContext(ctx context.Context) (*entity.PasswordInfo, error) {
+	return client.SSExecutor.CheckPasswordInfoContext(ctx)
 }
 
-func SudoPrefix(cmd string) string {
-	return fmt.Sprintf("sudo %s", cmd)
+func (client *OSClient) UpdatePasswordInfo(currentPassword, newPassword string) error {
+	return client.UpdatePasswordInfoContext(context.Background(), currentPassword, newPassword)
 }
 
-func SudoPrefixWithPassword(cmd, sudoPassword string) string {
-	return fmt.Sprintf("echo %s | sudo -S %s", sudoPassword, SudoPrefix(cmd))
+func (client *OSClient) UpdatePasswordInfoContext(ctx context.Context, currentPassword, newPassword string) error {
+	return client.SSExecutor.UpdatePasswordContext(ctx, currentPassword, newPassword)
 }
@@ -0,0 +1,415 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	packageRepoName = "mykubespray"
+	yumRepoFile     = "/etc/yum.repos.d/mykubespray.repo"
+	aptSourceFile   = "/etc/apt/sources.list.d/mykubespray.list"
+	// packageSection starts the output of a package in the query of installed packages.
+	packageSection = "@@package:"
+)
+
+// packageFormats are the package formats of the distributions PackageInstaller supports by os-release ID.
+var packageFormats = map[string]string{
+	"centos":    "rpm",
+	"rhel":      "rpm",
+	"rocky":     "rpm",
+	"kylin":     "rpm",
+	"uos":       "rpm",
+	"openeuler": "rpm",
+	"ubuntu":    "deb",
+	"debian":    "deb",
+}
+
+// packageLists are the package lists in pkg/conf by distribution, as id:version entries like
+// preflight.supported_os.
+var packageLists = map[string]string{
+	"centos:7":     "centos7.packages",
+	"debian:10":    "debian10.packages",
+	"ubuntu:22.04": "ubuntu2204.packages",
+	"kylin:v10":    "kylinv10sp3.packages",
+	"uos:20":       "uos20.packages",
+}
+
+var (
+	// packagePattern matches names such as docker-ce-20.10.8 or docker-ce=5:20.10.13~3-0~ubuntu-jammy.
+	packagePattern     = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.+_:~=\-]*$`)
+	packageRepoPattern = regexp.MustCompile(`^(https?|ftp|file)://\S+$`)
+	// packageRepoOptions restrict yum and dnf to the offline repository, the others cannot be reached
+	// from an offline node.
+	packageRepoOptions = fmt.Sprintf("--disablerepo=%s --enablerepo=%s", shellQuote("*"), packageRepoName)
+)
+
+// PackageInstaller installs the packages Kubernetes and its addons need on a node from an offline
+// repository. Installed packages are left alone, so running it again changes nothing.
+type PackageInstaller struct {
+	Conf     entity.PackageConf
+	OSClient OSClient
+}
+
+func NewPackageInstaller(conf entity.PackageConf, osClient OSClient) *PackageInstaller {
+	return &PackageInstaller{
+		Conf:     conf,
+		OSClient: osClient,
+	}
+}
+
+// ValidatePackageConf rejects repositories and package names that cannot be used.
+func ValidatePackageConf(conf entity.PackageConf) error {
+	if conf.Repo != "" && !strings.HasPrefix(conf.Repo, "/") && !packageRepoPattern.MatchString(conf.Repo) {
+		return fmt.Errorf("invalid repository %s, expected an http, https, ftp or file URL or the path of a mounted ISO", conf.Repo)
+	}
+	if strings.ContainsAny(conf.Repo, " \t\n\r") {
+		return fmt.Errorf("invalid repository %s", conf.Repo)
+	}
+	for _, name := range conf.Packages {
+		if !packagePattern.MatchString(name) {
+			return fmt.Errorf("invalid package %s", name)
+		}
+	}
+	return nil
+}
+
+// ReadPackageList reads a package list, one package per line. Empty lines, comments and repeated
+// packages are left out.
+func ReadPackageList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var packages []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") || seen[name] {
+			continue
+		}
+		if !packagePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid package %s in %s", name, path)
+		}
+		seen[name] = true
+		packages = append(packages, name)
+	}
+	return packages, scanner.Err()
+}
+
+// Run installs the packages that are missing on the node. With verify nothing is changed and the
+// missing packages are reported.
+func (installer *PackageInstaller) Run(ctx context.Context, verify bool) *entity.PackageReport {
+	report := &entity.PackageReport{Host: installer.OSClient.SSExecutor.Host.Name, Verify: verify}
+	if err := ValidatePackageConf(installer.Conf); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	output, err := installer.OSClient.SSExecutor.OutputContext(ctx, "cat /etc/os-release; echo; uname -m")
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to read /etc/os-release: %s", err.Error())
+		return report
+	}
+	id, version := parseOSIdentity(output)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	arch := packageArch(strings.TrimSpace(lines[len(lines)-1]))
+	report.Distribution = strings.TrimSpace(id + " " + version)
+	format, ok := packageFormats[id]
+	if !ok {
+		report.Error = fmt.Sprintf("%s is not a supported distribution", report.Distribution)
+		return report
+	}
+	packages, err := installer.packages(id, version)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Manager, err = installer.manager(ctx, format)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Repo = packageRepoURL(installer.Conf.Repo, id, version, arch)
+
+	installed, err := installer.query(ctx, format, packages)
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to query the installed packages: %s", err.Error())
+		return report
+	}
+	var missing []string
+	for _, name := range packages {
+		status := entity.PackageStatus{Name: name, Status: entity.PackagePresent, Version: installed[name].version}
+		if !installed[name].ok {
+			status.Status = entity.PackageMissing
+			if status.Version != "" {
+				status.Message = fmt.Sprintf("version %s is installed", status.Version)
+			}
+			missing = append(missing, name)
+		}
+		report.Packages = append(report.Packages, status)
+	}
+	if verify {
+		return report
+	}
+
+	if report.Repo != "" {
+		if err := installer.writeRepo(ctx, format, report.Repo); err != nil {
+			report.Error = fmt.Sprintf("failed to configure the repository: %s", err.Error())
+			return report
+		}
+	}
+	if len(missing) == 0 {
+		logger.GetLogger().Infof("All %d packages are installed on %s", len(packages), report.Host)
+		return report
+	}
+	if command := installer.refreshCommand(format, report.Manager, report.Repo != ""); command != "" {
+		if _, err := installer.root().OutputContext(ctx, command); err != nil {
+			report.Error = fmt.Sprintf("failed to refresh the repositories: %s", err.Error())
+			return report
+		}
+	}
+	failures := installer.install(ctx, format, report.Manager, report.Repo != "", missing)
+	if ctx.Err() != nil {
+		report.Error = ctx.Err().Error()
+		return report
+	}
+	installed, err = installer.query(ctx, format, missing)
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to query the installed packages: %s", err.Error())
+		return report
+	}
+	var failed []string
+	for i, status := range report.Packages {
+		if status.Status != entity.PackageMissing {
+			continue
+		}
+		if state := installed[status.Name]; state.ok {
+			report.Packages[i] = entity.PackageStatus{Name: status.Name, Status: entity.PackageInstalled, Version: state.version}
+			continue
+		}
+		message := failures[status.Name]
+		if message == "" {
+			message = "not installed after the install succeeded"
+		}
+		report.Packages[i].Status, report.Packages[i].Message = entity.PackageFailed, message
+		failed = append(failed, status.Name)
+	}
+	if len(failed) > 0 {
+		report.Error = fmt.Sprintf("failed packages: %s", strings.Join(failed, ", "))
+		logger.GetLogger().Errorf("Failed to install packages on %s: %s", report.Host, report.Error)
+		return report
+	}
+	logger.GetLogger().Infof("Installed %d packages on %s", len(missing), report.Host)
+	return report
+}
+
+func (installer *PackageInstaller) root() *SSHExecutor {
+	return installer.OSClient.SSExecutor.AsRoot()
+}
+
+// packages returns the packages of the request, or the list of the distribution.
+func (installer *PackageInstaller) packages(id, version string) ([]string, error) {
+	if len(installer.Conf.Packages) > 0 {
+		return installer.Conf.Packages, nil
+	}
+	for entry, list := range packageLists {
+		if isSupportedOS([]string{entry}, id, version) {
+			return ReadPackageList(filepath.Join(installer.Conf.ListDir, list))
+		}
+	}
+	return nil, fmt.Errorf("no package list for %s %s", id, version)
+}
+
+// manager returns the package manager of the node, dnf where it replaced yum.
+func (installer *PackageInstaller) manager(ctx context.Context, format string) (string, error) {
+	if format == "deb" {
+		return "apt-get", nil
+	}
+	result, err := installer.OSClient.SSExecutor.RunContext(ctx, "command -v dnf >/dev/null")
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode == 0 {
+		return "dnf", nil
+	}
+	return "yum", nil
+}
+
+// packageArch returns the architecture of uname -m as the offline repositories name it.
+func packageArch(machine string) string {
+	switch machine {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	}
+	return machine
+}
+
+// packageRepoURL returns the URL of the repository of a node, see entity.PackageConf.
+func packageRepoURL(repo, id, version, arch string) string {
+	if repo == "" {
+		return ""
+	}
+	if strings.HasPrefix(repo, "/") {
+		repo = "file://" + repo
+	}
+	return strings.NewReplacer("$ID", id, "$VERSION_ID", version, "$ARCH", arch).Replace(strings.TrimSuffix(repo, "/"))
+}
+
+// writeRepo points the package manager at the repository unless it points there already.
+func (installer *PackageInstaller) writeRepo(ctx context.Context, format, url string) error {
+	path := yumRepoFile
+	content := fmt.Sprintf("[%s]\nname=%s offline repository\nbaseurl=%s\nenabled=1\ngpgcheck=0\n", packageRepoName, packageRepoName, url)
+	if format == "deb" {
+		// a flat repository, as offline/prepare-repo.sh builds it
+		path = aptSourceFile
+		content = fmt.Sprintf("deb [trusted=yes] %s/ /\n", url)
+	}
+	current, err := installer.root().OutputContext(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", shellQuote(path)))
+	if err != nil || current == content {
+		return err
+	}
+	return installer.OSClient.SSExecutor.PutFile(ctx, strings.NewReader(content), RemoteFile{Path: path, Mode: 0644})
+}
+
+// refreshCommand returns the command that reads the metadata of the repositories, of the offline
+// repository alone when onlyRepo is set.
+func (installer *PackageInstaller) refreshCommand(format, manager string, onlyRepo bool) string {
+	switch {
+	case format == "deb" && onlyRepo:
+		return fmt.Sprintf("apt-get update -o Dir::Etc::sourcelist=%s -o Dir::Etc::sourceparts=- -o APT::Get::List-Cleanup=0", aptSourceFile)
+	case format == "deb":
+		return "apt-get update"
+	case onlyRepo:
+		return fmt.Sprintf("%s makecache %s", manager, packageRepoOptions)
+	}
+	return ""
+}
+
+// installCommand returns the command that installs packages.
+func (installer *PackageInstaller) installCommand(format, manager string, onlyRepo bool, packages []string) string {
+	quoted := make([]string, len(packages))
+	for i, name := range packages {
+		quoted[i] = shellQuote(name)
+	}
+	if format == "deb" {
+		// versions that are pinned in the list may be older than the installed ones
+		return "DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends --allow-downgrades " + strings.Join(quoted, " ")
+	}
+	command := manager + " install -y "
+	if onlyRepo {
+		command += packageRepoOptions + " "
+	}
+	return command + strings.Join(quoted, " ")
+}
+
+// install installs packages in one transaction. When that fails they are installed one by one, so
+// that a package that cannot be installed does not keep the others from being installed, and the
+// error of every failed package is returned by name.
+func (installer *PackageInstaller) install(ctx context.Context, format, manager string, onlyRepo bool, packages []string) map[string]string {
+	failures := make(map[string]string)
+	result, err := installer.root().RunContext(ctx, installer.installCommand(format, manager, onlyRepo, packages))
+	if err == nil && result.ExitCode == 0 {
+		return failures
+	}
+	if len(packages) == 1 {
+		failures[packages[0]] = installFailure(result, err)
+		return failures
+	}
+	for _, name := range packages {
+		if ctx.Err() != nil {
+			break
+		}
+		result, err := installer.root().RunContext(ctx, installer.installCommand(format, manager, onlyRepo, []string{name}))
+		if err != nil || result.ExitCode != 0 {
+			failures[name] = installFailure(result, err)
+		}
+	}
+	return failures
+}
+
+// installFailure returns the last line the package manager printed when it failed.
+func installFailure(result *entity.CommandResult, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	output := strings.TrimSpace(result.Stderr)
+	if output == "" {
+		output = strings.TrimSpace(result.Stdout)
+	}
+	if output == "" {
+		return fmt.Sprintf("exited with status %d", result.ExitCode)
+	}
+	lines := strings.Split(output, "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// packageState is whether a package is installed, and its installed version.
+type packageState struct {
+	ok      bool
+	version string
+}
+
+// query returns the state of packages by name. A package pinned to a version, e.g. docker-ce-20.10.8
+// or docker-ce=5:20.10.13~3-0~ubuntu-jammy, is only installed in that version.
+func (installer *PackageInstaller) query(ctx context.Context, format string, packages []string) (map[string]packageState, error) {
+	commands := make([]string, 0, len(packages)+1)
+	for _, name := range packages {
+		marker := "echo " + shellQuote(packageSection+name)
+		if format == "deb" {
+			base, _, _ := strings.Cut(name, "=")
+			commands = append(commands, fmt.Sprintf("%s; dpkg-query -W -f=%s %s 2>/dev/null", marker, shellQuote(`${db:Status-Abbrev}${Version}\n`), shellQuote(base)))
+			continue
+		}
+		// rpm -q accepts the name with a version and prints why a package is not installed on stdout
+		commands = append(commands, fmt.Sprintf("%s; rpm -q --quiet %[2]s && rpm -q --qf %[3]s %[2]s", marker, shellQuote(name), shellQuote(`%{VERSION}-%{RELEASE}\n`)))
+	}
+	commands = append(commands, "true")
+	output, err := installer.OSClient.SSExecutor.OutputContext(ctx, strings.Join(commands, "; "))
+	if err != nil {
+		return nil, err
+	}
+	return parsePackageQuery(format, output), nil
+}
+
+// parsePackageQuery parses the output of query. dpkg-query prints a line per architecture a package
+// is known for, e.g. "ii 7.81.0-1ubuntu1.16", and "un " for packages that are not installed.
+func parsePackageQuery(format, output string) map[string]packageState {
+	states := make(map[string]packageState)
+	var name string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, packageSection) {
+			name = strings.TrimPrefix(line, packageSection)
+			states[name] = packageState{}
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if name == "" || line == "" || states[name].ok {
+			continue
+		}
+		if format != "deb" {
+			states[name] = packageState{ok: true, version: line}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[0] != "ii" && fields[0] != "hi") {
+			continue
+		}
+		state := packageState{ok: true, version: fields[len(fields)-1]}
+		if _, pinned, ok := strings.Cut(name, "="); ok && pinned != state.version {
+			state.ok = false
+		}
+		states[name] = state
+	}
+	return states
+}
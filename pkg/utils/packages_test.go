@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils/sshtest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPackageInstallerReportsEveryPackage(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("root", "secret")
+	server.Respond(`cat /etc/os-release; echo; uname -m`, sshtest.Response{Stdout: "ID=\"rocky\"\nVERSION_ID=\"9.4\"\n\nx86_64\n"})
+	server.Respond(`command -v dnf.*`, sshtest.Response{})
+	server.Respond(`cat '/etc/yum.repos.d/mykubespray.repo'.*|dnf makecache .*`, sshtest.Response{})
+	var mutex sync.Mutex
+	installed := map[string]string{"curl": "7.76.1-29.el9"}
+	names := regexp.MustCompile(`'([^']+)'`)
+	server.RespondFunc(`(?s)echo '@@package:.*`, func(exec sshtest.Exec) sshtest.Response {
+		mutex.Lock()
+		defer mutex.Unlock()
+		var output strings.Builder
+		for _, match := range regexp.MustCompile(`'@@package:([^']+)'`).FindAllStringSubmatch(exec.Command, -1) {
+			fmt.Fprintf(&output, "@@package:%s\n", match[1])
+			if version, ok := installed[match[1]]; ok {
+				fmt.Fprintln(&output, version)
+			}
+		}
+		return sshtest.Response{Stdout: output.String()}
+	})
+	server.RespondFunc(`dnf install .*`, func(exec sshtest.Exec) sshtest.Response {
+		mutex.Lock()
+		defer mutex.Unlock()
+		var packages []string
+		for _, match := range names.FindAllStringSubmatch(exec.Command, -1) {
+			if match[1] != "*" {
+				packages = append(packages, match[1])
+			}
+		}
+		for _, name := range packages {
+			if name == "missing" {
+				return sshtest.Response{Stderr: "Error: Unable to find a match: missing\n", ExitCode: 1}
+			}
+		}
+		for _, name := range packages {
+			installed[name] = "20.10.8-3.el9"
+		}
+		return sshtest.Response{}
+	})
+	client := OSClient{SSExecutor: *connect(t, server.Host("root", "secret"))}
+
+	conf := entity.PackageConf{
+		Repo:     "http://10.0.0.1:8080/repository/$ID-$VERSION_ID/$ARCH/",
+		Packages: []string{"curl", "docker-ce-20.10.8", "missing"},
+	}
+	report := NewPackageInstaller(conf, client).Run(context.Background(), true)
+	if report.Error != "" || report.Manager != "dnf" || report.Distribution != "rocky 9.4" {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if statuses := report.Packages; len(statuses) != 3 || statuses[0].Status != entity.PackagePresent || statuses[1].Status != entity.PackageMissing {
+		t.Errorf("Expected docker-ce to be missing, got %+v", statuses)
+	}
+	for _, command := range server.Commands() {
+		if strings.Contains(command, "install") || strings.Contains(command, "makecache") {
+			t.Errorf("Expected verify not to change the node, got %q", command)
+		}
+	}
+
+	report = NewPackageInstaller(conf, client).Run(context.Background(), false)
+	if report.Repo != "http://10.0.0.1:8080/repository/rocky-9.4/amd64" || report.Error != "failed packages: missing" {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	expected := []entity.PackageStatus{
+		{Name: "curl", Status: entity.PackagePresent, Version: "7.76.1-29.el9"},
+		{Name: "docker-ce-20.10.8", Status: entity.PackageInstalled, Version: "20.10.8-3.el9"},
+		{Name: "missing", Status: entity.PackageFailed, Message: "Error: Unable to find a match: missing"},
+	}
+	if fmt.Sprint(report.Packages) != fmt.Sprint(expected) {
+		t.Errorf("Expected %+v, got %+v", expected, report.Packages)
+	}
+	uploads := server.Uploads()
+	if len(uploads) != 1 {
+		t.Fatalf("Expected the repository to be written once, got %v", uploads)
+	}
+	if repo, _ := server.File(yumRepoFile); !strings.Contains(string(repo), "baseurl=http://10.0.0.1:8080/repository/rocky-9.4/amd64\n") {
+		t.Errorf("Unexpected repository %q", repo)
+	}
+}
@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	CheckCIDR     = "cidr"
+	CheckRoles    = "roles"
+	CheckEtcd     = "etcd"
+	CheckManifest = "manifest"
+	CheckSSH      = "ssh"
+	CheckCPU      = "cpu"
+	CheckMemory   = "memory"
+	CheckDisk     = "disk"
+	CheckOS       = "os"
+)
+
+// Preflight validates a cluster spec before kk is started, so that problems surface in
+// seconds instead of half way through an install.
+type Preflight struct {
+	Conf         entity.KubekeyConf
+	Requirements entity.PreflightRequirements
+}
+
+func NewPreflight(conf entity.KubekeyConf, requirements entity.PreflightRequirements) *Preflight {
+	return &Preflight{
+		Conf:         conf,
+		Requirements: requirements,
+	}
+}
+
+// Validate runs every check. Cancelling ctx stops the commands still running on the hosts.
+func (preflight *Preflight) Validate(ctx context.Context) *entity.ValidationReport {
+	report := &entity.ValidationReport{Passed: true}
+	preflight.checkRoles(report)
+	preflight.checkEtcd(report)
+	preflight.checkManifest(report)
+	networks := preflight.checkCIDR(report)
+	if !preflight.Requirements.SkipHostScan {
+		preflight.checkHosts(ctx, report, networks)
+	}
+	return report
+}
+
+func (preflight *Preflight) checkRoles(report *entity.ValidationReport) {
+	names := make(map[string]bool)
+	for _, host := range preflight.Conf.Hosts {
+		if names[host.Name] {
+			report.Error(CheckRoles, host.Name, "host name is used more than once")
+		}
+		names[host.Name] = true
+	}
+	groups := []struct {
+		role    string
+		members []string
+	}{
+		{entity.RoleEtcd, preflight.Conf.Etcds},
+		{entity.RoleControlPlane, preflight.Conf.ContronPlanes},
+		{entity.RoleWorker, preflight.Conf.Workers},
+	}
+	for _, group := range groups {
+		if len(group.members) == 0 {
+			report.Error(CheckRoles, "", fmt.Sprintf("no host has the %s role", group.role))
+		}
+		for _, member := range group.members {
+			if !names[member] {
+				report.Error(CheckRoles, member, fmt.Sprintf("%s member %s is not defined in hosts", group.role, member))
+			}
+		}
+	}
+}
+
+func (preflight *Preflight) checkEtcd(report *entity.ValidationReport) {
+	count := len(preflight.Conf.Etcds)
+	if count > 0 && count%2 == 0 {
+		report.Error(CheckEtcd, "", fmt.Sprintf("etcd needs an odd number of members to keep quorum, got %d", count))
+	}
+}
+
+func (preflight *Preflight) checkManifest(report *entity.ValidationReport) {
+	version := preflight.Conf.KubernetesVersion
+	if version == "" {
+		report.Error(CheckManifest, "", "kubernetes version cannot be empty")
+		return
+	}
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	path := filepath.Join(preflight.Requirements.ManifestDir, fmt.Sprintf("manifest-%s.yaml", version))
+	if _, err := os.Stat(path); err != nil {
+		report.Error(CheckManifest, "", fmt.Sprintf("no manifest for kubernetes %s (%s)", version, path))
+	}
+}
+
+// checkCIDR verifies the pod and service networks and returns them for the host checks.
+func (preflight *Preflight) checkCIDR(report *entity.ValidationReport) []*net.IPNet {
+	var networks []*net.IPNet
+	cidrs := []struct {
+		name  string
+		value string
+	}{
+		{"pod", preflight.Conf.KubePodsCIDR},
+		{"service", preflight.Conf.KubeServiceCIDR},
+	}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr.value)
+		if err != nil {
+			report.Error(CheckCIDR, "", fmt.Sprintf("invalid %s CIDR %q", cidr.name, cidr.value))
+			continue
+		}
+		networks = append(networks, network)
+	}
+	if len(networks) == 2 && cidrOverlap(networks[0], networks[1]) {
+		report.Error(CheckCIDR, "", fmt.Sprintf("pod CIDR %s overlaps service CIDR %s", networks[0], networks[1]))
+	}
+	for _, host := range preflight.Conf.Hosts {
+		for _, address := range []string{host.Address, host.InternalAddress} {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				continue
+			}
+			for _, network := range networks {
+				if network.Contains(ip) {
+					report.Error(CheckCIDR, host.Name, fmt.Sprintf("address %s lies inside cluster CIDR %s", address, network))
+				}
+			}
+		}
+	}
+	return networks
+}
+
+func (preflight *Preflight) checkHosts(ctx context.Context, report *entity.ValidationReport, networks []*net.IPNet) {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, host := range preflight.Conf.Hosts {
+		wg.Add(1)
+		go func(host entity.Host) {
+			defer wg.Done()
+			hostReport := &entity.ValidationReport{Passed: true}
+			preflight.checkHost(ctx, hostReport, host, networks)
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, item := range hostReport.Items {
+				if item.Severity == entity.SeverityError {
+					report.Error(item.Check, item.Host, item.Message)
+				} else {
+					report.Warning(item.Check, item.Host, item.Message)
+				}
+			}
+		}(host)
+	}
+	wg.Wait()
+}
+
+func (preflight *Preflight) checkHost(ctx context.Context, report *entity.ValidationReport, host entity.Host, networks []*net.IPNet) {
+	connection, err := NewConnection(host)
+	if err != nil {
+		report.Error(CheckSSH, host.Name, fmt.Sprintf("cannot connect to %s:%d: %s", host.Address, host.Port, err.Error()))
+		return
+	}
+	defer connection.Client.Close()
+	executor := &SSHExecutor{Connection: *connection, Host: host}
+	requirements := preflight.Requirements
+
+	facts, err := executor.GatherFacts(ctx)
+	if err != nil {
+		report.Error(CheckSSH, host.Name, fmt.Sprintf("failed to gather facts: %s", err.Error()))
+		return
+	}
+	if !isSupportedOS(requirements.SupportedOS, facts.OS.ID, facts.OS.Version) {
+		report.Error(CheckOS, host.Name, fmt.Sprintf("%s %s is not a supported operating system", facts.OS.ID, facts.OS.Version))
+	}
+
+	if cpu := facts.CPU.Cores; cpu == 0 {
+		report.Error(CheckCPU, host.Name, "failed to read cpu count")
+	} else if cpu < requirements.MinCPU {
+		report.Error(CheckCPU, host.Name, fmt.Sprintf("%d cpus, at least %d required", cpu, requirements.MinCPU))
+	}
+
+	if facts.Memory.Total == 0 {
+		report.Error(CheckMemory, host.Name, "failed to read memory size")
+	} else if mb := int(facts.Memory.Total / 1024 / 1024); mb < requirements.MinMemoryMB {
+		report.Error(CheckMemory, host.Name, fmt.Sprintf("%dMB memory, at least %dMB required", mb, requirements.MinMemoryMB))
+	}
+
+	if root := rootFilesystem(facts.Filesystems); root == nil {
+		report.Error(CheckDisk, host.Name, "failed to read free disk space of /")
+	} else if gb := int(root.Available / 1024 / 1024 / 1024); gb < requirements.MinDiskGB {
+		report.Error(CheckDisk, host.Name, fmt.Sprintf("%dGB free on /, at least %dGB required", gb, requirements.MinDiskGB))
+	}
+
+	for _, hostInterface := range facts.Interfaces {
+		for _, address := range hostInterface.Addresses {
+			_, hostNetwork, err := net.ParseCIDR(address)
+			if err != nil || hostNetwork.IP.To4() == nil || hostNetwork.IP.IsLoopback() {
+				continue
+			}
+			for _, network := range networks {
+				if cidrOverlap(hostNetwork, network) {
+					report.Error(CheckCIDR, host.Name, fmt.Sprintf("host network %s overlaps cluster CIDR %s", hostNetwork, network))
+				}
+			}
+		}
+	}
+	logger.GetLogger().Infof("Preflight checks finished on host %s", host.Name)
+}
+
+// rootFilesystem returns the filesystem mounted on /, nil when there is none.
+func rootFilesystem(filesystems []entity.Filesystem) *entity.Filesystem {
+	for i := range filesystems {
+		if filesystems[i].Mountpoint == "/" {
+			return &filesystems[i]
+		}
+	}
+	return nil
+}
+
+func cidrOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+func parseOSIdentity(output string) (string, string) {
+	var id, version string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "ID=") {
+			id = strings.Trim(strings.TrimPrefix(line, "ID="), "\"'")
+		} else if strings.HasPrefix(line, "VERSION_ID=") {
+			version = strings.Trim(strings.TrimPrefix(line, "VERSION_ID="), "\"'")
+		}
+	}
+	return strings.ToLower(id), version
+}
+
+// isSupportedOS matches id and version against entries of the form "id:version".
+// A version matches when it equals the entry or starts with it followed by a dot, so "centos:7" accepts 7.9.
+func isSupportedOS(supported []string, id, version string) bool {
+	for _, entry := range supported {
+		parts := strings.SplitN(entry, ":", 2)
+		if !strings.EqualFold(parts[0], id) {
+			continue
+		}
+		if len(parts) == 1 || strings.EqualFold(parts[1], version) || strings.HasPrefix(strings.ToLower(version), strings.ToLower(parts[1])+".") {
+			return true
+		}
+	}
+	return false
+}
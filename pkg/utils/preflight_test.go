@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"context"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils/sshtest"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestPreflightChecksHostFacts(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.Respond(`(?s)sh -c .*`, sshtest.Response{Stdout: factsOutput})
+	host := server.Host("deploy", "secret")
+	host.Name = "node1"
+	preflight := NewPreflight(entity.KubekeyConf{}, entity.PreflightRequirements{
+		MinCPU:      16,
+		MinMemoryMB: 4096,
+		MinDiskGB:   200,
+		SupportedOS: []string{"rocky:9"},
+	})
+	_, podNetwork, _ := net.ParseCIDR("10.0.0.0/16")
+
+	report := &entity.ValidationReport{Passed: true}
+	preflight.checkHost(context.Background(), report, host, []*net.IPNet{podNetwork})
+	if len(server.Execs()) != 1 {
+		t.Errorf("Expected the facts to be gathered in a single command, got %v", server.Commands())
+	}
+	expected := []entity.ValidationItem{
+		{Check: CheckCPU, Host: "node1", Severity: entity.SeverityError, Message: "8 cpus, at least 16 required"},
+		{Check: CheckDisk, Host: "node1", Severity: entity.SeverityError, Message: "89GB free on /, at least 200GB required"},
+		{Check: CheckCIDR, Host: "node1", Severity: entity.SeverityError, Message: "host network 10.0.0.0/24 overlaps cluster CIDR 10.0.0.0/16"},
+	}
+	if report.Passed || !reflect.DeepEqual(report.Items, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, report.Items)
+	}
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	kkModulePattern   = regexp.MustCompile(`^\d{2}:\d{2}:\d{2} \S+ \[(\w+)\] (.*)$`)
+	kkResultPattern   = regexp.MustCompile(`^\d{2}:\d{2}:\d{2} \S+ (success|failed|skipped): \[(.+)\]$`)
+	kkPipelinePattern = regexp.MustCompile(`Pipeline\[(\w+)\] execute (successfully|failed)`)
+	kkFailedModule    = regexp.MustCompile(`Module\[(\w+)\] exec failed`)
+)
+
+// kkModuleCounts is the approximate number of modules kk runs for each operation.
+var kkModuleCounts = map[string]int{
+	entity.JobCreateCluster: 45,
+	entity.JobDeleteCluster: 10,
+	entity.JobAddNodes:      40,
+	entity.JobDeleteNodes:   12,
+	entity.JobRenewCerts:    6,
+	entity.JobApplyPlan:     40,
+	entity.JobUpgrade:       25,
+}
+
+const defaultModuleCount = 30
+
+// ProgressParser turns kk output into progress events. It keeps the current module between
+// lines, so one parser must be used per output stream.
+type ProgressParser struct {
+	expected int
+	modules  int
+	pipeline string
+	module   string
+	task     string
+	done     bool
+}
+
+func NewProgressParser(jobType string) *ProgressParser {
+	expected, ok := kkModuleCounts[jobType]
+	if !ok {
+		expected = defaultModuleCount
+	}
+	return &ProgressParser{expected: expected}
+}
+
+// Parse classifies a single line. Lines that carry no progress information become log events.
+func (parser *ProgressParser) Parse(line string, timestamp time.Time, isError bool) entity.ProgressEvent {
+	line = strings.TrimRight(line, "\r")
+	event := entity.ProgressEvent{
+		Type:      entity.EventLog,
+		Timestamp: timestamp,
+		Message:   line,
+		IsError:   isError,
+	}
+	if match := kkPipelinePattern.FindStringSubmatch(line); match != nil {
+		parser.pipeline = match[1]
+		event.Type = entity.EventPipeline
+		event.Status = entity.StatusSuccess
+		parser.done = match[2] == "successfully"
+		if !parser.done {
+			event.Status = entity.StatusFailed
+			event.IsError = true
+			if failed := kkFailedModule.FindStringSubmatch(line); failed != nil {
+				parser.module = failed[1]
+			}
+		}
+	} else if match := kkResultPattern.FindStringSubmatch(line); match != nil {
+		event.Type = entity.EventResult
+		event.Status = match[1]
+		event.Host = match[2]
+		event.IsError = event.Status == entity.StatusFailed
+	} else if match := kkModulePattern.FindStringSubmatch(line); match != nil {
+		if match[1] != parser.module {
+			parser.modules++
+		}
+		parser.module = match[1]
+		parser.task = match[2]
+		event.Type = entity.EventModule
+	}
+	event.Pipeline = parser.pipeline
+	event.Module = parser.module
+	event.Task = parser.task
+	event.Percent = parser.Percent()
+	return event
+}
+
+// Percent estimates the progress. It stays below 100 until kk reports that its pipeline succeeded.
+func (parser *ProgressParser) Percent() int {
+	if parser.done {
+		return 100
+	}
+	percent := parser.modules * 100 / parser.expected
+	if percent > 99 {
+		percent = 99
+	}
+	return percent
+}
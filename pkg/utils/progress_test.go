@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressParser(t *testing.T) {
+	// Lines of kk create cluster, the failed run ends with the error kk prints before it exits.
+	tests := []struct {
+		line  string
+		event entity.ProgressEvent
+	}{
+		{line: "10:02:11 CST [GreetingsModule] Greetings", event: entity.ProgressEvent{Type: entity.EventModule, Module: "GreetingsModule", Task: "Greetings", Percent: 2}},
+		{line: "10:02:11 CST message: [master1]", event: entity.ProgressEvent{Type: entity.EventLog, Module: "GreetingsModule", Task: "Greetings", Percent: 2}},
+		{line: "Greetings, KubeKey!", event: entity.ProgressEvent{Type: entity.EventLog, Module: "GreetingsModule", Task: "Greetings", Percent: 2}},
+		{line: "10:02:11 CST success: [master1]", event: entity.ProgressEvent{Type: entity.EventResult, Status: entity.StatusSuccess, Host: "master1", Module: "GreetingsModule", Task: "Greetings", Percent: 2}},
+		{line: "10:02:11 CST [NodePreCheckModule] A pre-check on nodes", event: entity.ProgressEvent{Type: entity.EventModule, Module: "NodePreCheckModule", Task: "A pre-check on nodes", Percent: 4}},
+		{line: "10:02:12 CST [NodePreCheckModule] A pre-check on nodes\r", event: entity.ProgressEvent{Type: entity.EventModule, Module: "NodePreCheckModule", Task: "A pre-check on nodes", Percent: 4}},
+		{line: "10:02:12 CST skipped: [worker1]", event: entity.ProgressEvent{Type: entity.EventResult, Status: entity.StatusSkipped, Host: "worker1", Module: "NodePreCheckModule", Task: "A pre-check on nodes", Percent: 4}},
+		{line: "10:04:37 CST [InstallKubeBinariesModule] Synchronize kubernetes binaries", event: entity.ProgressEvent{Type: entity.EventModule, Module: "InstallKubeBinariesModule", Task: "Synchronize kubernetes binaries", Percent: 6}},
+		{line: "10:04:52 CST failed: [worker1]", event: entity.ProgressEvent{Type: entity.EventResult, Status: entity.StatusFailed, Host: "worker1", IsError: true, Module: "InstallKubeBinariesModule", Task: "Synchronize kubernetes binaries", Percent: 6}},
+		{
+			line:  "error: Pipeline[CreateClusterPipeline] execute failed: Module[InstallKubeBinariesModule] exec failed: ",
+			event: entity.ProgressEvent{Type: entity.EventPipeline, Status: entity.StatusFailed, IsError: true, Pipeline: "CreateClusterPipeline", Module: "InstallKubeBinariesModule", Task: "Synchronize kubernetes binaries", Percent: 6},
+		},
+	}
+	parser := NewProgressParser(entity.JobCreateCluster)
+	now := time.Now()
+	for _, test := range tests {
+		event := parser.Parse(test.line, now, false)
+		expected := test.event
+		expected.Timestamp, expected.Message = now, strings.TrimSuffix(test.line, "\r")
+		if event != expected {
+			t.Errorf("Expected %q to be parsed as %+v, got %+v", test.line, expected, event)
+		}
+	}
+
+	parser = NewProgressParser(entity.JobRenewCerts)
+	parser.Parse("10:06:40 CST [RenewCertsModule] Renew control-plane certs", now, false)
+	if event := parser.Parse("10:06:52 CST Pipeline[RenewCertsPipeline] execute successfully", now, false); event.Type != entity.EventPipeline || event.Status != entity.StatusSuccess || event.Percent != 100 {
+		t.Errorf("Expected the pipeline to succeed at 100%%, got %+v", event)
+	}
+}
+
+func TestProgressPercent(t *testing.T) {
+	tests := []struct {
+		jobType  string
+		modules  int
+		done     bool
+		expected int
+	}{
+		{entity.JobCreateCluster, 0, false, 0},
+		{entity.JobCreateCluster, 9, false, 20},
+		{entity.JobRenewCerts, 3, false, 50},
+		{entity.JobRenewCerts, 12, false, 99},
+		{entity.JobRenewCerts, 2, true, 100},
+		{"unknown", 15, false, 50},
+	}
+	for _, test := range tests {
+		parser := NewProgressParser(test.jobType)
+		parser.modules, parser.done = test.modules, test.done
+		if percent := parser.Percent(); percent != test.expected {
+			t.Errorf("Expected %d modules of %s to be %d%%, got %d%%", test.modules, test.jobType, test.expected, percent)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+)
+
+// Provisioner installs and maintains a cluster described by entity.KubekeyConf.
+// GenerateConfig must be called before any other operation. Cancelling ctx stops the remote process.
+type Provisioner interface {
+	GenerateConfig() error
+	CreateCluster(ctx context.Context, logChan chan LogEntry) error
+	DeleteCluster(ctx context.Context, logChan chan LogEntry) error
+	AddNode(ctx context.Context, logChan chan LogEntry) error
+	DeleteNode(ctx context.Context, nodeName string, logChan chan LogEntry) error
+	UpgradeCluster(ctx context.Context, logChan chan LogEntry) error
+}
+
+var (
+	_ Provisioner = (*KubekeyClient)(nil)
+	_ Provisioner = (*KubesprayClient)(nil)
+)
+
+// writeRemoteFile writes content to path on the host of osClient, creating the parent directory.
+// The file is owned by the SSH user and only readable by it, as it holds host passwords.
+func writeRemoteFile(osClient *OSClient, path string, content []byte) error {
+	executor := osClient.SSExecutor
+	file := RemoteFile{Path: path, Mode: 0600, Owner: executor.Host.User}
+	if err := executor.PutFile(context.Background(), bytes.NewReader(content), file); err != nil {
+		logger.GetLogger().Errorf("Failed to write %s: %s", path, err.Error())
+		return err
+	}
+	return nil
+}
@@ -22,6 +22,12 @@ import (
 type SSHExecutor struct {
 	Connection SSHConnection
 	Host       entity.Host
+	// sessions is set for pooled executors, to cap the sessions open at once on the connection.
+	sessions *sessionLimiter
+	// asRoot escalates commands with the become method of the host, see AsRoot.
+	asRoot bool
+	// pool is set for pooled executors, to redial a connection that died since it was last probed.
+	pool *SSHExecutorPool
 }
 
 func NewExecutor(host entity.Host) *SSHExecutor {
@@ -37,59 +43,191 @@ func NewSSHExecutor(connection SSHConnection) *SSHExecutor {
 	return &SSHExecutor{Connection: connection}
 }
 
-// ExecuteCommand executes a command over SSH.
+// AsRoot returns an executor on the same connection that runs commands as root, escalating them with
+// the become method of the host unless the SSH user is root already.
+func (executor *SSHExecutor) AsRoot() *SSHExecutor {
+	escalated := *executor
+	escalated.asRoot = true
+	return &escalated
+}
 
-func (executor *SSHExecutor) ExecuteShortCommand(command string) (string, error) {
-	session, err := executor.Connection.Client.NewSession()
+// escalation returns command as it has to run on the host.
+func (executor *SSHExecutor) escalation(command string) escalation {
+	if !executor.asRoot || executor.WhoAmI() == "root" {
+		return escalation{command: command}
+	}
+	return escalate(executor.Host.Become, executor.becomePassword(), command)
+}
+
+// becomePassword returns the password commands are escalated with, none when sudo does not ask for one.
+func (executor *SSHExecutor) becomePassword() string {
+	password := executor.Host.Become.Password
+	if password == "" {
+		password = executor.Host.Password
+	}
+	if password != "" && (executor.Host.Become.Method == "" || executor.Host.Become.Method == entity.BecomeSudo) && executor.sudoNoPassword() {
+		return ""
+	}
+	return password
+}
+
+// sudoNoPassword tells whether sudo runs commands without a password, probed with sudo -n true once
+// per connection. sudo -S would otherwise swallow the first line of input on NOPASSWD hosts.
+func (executor *SSHExecutor) sudoNoPassword() bool {
+	cache := executor.Connection.identity
+	if cache != nil {
+		cache.mutex.Lock()
+		defer cache.mutex.Unlock()
+		if cache.sudoProbed {
+			return cache.sudoNoPassword
+		}
+	}
+	plain := *executor
+	plain.asRoot = false
+	noPassword := plain.run(context.Background(), "sudo -n true", nil, io.Discard, io.Discard) == nil
+	if cache != nil {
+		cache.sudoProbed = true
+		cache.sudoNoPassword = noPassword
+	}
+	return noPassword
+}
+
+// startCommand starts command on session, escalated when the executor runs as root. session.Stdout and
+// session.Stderr have to be set before. input, if not nil, is the stdin of the command. A terminal is
+// allocated when pty is set or the become method prompts for the password, without output processing
+// so that the output keeps its line endings. The returned func waits for the command like session.Wait.
+func (executor *SSHExecutor) startCommand(session *ssh.Session, command string, input io.Reader, pty bool) (func() error, error) {
+	escalated := executor.escalation(command)
+	if pty || escalated.prompt {
+		if err := session.RequestPty("xterm", 40, 200, ssh.TerminalModes{ssh.ECHO: 0, ssh.OPOST: 0}); err != nil {
+			if escalated.prompt {
+				return nil, fmt.Errorf("Cannot request tty: %w", err)
+			}
+			logger.GetLogger().Warnf("Failed to allocate terminal: %v", err)
+		}
+	}
+	var responder *promptResponder
+	switch {
+	case escalated.prompt:
+		stdin, err := session.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		out := session.Stdout
+		if out == nil {
+			out = io.Discard
+		}
+		responder = &promptResponder{out: out, stdin: stdin, password: escalated.password, input: input}
+		session.Stdout = responder
+	case escalated.password != "":
+		if input == nil {
+			input = strings.NewReader("")
+		}
+		session.Stdin = io.MultiReader(strings.NewReader(escalated.password+"\n"), input)
+	case input != nil:
+		session.Stdin = input
+	}
+	if err := session.Start(escalated.command); err != nil {
+		return nil, err
+	}
+	return func() error {
+		err := session.Wait()
+		if err != nil && responder != nil {
+			if failure := responder.failure(); failure != "" {
+				return fmt.Errorf("%w: %s", err, failure)
+			}
+		}
+		return err
+	}, nil
+}
+
+// run runs command and writes its stdout and stderr to the given writers, which may be the same. When
+// ctx is done the remote process is signalled, and killed and closed after sessionKillGrace. No terminal
+// is allocated for that, it would merge stderr into stdout.
+func (executor *SSHExecutor) run(ctx context.Context, command string, input io.Reader, stdout, stderr io.Writer) error {
+	session, closeSession, err := executor.newSession()
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
-		return "", err
+		return err
+	}
+	defer closeSession()
+	if stdout != nil && stdout == stderr {
+		// The session copies stdout and stderr concurrently.
+		stdout = &lockedWriter{writer: stdout}
+		stderr = stdout
 	}
-	defer session.Close()
-	res, err := session.CombinedOutput(command)
+	session.Stdout = stdout
+	session.Stderr = stderr
+	wait, err := executor.startCommand(session, command, input, false)
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to execute command: %v, %s", err, res)
+		logger.GetLogger().Errorf("Failed to execute command: %v", err)
+		return err
+	}
+	stop := cancelSession(ctx, session)
+	err = wait()
+	stop()
+	if ctx.Err() != nil {
+		logger.GetLogger().Warnf("Command cancelled: %s", command)
+		return ctx.Err()
+	}
+	return err
+}
+
+// lockedWriter serializes the writes to writer.
+type lockedWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writer.Write(p)
+}
+
+func (executor *SSHExecutor) ExecuteShortCommand(command string) (string, error) {
+	return executor.ExecuteShortCommandContext(context.Background(), command)
+}
+
+// ExecuteShortCommandContext runs command and returns its combined output. When ctx is done the
+// remote process is signalled and ctx.Err() is returned.
+func (executor *SSHExecutor) ExecuteShortCommandContext(ctx context.Context, command string) (string, error) {
+	var res bytes.Buffer
+	err := executor.run(ctx, command, nil, &res, &res)
+	if err != nil {
+		if err != ctx.Err() {
+			logger.GetLogger().Errorf("Failed to execute command: %v, %s", err, res.String())
+		}
 		return "", err
 	}
-	return string(res), nil
+	return res.String(), nil
 }
 
 func (executor *SSHExecutor) QuickExecuteShortCommand(command string) {
-	session, err := executor.Connection.Client.NewSession()
+	session, closeSession, err := executor.newSession()
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
 		return
 	}
-	defer session.Close()
-	err = session.Start(command)
+	defer closeSession()
+	_, err = executor.startCommand(session, command, nil, false)
 	if err != nil {
 		return
 	}
 }
 
 func (executor *SSHExecutor) ExecuteShortCMD(command string) ([]byte, error) {
-	session, err := executor.Connection.Client.NewSession()
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
-		return nil, err
-	}
-	defer session.Close()
-	res, err := session.CombinedOutput(command)
+	var res bytes.Buffer
+	err := executor.run(context.Background(), command, nil, &res, &res)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to execute command: %v", err)
 		return nil, err
 	}
-	return res, nil
+	return res.Bytes(), nil
 }
 
 func (executor *SSHExecutor) ExecuteCommandWithoutReturn(command string) error {
-	session, err := executor.Connection.Client.NewSession()
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
-		return err
-	}
-	defer session.Close()
-	err = session.Run(command)
+	err := executor.run(context.Background(), command, nil, nil, nil)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to execute command: %v", err)
 		return err
@@ -98,13 +236,7 @@ func (executor *SSHExecutor) ExecuteCommandWithoutReturn(command string) error {
 }
 
 func (executor *SSHExecutor) ExecuteCMDWithoutReturn(command string, outputHandler func(string)) error {
-	session, err := executor.Connection.Client.NewSession()
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
-		return err
-	}
-	defer session.Close()
-	err = session.Run(command)
+	err := executor.run(context.Background(), command, nil, nil, nil)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to execute command: %v", err)
 		return err
@@ -113,43 +245,60 @@ func (executor *SSHExecutor) ExecuteCMDWithoutReturn(command string, outputHandl
 	return nil
 }
 
+// WhoAmI returns the SSH user as the host sees it. It is looked up once per connection.
 func (executor *SSHExecutor) WhoAmI() string {
-	command := fmt.Sprintf("whoami")
-	user, err := executor.ExecuteShortCommand(command)
+	cache := executor.Connection.identity
+	if cache != nil {
+		cache.mutex.Lock()
+		defer cache.mutex.Unlock()
+		if cache.user != "" {
+			return cache.user
+		}
+	}
+	plain := *executor
+	plain.asRoot = false
+	user, err := plain.ExecuteShortCommand("whoami")
 	if err != nil {
 		logger.GetLogger().Warnf("Read username failed: %v", err)
 		return ""
 	}
-	return strings.TrimSpace(user)
+	user = strings.TrimSpace(user)
+	if cache != nil {
+		cache.user = user
+	}
+	return user
 }
 
 func (executor *SSHExecutor) ExecuteCommand(command string, logChan chan LogEntry) error {
-	session, err := executor.Connection.Client.NewSession()
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
-		return err
-	}
-	defer session.Close()
-	//session.RequestPty("xterm", 80, 40, ssh.TerminalModes{})
+	return executor.ExecuteCommandContext(context.Background(), command, logChan)
+}
 
-	stdin, err := session.StdinPipe()
+// ExecuteCommandContext streams the output of command to logChan. When ctx is done the remote process
+// is signalled like with run.
+func (executor *SSHExecutor) ExecuteCommandContext(ctx context.Context, command string, logChan chan LogEntry) error {
+	session, closeSession, err := executor.newSession()
 	if err != nil {
-		logger.GetLogger().Errorf("Unable to setup stdin for session: %v", err)
+		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
 		return err
 	}
+	defer closeSession()
 
-	stdoutPipe, err := session.StdoutPipe()
-	if err != nil {
-		logger.GetLogger().Errorf("Unable to create stdout pipe: %v", err)
-		return err
-	}
-	stderrPipe, err := session.StderrPipe()
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create stderr pipe: %v", err)
-		return err
+	stdinPipe, stdin := io.Pipe()
+	defer stdin.Close()
+	stdoutPipe, stdoutWriter := io.Pipe()
+	stderrPipe, stderrWriter := io.Pipe()
+	session.Stdout = stdoutWriter
+	session.Stderr = stderrWriter
+	var scanners sync.WaitGroup
+	scanners.Add(2)
+	closeOutput := func() {
+		stdoutWriter.Close()
+		stderrWriter.Close()
+		scanners.Wait()
 	}
 
 	go func() {
+		defer scanners.Done()
 		defer func() {
 			if r := recover(); r != nil {
 				logger.GetLogger().Errorf("Recovered from panic in stderr pipe: %v", r)
@@ -158,7 +307,7 @@ func (executor *SSHExecutor) ExecuteCommand(command string, logChan chan LogEntr
 		scanner := bufio.NewScanner(stdoutPipe)
 		for scanner.Scan() {
 			go fmt.Fprintln(stdin, "yes\n")
-			text := scanner.Text()
+			text := strings.TrimRight(scanner.Text(), "\r")
 			if strings.Contains(text, "[yes/no]") {
 				continue
 			} else {
@@ -168,6 +317,7 @@ func (executor *SSHExecutor) ExecuteCommand(command string, logChan chan LogEntr
 	}()
 
 	go func() {
+		defer scanners.Done()
 		defer func() {
 			if r := recover(); r != nil {
 				logger.GetLogger().Errorf("Recovered from panic in stderr pipe: %v", r)
@@ -176,7 +326,7 @@ func (executor *SSHExecutor) ExecuteCommand(command string, logChan chan LogEntr
 		scanner := bufio.NewScanner(stderrPipe)
 		for scanner.Scan() {
 			go fmt.Fprintln(stdin, "yes\n")
-			text := scanner.Text()
+			text := strings.TrimRight(scanner.Text(), "\r")
 			if strings.Contains(text, "[yes/no]") {
 				continue
 			} else {
@@ -185,31 +335,40 @@ func (executor *SSHExecutor) ExecuteCommand(command string, logChan chan LogEntr
 		}
 	}()
 
-	err = session.Start(command)
+	wait, err := executor.startCommand(session, command, stdinPipe, false)
 	if err != nil {
-		logChan <- LogEntry{Message: "Pipeline Done", IsError: true}
+		closeOutput()
+		logChan <- LogEntry{Message: PipelineDone, IsError: true}
 		logger.GetLogger().Errorf("Failed to run SSH command: %v", err)
 		return err
 	}
 
-	err = session.Wait()
+	stop := cancelSession(ctx, session)
+	err = wait()
+	stop()
+	closeOutput()
+	if ctx.Err() != nil {
+		logger.GetLogger().Warnf("SSH command cancelled: %s", command)
+		logChan <- LogEntry{Message: PipelineDone, IsError: true}
+		return ctx.Err()
+	}
 	if err != nil {
 		logger.GetLogger().Errorf("SSH command execution failed: %v", err)
-		logChan <- LogEntry{Message: "Pipeline Done", IsError: true}
+		logChan <- LogEntry{Message: PipelineDone, IsError: true}
 		return err
 	}
-	logChan <- LogEntry{Message: "Pipeline Done", IsError: false}
+	logChan <- LogEntry{Message: PipelineDone, IsError: false}
 	return nil
 }
 
 func (executor *SSHExecutor) ExecuteCommandNew(command string, logChan chan LogEntry) error {
-	session, err := executor.Connection.Client.NewSession()
+	session, closeSession, err := executor.newSession()
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
 		logChan <- LogEntry{Message: "Pipeline Failed", IsError: true}
 		return err
 	}
-	defer session.Close()
+	defer closeSession()
 	//session.RequestPty("xterm", 80, 40, ssh.TerminalModes{})
 
 	stdin, err := session.StdinPipe()
@@ -318,41 +477,12 @@ func (executor *SSHExecutor) CopyMultiFile(files []entity.FileSrcDest, outputHan
 		wg.Add(1)
 		go func(file entity.FileSrcDest) {
 			defer wg.Done()
-			byteData, err := os.ReadFile(file.SrcFile)
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to open source file: %v", err)
-				results <- MachineResult{Machine: "", Success: false, Error: fmt.Sprintf("Failed to open source file: %v", err)}
-				return
-			}
-
-			fileName := filepath.Base(file.DestFile)
-			tempFile := fmt.Sprintf("/tmp/%s", fileName)
-
-			touchCommand := fmt.Sprintf("echo '%s' > %s", string(byteData), tempFile)
-			err = executor.ExecuteCommandWithoutReturn(touchCommand)
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to copy file to destination: %v", err)
-				return
-			}
-
-			command := fmt.Sprintf("cp -f %s %s", tempFile, file.DestFile)
-			if executor.WhoAmI() != "root" {
-				command = SudoPrefixWithPassword(command, executor.Host.Password)
-			}
-			err = executor.ExecuteCommandWithoutReturn(command)
-			if err != nil {
+			if err := executor.putLocalFile(context.Background(), file.SrcFile, file.DestFile); err != nil {
 				logger.GetLogger().Errorf("Failed to copy file to destination: %v", err)
 				results <- MachineResult{Machine: "", Success: false, Error: fmt.Sprintf("Failed to copy file to destination: %v", err)}
 				return
 			}
 
-			rmCommand := fmt.Sprintf("rm -f %s", tempFile)
-			err = executor.ExecuteCommandWithoutReturn(rmCommand)
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to delete temp file: %v", err)
-				return
-			}
-
 			results <- MachineResult{Machine: "", Success: true, Error: ""}
 			outputHandler(fmt.Sprintf("Copied file %s to %s", file.SrcFile, file.DestFile))
 			return
@@ -384,52 +514,44 @@ func (executor *SSHExecutor) CopyMultiFile(files []entity.FileSrcDest, outputHan
 	return &copyResult
 }
 
-// CopyFile copies a file over SSH using SCP.
+// CopyFile copies a local file to destFile on the host, keeping its mode.
 func (executor *SSHExecutor) CopyFile(srcFile, destFile string, outputHandler func(string)) error {
-	byteData, err := os.ReadFile(srcFile)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to open source file: %v", err)
-		return err
-	}
-
-	fileName := filepath.Base(destFile)
-	tempFile := fmt.Sprintf("/tmp/%s", fileName)
+	return executor.CopyFileContext(context.Background(), srcFile, destFile, outputHandler)
+}
 
-	touchCommand := fmt.Sprintf("echo '%s' > %s", string(byteData), tempFile)
-	err = executor.ExecuteCommandWithoutReturn(touchCommand)
-	if err != nil {
+// CopyFileContext is CopyFile, stopping the transfer when ctx is done.
+func (executor *SSHExecutor) CopyFileContext(ctx context.Context, srcFile, destFile string, outputHandler func(string)) error {
+	if err := executor.putLocalFile(ctx, srcFile, destFile); err != nil {
 		logger.GetLogger().Errorf("Failed to copy file to destination: %v", err)
 		return err
 	}
+	outputHandler(fmt.Sprintf("Copied file %s to %s", srcFile, destFile))
+	return nil
+}
 
-	command := fmt.Sprintf("cp -f %s %s", tempFile, destFile)
-	if executor.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, executor.Host.Password)
-	}
-	err = executor.ExecuteCommandWithoutReturn(command)
+func (executor *SSHExecutor) putLocalFile(ctx context.Context, srcFile, destFile string) error {
+	src, err := os.Open(srcFile)
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to copy file to destination: %v", err)
+		logger.GetLogger().Errorf("Failed to open source file: %v", err)
 		return err
 	}
-
-	rmCommand := fmt.Sprintf("rm -f %s", tempFile)
-	err = executor.ExecuteCommandWithoutReturn(rmCommand)
+	defer src.Close()
+	info, err := src.Stat()
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to delete temp file: %v", err)
 		return err
 	}
-
-	outputHandler(fmt.Sprintf("Copied file %s to %s", srcFile, destFile))
-	return nil
+	return executor.PutFile(ctx, src, RemoteFile{Path: destFile, Mode: info.Mode()})
 }
 
 func (executor *SSHExecutor) MkDirALL(path string, outputHandler func(string)) error {
 	path = filepath.ToSlash(path)
 	command := fmt.Sprintf("mkdir -p %s", path)
-	if executor.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, executor.Host.Password)
+	// Directories in the home of the SSH user are created as that user.
+	mkdir := executor.AsRoot()
+	if strings.HasPrefix(path, "~") {
+		mkdir = executor
 	}
-	err := executor.ExecuteCommandWithoutReturn(command)
+	err := mkdir.ExecuteCommandWithoutReturn(command)
 	if err != nil {
 		errMsg := fmt.Sprintf("Failed to create directory '%s' on remote host: %v", path, err)
 		logger.GetLogger().Errorf("%s: %v", errMsg, err)
@@ -441,8 +563,13 @@ func (executor *SSHExecutor) MkDirALL(path string, outputHandler func(string)) e
 }
 
 func (executor *SSHExecutor) AddHosts(record entity.Record, outputHandler func(string)) error {
+	return executor.AddHostsContext(context.Background(), record, outputHandler)
+}
+
+// AddHostsContext is AddHosts, cancelling the commands when ctx is done.
+func (executor *SSHExecutor) AddHostsContext(ctx context.Context, record entity.Record, outputHandler func(string)) error {
 	getHostContentCMD := "cat /etc/hosts"
-	hostContent, err := executor.ExecuteShortCommand(getHostContentCMD)
+	hostContent, err := executor.ExecuteShortCommandContext(ctx, getHostContentCMD)
 	if err != nil {
 		errMsg := fmt.Errorf("failed to read /etc/hosts: %w", err)
 		log.Println("%s: %v", errMsg, err)
@@ -452,15 +579,12 @@ func (executor *SSHExecutor) AddHosts(record entity.Record, outputHandler func(s
 		cmdUpdate := fmt.Sprintf(`
 		#!/bin/bash
         # Remove all lines containing the hostname
-        sudo sed -i "/^.* %s$/d" /etc/hosts
+        sed -i "/^.* %s$/d" /etc/hosts
         # Add new entry
-        echo "%s %s" | sudo tee -a /etc/hosts > /dev/null
+        echo "%s %s" | tee -a /etc/hosts > /dev/null
     `, record.Domain, record.IP, record.Domain)
 		cmdUpdate = fmt.Sprintf("bash -c '%s'", cmdUpdate)
-		if executor.WhoAmI() != "root" {
-			cmdUpdate = SudoPrefixWithPassword(cmdUpdate, executor.Host.Password)
-		}
-		_, err = executor.ExecuteShortCommand(cmdUpdate)
+		_, err = executor.AsRoot().ExecuteShortCommandContext(ctx, cmdUpdate)
 		if err != nil {
 			logger.GetLogger().Errorf("failed to update /etc/hosts: %v", err)
 			return fmt.Errorf("failed to update /etc/hosts: %w", err)
@@ -469,10 +593,7 @@ func (executor *SSHExecutor) AddHosts(record entity.Record, outputHandler func(s
 		fmt.Printf("Updated %s to IP %s\n", record.Domain, record.IP)
 	} else {
 		cmdAdd := fmt.Sprintf(`bash -c 'echo "%s %s" >> /etc/hosts'`, record.IP, record.Domain)
-		if executor.WhoAmI() != "root" {
-			cmdAdd = SudoPrefixWithPassword(cmdAdd, executor.Host.Password)
-		}
-		_, err = executor.ExecuteShortCommand(cmdAdd)
+		_, err = executor.AsRoot().ExecuteShortCommandContext(ctx, cmdAdd)
 		if err != nil {
 			logger.GetLogger().Errorf("failed to add to /etc/hosts: %v", err)
 			return fmt.Errorf("failed to add to /etc/hosts: %w", err)
@@ -521,10 +642,7 @@ func (executor *SSHExecutor) AddMultiHosts(records []entity.Record, outputHandle
 		return fmt.Errorf("Failed to write to temporary file: %w", err)
 	}
 	cmd := fmt.Sprintf("cp %s /etc/hosts", tmpFile)
-	if executor.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, executor.Host.Password)
-	}
-	_, err = executor.ExecuteShortCommand(cmd)
+	_, err = executor.AsRoot().ExecuteShortCommand(cmd)
 	if err != nil {
 		logger.GetLogger().Errorf("failed to add to /etc/hosts: %v", err)
 		return fmt.Errorf("failed to add to /etc/hosts: %w", err)
@@ -561,11 +679,8 @@ func (executor *SSHExecutor) UpdateHostsFile(ip string, domain string) error {
 	}
 
 	// 写入更新后的内容
-	command := fmt.Sprintf("bash -c \"echo -n '%s' | sudo tee /etc/hosts\"", strings.Join(updatedLines, "\n"))
-	if executor.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, executor.Host.Password)
-	}
-	_, err = executor.ExecuteShortCommand(command)
+	command := fmt.Sprintf("bash -c \"echo -n '%s' | tee /etc/hosts\"", strings.Join(updatedLines, "\n"))
+	_, err = executor.AsRoot().ExecuteShortCommand(command)
 	if err != nil {
 		logger.GetLogger().Errorf("写入 /etc/hosts 出错: %v", err)
 		return fmt.Errorf("写入 /etc/hosts 出错: %w", err)
@@ -592,11 +707,8 @@ func (executor *SSHExecutor) UpdateResolvFile(ip string) error {
 	}
 
 	if !ipExists {
-		command := fmt.Sprintf("bash -c \" echo -n 'nameserver %s\n' | sudo tee -a /etc/resolv.conf\"", ip)
-		if executor.WhoAmI() != "root" {
-			command = SudoPrefixWithPassword(command, executor.Host.Password)
-		}
-		_, err = executor.ExecuteShortCommand(command)
+		command := fmt.Sprintf("bash -c \" echo -n 'nameserver %s\n' | tee -a /etc/resolv.conf\"", ip)
+		_, err = executor.AsRoot().ExecuteShortCommand(command)
 		if err != nil {
 			logger.GetLogger().Errorf("追加到 /etc/resolv.conf 出错: %v", err)
 			return fmt.Errorf("追加到 /etc/resolv.conf 出错: %w", err)
@@ -609,12 +721,17 @@ func (executor *SSHExecutor) UpdateResolvFile(ip string) error {
 }
 
 func (executor *SSHExecutor) ChangeExpiredPassword(currentPassword, newPassword string) error {
-	session, err := executor.Connection.Client.NewSession()
+	return executor.ChangeExpiredPasswordContext(context.Background(), currentPassword, newPassword)
+}
+
+// ChangeExpiredPasswordContext is ChangeExpiredPassword, giving up when ctx is done.
+func (executor *SSHExecutor) ChangeExpiredPasswordContext(ctx context.Context, currentPassword, newPassword string) error {
+	session, closeSession, err := executor.newSession()
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
 		return err
 	}
-	defer session.Close()
+	defer closeSession()
 
 	stdin, err := session.StdinPipe()
 	if err != nil {
@@ -643,7 +760,7 @@ func (executor *SSHExecutor) ChangeExpiredPassword(currentPassword, newPassword
 		return fmt.Errorf("Cannot start shell: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second) // 设置超时为30秒
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second) // 设置超时为30秒
 	defer cancel()
 
 	// 创建一个通道用于接收扫描结果
@@ -693,6 +810,7 @@ func (executor *SSHExecutor) ChangeExpiredPassword(currentPassword, newPassword
 		if ctx.Err() == context.DeadlineExceeded {
 			return fmt.Errorf("timeout: No password expiration warning detected.")
 		}
+		return ctx.Err()
 	}
 
 	return nil
@@ -700,21 +818,17 @@ func (executor *SSHExecutor) ChangeExpiredPassword(currentPassword, newPassword
 
 // CheckPasswordInfo 获取用户的密码信息
 func (executor *SSHExecutor) CheckPasswordInfo() (*entity.PasswordInfo, error) {
-	session, err := executor.Connection.Client.NewSession()
-	if err != nil {
-		return &entity.PasswordInfo{}, fmt.Errorf("failed to create SSH session: %w", err)
-	}
-	defer session.Close()
+	return executor.CheckPasswordInfoContext(context.Background())
+}
 
+// CheckPasswordInfoContext is CheckPasswordInfo, cancelling chage when ctx is done.
+func (executor *SSHExecutor) CheckPasswordInfoContext(ctx context.Context) (*entity.PasswordInfo, error) {
+	var res bytes.Buffer
 	command := fmt.Sprintf("chage -l %s", executor.Host.User)
-	if executor.WhoAmI() != "root" {
-		command = SudoPrefixWithPassword(command, executor.Host.Password)
-	}
-
-	output, err := session.CombinedOutput(command)
-	if err != nil {
-		return &entity.PasswordInfo{}, fmt.Errorf("failed to execute command: %w, %s", err, string(output))
+	if err := executor.AsRoot().run(ctx, command, nil, &res, &res); err != nil {
+		return &entity.PasswordInfo{}, fmt.Errorf("failed to execute command: %w, %s", err, res.String())
 	}
+	output := res.Bytes()
 
 	info := &entity.PasswordInfo{}
 	scanner := bufio.NewScanner(bytes.NewReader(output))
@@ -769,26 +883,16 @@ func (executor *SSHExecutor) CheckPasswordInfo() (*entity.PasswordInfo, error) {
 
 // UpdatePassword 修改用户密码
 func (executor *SSHExecutor) UpdatePassword(currentPassword, newPassword string) error {
-	session, err := executor.Connection.Client.NewSession()
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create SSH session: %s", err.Error())
-		return err
-	}
-	defer session.Close()
-
-	command := ""
-	if executor.WhoAmI() == "root" {
-		command = fmt.Sprintf("echo '%s:%s' | chpasswd", "root", newPassword)
-	} else {
-		command = fmt.Sprintf("bash -c \"echo '%s:%s' | sudo chpasswd\"", executor.Host.User, newPassword)
-		command = SudoPrefixWithPassword(command, executor.Host.Password)
-	}
+	return executor.UpdatePasswordContext(context.Background(), currentPassword, newPassword)
+}
 
-	output, err := session.CombinedOutput(command)
-	if err != nil {
-		return fmt.Errorf("failed to change password: %w, output: %s", err, output)
+// UpdatePasswordContext is UpdatePassword, cancelling chpasswd when ctx is done.
+func (executor *SSHExecutor) UpdatePasswordContext(ctx context.Context, currentPassword, newPassword string) error {
+	var output bytes.Buffer
+	input := strings.NewReader(fmt.Sprintf("%s:%s\n", executor.WhoAmI(), newPassword))
+	if err := executor.AsRoot().run(ctx, "chpasswd", input, &output, &output); err != nil {
+		return fmt.Errorf("failed to change password: %w, output: %s", err, output.String())
 	}
-
 	return nil
 }
 
@@ -803,24 +907,11 @@ func (executor *SSHExecutor) ReadFile(path string) ([]byte, error) {
 }
 
 func (executor *SSHExecutor) WriteFile(content []byte, path string, perm os.FileMode) error {
-	cmd := fmt.Sprintf("bash -c \"echo -e '%s' > %s\"", content, path)
-	if executor.WhoAmI() != "root" {
-		cmd = SudoPrefixWithPassword(cmd, executor.Host.Password)
-	}
-	err := executor.ExecuteCommandWithoutReturn(cmd)
+	err := executor.PutFile(context.Background(), bytes.NewReader(content), RemoteFile{Path: path, Mode: perm})
 	if err != nil {
 		logger.GetLogger().Errorf("Write %s failed: %v", path, err)
 		return err
 	}
-	chmodCommand := fmt.Sprintf("bash -c \"chmod %s %s\"", perm, path)
-	if executor.WhoAmI() != "root" {
-		chmodCommand = SudoPrefixWithPassword(chmodCommand, executor.Host.Password)
-	}
-	err = executor.ExecuteCommandWithoutReturn(chmodCommand)
-	if err != nil {
-		logger.GetLogger().Errorf("Chmod %s failed: %v", path, err)
-		return err
-	}
 	return nil
 }
 
@@ -857,34 +948,30 @@ func (executor *SSHExecutor) SetupPasswordLessLogin(pubkey string) error {
 }
 
 func (executor *SSHExecutor) DirIsExist(path string) bool {
-	cmd := fmt.Sprintf("test -d %s && echo 'exists' || echo 'not exists'", path)
-	output, err := executor.ExecuteShortCommand(cmd)
+	result, err := executor.Run(fmt.Sprintf("test -d %s", path))
 	if err != nil {
+		logger.GetLogger().Errorf("Failed to check %s: %v", path, err)
 		return false
-	} else if string(output) == "exists\n" {
-		return true
 	}
-	return false
+	return result.ExitCode == 0
 }
 
 func (executor *SSHExecutor) FileIsExists(path string) bool {
-	cmd := fmt.Sprintf("test -f %s && echo 'exists' || echo 'not exists'", path)
-	output, err := executor.ExecuteShortCommand(cmd)
+	result, err := executor.Run(fmt.Sprintf("test -f %s", path))
 	if err != nil {
+		logger.GetLogger().Errorf("Failed to check %s: %v", path, err)
 		return false
-	} else if string(output) == "exists\n" {
-		return true
 	}
-	return false
+	return result.ExitCode == 0
 }
 
 func (executor *SSHExecutor) FetchFile(path string, local string, perm os.FileMode) error {
-	sftpClient, err := sftp.NewClient(executor.Connection.Client)
+	sftpClient, closeSFTP, err := executor.newSFTPClient()
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to create SFTP client: %v", err)
 		return fmt.Errorf("Failed to create SFTP client: %w", err)
 	}
-	defer sftpClient.Close()
+	defer closeSFTP()
 
 	remoteFile, err := sftpClient.Open(path)
 	if err != nil {
@@ -931,15 +1018,14 @@ func (executor *SSHExecutor) FetchFile(path string, local string, perm os.FileMo
 }
 
 func (executor *SSHExecutor) Upload(localFile, remoteFile string) error {
+	return executor.UploadContext(context.Background(), localFile, remoteFile)
+}
 
-	sftpClient, err := sftp.NewClient(executor.Connection.Client)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create SFTP client: %v", err)
-		return fmt.Errorf("Failed to create SFTP client: %w", err)
-	}
-	defer sftpClient.Close()
+// UploadContext is Upload, stopping the transfer when ctx is done.
+func (executor *SSHExecutor) UploadContext(ctx context.Context, localFile, remoteFile string) error {
+	isRoot := executor.WhoAmI() == "root"
 	var tempPath string
-	if executor.WhoAmI() != "root" {
+	if !isRoot {
 		tempPath = filepath.Join("/tmp/", filepath.Base(localFile))
 		tempPath = filepath.ToSlash(tempPath)
 	} else {
@@ -953,22 +1039,34 @@ func (executor *SSHExecutor) Upload(localFile, remoteFile string) error {
 	}
 	defer srcFile.Close()
 
-	destFile, err := sftpClient.Create(tempPath)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create remote file %s: %v", tempPath, err)
-		return fmt.Errorf("failed to create remote file %s: %w", tempPath, err)
-	}
-	defer destFile.Close()
+	// The SFTP session is closed before the copy below opens another one.
+	err = func() error {
+		sftpClient, closeSFTP, err := executor.newSFTPClient()
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to create SFTP client: %v", err)
+			return fmt.Errorf("Failed to create SFTP client: %w", err)
+		}
+		defer closeSFTP()
+		destFile, err := sftpClient.Create(tempPath)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to create remote file %s: %v", tempPath, err)
+			return fmt.Errorf("failed to create remote file %s: %w", tempPath, err)
+		}
+		defer destFile.Close()
 
-	if _, err := io.Copy(destFile, srcFile); err != nil {
-		logger.GetLogger().Errorf("Failed to copy file %s to %s: %v", srcFile, destFile, err)
-		return fmt.Errorf("Failed to copy file %s to %s: %w", srcFile, destFile, err)
+		if _, err := io.Copy(destFile, contextReader{ctx: ctx, reader: srcFile}); err != nil {
+			logger.GetLogger().Errorf("Failed to copy file %s to %s: %v", srcFile, destFile, err)
+			return fmt.Errorf("Failed to copy file %s to %s: %w", srcFile, destFile, err)
+		}
+		return nil
+	}()
+	if err != nil {
+		return err
 	}
 
-	if executor.WhoAmI() != "root" {
+	if !isRoot {
 		command := fmt.Sprintf("cp -f %s %s", tempPath, remoteFile)
-		command = SudoPrefixWithPassword(command, executor.Host.Password)
-		err := executor.ExecuteCommandWithoutReturn(command)
+		err := executor.AsRoot().ExecuteCommandWithoutReturn(command)
 		if err != nil {
 			logger.GetLogger().Errorf("Failed to copy %s to %s: %w", tempPath, remoteFile, err)
 			return fmt.Errorf("Failed to copy %s to %s: %w", tempPath, remoteFile, err)
@@ -979,17 +1077,16 @@ func (executor *SSHExecutor) Upload(localFile, remoteFile string) error {
 }
 
 func (executor *SSHExecutor) Download(remoteFile, localFile string) error {
-	sftpClient, err := sftp.NewClient(executor.Connection.Client)
-	if err != nil {
-		logger.GetLogger().Errorf("Failed to create SFTP client: %v", err)
-		return fmt.Errorf("Failed to create SFTP client: %w", err)
-	}
+	return executor.DownloadContext(context.Background(), remoteFile, localFile)
+}
+
+// DownloadContext is Download, stopping the transfer when ctx is done.
+func (executor *SSHExecutor) DownloadContext(ctx context.Context, remoteFile, localFile string) error {
 	var tempPath string
 	if executor.WhoAmI() != "root" {
 		tempPath = filepath.Join("/tmp/", filepath.Base(remoteFile))
 		command := fmt.Sprintf("cp -f %s %s", remoteFile, tempPath)
-		command = SudoPrefixWithPassword(command, executor.Host.Password)
-		err := executor.ExecuteCommandWithoutReturn(command)
+		err := executor.AsRoot().ExecuteCommandWithoutReturn(command)
 		if err != nil {
 			logger.GetLogger().Errorf("Failed to copy %s to %s: %v", remoteFile, tempPath, err)
 			return fmt.Errorf("Failed to copy %s to %s: %w", remoteFile, tempPath, err)
@@ -997,6 +1094,12 @@ func (executor *SSHExecutor) Download(remoteFile, localFile string) error {
 	} else {
 		tempPath = remoteFile
 	}
+	sftpClient, closeSFTP, err := executor.newSFTPClient()
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to create SFTP client: %v", err)
+		return fmt.Errorf("Failed to create SFTP client: %w", err)
+	}
+	defer closeSFTP()
 	srcFile, err := sftpClient.Open(remoteFile)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to open remote file %s: %v", tempPath, err)
@@ -1011,7 +1114,7 @@ func (executor *SSHExecutor) Download(remoteFile, localFile string) error {
 	}
 	defer destFile.Close()
 
-	if _, err := io.Copy(destFile, srcFile); err != nil {
+	if _, err := io.Copy(destFile, contextReader{ctx: ctx, reader: srcFile}); err != nil {
 		logger.GetLogger().Errorf("Failed to copy file %s to %s: %v", srcFile, destFile, err)
 		return fmt.Errorf("Failed to copy file %s to %s: %w", srcFile, destFile, err)
 	}
@@ -1019,3 +1122,104 @@ func (executor *SSHExecutor) Download(remoteFile, localFile string) error {
 	logger.GetLogger().Infof("Successfully to download file %s to %s", remoteFile, localFile)
 	return nil
 }
+
+// newSession opens a session, waiting for a free slot first when the executor is pooled.
+// The returned func closes the session and frees the slot.
+func (executor *SSHExecutor) newSession() (*ssh.Session, func(), error) {
+	var session *ssh.Session
+	release, err := executor.open(func(client *ssh.Client) (err error) {
+		session, err = client.NewSession()
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, func() {
+		session.Close()
+		release()
+	}, nil
+}
+
+// newSFTPClient is newSession for the SFTP subsystem.
+func (executor *SSHExecutor) newSFTPClient() (*sftp.Client, func(), error) {
+	var sftpClient *sftp.Client
+	release, err := executor.open(func(client *ssh.Client) (err error) {
+		sftpClient, err = sftp.NewClient(client)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return sftpClient, func() {
+		sftpClient.Close()
+		release()
+	}, nil
+}
+
+// open runs open on the connection of the executor in a session slot, which the returned func
+// frees. When that fails on a pooled connection, the connection is redialled once, it may have
+// died since it was last probed.
+func (executor *SSHExecutor) open(open func(client *ssh.Client) error) (func(), error) {
+	if executor.asRoot && executor.WhoAmI() != "root" {
+		// whoami and the sudo probe take slots of their own, so they are cached before this one is taken.
+		executor.becomePassword()
+	}
+	release := executor.sessions.acquire()
+	err := open(executor.Connection.Client)
+	if err == nil {
+		return release, nil
+	}
+	release()
+	if executor.pool == nil {
+		return nil, err
+	}
+	pooled, redialErr := executor.pool.redial(executor.Host, executor.Connection.Client)
+	if redialErr != nil {
+		logger.GetLogger().Warnf("Failed to redial %s after %v: %v", executor.Host.Address, err, redialErr)
+		return nil, err
+	}
+	release = pooled.sessions.acquire()
+	if err := open(pooled.Connection.Client); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// sessionKillGrace is how long a cancelled remote process may take to exit after SIGTERM.
+const sessionKillGrace = 5 * time.Second
+
+// cancelSession signals the process of session once ctx is done, killing it and closing the
+// session if it is still running after sessionKillGrace. The returned func stops watching ctx.
+func cancelSession(ctx context.Context, session *ssh.Session) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Signal(ssh.SIGTERM)
+			select {
+			case <-done:
+			case <-time.After(sessionKillGrace):
+				session.Signal(ssh.SIGKILL)
+				session.Close()
+			}
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// contextReader fails reads once ctx is done, which stops an io.Copy in progress.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
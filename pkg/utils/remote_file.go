@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// RemoteFile describes where and how PutFile writes a file.
+type RemoteFile struct {
+	// Path is the destination. A leading ~/ is the home directory of the SSH user.
+	Path string
+	Mode os.FileMode
+	// Owner is passed to chown, e.g. "root:root". Empty leaves the owner to whoever moves the file into place.
+	Owner string
+	// Backup copies the previous file to Path.bak before it is replaced.
+	Backup bool
+}
+
+// PutFile streams content over SFTP to a staging file and moves it into place atomically, as root
+// unless the destination is in the home directory of the SSH user. The
+// sha256 of the written file is compared with the one of content.
+func (executor *SSHExecutor) PutFile(ctx context.Context, content io.Reader, file RemoteFile) error {
+	suffix, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	staged := fmt.Sprintf("/tmp/.mykubespray-%s", suffix)
+	home, sum, err := executor.stageFile(ctx, content, staged)
+	defer executor.ExecuteShortCommand(fmt.Sprintf("rm -f %s", shellQuote(staged)))
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to upload %s: %v", file.Path, err)
+		return fmt.Errorf("Failed to upload %s: %w", file.Path, err)
+	}
+	dest := file.Path
+	if strings.HasPrefix(dest, "~/") {
+		dest = path.Join(home, dest[2:])
+	}
+
+	mover := executor
+	if !strings.HasPrefix(dest, home+"/") {
+		mover = executor.AsRoot()
+	}
+	run := func(command string) (string, error) {
+		return mover.ExecuteShortCommandContext(ctx, command)
+	}
+
+	dir, name := path.Split(dest)
+	temp := path.Join(dir, fmt.Sprintf(".%s.%s", name, suffix))
+	steps := []string{
+		fmt.Sprintf("mkdir -p %s", shellQuote(dir)),
+		fmt.Sprintf("cp %s %s", shellQuote(staged), shellQuote(temp)),
+		fmt.Sprintf("chmod %o %s", file.Mode.Perm(), shellQuote(temp)),
+	}
+	if file.Owner != "" {
+		steps = append(steps, fmt.Sprintf("chown %s %s", shellQuote(file.Owner), shellQuote(temp)))
+	}
+	if file.Backup {
+		steps = append(steps, fmt.Sprintf("if [ -e %[1]s ]; then cp -p %[1]s %[2]s; fi", shellQuote(dest), shellQuote(dest+".bak")))
+	}
+	steps = append(steps, fmt.Sprintf("mv -f %s %s", shellQuote(temp), shellQuote(dest)))
+	script := strings.Join(steps, " && ")
+	if output, err := run(fmt.Sprintf("bash -c %s", shellQuote(script))); err != nil {
+		run(fmt.Sprintf("rm -f %s", shellQuote(temp)))
+		logger.GetLogger().Errorf("Failed to move %s into place: %v, %s", dest, err, output)
+		return fmt.Errorf("Failed to move %s into place: %w", dest, err)
+	}
+
+	output, err := run(fmt.Sprintf("sha256sum %s", shellQuote(dest)))
+	if err != nil {
+		return fmt.Errorf("Failed to checksum %s: %w", dest, err)
+	}
+	if fields := strings.Fields(output); len(fields) == 0 || fields[0] != sum {
+		logger.GetLogger().Errorf("Checksum mismatch for %s: expected %s, got %s", dest, sum, strings.TrimSpace(output))
+		return fmt.Errorf("checksum mismatch for %s", dest)
+	}
+	logger.GetLogger().Infof("Successfully wrote %s", dest)
+	return nil
+}
+
+// stageFile writes content to staged, readable only by the SSH user, and returns the home directory
+// of the user and the sha256 of content. The SFTP session is closed before it returns, so that it
+// does not hold a session slot while the file is moved.
+func (executor *SSHExecutor) stageFile(ctx context.Context, content io.Reader, staged string) (string, string, error) {
+	sftpClient, closeSFTP, err := executor.newSFTPClient()
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to create SFTP client: %w", err)
+	}
+	defer closeSFTP()
+	home, err := sftpClient.Getwd()
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get home directory: %w", err)
+	}
+	stagedFile, err := sftpClient.OpenFile(staged, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to create staging file %s: %w", staged, err)
+	}
+	if err := stagedFile.Chmod(0600); err != nil {
+		stagedFile.Close()
+		return "", "", fmt.Errorf("Failed to chmod staging file %s: %w", staged, err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(stagedFile, io.TeeReader(contextReader{ctx: ctx, reader: content}, hash))
+	if closeErr := stagedFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return home, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func randomSuffix() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
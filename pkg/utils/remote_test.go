@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils/sshtest"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	ConfigureHostKeys(entity.HostKeyModeInsecure, "", nil)
+}
+
+// connect returns an executor connected to host, closed when the test ends.
+func connect(t *testing.T, host entity.Host) *SSHExecutor {
+	t.Helper()
+	connection, err := NewConnection(host)
+	if err != nil {
+		t.Fatalf("Failed to connect to %s: %v", host.Address, err)
+	}
+	t.Cleanup(func() { connection.Client.Close() })
+	return &SSHExecutor{Connection: *connection, Host: host}
+}
+
+func TestPasswordLogin(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+
+	executor := connect(t, server.Host("deploy", "secret"))
+	if user := executor.WhoAmI(); user != "deploy" {
+		t.Errorf("Expected to log in as deploy, got %q", user)
+	}
+
+	if _, err := NewConnection(server.Host("deploy", "wrong")); err == nil {
+		t.Errorf("Expected login with a wrong password to fail")
+	}
+}
+
+func TestPrivateKeyLogin(t *testing.T) {
+	server := sshtest.NewServer(t)
+	host := server.Host("deploy", "")
+	host.PrivateKey = server.AuthorizeKey("deploy")
+
+	executor := connect(t, host)
+	if user := executor.WhoAmI(); user != "deploy" {
+		t.Errorf("Expected to log in as deploy, got %q", user)
+	}
+
+	other := sshtest.NewServer(t)
+	host = other.Host("deploy", "")
+	host.PrivateKey = server.AuthorizeKey("deploy")
+	if _, err := NewConnection(host); err == nil {
+		t.Errorf("Expected login with an unknown key to fail")
+	}
+}
+
+func TestRunReportsExitCode(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.Respond(`cat /etc/os-release`, sshtest.Response{Stdout: "ID=rocky\n"})
+	server.Respond(`cat /missing`, sshtest.Response{Stderr: "cat: /missing: No such file or directory\n", ExitCode: 1})
+	server.Respond(`test -d /etc`, sshtest.Response{})
+	server.Respond(`test -d .*`, sshtest.Response{ExitCode: 1})
+	executor := connect(t, server.Host("deploy", "secret"))
+
+	result, err := executor.Run("cat /missing")
+	if err != nil {
+		t.Fatalf("Expected the command to run, got %v", err)
+	}
+	if result.ExitCode != 1 || !strings.Contains(result.Stderr, "No such file") || result.Stdout != "" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	if output, err := executor.Output("cat /etc/os-release"); err != nil || output != "ID=rocky\n" {
+		t.Errorf("Expected the os-release, got %q, %v", output, err)
+	}
+	_, err = executor.Output("cat /missing")
+	var commandErr *CommandError
+	if !errors.As(err, &commandErr) || commandErr.Result.ExitCode != 1 {
+		t.Errorf("Expected a CommandError with exit status 1, got %v", err)
+	}
+
+	result, err = executor.Run("systemctl restart kubelet")
+	if err != nil || result.ExitCode != 127 {
+		t.Errorf("Expected exit status 127 for an unknown command, got %+v, %v", result, err)
+	}
+
+	if !executor.DirIsExist("/etc") {
+		t.Errorf("Expected /etc to exist")
+	}
+	if executor.DirIsExist("/nonexistent") {
+		t.Errorf("Expected /nonexistent not to exist")
+	}
+}
+
+func TestCancelledCommandIsSignalled(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.Respond(`sleep 600`, sshtest.Response{Delay: time.Minute})
+	executor := connect(t, server.Host("deploy", "secret"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := executor.ExecuteShortCommandContext(ctx, "sleep 600"); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the deadline to be reported, got %v", err)
+	}
+	execs := server.Execs()
+	if len(execs) != 1 || execs[0].Pty || execs[0].Signal != "TERM" {
+		t.Errorf("Expected the command to run without a terminal and be terminated, got %+v", execs)
+	}
+}
+
+func TestCancellableRunKeepsStreamsApart(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.Respond(`hostname`, sshtest.Response{Stdout: "node1\n", Stderr: "sudo: unable to resolve host node1\n"})
+	host := server.Host("deploy", "secret")
+	pool := NewSSHExecutorPool()
+	defer pool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := pool.ExecuteCommandParallel(ctx, "hostname", []entity.Host{host}, FanOutOptions{})
+	if len(result.Results) != 1 || result.Results[0].Result == nil {
+		t.Fatalf("Expected a command result, got %+v", result)
+	}
+	if got := result.Results[0].Result; got.Stdout != "node1\n" || got.Stderr != "sudo: unable to resolve host node1\n" {
+		t.Errorf("Expected stdout and stderr apart, got %q and %q", got.Stdout, got.Stderr)
+	}
+}
+
+func TestAsRootWithSudoPassword(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.AllowSudo("deploy", "secret")
+	server.Respond(`systemctl is-active kubelet`, sshtest.Response{Stdout: "active\n"})
+	client := &OSClient{SSExecutor: *connect(t, server.Host("deploy", "secret"))}
+
+	if !client.StatusService("kubelet") {
+		t.Errorf("Expected kubelet to be active")
+	}
+	if user, err := client.SSExecutor.AsRoot().Output("whoami"); err != nil || user != "root\n" {
+		t.Errorf("Expected to run as root, got %q, %v", user, err)
+	}
+
+	execs := server.Execs()
+	last := execs[len(execs)-1]
+	if !last.Sudo || last.Run != "whoami" {
+		t.Errorf("Expected whoami to run through sudo, got %+v", last)
+	}
+	for _, exec := range execs {
+		if strings.Contains(exec.Command, "secret") {
+			t.Errorf("The sudo password is part of the command %q", exec.Command)
+		}
+	}
+}
+
+func TestAsRootWithSudoNoPassword(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.AllowSudo("deploy", "")
+	host := server.Host("deploy", "secret")
+	host.Become = entity.Become{Method: entity.BecomeSudoNoPassword}
+	executor := connect(t, host).AsRoot()
+
+	if user, err := executor.Output("whoami"); err != nil || user != "root\n" {
+		t.Errorf("Expected to run as root, got %q, %v", user, err)
+	}
+	execs := server.Execs()
+	if last := execs[len(execs)-1]; !strings.HasPrefix(last.Command, "sudo -n ") {
+		t.Errorf("Expected sudo not to prompt, got %q", last.Command)
+	}
+
+	server.AllowSudo("deploy", "secret")
+	result, err := executor.Run("whoami")
+	if err != nil || result.ExitCode != 1 || !strings.Contains(result.Stderr, "a password is required") {
+		t.Errorf("Expected sudo to require a password, got %+v, %v", result, err)
+	}
+}
+
+func TestUpdatePasswordWithSudoNoPassword(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.AllowSudo("deploy", "")
+	server.Respond(`chpasswd`, sshtest.Response{ReadStdin: true})
+	executor := connect(t, server.Host("deploy", "secret"))
+
+	if err := executor.UpdatePasswordContext(context.Background(), "secret", "changed"); err != nil {
+		t.Fatalf("Expected the password to be updated, got %v", err)
+	}
+	execs := server.Execs()
+	last := execs[len(execs)-1]
+	if !strings.HasPrefix(last.Command, "sudo -n ") || last.Stdin != "deploy:changed\n" {
+		t.Errorf("Expected chpasswd to read the new password without a sudo password, got %+v", last)
+	}
+}
+
+func TestAsRootWithWrongSudoPassword(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.AllowSudo("deploy", "other")
+	server.AddUser("guest", "secret")
+	executor := connect(t, server.Host("deploy", "secret")).AsRoot()
+
+	result, err := executor.Run("whoami")
+	if err != nil || result.ExitCode != 1 || !strings.Contains(result.Stderr, "incorrect password") {
+		t.Errorf("Expected sudo to reject the password, got %+v, %v", result, err)
+	}
+
+	host := server.Host("guest", "secret")
+	host.Become.Password = "other"
+	result, err = connect(t, host).AsRoot().Run("whoami")
+	if err != nil || result.ExitCode != 1 || !strings.Contains(result.Stderr, "not in the sudoers file") {
+		t.Errorf("Expected guest not to be a sudoer, got %+v, %v", result, err)
+	}
+}
+
+func TestAsRootAsRootUser(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("root", "secret")
+	executor := connect(t, server.Host("root", "secret")).AsRoot()
+
+	if _, err := executor.Output("whoami"); err != nil {
+		t.Fatalf("Expected whoami to succeed, got %v", err)
+	}
+	for _, exec := range server.Execs() {
+		if exec.Sudo {
+			t.Errorf("Expected root not to use sudo, got %q", exec.Command)
+		}
+	}
+}
+
+func TestPutFile(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.AllowSudo("deploy", "secret")
+	executor := connect(t, server.Host("deploy", "secret"))
+
+	content := "127.0.0.1 localhost\n"
+	if err := executor.PutFile(context.Background(), strings.NewReader(content), RemoteFile{Path: "/etc/hosts", Mode: 0644}); err != nil {
+		t.Fatalf("Expected the file to be written, got %v", err)
+	}
+	uploads := server.Uploads()
+	if len(uploads) != 1 || !strings.HasPrefix(uploads[0], "/tmp/.mykubespray-") {
+		t.Fatalf("Expected the file to be staged in /tmp, got %v", uploads)
+	}
+	if written, _ := server.File("/etc/hosts"); string(written) != content {
+		t.Errorf("Expected %q to be written, got %q", content, written)
+	}
+	if _, ok := server.File(uploads[0]); ok {
+		t.Errorf("Expected the staged file %s to be removed", uploads[0])
+	}
+	var moved bool
+	for _, exec := range server.Execs() {
+		if exec.Sudo && strings.Contains(exec.Run, "mv -f") && strings.Contains(exec.Run, "/etc/hosts") {
+			moved = true
+		}
+	}
+	if !moved {
+		t.Errorf("Expected the file to be moved into place as root, got %v", server.Commands())
+	}
+}
+
+func TestOpenTerminal(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	executor := connect(t, server.Host("deploy", "secret"))
+
+	terminal, err := executor.OpenTerminal(80, 24)
+	if err != nil {
+		t.Fatalf("Expected a terminal, got %v", err)
+	}
+	defer terminal.Close()
+	if _, err := terminal.Write([]byte("whoami\rexit\r")); err != nil {
+		t.Fatalf("Failed to type: %v", err)
+	}
+	output, _ := io.ReadAll(terminal)
+	if !strings.Contains(string(output), "deploy\r\n") {
+		t.Errorf("Expected whoami to print deploy, got %q", output)
+	}
+	if code, err := terminal.Wait(); err != nil || code != 0 {
+		t.Errorf("Expected the shell to exit with status 0, got %d, %v", code, err)
+	}
+	if execs := server.Execs(); len(execs) != 1 || !execs[0].Pty {
+		t.Errorf("Expected whoami to run on a terminal, got %+v", execs)
+	}
+}
@@ -0,0 +1,400 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"net"
+	"strings"
+)
+
+const (
+	hostsFile              = "/etc/hosts"
+	resolvConfFile         = "/etc/resolv.conf"
+	resolvedDropIns        = "/etc/systemd/resolved.conf.d"
+	networkManagerDropIns  = "/etc/NetworkManager/conf.d"
+	networkManagerRunState = "/run/NetworkManager/"
+)
+
+// NameResolver reconciles the name resolution a cluster manages on a node. The records are kept in a
+// block of /etc/hosts marked with the cluster, the nameservers and search domains in such blocks of
+// resolv.conf, or in a drop-in of resolved.conf or NetworkManager when either manages resolv.conf.
+// Entries outside the blocks are left alone, entries in them that are no longer wanted are removed.
+type NameResolver struct {
+	ClusterID  uint
+	Resolution entity.NameResolution
+	OSClient   OSClient
+}
+
+func NewNameResolver(clusterID uint, resolution entity.NameResolution, osClient OSClient) *NameResolver {
+	return &NameResolver{
+		ClusterID:  clusterID,
+		Resolution: resolution,
+		OSClient:   osClient,
+	}
+}
+
+// ValidateNameResolution rejects records, nameservers and search domains that cannot be written, and
+// domains that are given different addresses.
+func ValidateNameResolution(resolution entity.NameResolution) error {
+	addresses := make(map[string]string)
+	for _, record := range resolution.Records {
+		if net.ParseIP(record.IP) == nil {
+			return fmt.Errorf("invalid address %s of %s", record.IP, record.Domain)
+		}
+		if !hostnamePattern.MatchString(record.Domain) {
+			return fmt.Errorf("invalid domain %s", record.Domain)
+		}
+		if ip, ok := addresses[record.Domain]; ok && ip != record.IP {
+			return fmt.Errorf("%s is given both %s and %s", record.Domain, ip, record.IP)
+		}
+		addresses[record.Domain] = record.IP
+	}
+	for _, nameserver := range resolution.Nameservers {
+		if net.ParseIP(nameserver) == nil {
+			return fmt.Errorf("invalid nameserver %s", nameserver)
+		}
+	}
+	for _, search := range resolution.Searches {
+		if !hostnamePattern.MatchString(search) {
+			return fmt.Errorf("invalid search domain %s", search)
+		}
+	}
+	return nil
+}
+
+// Run reconciles the node. With check nothing is changed and the differences are reported as drift.
+func (resolver *NameResolver) Run(ctx context.Context, check bool) *entity.NameResolutionReport {
+	report := &entity.NameResolutionReport{Host: resolver.OSClient.SSExecutor.Host.Name, Check: check}
+	if err := ValidateNameResolution(resolver.Resolution); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if err := resolver.syncHosts(ctx, report); err != nil {
+		report.Error = fmt.Sprintf("failed to update %s: %s", hostsFile, err.Error())
+		logger.GetLogger().Errorf("Failed to reconcile name resolution of %s: %s", report.Host, report.Error)
+		return report
+	}
+	if err := resolver.syncResolver(ctx, report); err != nil {
+		report.Error = fmt.Sprintf("failed to update the %s configuration: %s", report.Resolver, err.Error())
+		logger.GetLogger().Errorf("Failed to reconcile name resolution of %s: %s", report.Host, report.Error)
+		return report
+	}
+	logger.GetLogger().Infof("Reconciled name resolution of %s, changed: %t, drift: %t", report.Host, report.Changed, report.Drift)
+	return report
+}
+
+func (resolver *NameResolver) root() *SSHExecutor {
+	return resolver.OSClient.SSExecutor.AsRoot()
+}
+
+// markers return the lines around the block of the cluster.
+func (resolver *NameResolver) markers() (string, string) {
+	return fmt.Sprintf("# BEGIN mykubespray cluster %d", resolver.ClusterID), fmt.Sprintf("# END mykubespray cluster %d", resolver.ClusterID)
+}
+
+// resolverLines returns the wanted nameservers and search domains as resolv.conf lines.
+func (resolver *NameResolver) resolverLines() []string {
+	return append(resolver.nameserverLines(), resolver.searchLines()...)
+}
+
+func (resolver *NameResolver) nameserverLines() []string {
+	var lines []string
+	for _, nameserver := range resolver.Resolution.Nameservers {
+		lines = append(lines, "nameserver "+nameserver)
+	}
+	return lines
+}
+
+func (resolver *NameResolver) searchLines() []string {
+	if len(resolver.Resolution.Searches) == 0 {
+		return nil
+	}
+	return []string{"search " + strings.Join(resolver.Resolution.Searches, " ")}
+}
+
+// record reports the differences between the current and the wanted lines of a block and whether there
+// are any. key returns what identifies a line, a line with the key of another one updates it.
+func (resolver *NameResolver) record(report *entity.NameResolutionReport, current, wanted []string, key func(string) string) bool {
+	currentByKey := make(map[string]string)
+	for _, line := range current {
+		currentByKey[key(line)] = line
+	}
+	wantedKeys := make(map[string]bool)
+	var differs bool
+	for _, line := range wanted {
+		wantedKeys[key(line)] = true
+		switch previous, ok := currentByKey[key(line)]; {
+		case !ok:
+			report.Added = append(report.Added, line)
+		case previous != line:
+			report.Updated = append(report.Updated, line)
+		default:
+			continue
+		}
+		differs = true
+	}
+	for _, line := range current {
+		if !wantedKeys[key(line)] {
+			report.Removed = append(report.Removed, line)
+			differs = true
+		}
+	}
+	// the same entries in another order
+	if !differs && strings.Join(current, "\n") != strings.Join(wanted, "\n") {
+		differs = true
+	}
+	if differs {
+		resolver.differs(report)
+	}
+	return differs
+}
+
+// differs records that the node differs from what is wanted.
+func (resolver *NameResolver) differs(report *entity.NameResolutionReport) {
+	if report.Check {
+		report.Drift = true
+	} else {
+		report.Changed = true
+	}
+}
+
+func (resolver *NameResolver) syncHosts(ctx context.Context, report *entity.NameResolutionReport) error {
+	var wanted []string
+	for _, record := range resolver.Resolution.Records {
+		wanted = append(wanted, fmt.Sprintf("%s %s", record.IP, record.Domain))
+	}
+	content, err := resolver.root().OutputContext(ctx, "cat "+hostsFile)
+	if err != nil {
+		return err
+	}
+	begin, end := resolver.markers()
+	updated, current := replaceBlock(content, begin, end, wanted, false)
+	// a line is identified by its domain, the address is what changes
+	domain := func(line string) string {
+		if fields := strings.Fields(line); len(fields) > 1 {
+			return strings.Join(fields[1:], " ")
+		}
+		return line
+	}
+	if !resolver.record(report, current, wanted, domain) || report.Check {
+		return nil
+	}
+	return resolver.OSClient.SSExecutor.PutFile(ctx, strings.NewReader(updated), RemoteFile{Path: hostsFile, Mode: 0644})
+}
+
+func (resolver *NameResolver) syncResolver(ctx context.Context, report *entity.NameResolutionReport) error {
+	// /run/systemd/resolve/stub-resolv.conf
+	// active
+	output, err := resolver.root().OutputContext(ctx, "readlink -f "+resolvConfFile+"; systemctl is-active systemd-resolved 2>/dev/null || true")
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return fmt.Errorf("cannot resolve %s", resolvConfFile)
+	}
+	target := fields[0]
+	// search is a single line, nameservers are identified by their address
+	key := func(line string) string {
+		if strings.HasPrefix(line, "search ") {
+			return "search"
+		}
+		return line
+	}
+	wanted := resolver.resolverLines()
+	if strings.HasPrefix(target, "/run/systemd/resolve/") && len(fields) > 1 && fields[1] == "active" {
+		report.Resolver = entity.ResolverResolved
+		return resolver.syncResolved(ctx, report, wanted, key)
+	}
+
+	if target == resolvConfFile || strings.HasPrefix(target, networkManagerRunState) {
+		managed, err := resolver.networkManagerManages(ctx)
+		if err != nil {
+			return err
+		}
+		if managed {
+			report.Resolver = entity.ResolverNetworkManager
+			return resolver.syncNetworkManager(ctx, report, wanted, key)
+		}
+	}
+
+	report.Resolver = entity.ResolverResolvConf
+	content, err := resolver.root().OutputContext(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", target))
+	if err != nil {
+		return err
+	}
+	begin, end := resolver.markers()
+	// The nameservers go first, so that they are asked before the others. glibc only uses the last search
+	// or domain line, so the search domains go into a block of their own that is kept at the bottom. A
+	// symlinked resolv.conf is written through the link.
+	updated, current := replaceBlock(content, begin, end, resolver.nameserverLines(), true)
+	updated, searches := replaceBlock(updated, begin+" search", end+" search", nil, false)
+	updated, _ = replaceBlock(updated, begin+" search", end+" search", resolver.searchLines(), false)
+	current = append(current, searches...)
+	differs := resolver.record(report, current, wanted, key)
+	if !differs && updated != content {
+		// the same lines, but a block has to move, e.g. below a search line added after it
+		differs = true
+		resolver.differs(report)
+	}
+	if !differs || report.Check {
+		return nil
+	}
+	return resolver.OSClient.SSExecutor.PutFile(ctx, strings.NewReader(updated), RemoteFile{Path: target, Mode: 0644})
+}
+
+// networkManagerManages tells whether NetworkManager writes resolv.conf, which would drop the blocks
+// on its next DNS update. It does while it runs, unless dns=none or rc-manager=unmanaged.
+func (resolver *NameResolver) networkManagerManages(ctx context.Context) (bool, error) {
+	// active
+	// dns=default
+	// rc-manager=symlink
+	output, err := resolver.root().OutputContext(ctx, "systemctl is-active NetworkManager 2>/dev/null || true; NetworkManager --print-config 2>/dev/null | grep -E '^(dns|rc-manager)=' || true")
+	if err != nil {
+		return false, err
+	}
+	fields := strings.Fields(output)
+	if len(fields) == 0 || fields[0] != "active" {
+		return false, nil
+	}
+	for _, setting := range fields[1:] {
+		if setting == "dns=none" || setting == "rc-manager=unmanaged" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// syncNetworkManager keeps the nameservers and search domains in the global DNS configuration of a
+// NetworkManager drop-in, which NetworkManager writes to resolv.conf instead of the DNS of its connections.
+func (resolver *NameResolver) syncNetworkManager(ctx context.Context, report *entity.NameResolutionReport, wanted []string, key func(string) string) error {
+	// NetworkManager ignores a global DNS configuration without the servers of the default domain.
+	if len(resolver.Resolution.Searches) > 0 && len(resolver.Resolution.Nameservers) == 0 {
+		return fmt.Errorf("NetworkManager only takes search domains together with nameservers")
+	}
+	path := fmt.Sprintf("%s/mykubespray-cluster-%d.conf", networkManagerDropIns, resolver.ClusterID)
+	content, err := resolver.root().OutputContext(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", path))
+	if err != nil {
+		return err
+	}
+	var current []string
+	for _, line := range strings.Split(content, "\n") {
+		name, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch name {
+		case "servers":
+			for _, nameserver := range strings.Split(value, ",") {
+				current = append(current, "nameserver "+nameserver)
+			}
+		case "searches":
+			current = append(current, "search "+strings.Join(strings.Split(value, ","), " "))
+		}
+	}
+	if !resolver.record(report, current, wanted, key) || report.Check {
+		return nil
+	}
+	if len(wanted) == 0 {
+		_, err = resolver.root().OutputContext(ctx, "rm -f "+path+" && systemctl reload NetworkManager")
+		return err
+	}
+	begin, _ := resolver.markers()
+	dropIn := fmt.Sprintf("%s\n[global-dns-domain-*]\nservers=%s\n", begin, strings.Join(resolver.Resolution.Nameservers, ","))
+	if len(resolver.Resolution.Searches) > 0 {
+		dropIn += fmt.Sprintf("[global-dns]\nsearches=%s\n", strings.Join(resolver.Resolution.Searches, ","))
+	}
+	if err := resolver.OSClient.SSExecutor.PutFile(ctx, strings.NewReader(dropIn), RemoteFile{Path: path, Mode: 0644}); err != nil {
+		return err
+	}
+	_, err = resolver.root().OutputContext(ctx, "systemctl reload NetworkManager")
+	return err
+}
+
+// syncResolved keeps the nameservers and search domains in a resolved.conf drop-in, resolv.conf is
+// generated by systemd-resolved then.
+func (resolver *NameResolver) syncResolved(ctx context.Context, report *entity.NameResolutionReport, wanted []string, key func(string) string) error {
+	path := fmt.Sprintf("%s/mykubespray-cluster-%d.conf", resolvedDropIns, resolver.ClusterID)
+	content, err := resolver.root().OutputContext(ctx, fmt.Sprintf("cat %s 2>/dev/null || true", path))
+	if err != nil {
+		return err
+	}
+	var current []string
+	for _, line := range strings.Split(content, "\n") {
+		name, value, _ := strings.Cut(strings.TrimSpace(line), "=")
+		switch name {
+		case "DNS":
+			for _, nameserver := range strings.Fields(value) {
+				current = append(current, "nameserver "+nameserver)
+			}
+		case "Domains":
+			if domains := strings.Fields(value); len(domains) > 0 {
+				current = append(current, "search "+strings.Join(domains, " "))
+			}
+		}
+	}
+	if !resolver.record(report, current, wanted, key) || report.Check {
+		return nil
+	}
+	if len(wanted) == 0 {
+		_, err = resolver.root().OutputContext(ctx, "rm -f "+path+" && systemctl restart systemd-resolved")
+		return err
+	}
+	begin, _ := resolver.markers()
+	dropIn := fmt.Sprintf("%s\n[Resolve]\n", begin)
+	if len(resolver.Resolution.Nameservers) > 0 {
+		dropIn += fmt.Sprintf("DNS=%s\n", strings.Join(resolver.Resolution.Nameservers, " "))
+	}
+	if len(resolver.Resolution.Searches) > 0 {
+		dropIn += fmt.Sprintf("Domains=%s\n", strings.Join(resolver.Resolution.Searches, " "))
+	}
+	if _, err := resolver.root().OutputContext(ctx, "mkdir -p "+resolvedDropIns); err != nil {
+		return err
+	}
+	if err := resolver.OSClient.SSExecutor.PutFile(ctx, strings.NewReader(dropIn), RemoteFile{Path: path, Mode: 0644}); err != nil {
+		return err
+	}
+	_, err = resolver.root().OutputContext(ctx, "systemctl restart systemd-resolved")
+	return err
+}
+
+// replaceBlock returns content with the lines between begin and end replaced by lines, and the lines
+// that were there. Without lines the block is removed. Content without the block gets it at the top
+// or at the bottom.
+func replaceBlock(content, begin, end string, lines []string, top bool) (string, []string) {
+	var block string
+	if len(lines) > 0 {
+		block = begin + "\n" + strings.Join(lines, "\n") + "\n" + end + "\n"
+	}
+	all := strings.SplitAfter(content, "\n")
+	start, stop := -1, -1
+	for i, line := range all {
+		switch strings.TrimSpace(line) {
+		case begin:
+			if start < 0 {
+				start = i
+			}
+		case end:
+			if start >= 0 && stop < 0 {
+				stop = i
+			}
+		}
+	}
+	if start >= 0 && stop > start {
+		var current []string
+		for _, line := range all[start+1 : stop] {
+			if line = strings.TrimSpace(line); line != "" {
+				current = append(current, line)
+			}
+		}
+		return strings.Join(all[:start], "") + block + strings.Join(all[stop+1:], ""), current
+	}
+	switch {
+	case block == "":
+		return content, nil
+	case top:
+		return block + content, nil
+	case content != "" && !strings.HasSuffix(content, "\n"):
+		content += "\n"
+	}
+	return content + block, nil
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"github.com/whoisfisher/mykubespray/pkg/utils/sshtest"
+	"strings"
+	"testing"
+)
+
+func TestNameResolverReconcilesBlocks(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("root", "secret")
+	server.Respond(`cat /etc/hosts`, sshtest.Response{Stdout: "127.0.0.1 localhost\n" +
+		"# BEGIN mykubespray cluster 3\n10.0.0.1 node1\n10.0.0.9 node2\n10.0.0.3 node3\n# END mykubespray cluster 3\n" +
+		"192.168.1.10 registry.local\n"})
+	server.Respond(`readlink -f /etc/resolv.conf; .*`, sshtest.Response{Stdout: "/run/systemd/resolve/stub-resolv.conf\nactive\n"})
+	server.Respond(`cat /etc/systemd/resolved.conf.d/mykubespray-cluster-3.conf .*`, sshtest.Response{Stdout: "[Resolve]\nDNS=10.0.0.53\n"})
+	server.Respond(`systemctl restart systemd-resolved`, sshtest.Response{})
+	client := OSClient{SSExecutor: *connect(t, server.Host("root", "secret"))}
+
+	resolution := entity.NameResolution{
+		Records:     []entity.Record{{IP: "10.0.0.1", Domain: "node1"}, {IP: "10.0.0.2", Domain: "node2"}, {IP: "10.0.0.10", Domain: "lb.cars.local"}},
+		Nameservers: []string{"10.0.0.53", "10.0.0.54"},
+		Searches:    []string{"cars.local"},
+	}
+	report := NewNameResolver(3, resolution, client).Run(context.Background(), true)
+	if report.Error != "" || !report.Drift || report.Changed || report.Resolver != entity.ResolverResolved {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	if uploads := server.Uploads(); len(uploads) > 0 {
+		t.Fatalf("Expected check mode not to write files, got %v", uploads)
+	}
+
+	report = NewNameResolver(3, resolution, client).Run(context.Background(), false)
+	if report.Error != "" || !report.Changed || report.Drift {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	expected := "added [10.0.0.10 lb.cars.local nameserver 10.0.0.54 search cars.local], updated [10.0.0.2 node2], removed [10.0.0.3 node3]"
+	if got := fmt.Sprintf("added %v, updated %v, removed %v", report.Added, report.Updated, report.Removed); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+	uploads := server.Uploads()
+	if len(uploads) != 2 {
+		t.Fatalf("Expected /etc/hosts and the drop-in to be written, got %v", uploads)
+	}
+	hosts, _ := server.File("/etc/hosts")
+	if string(hosts) != "127.0.0.1 localhost\n"+
+		"# BEGIN mykubespray cluster 3\n10.0.0.1 node1\n10.0.0.2 node2\n10.0.0.10 lb.cars.local\n# END mykubespray cluster 3\n"+
+		"192.168.1.10 registry.local\n" {
+		t.Errorf("Unexpected /etc/hosts %q", hosts)
+	}
+	if dropIn, _ := server.File("/etc/systemd/resolved.conf.d/mykubespray-cluster-3.conf"); !strings.Contains(string(dropIn), "DNS=10.0.0.53 10.0.0.54\nDomains=cars.local\n") {
+		t.Errorf("Unexpected drop-in %q", dropIn)
+	}
+	for _, command := range server.Commands() {
+		if strings.Contains(command, "/etc/resolv.conf") && !strings.HasPrefix(command, "readlink") {
+			t.Errorf("Expected resolv.conf of systemd-resolved to be left alone, got %q", command)
+		}
+	}
+}
+
+func TestNameResolverKeepsSearchLast(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("root", "secret")
+	server.Respond(`cat /etc/hosts`, sshtest.Response{Stdout: "127.0.0.1 localhost\n"})
+	server.Respond(`readlink -f /etc/resolv.conf; .*`, sshtest.Response{Stdout: "/etc/resolv.conf\ninactive\n"})
+	server.Respond(`systemctl is-active NetworkManager .*`, sshtest.Response{Stdout: "inactive\n"})
+	server.WriteFile("/etc/resolv.conf", []byte("# BEGIN mykubespray cluster 3\nnameserver 10.0.0.53\nsearch cars.local\n# END mykubespray cluster 3\n"+
+		"nameserver 192.168.1.1\nsearch example.com\n"))
+	server.RespondFunc(`cat /etc/resolv.conf .*`, func(exec sshtest.Exec) sshtest.Response {
+		content, _ := server.File("/etc/resolv.conf")
+		return sshtest.Response{Stdout: string(content)}
+	})
+	client := OSClient{SSExecutor: *connect(t, server.Host("root", "secret"))}
+
+	resolution := entity.NameResolution{Nameservers: []string{"10.0.0.53"}, Searches: []string{"cars.local"}}
+	report := NewNameResolver(3, resolution, client).Run(context.Background(), false)
+	if report.Error != "" || !report.Changed || report.Resolver != entity.ResolverResolvConf || len(report.Added)+len(report.Updated)+len(report.Removed) > 0 {
+		t.Fatalf("Expected the search line to move without changing entries, got %+v", report)
+	}
+	expected := "# BEGIN mykubespray cluster 3\nnameserver 10.0.0.53\n# END mykubespray cluster 3\n" +
+		"nameserver 192.168.1.1\nsearch example.com\n" +
+		"# BEGIN mykubespray cluster 3 search\nsearch cars.local\n# END mykubespray cluster 3 search\n"
+	if resolvConf, _ := server.File("/etc/resolv.conf"); string(resolvConf) != expected {
+		t.Errorf("Unexpected resolv.conf %q", resolvConf)
+	}
+
+	report = NewNameResolver(3, resolution, client).Run(context.Background(), true)
+	if report.Error != "" || report.Drift {
+		t.Errorf("Expected no drift once the search line is last, got %+v", report)
+	}
+}
+
+func TestNameResolverConfiguresNetworkManager(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("root", "secret")
+	server.Respond(`cat /etc/hosts`, sshtest.Response{Stdout: "127.0.0.1 localhost\n"})
+	server.Respond(`readlink -f /etc/resolv.conf; .*`, sshtest.Response{Stdout: "/etc/resolv.conf\ninactive\n"})
+	server.Respond(`systemctl is-active NetworkManager .*`, sshtest.Response{Stdout: "active\ndns=default\n"})
+	server.Respond(`cat /etc/NetworkManager/conf.d/mykubespray-cluster-3.conf .*`, sshtest.Response{})
+	server.Respond(`systemctl reload NetworkManager`, sshtest.Response{})
+	client := OSClient{SSExecutor: *connect(t, server.Host("root", "secret"))}
+
+	resolution := entity.NameResolution{Nameservers: []string{"10.0.0.53", "10.0.0.54"}, Searches: []string{"cars.local"}}
+	report := NewNameResolver(3, resolution, client).Run(context.Background(), false)
+	if report.Error != "" || !report.Changed || report.Resolver != entity.ResolverNetworkManager {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	dropIn, _ := server.File("/etc/NetworkManager/conf.d/mykubespray-cluster-3.conf")
+	if !strings.Contains(string(dropIn), "[global-dns-domain-*]\nservers=10.0.0.53,10.0.0.54\n[global-dns]\nsearches=cars.local\n") {
+		t.Errorf("Unexpected drop-in %q", dropIn)
+	}
+	if _, ok := server.File("/etc/resolv.conf"); ok {
+		t.Errorf("Expected resolv.conf of NetworkManager to be left alone")
+	}
+	if commands := server.Commands(); commands[len(commands)-1] != "systemctl reload NetworkManager" {
+		t.Errorf("Expected NetworkManager to be reloaded, got %v", commands)
+	}
+}
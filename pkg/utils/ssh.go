@@ -5,9 +5,31 @@ import (
 	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/logger"
 	"golang.org/x/crypto/ssh"
+	"net"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// DefaultDialTimeout bounds connecting to a host and the SSH handshake unless configured otherwise.
+const DefaultDialTimeout = 30 * time.Second
+
+var dialTimeout atomic.Int64
+
+// ConfigureSSHDialTimeout sets how long connecting to a host and the SSH handshake may take,
+// DefaultDialTimeout when timeout is not positive.
+func ConfigureSSHDialTimeout(timeout time.Duration) {
+	dialTimeout.Store(int64(timeout))
+}
+
+func sshDialTimeout() time.Duration {
+	if timeout := time.Duration(dialTimeout.Load()); timeout > 0 {
+		return timeout
+	}
+	return DefaultDialTimeout
+}
+
 type SSHConfig struct {
 	Host        string
 	Port        int32
@@ -19,62 +41,154 @@ type SSHConfig struct {
 
 // SSHConnection manages an SSH connection.
 type SSHConnection struct {
-	Client *ssh.Client
+	Client   *ssh.Client
+	identity *identity
 }
 
 func NewConnection(host entity.Host) (*SSHConnection, error) {
-	sshConfig := &ssh.ClientConfig{
-		User:            host.User,
-		Auth:            host.AuthMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	if len(host.JumpHosts) == 0 {
+		return dialHost(nil, host)
 	}
-	if host.Password != "" {
-		sshConfig.Auth = append(sshConfig.Auth, ssh.Password(host.Password))
+	gateway, err := dialGateway(host.JumpHosts)
+	if err != nil {
+		return nil, err
 	}
-
-	if host.PrivateKey != "" {
-		key, err := parsePrivateKey(host.PrivateKey)
-		if err != nil {
-			logger.GetLogger().Errorf("Failed to parse private key: %s", err.Error())
-			return nil, err
-		}
-		sshConfig.Auth = append(sshConfig.Auth, key)
+	connection, err := dialHost(gateway, host)
+	if err != nil {
+		gateway.Close()
+		return nil, err
 	}
+	go func() {
+		connection.Client.Wait()
+		gateway.Close()
+	}()
+	return connection, nil
+}
 
+// dialHost connects to host, tunnelled through gateway when it is not nil.
+func dialHost(gateway *ssh.Client, host entity.Host) (*SSHConnection, error) {
+	sshConfig, err := clientConfig(host.User, host.Password, host.PrivateKey, host.AuthMethods)
+	if err != nil {
+		return nil, err
+	}
 	address := fmt.Sprintf("%s:%d", host.Address, host.Port)
-	client, err := ssh.Dial("tcp", address, sshConfig)
+	client, err := dial(gateway, address, sshConfig)
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to dial: %s", err.Error())
 		return nil, err
 	}
+	return &SSHConnection{Client: client, identity: &identity{}}, nil
+}
 
-	connection := &SSHConnection{
-		Client: client,
+// dialGateway connects to the last jump host of a chain through the previous ones.
+// Closing the returned client closes the whole chain.
+func dialGateway(jumpHosts []entity.JumpHost) (*ssh.Client, error) {
+	var chain []*ssh.Client
+	closeChain := func() {
+		for i := len(chain) - 1; i >= 0; i-- {
+			chain[i].Close()
+		}
 	}
+	for _, jumpHost := range jumpHosts {
+		sshConfig, err := clientConfig(jumpHost.User, jumpHost.Password, jumpHost.PrivateKey, nil)
+		if err != nil {
+			closeChain()
+			return nil, err
+		}
+		port := jumpHost.Port
+		if port == 0 {
+			port = 22
+		}
+		address := fmt.Sprintf("%s:%d", jumpHost.Address, port)
+		var previous *ssh.Client
+		if len(chain) > 0 {
+			previous = chain[len(chain)-1]
+		}
+		client, err := dial(previous, address, sshConfig)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to dial jump host %s: %s", address, err.Error())
+			closeChain()
+			return nil, fmt.Errorf("jump host %s: %w", address, err)
+		}
+		chain = append(chain, client)
+	}
+	gateway := chain[len(chain)-1]
+	go func() {
+		gateway.Wait()
+		closeChain()
+	}()
+	return gateway, nil
+}
 
-	return connection, nil
+func dial(gateway *ssh.Client, address string, sshConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	var conn net.Conn
+	var err error
+	if gateway == nil {
+		conn, err = net.DialTimeout("tcp", address, sshConfig.Timeout)
+	} else {
+		conn, err = gateway.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if algorithms := hostKeyAlgorithms(address); len(algorithms) > 0 {
+		restricted := *sshConfig
+		restricted.HostKeyAlgorithms = algorithms
+		sshConfig = &restricted
+	}
+	// ssh.ClientConfig.Timeout only bounds the TCP connect, a host that accepts the connection
+	// but never answers the handshake would hang the dial.
+	timer := time.AfterFunc(sshConfig.Timeout, func() { conn.Close() })
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, address, sshConfig)
+	if !timer.Stop() {
+		if err == nil {
+			clientConn.Close()
+		}
+		return nil, fmt.Errorf("ssh handshake with %s timed out after %s", address, sshConfig.Timeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(clientConn, channels, requests), nil
 }
 
-// NewSSHConnection establishes a new SSH connection.
-func NewSSHConnection(config SSHConfig) (*SSHConnection, error) {
+func clientConfig(user, password, privateKey string, authMethods []ssh.AuthMethod) (*ssh.ClientConfig, error) {
 	sshConfig := &ssh.ClientConfig{
-		User:            config.User,
-		Auth:            config.AuthMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		User:            user,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback(),
+		Timeout:         sshDialTimeout(),
 	}
-
-	if config.Password != "" {
-		sshConfig.Auth = append(sshConfig.Auth, ssh.Password(config.Password))
+	if password != "" {
+		sshConfig.Auth = append(sshConfig.Auth, ssh.Password(password))
 	}
-
-	if config.PrivateKey != "" {
-		key, err := parsePrivateKey(config.PrivateKey)
+	if privateKey != "" {
+		key, err := parsePrivateKey(privateKey)
 		if err != nil {
 			logger.GetLogger().Errorf("Failed to parse private key: %s", err.Error())
 			return nil, err
 		}
 		sshConfig.Auth = append(sshConfig.Auth, key)
 	}
+	return sshConfig, nil
+}
+
+// gatewayKey identifies a jump host chain, so that hosts behind the same chain can share its connection.
+func gatewayKey(jumpHosts []entity.JumpHost) string {
+	var hops []string
+	for _, jumpHost := range jumpHosts {
+		hops = append(hops, fmt.Sprintf("%s@%s:%d", jumpHost.User, jumpHost.Address, jumpHost.Port))
+	}
+	return strings.Join(hops, ",")
+}
+
+// NewSSHConnection establishes a new SSH connection.
+func NewSSHConnection(config SSHConfig) (*SSHConnection, error) {
+	sshConfig, err := clientConfig(config.User, config.Password, config.PrivateKey, config.AuthMethods)
+	if err != nil {
+		return nil, err
+	}
 
 	address := fmt.Sprintf("%s:%d", config.Host, config.Port)
 	client, err := ssh.Dial("tcp", address, sshConfig)
@@ -84,7 +198,8 @@ func NewSSHConnection(config SSHConfig) (*SSHConnection, error) {
 	}
 
 	connection := &SSHConnection{
-		Client: client,
+		Client:   client,
+		identity: &identity{},
 	}
 
 	return connection, nil
@@ -1,26 +1,94 @@
 package utils
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/whoisfisher/mykubespray/pkg/entity"
 	"github.com/whoisfisher/mykubespray/pkg/logger"
 	"golang.org/x/crypto/ssh"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// keepaliveTimeout is how long a keepalive request may stay unanswered before the connection counts as dead.
+const keepaliveTimeout = 10 * time.Second
+
 type SSHConnectionPool struct {
 	Connections sync.Map
 	mutex       sync.Mutex
 }
 
+// SSHSessionPool opens sessions on pooled connections. A session runs a single command, so every
+// call opens a new one.
 type SSHSessionPool struct {
-	Sessions sync.Map
-	mutex    sync.Mutex
+	executors *SSHExecutorPool
+}
+
+// PoolOptions tunes an SSHExecutorPool.
+type PoolOptions struct {
+	// KeepaliveInterval is how often pooled connections are probed.
+	KeepaliveInterval time.Duration
+	// IdleTimeout is how long a connection may stay unused before it is closed.
+	IdleTimeout time.Duration
+	// MaxSessions caps the sessions open at once on a connection. It must not exceed MaxSessions
+	// of sshd, which is 10 by default.
+	MaxSessions int
+}
+
+func DefaultPoolOptions() PoolOptions {
+	return PoolOptions{
+		KeepaliveInterval: 30 * time.Second,
+		IdleTimeout:       5 * time.Minute,
+		MaxSessions:       10,
+	}
 }
 
+// SSHExecutorPool shares SSH connections between operations on the same host. Connections are
+// keyed by address, port, user and a fingerprint of the credentials, probed with keepalives,
+// redialled when they are found dead and closed when they are idle. Dials and probes of a key
+// are serialized, those of different keys run in parallel.
 type SSHExecutorPool struct {
-	Executors sync.Map
-	mutex     sync.Mutex
+	Executors  sync.Map
+	Gateways   sync.Map
+	mutex      sync.Mutex
+	keyLocks   sync.Map
+	options    PoolOptions
+	stop       chan struct{}
+	closeOnce  sync.Once
+	dials      atomic.Int64
+	reconnects atomic.Int64
+	evictions  atomic.Int64
+}
+
+// pooledExecutor is an entry of SSHExecutorPool.Executors.
+type pooledExecutor struct {
+	executor *SSHExecutor
+	gateway  string
+}
+
+var (
+	sharedPool      = NewSSHExecutorPool()
+	sharedPoolMutex sync.Mutex
+)
+
+// GetSSHExecutorPool returns the pool shared by the services.
+func GetSSHExecutorPool() *SSHExecutorPool {
+	sharedPoolMutex.Lock()
+	defer sharedPoolMutex.Unlock()
+	return sharedPool
+}
+
+// ConfigureSSHPool replaces the shared pool with one using options, closing the previous one.
+func ConfigureSSHPool(options PoolOptions) {
+	sharedPoolMutex.Lock()
+	defer sharedPoolMutex.Unlock()
+	sharedPool.Close()
+	sharedPool = NewSSHExecutorPoolWithOptions(options)
 }
 
 func NewSSHConnectionPool() *SSHConnectionPool {
@@ -28,11 +96,28 @@ func NewSSHConnectionPool() *SSHConnectionPool {
 }
 
 func NewSSHSessionPool() *SSHSessionPool {
-	return &SSHSessionPool{}
+	return &SSHSessionPool{executors: NewSSHExecutorPool()}
 }
 
 func NewSSHExecutorPool() *SSHExecutorPool {
-	return &SSHExecutorPool{}
+	return NewSSHExecutorPoolWithOptions(DefaultPoolOptions())
+}
+
+// NewSSHExecutorPoolWithOptions creates a pool and starts its keepalives. Close stops them.
+func NewSSHExecutorPoolWithOptions(options PoolOptions) *SSHExecutorPool {
+	defaults := DefaultPoolOptions()
+	if options.KeepaliveInterval <= 0 {
+		options.KeepaliveInterval = defaults.KeepaliveInterval
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = defaults.IdleTimeout
+	}
+	if options.MaxSessions <= 0 {
+		options.MaxSessions = defaults.MaxSessions
+	}
+	pool := &SSHExecutorPool{options: options, stop: make(chan struct{})}
+	go pool.maintain()
+	return pool
 }
 
 func (pool *SSHConnectionPool) GetSSHConnection(host entity.Host) (*SSHConnection, error) {
@@ -49,62 +134,335 @@ func (pool *SSHConnectionPool) GetSSHConnection(host entity.Host) (*SSHConnectio
 	return conn, nil
 }
 
-func (pool *SSHSessionPool) GetSSHSession(host entity.Host) (*ssh.Session, error) {
-	//pool.mutex.Lock()
-	//defer pool.mutex.Unlock()
-	if session, exists := pool.Sessions.Load(host.Name); exists {
-		return session.(*ssh.Session), nil
-	}
-	conn, err := NewConnection(host)
+// GetSSHSession opens a session on the pooled connection to host. The returned func closes the session.
+func (pool *SSHSessionPool) GetSSHSession(host entity.Host) (*ssh.Session, func(), error) {
+	executor, err := pool.executors.GetSSHExecutor(host)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	session, err := conn.Client.NewSession()
-	if err != nil {
-		return nil, err
-	}
-	pool.Sessions.Store(host.Name, session)
-	return session, nil
+	return executor.newSession()
 }
 
 func (pool *SSHSessionPool) Close() {
-	pool.Sessions.Range(func(key, value interface{}) bool {
-		client := value.(*ssh.Client)
-		client.Close()
-		return true
-	})
+	pool.executors.Close()
 }
 
+// GetSSHExecutor returns the pooled executor for host, dialling it when there is none or the
+// previous connection does not answer a keepalive. A connection used within the last
+// KeepaliveInterval is returned without a probe, newSession redials it if it died since.
 func (pool *SSHExecutorPool) GetSSHExecutor(host entity.Host) (*SSHExecutor, error) {
-	//pool.mutex.Lock()
-	//defer pool.mutex.Unlock()
-	if executor, exists := pool.Executors.Load(host.Name); exists {
-		return executor.(*SSHExecutor), nil
+	key := poolKey(host)
+	if value, exists := pool.Executors.Load(key); exists {
+		sessions := value.(*pooledExecutor).executor.sessions
+		if sessions.inUse() > 0 || sessions.idle() < pool.options.KeepaliveInterval {
+			sessions.touch()
+			return value.(*pooledExecutor).executor, nil
+		}
 	}
-	conn, err := NewConnection(host)
+	unlock := pool.lock(key)
+	defer unlock()
+	if value, exists := pool.Executors.Load(key); exists {
+		entry := value.(*pooledExecutor)
+		sessions := entry.executor.sessions
+		if sessions.inUse() > 0 || sessions.idle() < pool.options.KeepaliveInterval || alive(entry.executor.Connection.Client) {
+			sessions.touch()
+			return entry.executor, nil
+		}
+		logger.GetLogger().Warnf("Connection %s is gone, reconnecting", key)
+		pool.evict(key, entry)
+		pool.reconnects.Add(1)
+	}
+	return pool.dial(key, host)
+}
+
+// redial replaces the pooled connection of host when it is still stale, the connection a session
+// could not be opened on, and does not answer a keepalive. It returns the executor to retry with.
+func (pool *SSHExecutorPool) redial(host entity.Host, stale *ssh.Client) (*SSHExecutor, error) {
+	key := poolKey(host)
+	unlock := pool.lock(key)
+	defer unlock()
+	if value, exists := pool.Executors.Load(key); exists {
+		entry := value.(*pooledExecutor)
+		if entry.executor.Connection.Client != stale {
+			return entry.executor, nil
+		}
+		if alive(stale) {
+			return nil, fmt.Errorf("connection %s answers keepalives", key)
+		}
+		logger.GetLogger().Warnf("Connection %s is gone, reconnecting", key)
+		pool.evict(key, entry)
+		pool.reconnects.Add(1)
+	}
+	return pool.dial(key, host)
+}
+
+// dial connects to host and pools the connection under key. The caller holds the lock of key.
+func (pool *SSHExecutorPool) dial(key string, host entity.Host) (*SSHExecutor, error) {
+	var gateway string
+	if len(host.JumpHosts) > 0 {
+		// The gateway stays locked until the connection through it is pooled, so that sweep
+		// does not take it for unused.
+		gateway = gatewayKey(host.JumpHosts) + "#" + credentialFingerprint(entity.Host{JumpHosts: host.JumpHosts})
+		unlock := pool.lock(gatewayLockKey(gateway))
+		defer unlock()
+	}
+	conn, err := pool.connect(gateway, host)
 	if err != nil {
 		return nil, err
 	}
+	pool.dials.Add(1)
 	executor := &SSHExecutor{
 		Connection: *conn,
 		Host:       host,
+		sessions:   newSessionLimiter(pool.options.MaxSessions),
+		pool:       pool,
 	}
-	pool.Executors.Store(host.Name, executor)
+	pool.Executors.Store(key, &pooledExecutor{executor: executor, gateway: gateway})
 	return executor, nil
 }
 
+// lock locks key, a connection or gateway key. The returned func unlocks it. sweep drops the locks
+// nobody holds, a lock that was dropped while waiting for it is taken again from keyLocks.
+func (pool *SSHExecutorPool) lock(key string) func() {
+	for {
+		value, _ := pool.keyLocks.LoadOrStore(key, &sync.Mutex{})
+		mutex := value.(*sync.Mutex)
+		mutex.Lock()
+		if current, exists := pool.keyLocks.Load(key); exists && current == value {
+			return mutex.Unlock
+		}
+		mutex.Unlock()
+	}
+}
+
+func gatewayLockKey(gateway string) string {
+	return "gateway " + gateway
+}
+
+// connect dials host, through the pooled gateway key unless it is empty. Hosts behind the same jump
+// hosts share one gateway connection. The caller holds the lock of the gateway.
+func (pool *SSHExecutorPool) connect(key string, host entity.Host) (*SSHConnection, error) {
+	if key == "" {
+		return NewConnection(host)
+	}
+	if value, exists := pool.Gateways.Load(key); exists {
+		gateway := value.(*ssh.Client)
+		conn, err := dialHost(gateway, host)
+		if err == nil {
+			return conn, nil
+		}
+		if alive(gateway) {
+			return nil, err
+		}
+		logger.GetLogger().Warnf("Gateway %s is gone, reconnecting", key)
+		gateway.Close()
+		pool.Gateways.Delete(key)
+	}
+	gateway, err := dialGateway(host.JumpHosts)
+	if err != nil {
+		return nil, err
+	}
+	pool.Gateways.Store(key, gateway)
+	return dialHost(gateway, host)
+}
+
+// maintain sweeps the pool every KeepaliveInterval until the pool is closed.
+func (pool *SSHExecutorPool) maintain() {
+	ticker := time.NewTicker(pool.options.KeepaliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pool.stop:
+			return
+		case <-ticker.C:
+			pool.sweep()
+		}
+	}
+}
+
+// sweep closes the connections that are idle for longer than IdleTimeout or do not answer a
+// keepalive, and the gateways no connection goes through anymore. It drops the unused key locks,
+// so that hosts that were removed or never answered do not keep theirs.
+func (pool *SSHExecutorPool) sweep() {
+	pool.Executors.Range(func(key, value interface{}) bool {
+		entry := value.(*pooledExecutor)
+		sessions := entry.executor.sessions
+		if sessions.inUse() == 0 && sessions.idle() > pool.options.IdleTimeout {
+			logger.GetLogger().Infof("Closing idle connection %s", key)
+			pool.evict(key.(string), entry)
+		} else if !alive(entry.executor.Connection.Client) {
+			logger.GetLogger().Warnf("Connection %s does not answer keepalives, closing", key)
+			pool.evict(key.(string), entry)
+		}
+		return true
+	})
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.Gateways.Range(func(key, value interface{}) bool {
+		// A gateway that is locked is being dialled through.
+		lock, _ := pool.keyLocks.LoadOrStore(gatewayLockKey(key.(string)), &sync.Mutex{})
+		if !lock.(*sync.Mutex).TryLock() {
+			return true
+		}
+		defer lock.(*sync.Mutex).Unlock()
+		used := false
+		pool.Executors.Range(func(_, entry interface{}) bool {
+			used = entry.(*pooledExecutor).gateway == key.(string)
+			return !used
+		})
+		if !used {
+			value.(*ssh.Client).Close()
+			pool.Gateways.Delete(key)
+		}
+		return true
+	})
+	pool.keyLocks.Range(func(key, value interface{}) bool {
+		mutex := value.(*sync.Mutex)
+		if mutex.TryLock() {
+			pool.keyLocks.Delete(key)
+			mutex.Unlock()
+		}
+		return true
+	})
+}
+
+// evict closes the connection of entry unless it was replaced in the meantime.
+func (pool *SSHExecutorPool) evict(key string, entry *pooledExecutor) {
+	if pool.Executors.CompareAndDelete(key, entry) {
+		entry.executor.Connection.Client.Close()
+		pool.evictions.Add(1)
+	}
+}
+
+// Stats reports the connections of the pool and how they are used.
+func (pool *SSHExecutorPool) Stats() entity.SSHPoolStats {
+	stats := entity.SSHPoolStats{
+		Dials:       pool.dials.Load(),
+		Reconnects:  pool.reconnects.Load(),
+		Evictions:   pool.evictions.Load(),
+		MaxSessions: pool.options.MaxSessions,
+		Hosts:       []entity.SSHPoolHostStats{},
+	}
+	pool.Executors.Range(func(key, value interface{}) bool {
+		entry := value.(*pooledExecutor)
+		host := entry.executor.Host
+		stats.Hosts = append(stats.Hosts, entity.SSHPoolHostStats{
+			Host:        fmt.Sprintf("%s@%s:%d", host.User, host.Address, host.Port),
+			Sessions:    entry.executor.sessions.inUse(),
+			IdleSeconds: int64(entry.executor.sessions.idle().Seconds()),
+			Gateway:     gatewayKey(host.JumpHosts),
+		})
+		return true
+	})
+	pool.Gateways.Range(func(key, value interface{}) bool {
+		stats.Gateways++
+		return true
+	})
+	stats.Connections = len(stats.Hosts)
+	sort.Slice(stats.Hosts, func(i, j int) bool {
+		return stats.Hosts[i].Host < stats.Hosts[j].Host
+	})
+	return stats
+}
+
 func (pool *SSHExecutorPool) Close() {
+	pool.closeOnce.Do(func() {
+		close(pool.stop)
+	})
 	pool.Executors.Range(func(key, value interface{}) bool {
-		client := value.(*SSHExecutor)
-		client.Connection.Client.Close()
+		value.(*pooledExecutor).executor.Connection.Client.Close()
+		pool.Executors.Delete(key)
+		return true
+	})
+	pool.Gateways.Range(func(key, value interface{}) bool {
+		value.(*ssh.Client).Close()
+		pool.Gateways.Delete(key)
 		return true
 	})
 }
 
+// poolKey identifies a connection by where it goes and with which credentials, so that a host
+// whose credentials change gets a new connection.
+func poolKey(host entity.Host) string {
+	return fmt.Sprintf("%s@%s:%d#%s", host.User, host.Address, host.Port, credentialFingerprint(host))
+}
+
+// credentialFingerprint hashes the credentials of host, including how it becomes root, and of its jump hosts.
+func credentialFingerprint(host entity.Host) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%s", host.Password, host.PrivateKey, host.Become.Method, host.Become.Password)
+	for _, jumpHost := range host.JumpHosts {
+		fmt.Fprintf(hash, "\x00%s@%s:%d\x00%s\x00%s", jumpHost.User, jumpHost.Address, jumpHost.Port, jumpHost.Password, jumpHost.PrivateKey)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// alive probes client with a keepalive request.
+func alive(client *ssh.Client) bool {
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		return err == nil
+	case <-time.After(keepaliveTimeout):
+		return false
+	}
+}
+
+// sessionLimiter caps the sessions open at once on a connection and records when it was last used.
+// A nil limiter does not limit anything.
+type sessionLimiter struct {
+	slots    chan struct{}
+	lastUsed atomic.Int64
+}
+
+func newSessionLimiter(max int) *sessionLimiter {
+	limiter := &sessionLimiter{slots: make(chan struct{}, max)}
+	limiter.touch()
+	return limiter
+}
+
+// acquire waits for a free slot. The returned func frees it.
+func (limiter *sessionLimiter) acquire() func() {
+	if limiter == nil {
+		return func() {}
+	}
+	limiter.slots <- struct{}{}
+	limiter.touch()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-limiter.slots
+			limiter.touch()
+		})
+	}
+}
+
+func (limiter *sessionLimiter) touch() {
+	if limiter != nil {
+		limiter.lastUsed.Store(time.Now().UnixNano())
+	}
+}
+
+func (limiter *sessionLimiter) inUse() int {
+	if limiter == nil {
+		return 0
+	}
+	return len(limiter.slots)
+}
+
+func (limiter *sessionLimiter) idle() time.Duration {
+	if limiter == nil {
+		return 0
+	}
+	return time.Since(time.Unix(0, limiter.lastUsed.Load()))
+}
+
 func (pool *SSHExecutorPool) ExecuteShortCommand(command string, host entity.Host) (string, error) {
-	pool.mutex.Lock()
 	executor, err := pool.GetSSHExecutor(host)
-	pool.mutex.Unlock()
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
 		return "", err
@@ -113,9 +471,7 @@ func (pool *SSHExecutorPool) ExecuteShortCommand(command string, host entity.Hos
 }
 
 func (pool *SSHExecutorPool) ExecuteShortCMD(command string, host entity.Host) ([]byte, error) {
-	pool.mutex.Lock()
 	executor, err := pool.GetSSHExecutor(host)
-	pool.mutex.Unlock()
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
 		return nil, err
@@ -123,10 +479,17 @@ func (pool *SSHExecutorPool) ExecuteShortCMD(command string, host entity.Host) (
 	return executor.ExecuteShortCMD(command)
 }
 
+func (pool *SSHExecutorPool) Run(command string, host entity.Host) (*entity.CommandResult, error) {
+	executor, err := pool.GetSSHExecutor(host)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
+		return nil, err
+	}
+	return executor.Run(command)
+}
+
 func (pool *SSHExecutorPool) ExecuteCommand(command string, host entity.Host, logChan chan LogEntry) error {
-	pool.mutex.Lock()
 	executor, err := pool.GetSSHExecutor(host)
-	pool.mutex.Unlock()
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
 		return err
@@ -135,9 +498,7 @@ func (pool *SSHExecutorPool) ExecuteCommand(command string, host entity.Host, lo
 }
 
 func (pool *SSHExecutorPool) ExecuteCommandWithoutReturn(command string, host entity.Host) error {
-	pool.mutex.Lock()
 	executor, err := pool.GetSSHExecutor(host)
-	pool.mutex.Unlock()
 	if err != nil {
 		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
 		return err
@@ -145,281 +506,117 @@ func (pool *SSHExecutorPool) ExecuteCommandWithoutReturn(command string, host en
 	return executor.ExecuteCommandWithoutReturn(command)
 }
 
-type MachineResult struct {
-	Machine string
-	Success bool
-	Error   string
+// Executor returns the pooled executor of host.
+func (pool *SSHExecutorPool) Executor(host entity.Host) (*SSHExecutor, error) {
+	executor, err := pool.GetSSHExecutor(host)
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
+		return nil, err
+	}
+	return executor, nil
 }
 
-type CopyResult struct {
-	OverallSuccess bool
-	Results        []MachineResult
+// unpooledOperation runs operation with an executor on a connection of its own, closed afterwards.
+func unpooledOperation(operation func(ctx context.Context, executor *SSHExecutor) MachineResult) HostOperation {
+	return func(ctx context.Context, host entity.Host) MachineResult {
+		conn, err := NewConnection(host)
+		if err != nil {
+			logger.GetLogger().Errorf("Failed to connect to %s: %s", host.Address, err.Error())
+			return MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
+		}
+		defer conn.Client.Close()
+		return operation(ctx, &SSHExecutor{Connection: *conn, Host: host})
+	}
 }
 
-func (pool *SSHExecutorPool) ExecuteCommandParallel(command string, hosts []entity.Host) *CopyResult {
-	var wg sync.WaitGroup
-	results := make(chan MachineResult, len(hosts))
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(host entity.Host) {
-			defer wg.Done()
-			pool.mutex.Lock()
-			executor, err := pool.GetSSHExecutor(host)
-			pool.mutex.Unlock()
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
-				return
-			}
-			err = executor.ExecuteCMDWithoutReturn(command, func(msg string) {
-				results <- MachineResult{Machine: host.Address, Success: true, Error: ""}
-			})
-			if err != nil {
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to execute command on %s: %s", host.Address, err.Error())}
-			}
-		}(host)
+// pooledOperation runs operation with the pooled executor of the host.
+func (pool *SSHExecutorPool) pooledOperation(operation func(ctx context.Context, executor *SSHExecutor) MachineResult) HostOperation {
+	return func(ctx context.Context, host entity.Host) MachineResult {
+		executor, err := pool.Executor(host)
+		if err != nil {
+			return MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
+		}
+		return operation(ctx, executor)
 	}
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	var successCount, failureCount int
-	var copyResult CopyResult
-	var machineResults []MachineResult
-	for result := range results {
-		if result.Success {
-			logger.GetLogger().Infof("Successfully to execute command on %s\n", result.Machine)
-			successCount++
-		} else {
-			logger.GetLogger().Errorf("Failedto execute command on %s: %s\n", result.Machine, result.Error)
-			failureCount++
-		}
-		machineResults = append(machineResults, result)
-	}
-	copyResult.Results = machineResults
-	if failureCount > 0 {
-		copyResult.OverallSuccess = false
-	} else {
-		copyResult.OverallSuccess = true
-	}
-	return &copyResult
-}
-
-func (pool *SSHExecutorPool) ExecuteCommandParallelWithoutPool(command string, hosts []entity.Host) *CopyResult {
-	var wg sync.WaitGroup
-	results := make(chan MachineResult, len(hosts))
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(host entity.Host) {
-			defer wg.Done()
-			conn, err := NewConnection(host)
-			if err != nil {
-				return
-			}
-			executor := &SSHExecutor{
-				Connection: *conn,
-			}
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
-				return
-			}
-			err = executor.ExecuteCMDWithoutReturn(command, func(msg string) {
-				results <- MachineResult{Machine: host.Address, Success: true, Error: ""}
-			})
-			if err != nil {
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to execute command on %s: %s", host.Address, err.Error())}
-			}
-		}(host)
+// machineResult reports the outcome of an operation on the host of executor.
+func machineResult(executor *SSHExecutor, action string, err error) MachineResult {
+	if err != nil {
+		return MachineResult{Machine: executor.Host.Address, Success: false, Error: fmt.Sprintf("Failed to %s on %s: %s", action, executor.Host.Address, err.Error())}
 	}
+	return MachineResult{Machine: executor.Host.Address, Success: true}
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	var successCount, failureCount int
-	var copyResult CopyResult
-	var machineResults []MachineResult
-	for result := range results {
-		if result.Success {
-			logger.GetLogger().Infof("Successfully to execute command on %s\n", result.Machine)
-			successCount++
-		} else {
-			logger.GetLogger().Errorf("Failedto execute command on %s: %s\n", result.Machine, result.Error)
-			failureCount++
+// commandOperation runs command. A command that exits non-zero is a failure.
+func commandOperation(command string) func(ctx context.Context, executor *SSHExecutor) MachineResult {
+	return func(ctx context.Context, executor *SSHExecutor) MachineResult {
+		result, err := executor.RunContext(ctx, command)
+		machineResult := MachineResult{Machine: result.Host, Success: err == nil && result.ExitCode == 0, Result: result}
+		switch {
+		case err != nil:
+			machineResult.Error = fmt.Sprintf("Failed to execute command on %s: %s", result.Host, err.Error())
+		case result.ExitCode != 0:
+			machineResult.Error = fmt.Sprintf("Command on %s exited with status %d: %s", result.Host, result.ExitCode, strings.TrimSpace(result.Stderr))
 		}
-		machineResults = append(machineResults, result)
-	}
-	copyResult.Results = machineResults
-	if failureCount > 0 {
-		copyResult.OverallSuccess = false
-	} else {
-		copyResult.OverallSuccess = true
-	}
-	return &copyResult
-}
-
-func (pool *SSHExecutorPool) CopyFileParallel(srcFile, destFile string, hosts []entity.Host) *CopyResult {
-	var wg sync.WaitGroup
-	results := make(chan MachineResult, len(hosts))
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(host entity.Host) {
-			defer wg.Done()
-			pool.mutex.Lock()
-			executor, err := pool.GetSSHExecutor(host)
-			pool.mutex.Unlock()
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
-				return
-			}
-			err = executor.CopyFile(srcFile, destFile, func(msg string) {
-				results <- MachineResult{Machine: host.Address, Success: true, Error: ""}
-			})
-			if err != nil {
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to copy file to %s: %s", host.Address, err.Error())}
-			}
-		}(host)
+		return machineResult
 	}
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	var successCount, failureCount int
-	var copyResult CopyResult
-	var machineResults []MachineResult
-	for result := range results {
-		if result.Success {
-			logger.GetLogger().Infof("Successfully copied file to %s\n", result.Machine)
-			successCount++
-		} else {
-			logger.GetLogger().Errorf("Failed to copy file to %s: %s\n", result.Machine, result.Error)
-			failureCount++
+// withCommandResults gives every started host of copyResult a command result, also the hosts that
+// could not be connected or timed out. Skipped hosts have none, they are listed in copyResult.Skipped.
+func withCommandResults(copyResult *CopyResult, command string, hosts []entity.Host) *CopyResult {
+	for i := range copyResult.Results {
+		if copyResult.Results[i].Result == nil {
+			copyResult.Results[i].Result = &entity.CommandResult{Host: hosts[i].Address, Command: redact(hosts[i], command), ExitCode: -1, Error: copyResult.Results[i].Error}
 		}
-		machineResults = append(machineResults, result)
-	}
-	copyResult.Results = machineResults
-	if failureCount > 0 {
-		copyResult.OverallSuccess = false
-	} else {
-		copyResult.OverallSuccess = true
-	}
-	return &copyResult
-}
-
-func (pool *SSHExecutorPool) CopyFileParallelWithoutPool(srcFile, destFile string, hosts []entity.Host) *CopyResult {
-	var wg sync.WaitGroup
-	results := make(chan MachineResult, len(hosts))
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(host entity.Host) {
-			defer wg.Done()
-			conn, err := NewConnection(host)
-			if err != nil {
-				return
-			}
-			executor := &SSHExecutor{
-				Connection: *conn,
-			}
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
-				return
-			}
-			err = executor.CopyFile(srcFile, destFile, func(msg string) {
-				results <- MachineResult{Machine: host.Address, Success: true, Error: ""}
-			})
-			if err != nil {
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to copy file to %s: %s", host.Address, err.Error())}
-			}
-		}(host)
 	}
+	return copyResult
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	var successCount, failureCount int
-	var copyResult CopyResult
-	var machineResults []MachineResult
-	for result := range results {
-		if result.Success {
-			logger.GetLogger().Infof("Successfully copied file to %s\n", result.Machine)
-			successCount++
-		} else {
-			logger.GetLogger().Errorf("Failed to copy file to %s: %s\n", result.Machine, result.Error)
-			failureCount++
-		}
-		machineResults = append(machineResults, result)
-	}
-	copyResult.Results = machineResults
-	if failureCount > 0 {
-		copyResult.OverallSuccess = false
-	} else {
-		copyResult.OverallSuccess = true
-	}
-	return &copyResult
-}
-
-func (pool *SSHExecutorPool) CopyMultiFileParallel(files []entity.FileSrcDest, hosts []entity.Host) *CopyResult {
-	var wg sync.WaitGroup
-	results := make(chan MachineResult, len(hosts))
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(host entity.Host) {
-			defer wg.Done()
-			pool.mutex.Lock()
-			executor, err := pool.GetSSHExecutor(host)
-			pool.mutex.Unlock()
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
-				return
-			}
-			_ = executor.CopyMultiFile(files, func(msg string) {
-				results <- MachineResult{Machine: host.Address, Success: true, Error: ""}
-			})
-			if err != nil {
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to copy file to %s: %s", host.Address, err.Error())}
-			}
-		}(host)
+func (pool *SSHExecutorPool) ExecuteCommandParallel(ctx context.Context, command string, hosts []entity.Host, options FanOutOptions) *CopyResult {
+	result := FanOut(ctx, "execute command", hosts, options, pool.pooledOperation(commandOperation(command)))
+	return withCommandResults(result, command, hosts)
+}
+
+func (pool *SSHExecutorPool) ExecuteCommandParallelWithoutPool(ctx context.Context, command string, hosts []entity.Host, options FanOutOptions) *CopyResult {
+	result := FanOut(ctx, "execute command", hosts, options, unpooledOperation(commandOperation(command)))
+	return withCommandResults(result, command, hosts)
+}
+
+func copyFileOperation(srcFile, destFile string) func(ctx context.Context, executor *SSHExecutor) MachineResult {
+	return func(ctx context.Context, executor *SSHExecutor) MachineResult {
+		return machineResult(executor, "copy file", executor.putLocalFile(ctx, srcFile, destFile))
 	}
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	var successCount, failureCount int
-	var copyResult CopyResult
-	var machineResults []MachineResult
-	for result := range results {
-		if result.Success {
-			logger.GetLogger().Infof("Successfully copied file to %s\n", result.Machine)
-			successCount++
-		} else {
-			logger.GetLogger().Errorf("Failed to copy file to %s: %s\n", result.Machine, result.Error)
-			failureCount++
+func (pool *SSHExecutorPool) CopyFileParallel(ctx context.Context, srcFile, destFile string, hosts []entity.Host, options FanOutOptions) *CopyResult {
+	return FanOut(ctx, "copy file", hosts, options, pool.pooledOperation(copyFileOperation(srcFile, destFile)))
+}
+
+func (pool *SSHExecutorPool) CopyFileParallelWithoutPool(ctx context.Context, srcFile, destFile string, hosts []entity.Host, options FanOutOptions) *CopyResult {
+	return FanOut(ctx, "copy file", hosts, options, unpooledOperation(copyFileOperation(srcFile, destFile)))
+}
+
+func (pool *SSHExecutorPool) CopyMultiFileParallel(ctx context.Context, files []entity.FileSrcDest, hosts []entity.Host, options FanOutOptions) *CopyResult {
+	return FanOut(ctx, "copy files", hosts, options, pool.pooledOperation(func(ctx context.Context, executor *SSHExecutor) MachineResult {
+		result := executor.CopyMultiFile(files, func(string) {})
+		if !result.OverallSuccess {
+			var errs []string
+			for _, fileResult := range result.Results {
+				if !fileResult.Success {
+					errs = append(errs, fileResult.Error)
+				}
+			}
+			return machineResult(executor, "copy files", fmt.Errorf("%s", strings.Join(errs, "; ")))
 		}
-		machineResults = append(machineResults, result)
-	}
-	copyResult.Results = machineResults
-	if failureCount > 0 {
-		copyResult.OverallSuccess = false
-	} else {
-		copyResult.OverallSuccess = true
-	}
-	return &copyResult
+		return machineResult(executor, "copy files", nil)
+	}))
 }
 
 func (pool *SSHExecutorPool) CopyFile(srcFile, destFile string, host entity.Host) error {
-	pool.mutex.Lock()
-	defer pool.mutex.Unlock()
-	executor, err := pool.GetSSHExecutor(host)
+	executor, err := pool.Executor(host)
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
 		return err
 	}
 	outputHandler := func(string) { logger.GetLogger().Infof("Copy file") }
@@ -427,177 +624,37 @@ func (pool *SSHExecutorPool) CopyFile(srcFile, destFile string, host entity.Host
 }
 
 func (pool *SSHExecutorPool) CopyMultiFile(files []entity.FileSrcDest, host entity.Host) (*CopyResult, error) {
-	pool.mutex.Lock()
-	defer pool.mutex.Unlock()
-	executor, err := pool.GetSSHExecutor(host)
+	executor, err := pool.Executor(host)
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
 		return nil, err
 	}
 	outputHandler := func(string) { logger.GetLogger().Infof("Copy file") }
 	return executor.CopyMultiFile(files, outputHandler), nil
 }
 
-func (pool *SSHExecutorPool) AddHostsParallel(record entity.Record, hosts []entity.Host) *CopyResult {
-	var wg sync.WaitGroup
-	results := make(chan MachineResult, len(hosts))
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(host entity.Host) {
-			defer wg.Done()
-			pool.mutex.Lock()
-			executor, err := pool.GetSSHExecutor(host)
-			pool.mutex.Unlock()
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
-				return
-			}
-			err = executor.AddHosts(record, func(msg string) {
-				results <- MachineResult{Machine: host.Address, Success: true, Error: ""}
-			})
-			if err != nil {
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to add hosts to %s: %s", host.Address, err.Error())}
-			}
-		}(host)
+func addHostsOperation(record entity.Record) func(ctx context.Context, executor *SSHExecutor) MachineResult {
+	return func(ctx context.Context, executor *SSHExecutor) MachineResult {
+		return machineResult(executor, "add hosts", executor.AddHosts(record, func(string) {}))
 	}
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	var successCount, failureCount int
-	var copyResult CopyResult
-	var machineResults []MachineResult
-	for result := range results {
-		if result.Success {
-			logger.GetLogger().Infof("Successfully add hosts to %s\n", result.Machine)
-			successCount++
-		} else {
-			logger.GetLogger().Errorf("Failed to add hosts %s: %s\n", result.Machine, result.Error)
-			failureCount++
-		}
-		machineResults = append(machineResults, result)
-	}
-	copyResult.Results = machineResults
-	if failureCount > 0 {
-		copyResult.OverallSuccess = false
-	} else {
-		copyResult.OverallSuccess = true
-	}
-	return &copyResult
-}
-
-func (pool *SSHExecutorPool) AddHostsParallelWithoutPool(record entity.Record, hosts []entity.Host) *CopyResult {
-	var wg sync.WaitGroup
-	results := make(chan MachineResult, len(hosts))
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(host entity.Host) {
-			defer wg.Done()
-			conn, err := NewConnection(host)
-			if err != nil {
-				return
-			}
-			executor := &SSHExecutor{
-				Connection: *conn,
-			}
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
-				return
-			}
-			err = executor.AddHosts(record, func(msg string) {
-				results <- MachineResult{Machine: host.Address, Success: true, Error: ""}
-			})
-			if err != nil {
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to add hosts to %s: %s", host.Address, err.Error())}
-			}
-		}(host)
-	}
+func (pool *SSHExecutorPool) AddHostsParallel(ctx context.Context, record entity.Record, hosts []entity.Host, options FanOutOptions) *CopyResult {
+	return FanOut(ctx, "add hosts", hosts, options, pool.pooledOperation(addHostsOperation(record)))
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	var successCount, failureCount int
-	var copyResult CopyResult
-	var machineResults []MachineResult
-	for result := range results {
-		if result.Success {
-			logger.GetLogger().Infof("Successfully add hosts to %s\n", result.Machine)
-			successCount++
-		} else {
-			logger.GetLogger().Errorf("Failed to add hosts %s: %s\n", result.Machine, result.Error)
-			failureCount++
-		}
-		machineResults = append(machineResults, result)
-	}
-	copyResult.Results = machineResults
-	if failureCount > 0 {
-		copyResult.OverallSuccess = false
-	} else {
-		copyResult.OverallSuccess = true
-	}
-	return &copyResult
-}
-
-func (pool *SSHExecutorPool) AddMultiHostsParallel(records []entity.Record, hosts []entity.Host) *CopyResult {
-	var wg sync.WaitGroup
-	results := make(chan MachineResult, len(hosts))
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(host entity.Host) {
-			defer wg.Done()
-			pool.mutex.Lock()
-			executor, err := pool.GetSSHExecutor(host)
-			pool.mutex.Unlock()
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
-				return
-			}
-			err = executor.AddMultiHosts(records, func(msg string) {
-				results <- MachineResult{Machine: host.Address, Success: true, Error: ""}
-			})
-			if err != nil {
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to add hosts to %s: %s", host.Address, err.Error())}
-			}
-		}(host)
-	}
+func (pool *SSHExecutorPool) AddHostsParallelWithoutPool(ctx context.Context, record entity.Record, hosts []entity.Host, options FanOutOptions) *CopyResult {
+	return FanOut(ctx, "add hosts", hosts, options, unpooledOperation(addHostsOperation(record)))
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	var successCount, failureCount int
-	var copyResult CopyResult
-	var machineResults []MachineResult
-	for result := range results {
-		if result.Success {
-			logger.GetLogger().Infof("Successfully add hosts to %s\n", result.Machine)
-			successCount++
-		} else {
-			logger.GetLogger().Errorf("Failed to add hosts %s: %s\n", result.Machine, result.Error)
-			failureCount++
-		}
-		machineResults = append(machineResults, result)
-	}
-	copyResult.Results = machineResults
-	if failureCount > 0 {
-		copyResult.OverallSuccess = false
-	} else {
-		copyResult.OverallSuccess = true
-	}
-	return &copyResult
+func (pool *SSHExecutorPool) AddMultiHostsParallel(ctx context.Context, records []entity.Record, hosts []entity.Host, options FanOutOptions) *CopyResult {
+	return FanOut(ctx, "add hosts", hosts, options, pool.pooledOperation(func(ctx context.Context, executor *SSHExecutor) MachineResult {
+		return machineResult(executor, "add hosts", executor.AddMultiHosts(records, func(string) {}))
+	}))
 }
 
 func (pool *SSHExecutorPool) AddHosts(record entity.Record, host entity.Host) error {
-	pool.mutex.Lock()
-	defer pool.mutex.Unlock()
-	executor, err := pool.GetSSHExecutor(host)
+	executor, err := pool.Executor(host)
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
 		return err
 	}
 	outputHandler := func(string) { logger.GetLogger().Infof("Add hosts") }
@@ -605,61 +662,16 @@ func (pool *SSHExecutorPool) AddHosts(record entity.Record, host entity.Host) er
 }
 
 func (pool *SSHExecutorPool) AddMultiHosts(records []entity.Record, host entity.Host) error {
-	pool.mutex.Lock()
-	defer pool.mutex.Unlock()
-	executor, err := pool.GetSSHExecutor(host)
+	executor, err := pool.Executor(host)
 	if err != nil {
-		logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
 		return err
 	}
 	outputHandler := func(string) { logger.GetLogger().Infof("Add hosts") }
 	return executor.AddMultiHosts(records, outputHandler)
 }
 
-func (pool *SSHExecutorPool) AddDNSParallel(dns string, hosts []entity.Host) *CopyResult {
-	var wg sync.WaitGroup
-	results := make(chan MachineResult, len(hosts))
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(host entity.Host) {
-			defer wg.Done()
-			pool.mutex.Lock()
-			executor, err := pool.GetSSHExecutor(host)
-			pool.mutex.Unlock()
-			if err != nil {
-				logger.GetLogger().Errorf("Failed to get SSH executor: %s", err.Error())
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to connect to %s: %s", host.Address, err.Error())}
-				return
-			}
-			err = executor.UpdateResolvFile(dns)
-			if err != nil {
-				results <- MachineResult{Machine: host.Address, Success: false, Error: fmt.Sprintf("Failed to add dns to %s: %s", host.Address, err.Error())}
-			}
-		}(host)
-	}
-
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-	var successCount, failureCount int
-	var copyResult CopyResult
-	var machineResults []MachineResult
-	for result := range results {
-		if result.Success {
-			logger.GetLogger().Infof("Successfully add dns to %s\n", result.Machine)
-			successCount++
-		} else {
-			logger.GetLogger().Errorf("Failed to add dns %s: %s\n", result.Machine, result.Error)
-			failureCount++
-		}
-		machineResults = append(machineResults, result)
-	}
-	copyResult.Results = machineResults
-	if failureCount > 0 {
-		copyResult.OverallSuccess = false
-	} else {
-		copyResult.OverallSuccess = true
-	}
-	return &copyResult
+func (pool *SSHExecutorPool) AddDNSParallel(ctx context.Context, dns string, hosts []entity.Host, options FanOutOptions) *CopyResult {
+	return FanOut(ctx, "add dns", hosts, options, pool.pooledOperation(func(ctx context.Context, executor *SSHExecutor) MachineResult {
+		return machineResult(executor, "add dns", executor.UpdateResolvFile(dns))
+	}))
 }
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"github.com/whoisfisher/mykubespray/pkg/utils/sshtest"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolDialsAHostOnce(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	pool := NewSSHExecutorPool()
+	defer pool.Close()
+
+	var wait sync.WaitGroup
+	executors := make([]*SSHExecutor, 10)
+	for i := range executors {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			executors[i], _ = pool.Executor(server.Host("deploy", "secret"))
+		}(i)
+	}
+	wait.Wait()
+	for _, executor := range executors {
+		if executor == nil || executor != executors[0] {
+			t.Fatalf("Expected every caller to share one executor, got %v", executors)
+		}
+	}
+	if dials := pool.Stats().Dials; dials != 1 {
+		t.Errorf("Expected one dial, got %d", dials)
+	}
+}
+
+func TestPoolRedialsADeadConnection(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	pool := NewSSHExecutorPool()
+	defer pool.Close()
+
+	executor, err := pool.Executor(server.Host("deploy", "secret"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	executor.Connection.Client.Close()
+	if user, err := executor.Output("whoami"); err != nil || user != "deploy\n" {
+		t.Fatalf("Expected the command to run on a new connection, got %q, %v", user, err)
+	}
+	if user, err := executor.Output("whoami"); err != nil || user != "deploy\n" {
+		t.Fatalf("Expected the stale executor to keep working, got %q, %v", user, err)
+	}
+	if stats := pool.Stats(); stats.Dials != 2 || stats.Reconnects != 1 {
+		t.Errorf("Expected one redial, got %+v", stats)
+	}
+}
+
+func TestDialTimesOutSilentHandshake(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	defer func() {
+		if conn := <-accepted; conn != nil {
+			conn.Close()
+		}
+	}()
+	ConfigureSSHDialTimeout(200 * time.Millisecond)
+	defer ConfigureSSHDialTimeout(0)
+
+	server := sshtest.NewServer(t)
+	host := server.Host("deploy", "secret")
+	address := listener.Addr().(*net.TCPAddr)
+	host.Address, host.Port = address.IP.String(), int32(address.Port)
+	start := time.Now()
+	if _, err := NewConnection(host); err == nil {
+		t.Fatalf("Expected the dial to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the dial to time out, it took %s", elapsed)
+	}
+}
+
+func TestPoolEscalatesWithASingleSession(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	server.AllowSudo("deploy", "secret")
+	pool := NewSSHExecutorPoolWithOptions(PoolOptions{MaxSessions: 1})
+	defer pool.Close()
+
+	executor, err := pool.Executor(server.Host("deploy", "secret"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if user, err := executor.AsRoot().Output("whoami"); err != nil || user != "root\n" {
+			t.Errorf("Expected to run as root, got %q, %v", user, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected the escalated command not to wait for its own session slot")
+	}
+}
+
+func TestSweepDropsUnusedKeyLocks(t *testing.T) {
+	server := sshtest.NewServer(t)
+	server.AddUser("deploy", "secret")
+	pool := NewSSHExecutorPool()
+	defer pool.Close()
+
+	unreachable := server.Host("deploy", "secret")
+	unreachable.Port = 1
+	if _, err := pool.Executor(unreachable); err == nil {
+		t.Fatalf("Expected the dial to fail")
+	}
+	if _, err := pool.Executor(server.Host("deploy", "secret")); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	unlock := pool.lock("held")
+	pool.sweep()
+	var keys []interface{}
+	pool.keyLocks.Range(func(key, _ interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 1 || keys[0] != "held" {
+		t.Errorf("Expected only the held lock to be kept, got %v", keys)
+	}
+	unlock()
+	if user, err := pool.ExecuteShortCommand("whoami", server.Host("deploy", "secret")); err != nil || user != "deploy\n" {
+		t.Errorf("Expected the host to be used after its lock was dropped, got %q, %v", user, err)
+	}
+}
@@ -0,0 +1,786 @@
+// Package sshtest provides an in-process SSH server for testing remote code. It serves exec
+// requests from scripted responses, interactive shells with a PTY and SFTP on an in-memory file
+// system, and records every command and uploaded file. The file commands PutFile runs, e.g. cp, mv
+// and sha256sum, work on the in-memory file system unless a response is scripted for them.
+package sshtest
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"github.com/pkg/sftp"
+	"github.com/whoisfisher/mykubespray/pkg/entity"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Response is what the server answers to a command.
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// ReadStdin reads the input of the command until EOF into Exec.Stdin before answering.
+	ReadStdin bool
+	// Delay holds the answer back. The command ends early when the client signals it or closes the session.
+	Delay time.Duration
+}
+
+// Exec is a command the server received.
+type Exec struct {
+	User string
+	// Command is the command line as sent by the client.
+	Command string
+	// Run is the command that ran, Command without a leading sudo.
+	Run string
+	// Sudo is set when Command was run through sudo.
+	Sudo  bool
+	Stdin string
+	Pty   bool
+	// Signal is the signal the client sent while the command ran, if any.
+	Signal string
+}
+
+// Handler answers a command.
+type Handler func(exec Exec) Response
+
+type responder struct {
+	pattern *regexp.Regexp
+	handler Handler
+}
+
+// sudoer is how a user may use sudo. An empty password means NOPASSWD.
+type sudoer struct {
+	password string
+}
+
+// Server is an SSH server on 127.0.0.1. Commands are answered by the first responder whose
+// pattern matches, then by the built-in whoami and file commands, and otherwise fail with exit status 127.
+type Server struct {
+	// Address and Port are where the server listens.
+	Address string
+	Port    int32
+
+	tb         testing.TB
+	listener   net.Listener
+	config     *ssh.ServerConfig
+	handlers   sftp.Handlers
+	files      sftp.Handlers
+	mutex      sync.Mutex
+	passwords  map[string]string
+	keys       map[string][]ssh.PublicKey
+	sudoers    map[string]sudoer
+	responders []responder
+	execs      []Exec
+	uploads    []string
+	wg         sync.WaitGroup
+	closeOnce  sync.Once
+}
+
+var (
+	hostKeyOnce sync.Once
+	hostKey     ssh.Signer
+)
+
+// sharedHostKey is the host key of every server in the process, so that a client which pinned it
+// for an address accepts a later server on the same port.
+func sharedHostKey(tb testing.TB) ssh.Signer {
+	hostKeyOnce.Do(func() {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			tb.Fatalf("Failed to generate host key: %v", err)
+		}
+		hostKey, err = ssh.NewSignerFromKey(private)
+		if err != nil {
+			tb.Fatalf("Failed to create host key signer: %v", err)
+		}
+	})
+	return hostKey
+}
+
+// NewServer starts a server that is closed when the test ends.
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("Failed to listen: %v", err)
+	}
+	server := &Server{
+		Address:   "127.0.0.1",
+		Port:      int32(listener.Addr().(*net.TCPAddr).Port),
+		tb:        tb,
+		listener:  listener,
+		files:     sftp.InMemHandler(),
+		passwords: make(map[string]string),
+		keys:      make(map[string][]ssh.PublicKey),
+		sudoers:   make(map[string]sudoer),
+	}
+	server.handlers = server.files
+	server.handlers.FilePut = recordingWriter{server: server, writer: server.files.FilePut}
+	server.config = &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			server.mutex.Lock()
+			defer server.mutex.Unlock()
+			if expected, ok := server.passwords[conn.User()]; ok && expected == string(password) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("wrong password for %s", conn.User())
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			server.mutex.Lock()
+			defer server.mutex.Unlock()
+			for _, authorized := range server.keys[conn.User()] {
+				if string(authorized.Marshal()) == string(key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	server.config.AddHostKey(sharedHostKey(tb))
+	server.mkdirAll("/tmp")
+	server.wg.Add(1)
+	go server.serve()
+	tb.Cleanup(server.Close)
+	return server
+}
+
+// Close stops the server and closes its connections.
+func (server *Server) Close() {
+	server.closeOnce.Do(func() {
+		server.listener.Close()
+		server.wg.Wait()
+	})
+}
+
+// AddUser lets user log in with password.
+func (server *Server) AddUser(user, password string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.passwords[user] = password
+	server.mkdirAll("/home/" + user)
+}
+
+// AuthorizeKey generates a key pair that user may log in with and returns the path of the private
+// key, in a directory that is removed when the test ends.
+func (server *Server) AuthorizeKey(user string) string {
+	server.tb.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		server.tb.Fatalf("Failed to generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		server.tb.Fatalf("Failed to marshal key: %v", err)
+	}
+	keyPath := filepath.Join(server.tb.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		server.tb.Fatalf("Failed to write key: %v", err)
+	}
+	publicKey, err := ssh.NewPublicKey(public)
+	if err != nil {
+		server.tb.Fatalf("Failed to convert key: %v", err)
+	}
+	server.mkdirAll("/home/" + user)
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.keys[user] = append(server.keys[user], publicKey)
+	return keyPath
+}
+
+// AllowSudo lets user run commands as root with sudo, authenticating with password, or without a
+// password when it is empty.
+func (server *Server) AllowSudo(user, password string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.sudoers[user] = sudoer{password: password}
+}
+
+// Host returns the inventory host of the server for user.
+func (server *Server) Host(user, password string) entity.Host {
+	return entity.Host{
+		Name:     fmt.Sprintf("sshtest-%d", server.Port),
+		Address:  server.Address,
+		Port:     server.Port,
+		User:     user,
+		Password: password,
+	}
+}
+
+// Respond answers commands matching pattern, a regular expression that has to match the whole command, with response.
+func (server *Server) Respond(pattern string, response Response) {
+	server.RespondFunc(pattern, func(Exec) Response {
+		return response
+	})
+}
+
+// RespondFunc answers commands matching pattern with handler.
+func (server *Server) RespondFunc(pattern string, handler Handler) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.responders = append(server.responders, responder{pattern: regexp.MustCompile("^(?:" + pattern + ")$"), handler: handler})
+}
+
+// Execs returns the commands received so far.
+func (server *Server) Execs() []Exec {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]Exec(nil), server.execs...)
+}
+
+// Commands returns the commands that ran so far, without sudo.
+func (server *Server) Commands() []string {
+	var commands []string
+	for _, exec := range server.Execs() {
+		commands = append(commands, exec.Run)
+	}
+	return commands
+}
+
+// Uploads returns the paths written over SFTP so far.
+func (server *Server) Uploads() []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]string(nil), server.uploads...)
+}
+
+// File returns the content of a file on the in-memory file system.
+func (server *Server) File(path string) ([]byte, bool) {
+	content, err := server.readFile(path)
+	return content, err == nil
+}
+
+// WriteFile puts a file and its directories on the in-memory file system, e.g. for the client to download.
+func (server *Server) WriteFile(file string, content []byte) {
+	server.tb.Helper()
+	server.mkdirAll(path.Dir(file))
+	if err := server.writeFile(file, content); err != nil {
+		server.tb.Fatalf("Failed to write %s: %v", file, err)
+	}
+}
+
+func (server *Server) readFile(path string) ([]byte, error) {
+	request := sftp.NewRequest("Get", path)
+	// SSH_FXF_READ
+	request.Flags = 0x01
+	file, err := server.files.FileGet.Fileread(request)
+	if err != nil {
+		return nil, err
+	}
+	if info, ok := file.(os.FileInfo); ok && info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	var content []byte
+	buffer := make([]byte, 4096)
+	for offset := int64(0); ; {
+		n, err := file.ReadAt(buffer, offset)
+		content = append(content, buffer[:n]...)
+		offset += int64(n)
+		if err == io.EOF {
+			return content, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// writeFile writes path without recording it as an upload.
+func (server *Server) writeFile(path string, content []byte) error {
+	request := sftp.NewRequest("Put", path)
+	// SSH_FXF_WRITE | SSH_FXF_CREAT | SSH_FXF_TRUNC
+	request.Flags = 0x02 | 0x08 | 0x10
+	writer, err := server.files.FilePut.Filewrite(request)
+	if err != nil {
+		return err
+	}
+	_, err = writer.WriteAt(content, 0)
+	return err
+}
+
+// mkdirAll creates a directory and its parents on the in-memory file system.
+func (server *Server) mkdirAll(dir string) {
+	for i := 1; i <= len(dir); i++ {
+		if i == len(dir) || dir[i] == '/' {
+			// Existing directories fail to be created again.
+			server.handlers.FileCmd.Filecmd(sftp.NewRequest("Mkdir", dir[:i]))
+		}
+	}
+}
+
+func (server *Server) serve() {
+	defer server.wg.Done()
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		server.wg.Add(1)
+		go func() {
+			defer server.wg.Done()
+			server.handleConn(conn)
+		}()
+	}
+}
+
+func (server *Server) handleConn(conn net.Conn) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, server.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	go func() {
+		for request := range requests {
+			// keepalive@openssh.com and anything else is accepted
+			if request.WantReply {
+				request.Reply(true, nil)
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.handleSession(serverConn.User(), channel, channelRequests)
+		}()
+	}
+	wg.Wait()
+}
+
+// session is the state of a session channel.
+type session struct {
+	user    string
+	channel ssh.Channel
+	pty     bool
+	signals chan string
+}
+
+func (server *Server) handleSession(user string, channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	current := &session{user: user, channel: channel, signals: make(chan string, 1)}
+	started := false
+	for request := range requests {
+		switch request.Type {
+		case "pty-req":
+			current.pty = true
+			request.Reply(true, nil)
+		case "env", "window-change":
+			request.Reply(true, nil)
+		case "signal":
+			var payload struct{ Signal string }
+			ssh.Unmarshal(request.Payload, &payload)
+			select {
+			case current.signals <- payload.Signal:
+			default:
+			}
+		case "exec":
+			var payload struct{ Command string }
+			if started || ssh.Unmarshal(request.Payload, &payload) != nil {
+				request.Reply(false, nil)
+				continue
+			}
+			started = true
+			request.Reply(true, nil)
+			go func() {
+				status := server.exec(current, payload.Command, bufio.NewReader(channel))
+				exit(channel, status)
+			}()
+		case "shell":
+			if started {
+				request.Reply(false, nil)
+				continue
+			}
+			started = true
+			request.Reply(true, nil)
+			go func() {
+				exit(channel, server.shell(current))
+			}()
+		case "subsystem":
+			var payload struct{ Name string }
+			if started || ssh.Unmarshal(request.Payload, &payload) != nil || payload.Name != "sftp" {
+				request.Reply(false, nil)
+				continue
+			}
+			started = true
+			request.Reply(true, nil)
+			go func() {
+				sftpServer := sftp.NewRequestServer(channel, server.handlers, sftp.WithStartDirectory("/home/"+user))
+				sftpServer.Serve()
+				sftpServer.Close()
+				exit(channel, 0)
+			}()
+		default:
+			if request.WantReply {
+				request.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func exit(channel ssh.Channel, status int) {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, uint32(status))
+	channel.SendRequest("exit-status", false, payload)
+	channel.Close()
+}
+
+// exec runs command and returns its exit status.
+func (server *Server) exec(current *session, command string, stdin *bufio.Reader) int {
+	exec := Exec{User: current.user, Command: command, Run: command, Pty: current.pty}
+	stderr := current.channel.Stderr()
+	if current.pty {
+		stderr = current.channel
+	}
+	if words, ok := splitWords(command); ok && len(words) > 0 && words[0] == "sudo" {
+		run, options := parseSudo(words[1:])
+		exec.Run = run
+		exec.Sudo = true
+		if status, message := server.authorizeSudo(current.user, options, stdin); status != 0 {
+			server.record(exec)
+			io.WriteString(stderr, message)
+			return status
+		}
+	}
+	handler := server.handler(exec)
+	response := handler(exec)
+	if response.ReadStdin {
+		input, _ := io.ReadAll(stdin)
+		exec.Stdin = string(input)
+		response = handler(exec)
+	}
+	if response.Delay > 0 {
+		select {
+		case <-time.After(response.Delay):
+		case exec.Signal = <-current.signals:
+			server.record(exec)
+			return 128 + 15
+		}
+	}
+	server.record(exec)
+	io.WriteString(current.channel, response.Stdout)
+	io.WriteString(stderr, response.Stderr)
+	return response.ExitCode
+}
+
+func (server *Server) record(exec Exec) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.execs = append(server.execs, exec)
+}
+
+// handler returns what answers exec.
+func (server *Server) handler(exec Exec) Handler {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	for _, responder := range server.responders {
+		if responder.pattern.MatchString(exec.Run) {
+			return responder.handler
+		}
+	}
+	if exec.Run == "whoami" {
+		return func(exec Exec) Response {
+			if exec.Sudo {
+				return Response{Stdout: "root\n"}
+			}
+			return Response{Stdout: exec.User + "\n"}
+		}
+	}
+	if handler, ok := server.builtin(exec.Run); ok {
+		return handler
+	}
+	return func(exec Exec) Response {
+		return Response{Stderr: fmt.Sprintf("sh: %s: command not found\n", exec.Run), ExitCode: 127}
+	}
+}
+
+// builtin returns the handler of true or a file command on the in-memory file system: sha256sum,
+// cp, mv, rm, mkdir, chmod and chown, and bash -c or sh -c scripts of those joined by &&.
+func (server *Server) builtin(run string) (Handler, bool) {
+	words, ok := splitWords(run)
+	if !ok || len(words) == 0 {
+		return nil, false
+	}
+	if run == "true" {
+		return func(exec Exec) Response { return Response{} }, true
+	}
+	if (words[0] == "bash" || words[0] == "sh") && len(words) == 3 && words[1] == "-c" {
+		steps := strings.Split(words[2], " && ")
+		return func(exec Exec) Response {
+			var response Response
+			for _, step := range steps {
+				exec.Run = strings.TrimSpace(step)
+				result := server.handler(exec)(exec)
+				response.Stdout += result.Stdout
+				response.Stderr += result.Stderr
+				if result.ExitCode != 0 {
+					response.ExitCode = result.ExitCode
+					break
+				}
+			}
+			return response
+		}, true
+	}
+	command, args := words[0], words[1:]
+	force := false
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		force = force || strings.Contains(args[0], "f")
+		args = args[1:]
+	}
+	failed := func(format string, a ...interface{}) Response {
+		return Response{Stderr: command + ": " + fmt.Sprintf(format, a...) + "\n", ExitCode: 1}
+	}
+	switch command {
+	case "sha256sum":
+		return func(Exec) Response {
+			var response Response
+			for _, name := range args {
+				content, err := server.readFile(name)
+				if err != nil {
+					response.Stderr += fmt.Sprintf("sha256sum: %s: No such file or directory\n", name)
+					response.ExitCode = 1
+					continue
+				}
+				response.Stdout += fmt.Sprintf("%x  %s\n", sha256.Sum256(content), name)
+			}
+			return response
+		}, true
+	case "cp", "mv":
+		if len(args) != 2 {
+			return nil, false
+		}
+		return func(Exec) Response {
+			content, err := server.readFile(args[0])
+			if err != nil {
+				return failed("cannot stat '%s': No such file or directory", args[0])
+			}
+			if command == "mv" {
+				request := sftp.NewRequest("PosixRename", args[0])
+				request.Target = args[1]
+				err = server.files.FileCmd.(sftp.PosixRenameFileCmder).PosixRename(request)
+			} else {
+				err = server.writeFile(args[1], content)
+			}
+			if err != nil {
+				return failed("cannot create '%s': %v", args[1], err)
+			}
+			return Response{}
+		}, true
+	case "rm":
+		return func(Exec) Response {
+			for _, name := range args {
+				if err := server.files.FileCmd.Filecmd(sftp.NewRequest("Remove", name)); err != nil && !force {
+					return failed("cannot remove '%s': %v", name, err)
+				}
+			}
+			return Response{}
+		}, true
+	case "mkdir":
+		return func(Exec) Response {
+			for _, dir := range args {
+				server.mkdirAll(path.Clean(dir))
+			}
+			return Response{}
+		}, true
+	case "chmod", "chown":
+		if len(args) != 2 {
+			return nil, false
+		}
+		return func(Exec) Response {
+			if _, err := server.readFile(args[1]); err != nil {
+				return failed("cannot access '%s': No such file or directory", args[1])
+			}
+			return Response{}
+		}, true
+	}
+	return nil, false
+}
+
+// sudoOptions are the sudo flags the server understands.
+type sudoOptions struct {
+	stdin          bool
+	nonInteractive bool
+}
+
+// parseSudo returns the command sudo runs and its options. sh -c script runs script.
+func parseSudo(words []string) (string, sudoOptions) {
+	var options sudoOptions
+	for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+		word := words[0]
+		words = words[1:]
+		if word == "--" {
+			break
+		}
+		switch word {
+		case "-S":
+			options.stdin = true
+		case "-n":
+			options.nonInteractive = true
+		case "-p", "-u":
+			if len(words) > 0 {
+				words = words[1:]
+			}
+		}
+	}
+	if len(words) == 3 && words[0] == "sh" && words[1] == "-c" {
+		return words[2], options
+	}
+	return strings.Join(words, " "), options
+}
+
+// authorizeSudo checks that user may use sudo the way options ask for. It returns the exit status
+// and message of sudo when not.
+func (server *Server) authorizeSudo(user string, options sudoOptions, stdin *bufio.Reader) (int, string) {
+	server.mutex.Lock()
+	rule, ok := server.sudoers[user]
+	server.mutex.Unlock()
+	if !ok {
+		return 1, fmt.Sprintf("%s is not in the sudoers file.  This incident will be reported.\n", user)
+	}
+	if rule.password == "" {
+		return 0, ""
+	}
+	if options.nonInteractive || !options.stdin {
+		return 1, "sudo: a password is required\n"
+	}
+	password, err := stdin.ReadString('\n')
+	if err != nil && password == "" {
+		return 1, "sudo: no password was provided\n"
+	}
+	if strings.TrimSuffix(password, "\n") != rule.password {
+		return 1, "Sorry, try again.\nsudo: 1 incorrect password attempt\n"
+	}
+	return 0, ""
+}
+
+// shell reads lines typed on the terminal, echoes them and answers each like a command until exit.
+func (server *Server) shell(current *session) int {
+	io.WriteString(current.channel, "$ ")
+	reader := bufio.NewReader(current.channel)
+	var line strings.Builder
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0
+		}
+		if b != '\r' && b != '\n' {
+			line.WriteByte(b)
+			current.channel.Write([]byte{b})
+			continue
+		}
+		command := strings.TrimSpace(line.String())
+		line.Reset()
+		io.WriteString(current.channel, "\r\n")
+		if command == "exit" {
+			return 0
+		}
+		if command != "" {
+			exec := Exec{User: current.user, Command: command, Run: command, Pty: true}
+			response := server.handler(exec)(exec)
+			server.record(exec)
+			output := response.Stdout + response.Stderr
+			io.WriteString(current.channel, strings.ReplaceAll(output, "\n", "\r\n"))
+		}
+		io.WriteString(current.channel, "$ ")
+	}
+}
+
+// splitWords splits a command line into words like sh does for quotes and backslashes.
+func splitWords(command string) ([]string, bool) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, false
+			}
+			word.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`", command[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(command[i])
+			}
+			if i == len(command) {
+				return nil, false
+			}
+			inWord = true
+		case c == '\\' && i+1 < len(command):
+			i++
+			word.WriteByte(command[i])
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, true
+}
+
+// recordingWriter records the paths written over SFTP.
+type recordingWriter struct {
+	server *Server
+	writer sftp.FileWriter
+}
+
+func (recorder recordingWriter) Filewrite(request *sftp.Request) (io.WriterAt, error) {
+	file, err := recorder.writer.Filewrite(request)
+	if err != nil {
+		return nil, err
+	}
+	recorder.record(request.Filepath)
+	return file, nil
+}
+
+func (recorder recordingWriter) OpenFile(request *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	file, err := recorder.writer.(sftp.OpenFileWriter).OpenFile(request)
+	if err != nil {
+		return nil, err
+	}
+	recorder.record(request.Filepath)
+	return file, nil
+}
+
+func (recorder recordingWriter) record(path string) {
+	recorder.server.mutex.Lock()
+	defer recorder.server.mutex.Unlock()
+	recorder.server.uploads = append(recorder.server.uploads, path)
+}
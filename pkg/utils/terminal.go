@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"github.com/whoisfisher/mykubespray/pkg/logger"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"sync"
+)
+
+// Terminal is an interactive login shell on a host. Stdout and stderr of the shell are merged by
+// the terminal and read with Read, keystrokes are sent with Write.
+type Terminal struct {
+	session      *ssh.Session
+	closeSession func()
+	stdin        io.WriteCloser
+	output       io.Reader
+	closeOnce    sync.Once
+}
+
+// OpenTerminal starts a login shell of the SSH user in a terminal of cols x rows. The shell is not
+// escalated, the user can sudo inside it.
+func (executor *SSHExecutor) OpenTerminal(cols, rows int) (*Terminal, error) {
+	session, closeSession, err := executor.newSession()
+	if err != nil {
+		logger.GetLogger().Errorf("Failed to create SSH session: %v", err)
+		return nil, err
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm-256color", rows, cols, modes); err != nil {
+		closeSession()
+		return nil, fmt.Errorf("Cannot request tty: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		closeSession()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		closeSession()
+		return nil, err
+	}
+	if err := session.Shell(); err != nil {
+		closeSession()
+		return nil, fmt.Errorf("Failed to start shell: %w", err)
+	}
+	return &Terminal{session: session, closeSession: closeSession, stdin: stdin, output: stdout}, nil
+}
+
+func (terminal *Terminal) Read(p []byte) (int, error) {
+	return terminal.output.Read(p)
+}
+
+func (terminal *Terminal) Write(p []byte) (int, error) {
+	return terminal.stdin.Write(p)
+}
+
+// Resize changes the size of the terminal.
+func (terminal *Terminal) Resize(cols, rows int) error {
+	return terminal.session.WindowChange(rows, cols)
+}
+
+// Wait waits for the shell to exit and returns its exit status, -1 if it has none.
+func (terminal *Terminal) Wait() (int, error) {
+	err := terminal.session.Wait()
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.As(err, &exitErr):
+		return exitErr.ExitStatus(), nil
+	default:
+		return -1, err
+	}
+}
+
+// Close hangs up the shell and closes the session.
+func (terminal *Terminal) Close() {
+	terminal.closeOnce.Do(func() {
+		terminal.session.Signal(ssh.SIGHUP)
+		terminal.stdin.Close()
+		terminal.closeSession()
+	})
+}